@@ -16,7 +16,8 @@ import {
     AlertCircle,
     CheckCircle2,
     Eye,
-    Trash2
+    Trash2,
+    RefreshCw
 } from 'lucide-react';
 import api from '@/lib/api';
 
@@ -50,6 +51,20 @@ export default function DatingManagementPage() {
         }
     };
 
+    // Uploads every completed profile to the RAG backend again
+    const handleReindexProfiles = async () => {
+        if (!confirm('Reindex all completed profiles? This runs in the background.')) return;
+        setActionLoading('reindex');
+        try {
+            const res = await api.post('/admin/profiles/reindex');
+            alert(`Queued ${res.data.queued} profiles for reindexing`);
+        } catch (err: any) {
+            alert(err.response?.data?.error || 'Failed to reindex profiles');
+        } finally {
+            setActionLoading(null);
+        }
+    };
+
     const isSuspicious = (text: string) => {
         if (!text) return false;
         const lowerText = text.toLowerCase();
@@ -64,6 +79,14 @@ export default function DatingManagementPage() {
                     <p className="text-[var(--muted-foreground)] mt-1">Moderate and manage community dating profiles</p>
                 </div>
                 <div className="flex items-center gap-3">
+                    <button
+                        onClick={handleReindexProfiles}
+                        disabled={actionLoading === 'reindex'}
+                        className="px-4 py-2 bg-[var(--secondary)] rounded-full text-sm font-semibold border border-[var(--border)] hover:border-[var(--primary)]/50 disabled:opacity-50"
+                    >
+                        {actionLoading === 'reindex' ? <Loader2 className="w-4 h-4 inline mr-2 animate-spin" /> : <RefreshCw className="w-4 h-4 inline mr-2" />}
+                        Reindex Profiles
+                    </button>
                     <div className="px-4 py-2 bg-pink-500/10 text-pink-500 rounded-full text-sm font-semibold border border-pink-500/20">
                         <Heart className="w-4 h-4 inline mr-2" />
                         {profiles?.length || 0} Registered Profiles
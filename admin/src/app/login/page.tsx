@@ -24,6 +24,7 @@ export default function LoginPage() {
 
             if (user.role === 'admin' || user.role === 'superadmin') {
                 localStorage.setItem('admin_data', JSON.stringify(user));
+                localStorage.setItem('admin_token', response.data.token);
                 router.push('/dashboard');
             } else {
                 setError('Access denied. Admin privileges required.');
@@ -49,7 +49,8 @@ export default function SettingsPage() {
     const handleSave = async () => {
         setLoading(true);
         try {
-            await api.post('/admin/settings', settings);
+            const res = await api.post('/admin/settings', settings);
+            if (res.data?.warning) alert(res.data.warning);
             setSuccess(true);
             setTimeout(() => setSuccess(false), 3000);
         } catch (err) {
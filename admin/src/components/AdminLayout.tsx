@@ -36,7 +36,10 @@ export default function AdminLayout({ children }: { children: React.ReactNode })
 
     useEffect(() => {
         const data = localStorage.getItem('admin_data');
-        if (!data && pathname !== '/login' && pathname !== '/') {
+        // Sessions from before tokens were issued have to log in again
+        const token = localStorage.getItem('admin_token');
+        if ((!data || !token) && pathname !== '/login' && pathname !== '/') {
+            localStorage.removeItem('admin_data');
             router.push('/login');
         } else if (data) {
             setAdmin(JSON.parse(data));
@@ -45,6 +48,7 @@ export default function AdminLayout({ children }: { children: React.ReactNode })
 
     const handleLogout = () => {
         localStorage.removeItem('admin_data');
+        localStorage.removeItem('admin_token');
         router.push('/login');
     };
 
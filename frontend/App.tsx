@@ -14,6 +14,8 @@ import { RootStackParamList } from './types/navigation';
 import { PortalMainScreen } from './screens/portal/PortalMainScreen';
 import { AppSettingsScreen } from './screens/settings/AppSettingsScreen';
 import { KrishnaAssistant } from './components/KrishnaAssistant';
+// Registers the axios interceptor that adds the session token
+import './services/apiClient';
 import { ContactProfileScreen } from './screens/portal/contacts/ContactProfileScreen';
 
 import { RoomChatScreen } from './screens/portal/chat/RoomChatScreen';
@@ -156,6 +156,9 @@ export const ChatProvider = ({ children }: { children: ReactNode }) => {
     // WebSocket Listener for real-time messages
     useEffect(() => {
         const removeListener = addListener((msg: any) => {
+            // Room events are handled by the room screen
+            if (msg.type === 'room_event' || !msg.ID) return;
+
             // Check if it's a P2P message for the current chat or an AI message
             const isTargetedToMe = msg.recipientId === currentUser?.ID;
             const isFromCurrentRecipient = msg.senderId === recipientId;
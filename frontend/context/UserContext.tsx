@@ -1,6 +1,7 @@
 import React, { createContext, useState, useContext, ReactNode, useEffect } from 'react';
 import AsyncStorage from '@react-native-async-storage/async-storage';
 import { contactService } from '../services/contactService';
+import { getAuthToken } from '../services/apiClient';
 
 interface UserProfile {
     karmicName: string;
@@ -22,7 +23,7 @@ interface UserContextType {
     user: UserProfile | null;
     isLoggedIn: boolean;
     isLoading: boolean;
-    login: (profile: UserProfile) => Promise<void>;
+    login: (profile: UserProfile, token?: string) => Promise<void>;
     logout: () => Promise<void>;
     setTourCompleted: () => Promise<void>;
 }
@@ -57,8 +58,12 @@ export const UserProvider = ({ children }: { children: ReactNode }) => {
     const loadUser = async () => {
         try {
             const savedUser = await AsyncStorage.getItem('user');
-            if (savedUser && savedUser !== 'undefined') {
+            const token = await getAuthToken();
+            if (savedUser && savedUser !== 'undefined' && token) {
                 setUser(JSON.parse(savedUser));
+            } else if (savedUser) {
+                // Sessions saved before tokens were issued can't call the API; sign in again
+                await AsyncStorage.removeItem('user');
             }
         } catch (e) {
             console.error('Failed to load user', e);
@@ -67,14 +72,18 @@ export const UserProvider = ({ children }: { children: ReactNode }) => {
         }
     };
 
-    const login = async (profile: UserProfile) => {
+    const login = async (profile: UserProfile, token?: string) => {
         setUser(profile);
         await AsyncStorage.setItem('user', JSON.stringify(profile));
+        if (token) {
+            await AsyncStorage.setItem('authToken', token);
+        }
     };
 
     const logout = async () => {
         setUser(null);
         await AsyncStorage.removeItem('user');
+        await AsyncStorage.removeItem('authToken');
     };
 
     const setTourCompleted = async () => {
@@ -13,6 +13,9 @@ export default {
         settings: 'Settings',
     },
     chat: {
+        roomArchived: 'This room is archived and read-only.',
+        roomDeleted: 'This room has been deleted.',
+        aiQuotaExceeded: 'AI limit reached',
         welcome: 'Namaste. I am your assistant 🙇‍♂️. How can I help you?',
         placeholder: 'Type a message...',
         newChat: 'Find in ...',
@@ -13,6 +13,9 @@ export default {
         settings: 'Настройки',
     },
     chat: {
+        roomArchived: 'Комната в архиве, писать в неё нельзя.',
+        roomDeleted: 'Комната удалена.',
+        aiQuotaExceeded: 'Лимит ИИ исчерпан',
         welcome: 'Я ваш слуга, Кришна дас 🙇‍♂️. Чем могу быть полезен?',
         placeholder: 'Введите сообщение...',
         newChat: 'Найти в ...',
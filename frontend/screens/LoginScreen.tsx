@@ -91,8 +91,8 @@ const LoginScreen: React.FC<Props> = ({ navigation }) => {
                 password,
             });
 
-            const { user } = response.data;
-            await login(user);
+            const { user, token } = response.data;
+            await login(user, token);
         } catch (error: any) {
             console.warn('Login failure:', error.message);
             const msg = error.response?.data?.error || t('login_failed');
@@ -130,6 +130,7 @@ const LoginScreen: React.FC<Props> = ({ navigation }) => {
             });
 
             let { user } = loginRes.data;
+            const { token } = loginRes.data;
 
             // If user exists but profile is not complete, update it automatically
             if (!user.isProfileComplete) {
@@ -140,7 +141,7 @@ const LoginScreen: React.FC<Props> = ({ navigation }) => {
                 user = updateRes.data.user;
             }
 
-            await login(user);
+            await login(user, token);
 
         } catch (error: any) {
             console.log('Dev Login: Login failed, attempting registration...');
@@ -151,8 +152,8 @@ const LoginScreen: React.FC<Props> = ({ navigation }) => {
                     email: devEmail,
                     password: devPassword,
                 });
-                const { user } = retryLoginRes.data;
-                await login(user);
+                const { user, token } = retryLoginRes.data;
+                await login(user, token);
             } catch (regError: any) {
                 console.error('Dev Login Error:', regError.response?.data || regError.message);
                 const errorMsg = regError.response?.data?.error || regError.message;
@@ -32,6 +32,7 @@ import { NativeStackScreenProps } from '@react-navigation/native-stack';
 import { RootStackParamList } from '../types/navigation';
 import { API_PATH } from '../config/api.config';
 import { contactService } from '../services/contactService';
+import { getAuthToken } from '../services/apiClient';
 
 type Props = NativeStackScreenProps<RootStackParamList, 'Registration'>;
 
@@ -253,8 +254,12 @@ const RegistrationScreen: React.FC<Props> = ({ navigation, route }) => {
                     email,
                     password,
                 });
-                const user = response.data.user;
+                const { user, token } = response.data;
                 await AsyncStorage.setItem('user', JSON.stringify(user));
+                // Keep the session token so the profile step is authenticated
+                if (token) {
+                    await AsyncStorage.setItem('authToken', token);
+                }
                 // Move to phase 2
                 navigation.setParams({ phase: 'profile' });
             } else {
@@ -299,7 +304,7 @@ const RegistrationScreen: React.FC<Props> = ({ navigation, route }) => {
                 }
 
                 await AsyncStorage.setItem('user', JSON.stringify(updatedUser));
-                await login(updatedUser);
+                await login(updatedUser, (await getAuthToken()) || undefined);
             }
         } catch (error: any) {
             console.error('Registration/Update error:', error);
@@ -323,7 +328,7 @@ const RegistrationScreen: React.FC<Props> = ({ navigation, route }) => {
                     onPress: async () => {
                         const userStr = await AsyncStorage.getItem('user');
                         if (userStr && userStr !== 'undefined') {
-                            await login(JSON.parse(userStr));
+                            await login(JSON.parse(userStr), (await getAuthToken()) || undefined);
                         }
                     }
                 }
@@ -15,6 +15,7 @@ import {
 import { useTranslation } from 'react-i18next';
 import { COLORS } from '../../../components/chat/ChatConstants';
 import { API_PATH } from '../../../config/api.config';
+import { apiFetch } from '../../../services/apiClient';
 import { useUser } from '../../../context/UserContext';
 
 interface CreateRoomModalProps {
@@ -54,7 +55,7 @@ export const CreateRoomModal: React.FC<CreateRoomModalProps> = ({ visible, onClo
 
         setLoading(true);
         try {
-            const response = await fetch(`${API_PATH}/rooms`, {
+            const response = await apiFetch(`${API_PATH}/rooms`, {
                 method: 'POST',
                 headers: {
                     'Content-Type': 'application/json',
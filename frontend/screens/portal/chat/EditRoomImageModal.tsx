@@ -13,6 +13,7 @@ import {
 import { useTranslation } from 'react-i18next';
 import { COLORS } from '../../../components/chat/ChatConstants';
 import { API_PATH } from '../../../config/api.config';
+import { apiFetch } from '../../../services/apiClient';
 import { launchImageLibrary } from 'react-native-image-picker';
 
 interface EditRoomImageModalProps {
@@ -92,7 +93,7 @@ export const EditRoomImageModal: React.FC<EditRoomImageModalProps> = ({
                 type,
             } as any);
 
-            const response = await fetch(`${API_PATH}/rooms/${roomId}/image`, {
+            const response = await apiFetch(`${API_PATH}/rooms/${roomId}/image`, {
                 method: 'POST',
                 body: formData,
                 headers: {
@@ -123,7 +124,7 @@ export const EditRoomImageModal: React.FC<EditRoomImageModalProps> = ({
         try {
             // Создаем пустой файл или отправляем preset ID
             // В данном случае, сохраним preset как строку
-            const response = await fetch(`${API_PATH}/rooms/${roomId}`, {
+            const response = await apiFetch(`${API_PATH}/rooms/${roomId}`, {
                 method: 'PUT',
                 headers: {
                     'Content-Type': 'application/json',
@@ -15,6 +15,7 @@ import Clipboard from '@react-native-clipboard/clipboard';
 import { useTranslation } from 'react-i18next';
 import { COLORS } from '../../../components/chat/ChatConstants';
 import { API_PATH } from '../../../config/api.config';
+import { apiFetch } from '../../../services/apiClient';
 import { useUser } from '../../../context/UserContext';
 
 interface InviteFriendModalProps {
@@ -40,8 +41,8 @@ export const InviteFriendModal: React.FC<InviteFriendModalProps> = ({ visible, o
         if (!user) return;
         try {
             const [friendsResponse, membersResponse] = await Promise.all([
-                fetch(`${API_PATH}/friends/${user.ID}`),
-                fetch(`${API_PATH}/rooms/${roomId}/members`)
+                apiFetch(`${API_PATH}/friends/${user.ID}`),
+                apiFetch(`${API_PATH}/rooms/${roomId}/members`)
             ]);
 
             if (friendsResponse.ok) {
@@ -75,7 +76,7 @@ export const InviteFriendModal: React.FC<InviteFriendModalProps> = ({ visible, o
     const handleInvite = async (friendId: number) => {
         setInvitingId(friendId);
         try {
-            const response = await fetch(`${API_PATH}/rooms/invite`, {
+            const response = await apiFetch(`${API_PATH}/rooms/invite`, {
                 method: 'POST',
                 headers: {
                     'Content-Type': 'application/json',
@@ -89,7 +90,7 @@ export const InviteFriendModal: React.FC<InviteFriendModalProps> = ({ visible, o
             if (response.ok) {
                 Alert.alert(t('common.success'), t('chat.invite') + ' ' + t('common.success'));
                 // Refetch members to get proper data
-                const membersResponse = await fetch(`${API_PATH}/rooms/${roomId}/members`);
+                const membersResponse = await apiFetch(`${API_PATH}/rooms/${roomId}/members`);
                 if (membersResponse.ok) {
                     const members = await membersResponse.json();
                     setRoomMembers(members);
@@ -110,7 +111,7 @@ export const InviteFriendModal: React.FC<InviteFriendModalProps> = ({ visible, o
     const handleRemove = async (friendId: number) => {
         setInvitingId(friendId);
         try {
-            const response = await fetch(`${API_PATH}/rooms/remove`, {
+            const response = await apiFetch(`${API_PATH}/rooms/remove`, {
                 method: 'POST',
                 headers: {
                     'Content-Type': 'application/json',
@@ -138,7 +139,7 @@ export const InviteFriendModal: React.FC<InviteFriendModalProps> = ({ visible, o
     const handleMakeAdmin = async (friendId: number) => {
         setInvitingId(friendId);
         try {
-            const response = await fetch(`${API_PATH}/rooms/role`, {
+            const response = await apiFetch(`${API_PATH}/rooms/role`, {
                 method: 'POST',
                 headers: {
                     'Content-Type': 'application/json',
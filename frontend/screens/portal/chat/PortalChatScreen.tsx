@@ -3,6 +3,7 @@ import { View, Text, StyleSheet, FlatList, TouchableOpacity, useColorScheme, Act
 import { useTranslation } from 'react-i18next';
 import { COLORS } from '../../../components/chat/ChatConstants';
 import { API_PATH } from '../../../config/api.config';
+import { apiFetch } from '../../../services/apiClient';
 import { useUser } from '../../../context/UserContext';
 
 import { CreateRoomModal } from './CreateRoomModal';
@@ -43,7 +44,7 @@ export const PortalChatScreen: React.FC = () => {
 
     const fetchRooms = async () => {
         try {
-            const response = await fetch(`${API_PATH}/rooms`);
+            const response = await apiFetch(`${API_PATH}/rooms`);
             if (response.ok) {
                 const data = await response.json();
                 setRooms(data);
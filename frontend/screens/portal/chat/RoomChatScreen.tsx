@@ -10,6 +10,7 @@ import {
     KeyboardAvoidingView,
     Platform,
     ActivityIndicator,
+    Alert,
     useColorScheme,
 } from 'react-native';
 import { useTranslation } from 'react-i18next';
@@ -17,6 +18,7 @@ import { NativeStackScreenProps } from '@react-navigation/native-stack';
 import { RootStackParamList } from '../../../types/navigation';
 import { COLORS } from '../../../components/chat/ChatConstants';
 import { API_PATH } from '../../../config/api.config';
+import { apiFetch } from '../../../services/apiClient';
 import { useUser } from '../../../context/UserContext';
 import { useWebSocket } from '../../../context/WebSocketContext';
 import { InviteFriendModal } from './InviteFriendModal';
@@ -37,20 +39,30 @@ export const RoomChatScreen: React.FC<Props> = ({ route, navigation }) => {
     const [loading, setLoading] = useState(true);
     const [inviteVisible, setInviteVisible] = useState(false);
     const [settingsVisible, setSettingsVisible] = useState(false);
+    const [archived, setArchived] = useState(false);
+
+    const formatMessage = (m: any) => ({
+        id: m.ID.toString(),
+        content: m.content,
+        sender: m.senderId === user?.ID ? (user?.karmicName || 'Me') : (m.senderId === 0 ? 'AI' : 'Other'),
+        isMe: m.senderId === user?.ID,
+        time: new Date(m.CreatedAt).toLocaleTimeString([], { hour: '2-digit', minute: '2-digit' }),
+    });
+
+    // Adds a message unless it is already shown (e.g. we sent it and it came back via WS)
+    const appendMessage = (formattedMsg: any) => {
+        setMessages(prev => {
+            if (prev.find(m => m.id === formattedMsg.id)) return prev;
+            return [...prev, formattedMsg];
+        });
+    };
 
     const fetchMessages = async () => {
         try {
-            const response = await fetch(`${API_PATH}/messages/${user?.ID}/0?roomId=${roomId}`);
+            const response = await apiFetch(`${API_PATH}/messages/${user?.ID}/0?roomId=${roomId}`);
             if (response.ok) {
                 const data = await response.json();
-                const formattedMessages = data.map((m: any) => ({
-                    id: m.ID.toString(),
-                    content: m.content,
-                    sender: m.senderId === user?.ID ? (user?.karmicName || 'Me') : (m.senderId === 0 ? 'AI' : 'Other'),
-                    isMe: m.senderId === user?.ID,
-                    time: new Date(m.CreatedAt).toLocaleTimeString([], { hour: '2-digit', minute: '2-digit' }),
-                }));
-                setMessages(formattedMessages);
+                setMessages(data.map(formatMessage));
             }
         } catch (error) {
             console.error('Error fetching messages:', error);
@@ -63,21 +75,15 @@ export const RoomChatScreen: React.FC<Props> = ({ route, navigation }) => {
         fetchMessages();
 
         const removeListener = addListener((msg: any) => {
-            // Check if message belongs to this room
-            if (msg.roomId === roomId) {
-                const formattedMsg = {
-                    id: msg.ID.toString(),
-                    content: msg.content,
-                    sender: msg.senderId === user?.ID ? (user?.karmicName || 'Me') : (msg.senderId === 0 ? 'AI' : 'Other'),
-                    isMe: msg.senderId === user?.ID,
-                    time: new Date(msg.CreatedAt).toLocaleTimeString([], { hour: '2-digit', minute: '2-digit' }),
-                };
-                setMessages(prev => {
-                    // Avoid duplicates (e.g. if we sent it and it came back via WS)
-                    if (prev.find(m => m.id === formattedMsg.id)) return prev;
-                    return [...prev, formattedMsg];
-                });
+            if (msg.roomId !== roomId) return;
+
+            // Room events share the socket with messages but carry no message fields
+            if (msg.type === 'room_event') {
+                handleRoomEvent(msg);
+                return;
             }
+            if (!msg.ID) return;
+            appendMessage(formatMessage(msg));
         });
 
         navigation.setOptions({
@@ -97,8 +103,65 @@ export const RoomChatScreen: React.FC<Props> = ({ route, navigation }) => {
         return () => removeListener();
     }, [navigation, roomName, roomId, user?.ID]);
 
+    // The AI reply is shown while it is generated, under a temporary id that
+    // ai_stream_end replaces with the saved message
+    const handleStreamEvent = (event: any) => {
+        const streamKey = `stream-${event.data?.streamId}`;
+        switch (event.event) {
+            case 'ai_stream_start':
+                appendMessage({
+                    id: streamKey,
+                    content: '',
+                    sender: 'AI',
+                    isMe: false,
+                    time: new Date().toLocaleTimeString([], { hour: '2-digit', minute: '2-digit' }),
+                });
+                break;
+            case 'ai_stream_delta':
+                setMessages(prev => prev.map(m => (m.id === streamKey ? { ...m, content: m.content + event.data.delta } : m)));
+                break;
+            case 'ai_stream_end': {
+                const finalMsg = formatMessage(event.data.message);
+                setMessages(prev => {
+                    const rest = prev.filter(m => m.id !== streamKey && m.id !== finalMsg.id);
+                    return [...rest, finalMsg];
+                });
+                break;
+            }
+            case 'ai_stream_error':
+                setMessages(prev => prev.filter(m => m.id !== streamKey));
+                break;
+        }
+    };
+
+    const handleRoomEvent = (event: any) => {
+        if (event.event.startsWith('ai_stream_')) {
+            handleStreamEvent(event);
+            return;
+        }
+        switch (event.event) {
+            case 'room_archived':
+                setArchived(true);
+                break;
+            case 'room_unarchived':
+                setArchived(false);
+                break;
+            case 'room_deleted':
+                Alert.alert(roomName, t('chat.roomDeleted'));
+                navigation.goBack();
+                break;
+            case 'member_left':
+                // Leaving from another device closes the room here too
+                if (event.userId === user?.ID) navigation.goBack();
+                break;
+            case 'ai_quota_exceeded':
+                Alert.alert(t('chat.aiQuotaExceeded'), event.data);
+                break;
+        }
+    };
+
     const handleSendMessage = async () => {
-        if (!inputText.trim()) return;
+        if (!inputText.trim() || archived) return;
 
         const newMessage = {
             senderId: user?.ID,
@@ -110,7 +173,7 @@ export const RoomChatScreen: React.FC<Props> = ({ route, navigation }) => {
         setInputText('');
 
         try {
-            const response = await fetch(`${API_PATH}/messages`, {
+            const response = await apiFetch(`${API_PATH}/messages`, {
                 method: 'POST',
                 headers: {
                     'Content-Type': 'application/json',
@@ -163,8 +226,12 @@ export const RoomChatScreen: React.FC<Props> = ({ route, navigation }) => {
                     />
                 )}
 
+                {archived && (
+                    <Text style={[styles.archivedNotice, { color: theme.subText }]}>{t('chat.roomArchived')}</Text>
+                )}
                 <View style={[styles.inputContainer, { backgroundColor: theme.header, borderTopColor: theme.borderColor }]}>
                     <TextInput
+                        editable={!archived}
                         style={[styles.input, { color: theme.text, backgroundColor: theme.background }]}
                         value={inputText}
                         onChangeText={setInputText}
@@ -224,6 +291,11 @@ const styles = StyleSheet.create({
         alignSelf: 'flex-end',
         marginTop: 4,
     },
+    archivedNotice: {
+        textAlign: 'center',
+        fontSize: 12,
+        paddingVertical: 6,
+    },
     inputContainer: {
         flexDirection: 'row',
         padding: 12,
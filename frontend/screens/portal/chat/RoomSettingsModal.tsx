@@ -13,6 +13,7 @@ import {
 import { useTranslation } from 'react-i18next';
 import { COLORS } from '../../../components/chat/ChatConstants';
 import { API_PATH } from '../../../config/api.config';
+import { apiFetch } from '../../../services/apiClient';
 
 interface RoomSettingsModalProps {
     visible: boolean;
@@ -34,7 +35,7 @@ export const RoomSettingsModal: React.FC<RoomSettingsModalProps> = ({ visible, o
 
     const fetchSettings = async () => {
         try {
-            const response = await fetch(`${API_PATH}/rooms`);
+            const response = await apiFetch(`${API_PATH}/rooms`);
             if (response.ok) {
                 const rooms = await response.json();
                 const currentRoom = rooms.find((r: any) => r.ID === roomId);
@@ -59,7 +60,7 @@ export const RoomSettingsModal: React.FC<RoomSettingsModalProps> = ({ visible, o
     const handleUpdateSettings = async (updates: { isPublic?: boolean; aiEnabled?: boolean }) => {
         setSaving(true);
         try {
-            const response = await fetch(`${API_PATH}/rooms/${roomId}/settings`, {
+            const response = await apiFetch(`${API_PATH}/rooms/${roomId}/settings`, {
                 method: 'PUT',
                 headers: {
                     'Content-Type': 'application/json',
@@ -90,7 +91,7 @@ export const RoomSettingsModal: React.FC<RoomSettingsModalProps> = ({ visible, o
     const handleGetSummary = async () => {
         setSummaryLoading(true);
         try {
-            const response = await fetch(`${API_PATH}/rooms/${roomId}/summary`);
+            const response = await apiFetch(`${API_PATH}/rooms/${roomId}/summary`);
             const data = await response.json();
             if (response.ok) {
                 Alert.alert(t('chat.summary') || 'Chat Summary', data.summary);
@@ -0,0 +1,34 @@
+import AsyncStorage from '@react-native-async-storage/async-storage';
+import axios from 'axios';
+import { API_BASE_URL } from '../config/api.config';
+
+// Токен сессии, выданный при входе или регистрации
+export const getAuthToken = async (): Promise<string | null> => {
+    return AsyncStorage.getItem('authToken');
+};
+
+// Заголовок авторизации, пустой объект если токена нет
+export const authHeaders = async (): Promise<Record<string, string>> => {
+    const token = await getAuthToken();
+    return token ? { Authorization: `Bearer ${token}` } : {};
+};
+
+// fetch к нашему API с токеном сессии
+export const apiFetch = async (url: string, init: RequestInit = {}): Promise<Response> => {
+    const headers = {
+        ...(await authHeaders()),
+        ...((init.headers as Record<string, string>) || {}),
+    };
+    return fetch(url, { ...init, headers });
+};
+
+// axios добавляет токен ко всем запросам к нашему API
+axios.interceptors.request.use(async (config) => {
+    if (config.url?.startsWith(API_BASE_URL)) {
+        const headers = await authHeaders();
+        Object.entries(headers).forEach(([key, value]) => {
+            config.headers.set(key, value);
+        });
+    }
+    return config;
+});
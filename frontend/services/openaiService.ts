@@ -10,6 +10,7 @@ try {
 import { getModelConfig, ModelConfig } from '../config/models.config';
 
 import { API_PATH } from '../config/api.config';
+import { authHeaders } from './apiClient';
 
 const API_KEY = Config?.API_OPEN_AI || '';
 
@@ -105,13 +106,16 @@ export const sendMessage = async (
       requestBody.provider = provider;
     }
 
+    // Шлюз принимает только токен сессии, выданный при входе
+    const sessionHeaders = await authHeaders();
+
     // Попробуем прямой fetch
     try {
       const response = await fetch(`${API_PATH}/v1/chat/completions`, {
         method: 'POST',
         headers: {
           'Content-Type': 'application/json',
-          'Authorization': `Bearer ${API_KEY}`,
+          ...sessionHeaders,
         },
         body: JSON.stringify(requestBody),
         signal: options.signal,
@@ -147,7 +151,8 @@ export const sendMessage = async (
 
       // Fallback на SDK
       const completion = await openaiClient.chat.completions.create(requestBody, {
-        signal: options.signal
+        signal: options.signal,
+        headers: sessionHeaders,
       });
 
       const content = completion.choices[0]?.message?.content || '';
@@ -191,7 +196,7 @@ export const getAvailableModels = async (provider?: string): Promise<any> => {
     const response = await fetch(url, {
       method: 'GET',
       headers: {
-        Authorization: `Bearer ${API_KEY}`,
+        ...(await authHeaders()),
         'Content-Type': 'application/json',
       },
       signal: controller.signal
@@ -3,6 +3,7 @@ package main
 import (
 	"fmt"
 	"log"
+	"rag-agent-server/internal/config"
 	"rag-agent-server/internal/database"
 	"rag-agent-server/internal/models"
 	"time"
@@ -15,7 +16,7 @@ func main() {
 		log.Println("No .env file found")
 	}
 
-	database.Connect()
+	database.Connect(config.MustLoad())
 
 	model := models.AiModel{
 		ModelID:        "gpt5",
@@ -2,6 +2,7 @@ package main
 
 import (
 	"log"
+	"rag-agent-server/internal/config"
 	"rag-agent-server/internal/database"
 	"rag-agent-server/internal/models"
 	"time"
@@ -11,7 +12,7 @@ import (
 
 func main() {
 	godotenv.Load()
-	database.Connect()
+	database.Connect(config.MustLoad())
 
 	// Add working text models
 	workingModels := []models.AiModel{
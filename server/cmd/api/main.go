@@ -3,11 +3,12 @@ package main
 import (
 	"fmt"
 	"log"
+	"rag-agent-server/internal/config"
 	"rag-agent-server/internal/database"
 	"rag-agent-server/internal/handlers"
-	"rag-agent-server/internal/models"
 	"rag-agent-server/internal/services"
 	"rag-agent-server/internal/websocket"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/cors"
@@ -22,53 +23,170 @@ func main() {
 		log.Println("No .env file found")
 	}
 
+	// Load and validate configuration
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("[Config] Invalid configuration: %v", err)
+	}
+
 	// Initialize Database
-	database.Connect()
+	database.Connect(cfg)
+
+	// Settings stored in the database override the static configuration
+	configStore := config.NewStore(cfg)
+	if err := configStore.UseOverrides(config.SystemSettingSource(database.DB, configStore.Secrets())); err != nil {
+		log.Fatalf("[Config] Could not read settings from database: %v", err)
+	}
+	if configStore.Secrets() == nil {
+		log.Println("[Config] SECRETS_MASTER_KEY is not set, API keys saved from the admin panel are stored unencrypted")
+	} else if sealed, err := config.RotateSecrets(database.DB, configStore.Secrets(), 0); err != nil {
+		log.Printf("[Config] Failed to encrypt stored secrets: %v", err)
+	} else if sealed > 0 {
+		// Encrypts plaintext secrets left from before and finishes key rotations
+		log.Printf("[Config] Encrypted %d stored secrets with key %s", sealed, configStore.Secrets().KeyID())
+	}
+	configStore.Watch(time.Minute)
 
-	// Initialize Fiber App
-	app := fiber.New()
+	// Initialize Fiber App. Knowledge uploads need room for the document plus
+	// the rest of the multipart form; every other route keeps the default limit.
+	knowledgeUploadLimit := services.MaxKnowledgeFileSize + 1<<20
+	app := fiber.New(fiber.Config{
+		BodyLimit: knowledgeUploadLimit,
+	})
 
 	// Middleware
 	app.Use(logger.New())
 	app.Use(cors.New())
+	app.Use(handlers.LimitBody(fiber.DefaultBodyLimit, map[string]int{
+		"POST /api/admin/knowledge/documents": knowledgeUploadLimit,
+	}))
 
 	// Services
-	aiChatService := services.NewAiChatService()
-	hub := websocket.NewHub()
+	usageMeter := services.NewUsageMeter()
+	promptService := services.NewPromptService()
+	promptService.SeedDefaultPrompts()
+	aiChatService := services.NewAiChatService(configStore, usageMeter, promptService)
+	// RAG-enabled models are grounded in the profiles and documents of the RAG backend
+	ragService, err := services.NewRAGService(configStore)
+	if err != nil {
+		log.Fatalf("[RAG] Could not start the %s backend: %v", cfg.RAG.Backend, err)
+	}
+	aiChatService.UseRetriever(ragService.Retriever())
+	if queued, err := ragService.IndexMissingProfiles(); err != nil {
+		log.Printf("[RAG] Failed to queue missing profiles: %v", err)
+	} else if queued > 0 {
+		log.Printf("[RAG] Indexing %d profiles missing from the store", queued)
+	}
+	knowledgeService := services.NewKnowledgeService(ragService)
+	knowledgeService.ResumeIndexing()
+	hub := websocket.NewHub(handlers.RoomMemberIDs)
 	go hub.Run()
+	messageScheduler := services.NewMessageScheduler(hub)
+	messageScheduler.Start()
+	modelHealthChecker := services.NewModelHealthChecker(configStore, aiChatService)
+	modelHealthChecker.Start()
+	modelSyncService := services.NewModelSyncService(configStore)
+	modelSyncService.Start()
+	billingService := services.NewBillingService(configStore)
+	billingService.SeedDefaultPlans()
+	billingService.Start()
 
 	// Handlers
-	authHandler := handlers.NewAuthHandler()
-	messageHandler := handlers.NewMessageHandler(aiChatService, hub)
-	roomHandler := handlers.NewRoomHandler()
-	adminHandler := handlers.NewAdminHandler()
-	aiHandler := handlers.NewAiHandler()
-	mediaHandler := handlers.NewMediaHandler()
-	datingHandler := handlers.NewDatingHandler(aiChatService)
+	tokenIssuer := services.NewTokenIssuer(cfg.Auth)
+	authHandler := handlers.NewAuthHandler(ragService, tokenIssuer)
+	moderationService := services.NewModerationService(configStore, aiChatService)
+	aiReplyDispatcher := services.NewAiReplyDispatcher(aiChatService, hub)
+	messageHandler := handlers.NewMessageHandler(aiChatService, hub, moderationService, aiReplyDispatcher)
+	roomHandler := handlers.NewRoomHandler(hub, billingService)
+	adminHandler := handlers.NewAdminHandler(configStore, ragService)
+	aiHandler := handlers.NewAiHandler(aiChatService, modelHealthChecker, modelSyncService)
+	mediaHandler := handlers.NewMediaHandler(billingService)
+	datingHandler := handlers.NewDatingHandler(aiChatService, billingService, promptService)
+	scheduledMessageHandler := handlers.NewScheduledMessageHandler()
+	moderationHandler := handlers.NewModerationHandler(hub)
+	aiUsageHandler := handlers.NewAiUsageHandler(usageMeter)
+	billingHandler := handlers.NewBillingHandler(billingService)
+	promptHandler := handlers.NewPromptHandler(promptService)
+	knowledgeHandler := handlers.NewKnowledgeHandler(knowledgeService)
 
 	// Routes
 	api := app.Group("/api")
 
-	// Admin Routes (Protected - should ideally have middleware)
-	admin := api.Group("/admin")
+	// requireAuth guards the routes that act as the caller: admin, rooms,
+	// messages, reports, billing, AI usage and everything that spends AI
+	// credits. Profile, contact, friend, media and dating profile routes still
+	// take the user from the path and are not authenticated yet.
+	requireAuth := handlers.RequireAuth(tokenIssuer)
+
+	// Admin Routes
+	admin := api.Group("/admin", requireAuth, handlers.RequireAdmin())
 	admin.Get("/users", adminHandler.GetUsers)
 	admin.Post("/users/:id/toggle-block", adminHandler.ToggleBlockUser)
 	admin.Put("/users/:id/role", adminHandler.UpdateUserRole)
 	admin.Post("/admins", adminHandler.AddAdmin)
 	admin.Get("/stats", adminHandler.GetStats)
 	admin.Get("/dating/profiles", adminHandler.GetDatingProfiles)
+	admin.Post("/profiles/reindex", adminHandler.ReindexProfiles)
 	admin.Post("/dating/profiles/:id/flag", adminHandler.FlagDatingProfile)
 	admin.Get("/settings", adminHandler.GetSystemSettings)
 	admin.Post("/settings", adminHandler.UpdateSystemSettings)
+	admin.Post("/settings/rotate-secrets", adminHandler.RotateSecrets)
+	admin.Get("/settings/audit", adminHandler.GetSettingAudit)
+
+	// Moderation Queue
+	admin.Get("/moderation/reports", moderationHandler.GetReports)
+	admin.Post("/moderation/reports/:id/resolve", moderationHandler.ResolveReport)
+	admin.Post("/moderation/reports/:id/dismiss", moderationHandler.DismissReport)
 
 	// AI Model Management Routes
 	admin.Get("/ai-models", aiHandler.GetAdminModels)
 	admin.Post("/ai-models/sync", aiHandler.SyncModels)
+	admin.Get("/ai-models/sync-logs", aiHandler.GetSyncLogs)
 	admin.Put("/ai-models/:id", aiHandler.UpdateModel)
 	admin.Delete("/ai-models/:id", aiHandler.DeleteModel)
 	admin.Post("/ai-models/:id/test", aiHandler.TestModel)
 	admin.Post("/ai-models/bulk-test", aiHandler.BulkTestModels)
 	admin.Post("/ai-models/disable-offline", aiHandler.DisableOfflineModels)
+	admin.Get("/ai-models/circuits", aiHandler.GetCircuitStatus)
+	admin.Get("/ai-models/health", aiHandler.GetModelsHealth)
+	admin.Get("/ai-models/:id/health", aiHandler.GetModelHealth)
+	admin.Get("/ai-cache", aiHandler.GetCacheStats)
+	admin.Delete("/ai-cache", aiHandler.ClearCache)
+	admin.Get("/ai-features", aiHandler.GetFeatureModels)
+	admin.Put("/ai-features/:feature", aiHandler.UpdateFeatureModels)
+
+	// Admin Prompt Template Routes
+	admin.Get("/prompts", promptHandler.GetPrompts)
+	admin.Get("/prompts/:key", promptHandler.GetPromptVersions)
+	admin.Post("/prompts/:key", promptHandler.SavePromptVersion)
+	admin.Post("/prompts/:key/preview", promptHandler.PreviewPrompt)
+	admin.Post("/prompts/:key/rollback", promptHandler.RollbackPrompt)
+
+	// Admin Knowledge Base Routes
+	admin.Get("/knowledge/collections", knowledgeHandler.GetCollections)
+	admin.Get("/knowledge/documents", knowledgeHandler.GetDocuments)
+	admin.Post("/knowledge/documents", knowledgeHandler.UploadDocument)
+	admin.Get("/knowledge/documents/:id", knowledgeHandler.GetDocument)
+	admin.Put("/knowledge/documents/:id", knowledgeHandler.UpdateDocument)
+	admin.Delete("/knowledge/documents/:id", knowledgeHandler.DeleteDocument)
+	admin.Post("/knowledge/documents/:id/reindex", knowledgeHandler.ReindexDocument)
+	admin.Post("/knowledge/reindex", knowledgeHandler.ReindexAll)
+
+	// AI Usage & Quotas
+	admin.Get("/ai-usage", aiUsageHandler.GetUsageReport)
+	admin.Get("/ai-usage/users/:id", aiUsageHandler.GetUserUsage)
+	admin.Get("/ai-usage/quotas", aiUsageHandler.GetQuotas)
+	admin.Put("/ai-usage/quotas/:plan", aiUsageHandler.UpdateQuota)
+
+	// Subscription Plans
+	admin.Put("/plans/:code", billingHandler.UpdatePlan)
+	admin.Put("/plans/:code/prices", billingHandler.UpdatePlanPrices)
+
+	// Scheduled Room Messages
+	admin.Get("/rooms/:id/scheduled-messages", scheduledMessageHandler.GetScheduledMessages)
+	admin.Post("/rooms/:id/scheduled-messages", scheduledMessageHandler.CreateScheduledMessage)
+	admin.Put("/rooms/:id/scheduled-messages/:jobId", scheduledMessageHandler.UpdateScheduledMessage)
+	admin.Delete("/rooms/:id/scheduled-messages/:jobId", scheduledMessageHandler.DeleteScheduledMessage)
 
 	api.Post("/register", authHandler.Register)
 	api.Post("/login", authHandler.Login)
@@ -83,8 +201,17 @@ func main() {
 	api.Post("/blocks/remove", authHandler.UnblockUser)
 	api.Get("/blocks/:id", authHandler.GetBlockedUsers)
 	log.Println("Registering /api/messages routes...")
-	api.Post("/messages", messageHandler.SendMessage)
-	api.Get("/messages/:userId/:recipientId", messageHandler.GetMessages)
+	api.Post("/messages", requireAuth, messageHandler.SendMessage)
+	api.Get("/messages/:userId/:recipientId", requireAuth, messageHandler.GetMessages)
+	api.Post("/reports", requireAuth, moderationHandler.CreateReport)
+	api.Get("/ai-usage/me", requireAuth, aiUsageHandler.GetMyUsage)
+
+	// Billing Routes
+	api.Get("/plans", billingHandler.GetPlans)
+	api.Get("/billing/me", requireAuth, billingHandler.GetMyBilling)
+	api.Post("/billing/checkout", requireAuth, billingHandler.Checkout)
+	api.Post("/billing/webhook/:provider", billingHandler.HandleWebhook)
+	api.Post("/billing/fake-checkout/:id", requireAuth, billingHandler.CompleteFakeCheckout)
 
 	// WebSocket Route
 	api.Get("/ws/:id", ws.New(func(c *ws.Conn) {
@@ -102,7 +229,7 @@ func main() {
 			Hub:    hub,
 			Conn:   c,
 			UserID: userId,
-			Send:   make(chan models.Message, 256),
+			Send:   make(chan interface{}, 256),
 		}
 		hub.Register <- client
 
@@ -111,16 +238,34 @@ func main() {
 	}))
 
 	// Room Routes
-	api.Post("/rooms", roomHandler.CreateRoom)
-	api.Get("/rooms", roomHandler.GetRooms)
-	api.Post("/rooms/invite", roomHandler.InviteUser)
-	api.Post("/rooms/remove", roomHandler.RemoveUser)
-	api.Post("/rooms/role", roomHandler.UpdateMemberRole)
-	api.Get("/rooms/:id/members", roomHandler.GetRoomMembers)
-	api.Get("/rooms/:id/summary", messageHandler.GetRoomSummary)
-	api.Put("/rooms/:id", roomHandler.UpdateRoom)
-	api.Put("/rooms/:id/settings", roomHandler.UpdateRoomSettings)
-	api.Post("/rooms/:id/image", roomHandler.UpdateRoomImage)
+	api.Post("/rooms", requireAuth, roomHandler.CreateRoom)
+	api.Get("/rooms", requireAuth, roomHandler.GetRooms)
+	api.Get("/rooms/my", requireAuth, roomHandler.GetMyRooms)
+	api.Get("/rooms/discover", requireAuth, roomHandler.DiscoverRooms)
+	api.Get("/rooms/categories", requireAuth, roomHandler.GetRoomCategories)
+	api.Post("/rooms/invite", requireAuth, roomHandler.InviteUser)
+	api.Post("/rooms/remove", requireAuth, roomHandler.RemoveUser)
+	api.Post("/rooms/role", requireAuth, roomHandler.UpdateMemberRole)
+	api.Get("/rooms/:id/members", requireAuth, roomHandler.GetRoomMembers)
+	api.Get("/rooms/:id/summary", requireAuth, messageHandler.GetRoomSummary)
+	api.Put("/rooms/:id", requireAuth, roomHandler.UpdateRoom)
+	api.Put("/rooms/:id/settings", requireAuth, roomHandler.UpdateRoomSettings)
+	api.Post("/rooms/:id/image", requireAuth, roomHandler.UpdateRoomImage)
+	api.Get("/rooms/:id/ai-settings", requireAuth, roomHandler.GetRoomAiSettings)
+	api.Put("/rooms/:id/ai-settings", requireAuth, roomHandler.UpdateRoomAiSettings)
+	api.Post("/rooms/:id/transfer-ownership", requireAuth, roomHandler.TransferOwnership)
+	api.Post("/rooms/:id/archive", requireAuth, roomHandler.ArchiveRoom)
+	api.Delete("/rooms/:id", requireAuth, roomHandler.DeleteRoom)
+	api.Post("/rooms/:id/leave", requireAuth, roomHandler.LeaveRoom)
+	api.Post("/rooms/:id/join", requireAuth, roomHandler.JoinRoom)
+	api.Get("/rooms/:id/invites", requireAuth, roomHandler.GetInvites)
+	api.Post("/rooms/:id/invites", requireAuth, roomHandler.CreateInvite)
+	api.Delete("/rooms/:id/invites/:inviteId", requireAuth, roomHandler.RevokeInvite)
+	api.Get("/rooms/:id/join-requests", requireAuth, roomHandler.GetJoinRequests)
+	api.Post("/rooms/:id/join-requests/:requestId/approve", requireAuth, roomHandler.ApproveJoinRequest)
+	api.Post("/rooms/:id/join-requests/:requestId/reject", requireAuth, roomHandler.RejectJoinRequest)
+	api.Get("/room-invites/:code", requireAuth, roomHandler.GetInvitePreview)
+	api.Post("/room-invites/:code/accept", requireAuth, roomHandler.AcceptInvite)
 
 	// Media Routes
 	api.Post("/media/upload/:userId", mediaHandler.UploadPhoto)
@@ -132,7 +277,7 @@ func main() {
 	api.Get("/dating/stats", datingHandler.GetDatingStats)
 	api.Get("/dating/cities", datingHandler.GetDatingCities)
 	api.Get("/dating/candidates", datingHandler.GetCandidates)
-	api.Post("/dating/compatibility/:userId/:candidateId", datingHandler.GetCompatibility)
+	api.Post("/dating/compatibility/:userId/:candidateId", requireAuth, datingHandler.GetCompatibility)
 	api.Get("/dating/profile/:id", datingHandler.GetDatingProfile)
 	api.Put("/dating/profile/:id", datingHandler.UpdateDatingProfile)
 	api.Post("/dating/favorites", datingHandler.AddToFavorites)
@@ -144,13 +289,13 @@ func main() {
 	// Static files for avatars
 	app.Static("/uploads", "./uploads")
 
-	chatHandler := handlers.NewChatHandler()
+	chatHandler := handlers.NewChatHandler(configStore, usageMeter, aiChatService)
 	// Use /v1 prefix to match frontend expectation
-	api.Post("/v1/chat/completions", chatHandler.HandleChat)
+	api.Post("/v1/chat/completions", requireAuth, chatHandler.HandleChat)
 	api.Get("/v1/models", aiHandler.GetClientModels)
 
 	// Start Server
-	port := ":8081"
+	port := ":" + cfg.Port
 	log.Printf("Server starting on port %s", port)
 	log.Fatal(app.Listen(port))
 }
@@ -2,6 +2,7 @@ package main
 
 import (
 	"log"
+	"rag-agent-server/internal/config"
 	"rag-agent-server/internal/database"
 	"rag-agent-server/internal/models"
 
@@ -10,7 +11,7 @@ import (
 
 func main() {
 	godotenv.Load()
-	database.Connect()
+	database.Connect(config.MustLoad())
 
 	faces := []string{"/uploads/media/face1.png", "/uploads/media/face2.png", "/uploads/media/face3.png"}
 
@@ -3,6 +3,7 @@ package main
 import (
 	"fmt"
 	"math/rand"
+	"rag-agent-server/internal/config"
 	"rag-agent-server/internal/database"
 	"rag-agent-server/internal/models"
 	"time"
@@ -43,7 +44,7 @@ func main() {
 	}
 
 	fmt.Println("Connecting to database...")
-	database.Connect()
+	database.Connect(config.MustLoad())
 
 	// Auto-migrate to ensure columns exist
 	database.DB.AutoMigrate(&models.User{})
@@ -3,23 +3,43 @@ package main
 import (
 	"fmt"
 	"log"
+	"rag-agent-server/internal/config"
 	"rag-agent-server/internal/database"
 	"rag-agent-server/internal/models"
 
 	"github.com/joho/godotenv"
 )
 
+// read_key reports whether the gateway API key is stored in the database and
+// whether it is encrypted. The key itself is never printed.
 func main() {
 	if err := godotenv.Load(); err != nil {
 		log.Println("No .env file found")
 	}
 
-	database.Connect()
+	cfg := config.MustLoad()
+	database.Connect(cfg)
 
 	var setting models.SystemSetting
 	if err := database.DB.Where("key = ?", "API_OPEN_AI").First(&setting).Error; err != nil {
 		log.Printf("Error fetching setting: %v\n", err)
-	} else {
-		fmt.Printf("Current DB Value: %s\n", setting.Value)
+		return
 	}
+
+	if !config.IsSealed(setting.Value) {
+		fmt.Printf("Current DB Value: %s (plaintext, will be encrypted on next server start with SECRETS_MASTER_KEY)\n", config.Mask(setting.Value))
+		return
+	}
+
+	box, err := config.NewSecretBox(cfg.Secrets)
+	if err != nil || box == nil {
+		fmt.Println("Current DB Value: encrypted (SECRETS_MASTER_KEY not available to verify it)")
+		return
+	}
+	value, err := box.Open(setting.Value)
+	if err != nil {
+		fmt.Printf("Current DB Value: encrypted, cannot decrypt: %v\n", err)
+		return
+	}
+	fmt.Printf("Current DB Value: %s (encrypted)\n", config.Mask(value))
 }
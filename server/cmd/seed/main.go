@@ -2,6 +2,7 @@ package main
 
 import (
 	"log"
+	"rag-agent-server/internal/config"
 	"rag-agent-server/internal/database"
 	"rag-agent-server/internal/models"
 	"rag-agent-server/internal/services"
@@ -17,9 +18,13 @@ func main() {
 	}
 
 	// Initialize DB
-	database.Connect()
+	cfg := config.MustLoad()
+	database.Connect(cfg)
 
-	ragService := services.NewRAGService()
+	ragService, err := services.NewRAGService(config.NewStore(cfg))
+	if err != nil {
+		log.Fatalf("Could not start the RAG backend: %v", err)
+	}
 
 	testUsers := []models.User{
 		{
@@ -7,6 +7,7 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
+	"rag-agent-server/internal/config"
 	"rag-agent-server/internal/database"
 	"rag-agent-server/internal/models"
 	"time"
@@ -51,7 +52,7 @@ func main() {
 		log.Println("No .env file found")
 	}
 
-	database.Connect()
+	database.Connect(config.MustLoad())
 
 	password, _ := bcrypt.GenerateFromPassword([]byte("password"), bcrypt.DefaultCost)
 
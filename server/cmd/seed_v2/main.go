@@ -7,6 +7,7 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
+	"rag-agent-server/internal/config"
 	"rag-agent-server/internal/database"
 	"rag-agent-server/internal/models"
 	"time"
@@ -26,7 +27,7 @@ func main() {
 		log.Println("No .env file found, using defaults")
 	}
 
-	database.Connect()
+	database.Connect(config.MustLoad())
 	log.Println("Connected to database")
 
 	photos := []string{
@@ -0,0 +1,463 @@
+// Package config is the single source of runtime configuration.
+//
+// Values are layered with the following precedence (later wins):
+//
+//  1. built-in defaults
+//  2. a JSON file of KEY: value pairs (CONFIG_FILE, default ./config.json)
+//  3. environment variables (including .env)
+//  4. SystemSetting rows in the database, for keys marked dynamic
+//
+// Dynamic keys can be changed from the admin panel without a restart; the
+// Store reloads them on demand and periodically.
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+type Config struct {
+	Port       string
+	Database   DatabaseConfig
+	SuperAdmin SuperAdminConfig
+	AI         AIConfig
+	Moderation ModerationConfig
+	Secrets    SecretsConfig
+	Billing    BillingConfig
+	Auth       AuthConfig
+	RAG        RAGConfig
+}
+
+type DatabaseConfig struct {
+	Host     string
+	Port     string
+	User     string
+	Password string
+	Name     string
+}
+
+// DSN is the PostgreSQL connection string
+func (d DatabaseConfig) DSN() string {
+	return fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=disable",
+		d.Host, d.Port, d.User, d.Password, d.Name)
+}
+
+type SuperAdminConfig struct {
+	Email    string
+	Password string
+}
+
+type AIConfig struct {
+	// GatewayURL is the base of the shared OpenAI-compatible webhook
+	GatewayURL    string
+	GatewayAPIKey string
+	// Provider forces a provider for every model; only "fake" is supported
+	Provider     string
+	DefaultModel string
+
+	OpenAIAPIKey     string
+	OpenAIBaseURL    string
+	AnthropicAPIKey  string
+	AnthropicBaseURL string
+	GeminiAPIKey     string
+	GeminiBaseURL    string
+	GeminiCorpusID   string
+	// GeminiRetrievalModel runs file search lookups for RAG-enabled models
+	GeminiRetrievalModel string
+	LocalAPIKey          string
+	LocalBaseURL         string
+	// NativeProviders lists the vendors (openai, anthropic, gemini) whose
+	// models are called with their own key instead of through the gateway.
+	// Having a key configured is not enough: GEMINI_API_KEY, for one, is
+	// also used for retrieval.
+	NativeProviders string
+
+	// Background model health checks; an interval of 0 disables them
+	HealthCheckIntervalMinutes  int
+	HealthCheckConcurrency      int
+	HealthCheckFailureThreshold int
+	// Hours between model catalogue syncs; 0 disables them
+	ModelSyncIntervalHours int
+	// MaxCompletionTokens caps max_tokens on /v1/chat/completions
+	MaxCompletionTokens int
+	// Response cache for repeatable AI calls (summaries, compatibility, moderation)
+	ResponseCacheEnabled    bool
+	ResponseCacheMaxEntries int
+}
+
+// nativeProviderNames are the vendors NativeProviders may list
+var nativeProviderNames = []string{"openai", "anthropic", "gemini"}
+
+// UsesNative reports whether models of a vendor are called natively
+func (a AIConfig) UsesNative(vendor string) bool {
+	for _, name := range strings.Split(a.NativeProviders, ",") {
+		if strings.EqualFold(strings.TrimSpace(name), vendor) {
+			return true
+		}
+	}
+	return false
+}
+
+// ChatCompletionsURL is the gateway's chat completions endpoint
+func (a AIConfig) ChatCompletionsURL() string {
+	return a.GatewayURL + "/chat/completions"
+}
+
+// ModelsURL is the gateway's model list endpoint
+func (a AIConfig) ModelsURL() string {
+	return a.GatewayURL + "/models"
+}
+
+type ModerationConfig struct {
+	// Comma or newline separated keyword lists
+	BlockKeywords string
+	HoldKeywords  string
+	FlagKeywords  string
+	AiEnabled     bool
+}
+
+type BillingConfig struct {
+	// PaymentProvider selects the payment integration; empty disables checkout.
+	// Only "fake" ships with the server.
+	PaymentProvider string
+	WebhookSecret   string
+}
+
+type AuthConfig struct {
+	// TokenSecret signs session tokens. When empty a random secret is used,
+	// so tokens don't survive a restart.
+	TokenSecret   string
+	TokenTTLHours int
+}
+
+type RAGConfig struct {
+	// Backend is where retrieval runs: "gemini" (file search store) or
+	// "pgvector" (self-hosted in our Postgres)
+	Backend string
+	// EmbeddingsProvider is "openai", "local" (any OpenAI-compatible server
+	// at LOCAL_AI_BASE_URL) or "fake" (deterministic, for development)
+	EmbeddingsProvider   string
+	EmbeddingsModel      string
+	EmbeddingsDimensions int
+	// Chunks are measured in characters
+	ChunkSize    int
+	ChunkOverlap int
+}
+
+// field binds a configuration key to a Config field
+type field struct {
+	key      string
+	fallback string
+	// dynamic keys may be overridden by SystemSetting rows
+	dynamic bool
+	// secret values are never shown in full
+	secret bool
+	bind   func(c *Config) interface{} // *string, *bool or *int
+}
+
+var fields = []field{
+	{key: "PORT", fallback: "8081", bind: func(c *Config) interface{} { return &c.Port }},
+
+	{key: "DB_HOST", fallback: "localhost", bind: func(c *Config) interface{} { return &c.Database.Host }},
+	{key: "DB_PORT", fallback: "5435", bind: func(c *Config) interface{} { return &c.Database.Port }},
+	{key: "DB_USER", fallback: "raguser", bind: func(c *Config) interface{} { return &c.Database.User }},
+	{key: "DB_PASSWORD", fallback: "ragpassword", secret: true, bind: func(c *Config) interface{} { return &c.Database.Password }},
+	{key: "DB_NAME", fallback: "ragdb", bind: func(c *Config) interface{} { return &c.Database.Name }},
+
+	{key: "SUPERADMIN_EMAIL", bind: func(c *Config) interface{} { return &c.SuperAdmin.Email }},
+	{key: "SUPERADMIN_PASSWORD", secret: true, bind: func(c *Config) interface{} { return &c.SuperAdmin.Password }},
+
+	{key: "AI_GATEWAY_URL", fallback: "https://rvlautoai.ru/webhook/v1", bind: func(c *Config) interface{} { return &c.AI.GatewayURL }},
+	{key: "API_OPEN_AI", dynamic: true, secret: true, bind: func(c *Config) interface{} { return &c.AI.GatewayAPIKey }},
+	{key: "AI_PROVIDER", bind: func(c *Config) interface{} { return &c.AI.Provider }},
+	{key: "DEFAULT_ASTRO_MODEL", fallback: "gpt4o", dynamic: true, bind: func(c *Config) interface{} { return &c.AI.DefaultModel }},
+	{key: "OPENAI_API_KEY", dynamic: true, secret: true, bind: func(c *Config) interface{} { return &c.AI.OpenAIAPIKey }},
+	{key: "OPENAI_BASE_URL", fallback: "https://api.openai.com/v1", dynamic: true, bind: func(c *Config) interface{} { return &c.AI.OpenAIBaseURL }},
+	{key: "ANTHROPIC_API_KEY", dynamic: true, secret: true, bind: func(c *Config) interface{} { return &c.AI.AnthropicAPIKey }},
+	{key: "ANTHROPIC_BASE_URL", fallback: "https://api.anthropic.com", dynamic: true, bind: func(c *Config) interface{} { return &c.AI.AnthropicBaseURL }},
+	{key: "GEMINI_API_KEY", dynamic: true, secret: true, bind: func(c *Config) interface{} { return &c.AI.GeminiAPIKey }},
+	{key: "GEMINI_BASE_URL", fallback: "https://generativelanguage.googleapis.com", dynamic: true, bind: func(c *Config) interface{} { return &c.AI.GeminiBaseURL }},
+	{key: "GEMINI_CORPUS_ID", bind: func(c *Config) interface{} { return &c.AI.GeminiCorpusID }},
+	{key: "GEMINI_RETRIEVAL_MODEL", fallback: "gemini-2.5-flash", dynamic: true, bind: func(c *Config) interface{} { return &c.AI.GeminiRetrievalModel }},
+	{key: "LOCAL_AI_API_KEY", dynamic: true, secret: true, bind: func(c *Config) interface{} { return &c.AI.LocalAPIKey }},
+	{key: "LOCAL_AI_BASE_URL", fallback: "http://localhost:11434/v1", dynamic: true, bind: func(c *Config) interface{} { return &c.AI.LocalBaseURL }},
+	{key: "AI_NATIVE_PROVIDERS", dynamic: true, bind: func(c *Config) interface{} { return &c.AI.NativeProviders }},
+	{key: "AI_HEALTH_CHECK_INTERVAL_MINUTES", fallback: "15", dynamic: true, bind: func(c *Config) interface{} { return &c.AI.HealthCheckIntervalMinutes }},
+	{key: "AI_HEALTH_CHECK_CONCURRENCY", fallback: "4", dynamic: true, bind: func(c *Config) interface{} { return &c.AI.HealthCheckConcurrency }},
+	{key: "AI_HEALTH_CHECK_FAILURE_THRESHOLD", fallback: "3", dynamic: true, bind: func(c *Config) interface{} { return &c.AI.HealthCheckFailureThreshold }},
+	{key: "AI_MODEL_SYNC_INTERVAL_HOURS", fallback: "24", dynamic: true, bind: func(c *Config) interface{} { return &c.AI.ModelSyncIntervalHours }},
+	{key: "AI_MAX_COMPLETION_TOKENS", fallback: "4096", dynamic: true, bind: func(c *Config) interface{} { return &c.AI.MaxCompletionTokens }},
+	{key: "AI_RESPONSE_CACHE_ENABLED", fallback: "true", dynamic: true, bind: func(c *Config) interface{} { return &c.AI.ResponseCacheEnabled }},
+	{key: "AI_RESPONSE_CACHE_MAX_ENTRIES", fallback: "1000", dynamic: true, bind: func(c *Config) interface{} { return &c.AI.ResponseCacheMaxEntries }},
+
+	{key: "MODERATION_BLOCK_KEYWORDS", dynamic: true, bind: func(c *Config) interface{} { return &c.Moderation.BlockKeywords }},
+	{key: "MODERATION_HOLD_KEYWORDS", dynamic: true, bind: func(c *Config) interface{} { return &c.Moderation.HoldKeywords }},
+	{key: "MODERATION_FLAG_KEYWORDS", dynamic: true, bind: func(c *Config) interface{} { return &c.Moderation.FlagKeywords }},
+	{key: "MODERATION_AI_ENABLED", fallback: "false", dynamic: true, bind: func(c *Config) interface{} { return &c.Moderation.AiEnabled }},
+
+	{key: "PAYMENT_PROVIDER", bind: func(c *Config) interface{} { return &c.Billing.PaymentProvider }},
+	{key: "PAYMENT_WEBHOOK_SECRET", dynamic: true, secret: true, bind: func(c *Config) interface{} { return &c.Billing.WebhookSecret }},
+
+	{key: "AUTH_TOKEN_SECRET", secret: true, bind: func(c *Config) interface{} { return &c.Auth.TokenSecret }},
+	{key: "AUTH_TOKEN_TTL_HOURS", fallback: "720", bind: func(c *Config) interface{} { return &c.Auth.TokenTTLHours }},
+
+	{key: "RAG_BACKEND", fallback: "gemini", bind: func(c *Config) interface{} { return &c.RAG.Backend }},
+	{key: "RAG_EMBEDDINGS_PROVIDER", fallback: "openai", bind: func(c *Config) interface{} { return &c.RAG.EmbeddingsProvider }},
+	{key: "RAG_EMBEDDINGS_MODEL", fallback: "text-embedding-3-small", dynamic: true, bind: func(c *Config) interface{} { return &c.RAG.EmbeddingsModel }},
+	{key: "RAG_EMBEDDINGS_DIMENSIONS", fallback: "1536", bind: func(c *Config) interface{} { return &c.RAG.EmbeddingsDimensions }},
+	{key: "RAG_CHUNK_SIZE", fallback: "1200", dynamic: true, bind: func(c *Config) interface{} { return &c.RAG.ChunkSize }},
+	{key: "RAG_CHUNK_OVERLAP", fallback: "200", dynamic: true, bind: func(c *Config) interface{} { return &c.RAG.ChunkOverlap }},
+
+	{key: "SECRETS_MASTER_KEY", secret: true, bind: func(c *Config) interface{} { return &c.Secrets.MasterKey }},
+	{key: "SECRETS_PREVIOUS_MASTER_KEYS", secret: true, bind: func(c *Config) interface{} { return &c.Secrets.PreviousMasterKeys }},
+}
+
+func lookupField(key string) (field, bool) {
+	for _, f := range fields {
+		if f.key == key {
+			return f, true
+		}
+	}
+	return field{}, false
+}
+
+// IsDynamic reports whether key can be overridden from the admin panel
+func IsDynamic(key string) bool {
+	f, ok := lookupField(key)
+	return ok && f.dynamic
+}
+
+// IsSecret reports whether key holds a credential that must not be displayed
+func IsSecret(key string) bool {
+	f, ok := lookupField(key)
+	return ok && f.secret
+}
+
+// SecretSettingKeys lists the credentials that can be stored in SystemSetting.
+// They are encrypted at rest and never returned in full.
+func SecretSettingKeys() []string {
+	var keys []string
+	for _, f := range fields {
+		if f.dynamic && f.secret {
+			keys = append(keys, f.key)
+		}
+	}
+	return keys
+}
+
+func (c *Config) set(f field, value string) error {
+	switch target := f.bind(c).(type) {
+	case *string:
+		*target = strings.TrimSpace(value)
+	case *bool:
+		parsed, err := strconv.ParseBool(strings.TrimSpace(value))
+		if err != nil {
+			return fmt.Errorf("%s: %q is not a boolean", f.key, value)
+		}
+		*target = parsed
+	case *int:
+		parsed, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil {
+			return fmt.Errorf("%s: %q is not a number", f.key, value)
+		}
+		*target = parsed
+	}
+	return nil
+}
+
+// Get returns the value of a key as a string
+func (c *Config) Get(key string) string {
+	f, ok := lookupField(key)
+	if !ok {
+		return ""
+	}
+	switch target := f.bind(c).(type) {
+	case *string:
+		return *target
+	case *bool:
+		return strconv.FormatBool(*target)
+	case *int:
+		return strconv.Itoa(*target)
+	}
+	return ""
+}
+
+// Load builds the configuration from defaults, the config file and the
+// environment, and validates it. Database overrides are applied by a Store.
+func Load() (*Config, error) {
+	cfg := &Config{}
+	for _, f := range fields {
+		if err := cfg.set(f, f.fallback); err != nil {
+			return nil, err
+		}
+	}
+
+	fileValues, err := readFile()
+	if err != nil {
+		return nil, err
+	}
+	if err := cfg.apply(fileValues, false); err != nil {
+		return nil, err
+	}
+
+	envValues := make(map[string]string)
+	for _, f := range fields {
+		if value := os.Getenv(f.key); value != "" {
+			envValues[f.key] = value
+		}
+	}
+	// AI_API_URL used to hold the full completions URL
+	if legacy := os.Getenv("AI_API_URL"); legacy != "" && envValues["AI_GATEWAY_URL"] == "" {
+		envValues["AI_GATEWAY_URL"] = strings.TrimSuffix(strings.TrimRight(legacy, "/"), "/chat/completions")
+	}
+	if err := cfg.apply(envValues, false); err != nil {
+		return nil, err
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// MustLoad is Load for command-line tools: it exits on invalid configuration
+func MustLoad() *Config {
+	cfg, err := Load()
+	if err != nil {
+		log.Fatalf("[Config] Invalid configuration: %v", err)
+	}
+	return cfg
+}
+
+// apply sets non-empty values for known keys. With dynamicOnly, keys that
+// may not be changed at runtime are ignored.
+func (c *Config) apply(values map[string]string, dynamicOnly bool) error {
+	for key, value := range values {
+		f, ok := lookupField(key)
+		if !ok || value == "" || (dynamicOnly && !f.dynamic) {
+			continue
+		}
+		if err := c.set(f, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func readFile() (map[string]string, error) {
+	path := os.Getenv("CONFIG_FILE")
+	explicit := path != ""
+	if !explicit {
+		path = "config.json"
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) && !explicit {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("reading config file %s: %v", path, err)
+	}
+
+	var raw map[string]interface{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("parsing config file %s: %v", path, err)
+	}
+	values := make(map[string]string, len(raw))
+	for key, value := range raw {
+		values[key] = fmt.Sprint(value)
+	}
+	return values, nil
+}
+
+// Validate checks that the configuration is usable
+func (c *Config) Validate() error {
+	var problems []string
+
+	if port, err := strconv.Atoi(c.Port); err != nil || port < 1 || port > 65535 {
+		problems = append(problems, fmt.Sprintf("PORT %q is not a valid port", c.Port))
+	}
+	if c.Database.Host == "" || c.Database.User == "" || c.Database.Name == "" {
+		problems = append(problems, "DB_HOST, DB_USER and DB_NAME are required")
+	}
+	if (c.SuperAdmin.Email == "") != (c.SuperAdmin.Password == "") {
+		problems = append(problems, "SUPERADMIN_EMAIL and SUPERADMIN_PASSWORD must be set together")
+	}
+	if c.AI.Provider != "" && c.AI.Provider != "fake" {
+		problems = append(problems, fmt.Sprintf("AI_PROVIDER %q is not supported", c.AI.Provider))
+	}
+	for _, name := range strings.Split(c.AI.NativeProviders, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name != "" && !slices.Contains(nativeProviderNames, name) {
+			problems = append(problems, fmt.Sprintf("AI_NATIVE_PROVIDERS: %q is not one of %s", name, strings.Join(nativeProviderNames, ", ")))
+		}
+	}
+	if _, err := NewSecretBox(c.Secrets); err != nil {
+		problems = append(problems, err.Error())
+	}
+	if c.Billing.PaymentProvider != "" && c.Billing.PaymentProvider != "fake" {
+		problems = append(problems, fmt.Sprintf("PAYMENT_PROVIDER %q is not supported", c.Billing.PaymentProvider))
+	}
+	if c.RAG.Backend != "gemini" && c.RAG.Backend != "pgvector" {
+		problems = append(problems, fmt.Sprintf("RAG_BACKEND %q is not supported", c.RAG.Backend))
+	}
+	switch c.RAG.EmbeddingsProvider {
+	case "openai", "local", "fake":
+	default:
+		problems = append(problems, fmt.Sprintf("RAG_EMBEDDINGS_PROVIDER %q is not supported", c.RAG.EmbeddingsProvider))
+	}
+	if c.RAG.EmbeddingsDimensions < 1 || c.RAG.EmbeddingsDimensions > 16000 {
+		problems = append(problems, "RAG_EMBEDDINGS_DIMENSIONS must be between 1 and 16000")
+	}
+	if c.RAG.ChunkSize < 200 || c.RAG.ChunkOverlap < 0 || c.RAG.ChunkOverlap >= c.RAG.ChunkSize {
+		problems = append(problems, "RAG_CHUNK_SIZE must be at least 200 and RAG_CHUNK_OVERLAP between 0 and the chunk size")
+	}
+	if c.AI.DefaultModel == "" {
+		problems = append(problems, "DEFAULT_ASTRO_MODEL must not be empty")
+	}
+	if c.AI.HealthCheckIntervalMinutes < 0 || c.AI.ModelSyncIntervalHours < 0 {
+		problems = append(problems, "AI_HEALTH_CHECK_INTERVAL_MINUTES and AI_MODEL_SYNC_INTERVAL_HOURS must not be negative")
+	}
+	if c.AI.MaxCompletionTokens < 1 {
+		problems = append(problems, "AI_MAX_COMPLETION_TOKENS must be at least 1")
+	}
+	if c.AI.ResponseCacheMaxEntries < 0 {
+		problems = append(problems, "AI_RESPONSE_CACHE_MAX_ENTRIES must not be negative")
+	}
+	if c.Auth.TokenTTLHours < 1 {
+		problems = append(problems, "AUTH_TOKEN_TTL_HOURS must be at least 1")
+	}
+	if c.Auth.TokenSecret != "" && len(c.Auth.TokenSecret) < 32 {
+		problems = append(problems, "AUTH_TOKEN_SECRET must be at least 32 characters")
+	}
+	if c.AI.HealthCheckConcurrency < 1 || c.AI.HealthCheckFailureThreshold < 1 {
+		problems = append(problems, "AI_HEALTH_CHECK_CONCURRENCY and AI_HEALTH_CHECK_FAILURE_THRESHOLD must be at least 1")
+	}
+
+	urls := map[string]*string{
+		"AI_GATEWAY_URL":     &c.AI.GatewayURL,
+		"OPENAI_BASE_URL":    &c.AI.OpenAIBaseURL,
+		"ANTHROPIC_BASE_URL": &c.AI.AnthropicBaseURL,
+		"GEMINI_BASE_URL":    &c.AI.GeminiBaseURL,
+		"LOCAL_AI_BASE_URL":  &c.AI.LocalBaseURL,
+	}
+	for key, value := range urls {
+		parsed, err := url.Parse(*value)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			problems = append(problems, fmt.Sprintf("%s %q is not an http(s) URL", key, *value))
+			continue
+		}
+		*value = strings.TrimRight(*value, "/")
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("%s", strings.Join(problems, "; "))
+	}
+	return nil
+}
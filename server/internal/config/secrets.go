@@ -0,0 +1,172 @@
+package config
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// sealedPrefix marks an encrypted SystemSetting value:
+// enc:v1:<key id>:<base64(nonce | ciphertext)>
+const sealedPrefix = "enc:v1:"
+
+type SecretsConfig struct {
+	// MasterKey encrypts secret settings at rest: 32 bytes in base64, or a
+	// passphrase of at least 16 characters
+	MasterKey string
+	// PreviousMasterKeys (comma separated) can still decrypt during rotation
+	PreviousMasterKeys string
+}
+
+type secretKey struct {
+	id   string
+	aead cipher.AEAD
+}
+
+// SecretBox encrypts and decrypts secret setting values with AES-256-GCM.
+// Values sealed with a previous master key stay readable until rotated.
+type SecretBox struct {
+	current  secretKey
+	previous []secretKey
+}
+
+func deriveKey(material string) (secretKey, error) {
+	material = strings.TrimSpace(material)
+	raw, err := base64.StdEncoding.DecodeString(material)
+	if err != nil || len(raw) != 32 {
+		if len(material) < 16 {
+			return secretKey{}, fmt.Errorf("master key must be 32 bytes in base64 or at least 16 characters")
+		}
+		sum := sha256.Sum256([]byte(material))
+		raw = sum[:]
+	}
+
+	block, err := aes.NewCipher(raw)
+	if err != nil {
+		return secretKey{}, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return secretKey{}, err
+	}
+	fingerprint := sha256.Sum256(raw)
+	return secretKey{id: hex.EncodeToString(fingerprint[:4]), aead: aead}, nil
+}
+
+// NewSecretBox returns nil when no master key is configured
+func NewSecretBox(cfg SecretsConfig) (*SecretBox, error) {
+	if cfg.MasterKey == "" {
+		return nil, nil
+	}
+	current, err := deriveKey(cfg.MasterKey)
+	if err != nil {
+		return nil, fmt.Errorf("SECRETS_MASTER_KEY: %v", err)
+	}
+	box := &SecretBox{current: current}
+	for _, material := range strings.Split(cfg.PreviousMasterKeys, ",") {
+		if strings.TrimSpace(material) == "" {
+			continue
+		}
+		key, err := deriveKey(material)
+		if err != nil {
+			return nil, fmt.Errorf("SECRETS_PREVIOUS_MASTER_KEYS: %v", err)
+		}
+		box.previous = append(box.previous, key)
+	}
+	return box, nil
+}
+
+// IsSealed reports whether a stored value is encrypted
+func IsSealed(stored string) bool {
+	return strings.HasPrefix(stored, sealedPrefix)
+}
+
+// Seal encrypts a value with the current master key
+func (b *SecretBox) Seal(plaintext string) (string, error) {
+	nonce := make([]byte, b.current.aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+	sealed := b.current.aead.Seal(nonce, nonce, []byte(plaintext), nil)
+	return sealedPrefix + b.current.id + ":" + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Open decrypts a sealed value. Plain values are returned unchanged so that
+// settings written before encryption was enabled keep working.
+func (b *SecretBox) Open(stored string) (string, error) {
+	if !IsSealed(stored) {
+		return stored, nil
+	}
+	id, payload, ok := strings.Cut(strings.TrimPrefix(stored, sealedPrefix), ":")
+	if !ok {
+		return "", fmt.Errorf("malformed encrypted value")
+	}
+	if b == nil {
+		return "", fmt.Errorf("value is encrypted but SECRETS_MASTER_KEY is not set")
+	}
+
+	key, found := b.keyByID(id)
+	if !found {
+		return "", fmt.Errorf("value was encrypted with an unknown master key %s", id)
+	}
+	data, err := base64.StdEncoding.DecodeString(payload)
+	if err != nil || len(data) < key.aead.NonceSize() {
+		return "", fmt.Errorf("malformed encrypted value")
+	}
+	nonceSize := key.aead.NonceSize()
+	plaintext, err := key.aead.Open(nil, data[:nonceSize], data[nonceSize:], nil)
+	if err != nil {
+		return "", fmt.Errorf("cannot decrypt value: %v", err)
+	}
+	return string(plaintext), nil
+}
+
+func (b *SecretBox) keyByID(id string) (secretKey, bool) {
+	if b.current.id == id {
+		return b.current, true
+	}
+	for _, key := range b.previous {
+		if key.id == id {
+			return key, true
+		}
+	}
+	return secretKey{}, false
+}
+
+// NeedsRotation reports whether a stored value is plaintext or sealed with
+// an older master key
+func (b *SecretBox) NeedsRotation(stored string) bool {
+	if stored == "" {
+		return false
+	}
+	return !strings.HasPrefix(stored, sealedPrefix+b.current.id+":")
+}
+
+// KeyID identifies the current master key without revealing it
+func (b *SecretBox) KeyID() string {
+	return b.current.id
+}
+
+// Mask hides a secret for display, keeping the last four characters of long
+// values so admins can tell keys apart
+func Mask(secret string) string {
+	if secret == "" {
+		return ""
+	}
+	if len(secret) <= 8 {
+		return strings.Repeat("*", 8)
+	}
+	return strings.Repeat("*", 8) + secret[len(secret)-4:]
+}
+
+// IsMasked reports whether a value submitted by the UI is a mask echoed back
+// rather than a new secret
+func IsMasked(value string) bool {
+	return strings.HasPrefix(value, "********")
+}
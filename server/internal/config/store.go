@@ -0,0 +1,220 @@
+package config
+
+import (
+	"fmt"
+	"log"
+	"rag-agent-server/internal/models"
+	"sort"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// OverrideSource returns runtime overrides keyed by configuration key
+type OverrideSource func() (map[string]string, error)
+
+// SystemSettingSource reads overrides from the system_settings table,
+// decrypting secret values. A secret that cannot be decrypted is skipped so
+// that one bad row does not block every other setting.
+func SystemSettingSource(db *gorm.DB, box *SecretBox) OverrideSource {
+	return func() (map[string]string, error) {
+		var settings []models.SystemSetting
+		if err := db.Find(&settings).Error; err != nil {
+			return nil, err
+		}
+		values := make(map[string]string, len(settings))
+		for _, s := range settings {
+			value, err := box.Open(s.Value)
+			if err != nil {
+				log.Printf("[Config] Ignoring setting %s: %v", s.Key, err)
+				continue
+			}
+			values[s.Key] = value
+		}
+		return values, nil
+	}
+}
+
+// Store holds the current configuration and swaps it atomically on reload.
+// Handlers and services keep a *Store and call Get for every use, so they
+// always see the latest dynamic settings.
+type Store struct {
+	base    *Config
+	secrets *SecretBox
+	source  OverrideSource
+
+	mu      sync.RWMutex
+	current *Config
+}
+
+func NewStore(base *Config) *Store {
+	current := *base
+	// The master key was validated by Load
+	secrets, _ := NewSecretBox(base.Secrets)
+	return &Store{base: base, secrets: secrets, current: &current}
+}
+
+// Secrets returns the box used to encrypt secret settings, or nil when no
+// master key is configured
+func (s *Store) Secrets() *SecretBox {
+	return s.secrets
+}
+
+// EncodeSetting prepares a value for storage in SystemSetting: secrets are
+// encrypted, everything else is stored as is. Without a master key secrets
+// are stored in plaintext too; RotateSecrets encrypts them once one is set.
+func (s *Store) EncodeSetting(key, value string) (string, error) {
+	if value == "" || !IsSecret(key) || s.secrets == nil {
+		return value, nil
+	}
+	return s.secrets.Seal(value)
+}
+
+// Get returns the current configuration. Callers must not modify it.
+func (s *Store) Get() *Config {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.current
+}
+
+// UseOverrides sets the source of dynamic overrides and loads them
+func (s *Store) UseOverrides(source OverrideSource) error {
+	s.source = source
+	return s.Reload()
+}
+
+// build layers overrides on top of the static configuration
+func (s *Store) build(extra map[string]string) (*Config, error) {
+	next := *s.base
+	if s.source != nil {
+		overrides, err := s.source()
+		if err != nil {
+			return nil, err
+		}
+		next.applyStored(overrides)
+	}
+	if err := next.apply(extra, true); err != nil {
+		return nil, err
+	}
+	if err := next.Validate(); err != nil {
+		return nil, err
+	}
+	return &next, nil
+}
+
+// applyStored layers stored settings one key at a time. A row whose value
+// is invalid, alone or together with the rest, is logged and skipped, so the
+// key keeps its env or default value instead of failing the whole load.
+func (c *Config) applyStored(values map[string]string) {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		f, ok := lookupField(key)
+		if !ok || values[key] == "" || !f.dynamic {
+			continue
+		}
+		candidate := *c
+		err := candidate.set(f, values[key])
+		if err == nil {
+			err = candidate.Validate()
+		}
+		if err != nil {
+			log.Printf("[Config] Ignoring setting %s: %v", key, err)
+			continue
+		}
+		*c = candidate
+	}
+}
+
+// Reload re-reads the overrides. An invalid result is rejected and the
+// previous configuration stays in effect.
+func (s *Store) Reload() error {
+	next, err := s.build(nil)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	s.current = next
+	s.mu.Unlock()
+	return nil
+}
+
+// Check validates the configuration that would result from applying the
+// given overrides, without applying them
+func (s *Store) Check(overrides map[string]string) error {
+	_, err := s.build(overrides)
+	return err
+}
+
+// Watch reloads the overrides periodically so that changes made by other
+// server instances are picked up. It returns a function that stops watching.
+func (s *Store) Watch(interval time.Duration) func() {
+	stop := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := s.Reload(); err != nil {
+					log.Printf("[Config] Reload failed, keeping previous settings: %v", err)
+				}
+			case <-stop:
+				return
+			}
+		}
+	}()
+	return func() { close(stop) }
+}
+
+// RotateSecrets re-encrypts every stored secret that is still plaintext or
+// sealed with a previous master key, recording an audit entry for each.
+// It returns how many settings were rewritten.
+func RotateSecrets(db *gorm.DB, box *SecretBox, actorID uint) (int, error) {
+	if box == nil {
+		return 0, fmt.Errorf("SECRETS_MASTER_KEY is not set")
+	}
+
+	var settings []models.SystemSetting
+	if err := db.Where("key IN ?", SecretSettingKeys()).Find(&settings).Error; err != nil {
+		return 0, err
+	}
+
+	rotated := 0
+	for _, setting := range settings {
+		if !box.NeedsRotation(setting.Value) {
+			continue
+		}
+		plaintext, err := box.Open(setting.Value)
+		if err != nil {
+			return rotated, fmt.Errorf("%s: %v", setting.Key, err)
+		}
+		sealed, err := box.Seal(plaintext)
+		if err != nil {
+			return rotated, err
+		}
+
+		err = db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Model(&setting).Update("value", sealed).Error; err != nil {
+				return err
+			}
+			return tx.Create(&models.SettingAudit{
+				Key:      setting.Key,
+				Action:   models.SettingAuditRotate,
+				ActorID:  actorID,
+				OldValue: Mask(plaintext),
+				NewValue: Mask(plaintext),
+			}).Error
+		})
+		if err != nil {
+			return rotated, err
+		}
+		rotated++
+	}
+	return rotated, nil
+}
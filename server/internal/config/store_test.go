@@ -0,0 +1,86 @@
+package config
+
+import (
+	"errors"
+	"testing"
+)
+
+func testStore(t *testing.T, stored map[string]string) *Store {
+	t.Helper()
+	t.Setenv("CONFIG_FILE", "")
+	base, err := Load()
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	store := NewStore(base)
+	if err := store.UseOverrides(func() (map[string]string, error) { return stored, nil }); err != nil {
+		t.Fatalf("UseOverrides: %v", err)
+	}
+	return store
+}
+
+func TestStoredSettingsOverrideDefaults(t *testing.T) {
+	store := testStore(t, map[string]string{
+		"AI_MAX_COMPLETION_TOKENS": "2048",
+		"LOCAL_AI_BASE_URL":        "http://ollama:11434/v1/",
+		// Not dynamic, so the stored row is ignored
+		"PORT": "9999",
+	})
+
+	cfg := store.Get()
+	if cfg.AI.MaxCompletionTokens != 2048 {
+		t.Errorf("MaxCompletionTokens = %d, want 2048", cfg.AI.MaxCompletionTokens)
+	}
+	if cfg.AI.LocalBaseURL != "http://ollama:11434/v1" {
+		t.Errorf("LocalBaseURL = %q", cfg.AI.LocalBaseURL)
+	}
+	if cfg.Port != "8081" {
+		t.Errorf("Port = %q, want the default", cfg.Port)
+	}
+}
+
+func TestInvalidStoredSettingFallsBack(t *testing.T) {
+	store := testStore(t, map[string]string{
+		"AI_MAX_COMPLETION_TOKENS":    "lots",
+		"AI_HEALTH_CHECK_CONCURRENCY": "0",
+		"OPENAI_BASE_URL":             "not a url",
+		"RAG_CHUNK_SIZE":              "800",
+	})
+
+	cfg := store.Get()
+	if cfg.AI.MaxCompletionTokens != 4096 {
+		t.Errorf("MaxCompletionTokens = %d, want the default", cfg.AI.MaxCompletionTokens)
+	}
+	if cfg.AI.HealthCheckConcurrency != 4 {
+		t.Errorf("HealthCheckConcurrency = %d, want the default", cfg.AI.HealthCheckConcurrency)
+	}
+	if cfg.AI.OpenAIBaseURL != "https://api.openai.com/v1" {
+		t.Errorf("OpenAIBaseURL = %q, want the default", cfg.AI.OpenAIBaseURL)
+	}
+	if cfg.RAG.ChunkSize != 800 {
+		t.Errorf("valid settings must still apply, ChunkSize = %d", cfg.RAG.ChunkSize)
+	}
+}
+
+func TestUnreadableSettingsFail(t *testing.T) {
+	t.Setenv("CONFIG_FILE", "")
+	base, err := Load()
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	store := NewStore(base)
+	failure := errors.New("database is down")
+	if err := store.UseOverrides(func() (map[string]string, error) { return nil, failure }); !errors.Is(err, failure) {
+		t.Errorf("err = %v, want %v", err, failure)
+	}
+}
+
+func TestCheckRejectsInvalidUpdates(t *testing.T) {
+	store := testStore(t, nil)
+	if err := store.Check(map[string]string{"AI_MAX_COMPLETION_TOKENS": "0"}); err == nil {
+		t.Error("expected Check to reject an invalid value")
+	}
+	if err := store.Check(map[string]string{"AI_MAX_COMPLETION_TOKENS": "1024"}); err != nil {
+		t.Errorf("Check: %v", err)
+	}
+}
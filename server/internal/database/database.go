@@ -1,9 +1,8 @@
 package database
 
 import (
-	"fmt"
 	"log"
-	"os"
+	"rag-agent-server/internal/config"
 	"rag-agent-server/internal/models"
 
 	"golang.org/x/crypto/bcrypt"
@@ -13,21 +12,10 @@ import (
 
 var DB *gorm.DB
 
-func Connect() {
+func Connect(cfg *config.Config) {
 	var err error
 
-	// Get database connection parameters from environment variables
-	dbHost := getEnv("DB_HOST", "localhost")
-	dbPort := getEnv("DB_PORT", "5435")
-	dbUser := getEnv("DB_USER", "raguser")
-	dbPassword := getEnv("DB_PASSWORD", "ragpassword")
-	dbName := getEnv("DB_NAME", "ragdb")
-
-	// Build PostgreSQL DSN
-	dsn := fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=disable",
-		dbHost, dbPort, dbUser, dbPassword, dbName)
-
-	DB, err = gorm.Open(postgres.Open(dsn), &gorm.Config{})
+	DB, err = gorm.Open(postgres.Open(cfg.Database.DSN()), &gorm.Config{})
 	if err != nil {
 		log.Fatal("Failed to connect to database:", err)
 	}
@@ -35,24 +23,41 @@ func Connect() {
 	log.Println("Connected to Database")
 
 	// Auto Migrate
-	err = DB.AutoMigrate(&models.User{}, &models.Friend{}, &models.Message{}, &models.Block{}, &models.Room{}, &models.RoomMember{}, &models.AiModel{}, &models.Media{}, &models.SystemSetting{}, &models.DatingFavorite{}, &models.DatingCompatibility{})
+	err = DB.AutoMigrate(&models.User{}, &models.Friend{}, &models.Message{}, &models.Block{}, &models.Room{}, &models.RoomMember{}, &models.AiModel{}, &models.Media{}, &models.SystemSetting{}, &models.DatingFavorite{}, &models.DatingCompatibility{}, &models.ScheduledMessage{}, &models.Report{}, &models.RoomInvite{}, &models.RoomJoinRequest{}, &models.RoomAiSettings{}, &models.RoomContextSummary{}, &models.SettingAudit{}, &models.AiUsage{}, &models.AiPlanQuota{}, &models.Plan{}, &models.PlanPrice{}, &models.Subscription{}, &models.Checkout{}, &models.PaymentEvent{}, &models.AiModelHealthCheck{}, &models.ModelSyncLog{}, &models.AiFeatureModel{}, &models.PromptTemplate{}, &models.KnowledgeDocument{})
 	if err != nil {
 		log.Fatal("Failed to migrate database:", err)
 	}
 	log.Println("Database Migrated")
-	InitializeSuperAdmin()
+	migrateRoomOwners()
+	InitializeSuperAdmin(cfg.SuperAdmin)
+}
+
+// migrateRoomOwners upgrades room creators, who used to be stored as plain
+// admins, to the owner role.
+func migrateRoomOwners() {
+	result := DB.Exec(`UPDATE room_members SET role = 'owner'
+		FROM rooms
+		WHERE rooms.id = room_members.room_id
+		AND rooms.owner_id = room_members.user_id
+		AND room_members.role = 'admin'
+		AND room_members.deleted_at IS NULL`)
+	if result.Error != nil {
+		log.Printf("[DB] Failed to migrate room owners: %v", result.Error)
+	} else if result.RowsAffected > 0 {
+		log.Printf("[DB] Upgraded %d room creators to owner role", result.RowsAffected)
+	}
 }
 
-func InitializeSuperAdmin() {
-	email := os.Getenv("SUPERADMIN_EMAIL")
-	password := os.Getenv("SUPERADMIN_PASSWORD")
+func InitializeSuperAdmin(superAdmin config.SuperAdminConfig) {
+	email := superAdmin.Email
+	password := superAdmin.Password
 
 	if email == "" || password == "" {
-		log.Println("[AUTH] Superadmin credentials not set in environment, skipping initialization")
+		log.Println("[AUTH] Superadmin credentials not configured, skipping initialization")
 		return
 	}
 
-	log.Printf("[AUTH] Attempting to initialize superadmin from environment: %s", email)
+	log.Printf("[AUTH] Attempting to initialize superadmin from configuration: %s", email)
 
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
 	if err != nil {
@@ -89,10 +94,3 @@ func InitializeSuperAdmin() {
 		log.Printf("[AUTH] Superadmin %s created successfully", email)
 	}
 }
-
-func getEnv(key, defaultValue string) string {
-	if value := os.Getenv(key); value != "" {
-		return value
-	}
-	return defaultValue
-}
@@ -1,19 +1,28 @@
 package handlers
 
 import (
-	"os"
+	"errors"
+	"fmt"
+	"log"
+	"rag-agent-server/internal/config"
 	"rag-agent-server/internal/database"
 	"rag-agent-server/internal/models"
+	"rag-agent-server/internal/services"
+	"sort"
 	"strings"
 
 	"github.com/gofiber/fiber/v2"
 	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
 )
 
-type AdminHandler struct{}
+type AdminHandler struct {
+	cfg        *config.Store
+	ragService *services.RAGService
+}
 
-func NewAdminHandler() *AdminHandler {
-	return &AdminHandler{}
+func NewAdminHandler(cfg *config.Store, ragService *services.RAGService) *AdminHandler {
+	return &AdminHandler{cfg: cfg, ragService: ragService}
 }
 
 func (h *AdminHandler) GetUsers(c *fiber.Ctx) error {
@@ -192,6 +201,9 @@ func (h *AdminHandler) FlagDatingProfile(c *fiber.Ctx) error {
 
 // System Settings
 
+// GetSystemSettings returns stored settings. Secrets are always masked; the
+// effective value of every secret is included even when it only comes from
+// the environment, so the UI can show whether it is configured.
 func (h *AdminHandler) GetSystemSettings(c *fiber.Ctx) error {
 	var settings []models.SystemSetting
 	if err := database.DB.Find(&settings).Error; err != nil {
@@ -200,34 +212,172 @@ func (h *AdminHandler) GetSystemSettings(c *fiber.Ctx) error {
 
 	settingsMap := make(map[string]string)
 	for _, s := range settings {
-		settingsMap[s.Key] = s.Value
+		// Rows for keys that are no longer dynamic have no effect
+		if config.IsDynamic(s.Key) && !config.IsSecret(s.Key) {
+			settingsMap[s.Key] = s.Value
+		}
 	}
 
-	// Always ensure API_OPEN_AI is present for the UI even if only in env
-	if _, ok := settingsMap["API_OPEN_AI"]; !ok {
-		settingsMap["API_OPEN_AI"] = strings.Repeat("*", len(os.Getenv("API_OPEN_AI")))
+	cfg := h.cfg.Get()
+	for _, key := range config.SecretSettingKeys() {
+		settingsMap[key] = config.Mask(cfg.Get(key))
 	}
 
 	return c.JSON(settingsMap)
 }
 
+// settingAuditValue is how a value appears in the audit log
+func settingAuditValue(key, value string) string {
+	if config.IsSecret(key) {
+		return config.Mask(value)
+	}
+	return value
+}
+
+// UpdateSystemSettings stores settings and applies them immediately. Only
+// dynamic keys are accepted. Secrets are write-only: a masked value sent back
+// by the UI leaves the secret unchanged, an empty value removes the override.
+// Without SECRETS_MASTER_KEY secrets are saved unencrypted and the response
+// carries a warning.
 func (h *AdminHandler) UpdateSystemSettings(c *fiber.Ctx) error {
-	var updates map[string]string
-	if err := c.BodyParser(&updates); err != nil {
+	var body map[string]string
+	if err := c.BodyParser(&body); err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Cannot parse JSON"})
 	}
 
+	updates := make(map[string]string)
+	var unencrypted []string
+	for k, v := range body {
+		if !config.IsDynamic(k) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": fmt.Sprintf("%s cannot be changed from the admin panel", k)})
+		}
+		if config.IsSecret(k) && config.IsMasked(v) {
+			continue
+		}
+		if config.IsSecret(k) && v != "" && h.cfg.Secrets() == nil {
+			unencrypted = append(unencrypted, k)
+		}
+		updates[k] = v
+	}
+
+	// Reject values that would leave the server misconfigured
+	if err := h.cfg.Check(updates); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	// Encrypt everything up front so a failure saves nothing
+	encoded := make(map[string]string, len(updates))
 	for k, v := range updates {
+		stored, err := h.cfg.EncodeSetting(k, v)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		}
+		encoded[k] = stored
+	}
+
+	actorID := requesterID(c)
+	for k, v := range updates {
+		stored := encoded[k]
+
 		var setting models.SystemSetting
-		database.DB.Where("key = ?", k).FirstOrCreate(&setting, models.SystemSetting{Key: k})
-		setting.Value = v
-		database.DB.Save(&setting)
+		exists := database.DB.Where("key = ?", k).First(&setting).Error == nil
+
+		audit := models.SettingAudit{Key: k, ActorID: actorID, NewValue: settingAuditValue(k, v), IP: c.IP()}
+		if exists {
+			old, err := h.cfg.Secrets().Open(setting.Value)
+			if err != nil {
+				old = ""
+			}
+			if old == v {
+				continue
+			}
+			audit.OldValue = settingAuditValue(k, old)
+		}
 
-		// Special case: update env for current session if it's API_OPEN_AI
-		if k == "API_OPEN_AI" && v != "" {
-			os.Setenv("API_OPEN_AI", v)
+		err := database.DB.Transaction(func(tx *gorm.DB) error {
+			switch {
+			case v == "" && exists:
+				audit.Action = models.SettingAuditDelete
+				if err := tx.Unscoped().Delete(&setting).Error; err != nil {
+					return err
+				}
+			case exists:
+				audit.Action = models.SettingAuditUpdate
+				if err := tx.Model(&setting).Update("value", stored).Error; err != nil {
+					return err
+				}
+			case v == "":
+				return nil
+			default:
+				audit.Action = models.SettingAuditCreate
+				if err := tx.Create(&models.SystemSetting{Key: k, Value: stored}).Error; err != nil {
+					return err
+				}
+			}
+			return tx.Create(&audit).Error
+		})
+		if err != nil {
+			log.Printf("[Settings] Failed to save %s: %v", k, err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not save settings"})
 		}
 	}
 
+	// Apply the new values without a restart
+	if err := h.cfg.Reload(); err != nil {
+		log.Printf("[Config] Reload after settings update failed: %v", err)
+	}
+
+	if len(unencrypted) > 0 {
+		sort.Strings(unencrypted)
+		log.Printf("[Settings] SECRETS_MASTER_KEY is not set, stored %s unencrypted", strings.Join(unencrypted, ", "))
+		return c.JSON(fiber.Map{
+			"message": "Settings updated",
+			"warning": "SECRETS_MASTER_KEY is not set, so " + strings.Join(unencrypted, ", ") + " were stored unencrypted. They will be encrypted once a master key is configured.",
+		})
+	}
 	return c.JSON(fiber.Map{"message": "Settings updated"})
 }
+
+// RotateSecrets re-encrypts stored secrets with the current master key.
+// Run it after moving the old key to SECRETS_PREVIOUS_MASTER_KEYS.
+func (h *AdminHandler) RotateSecrets(c *fiber.Ctx) error {
+	rotated, err := config.RotateSecrets(database.DB, h.cfg.Secrets(), requesterID(c))
+	if err != nil {
+		log.Printf("[Settings] Secret rotation failed after %d settings: %v", rotated, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   err.Error(),
+			"rotated": rotated,
+		})
+	}
+	return c.JSON(fiber.Map{
+		"rotated": rotated,
+		"keyId":   h.cfg.Secrets().KeyID(),
+	})
+}
+
+// GetSettingAudit lists setting changes, newest first. Optional ?key= filter.
+func (h *AdminHandler) GetSettingAudit(c *fiber.Ctx) error {
+	query := database.DB.Order("created_at desc").Limit(200)
+	if key := c.Query("key"); key != "" {
+		query = query.Where("key = ?", key)
+	}
+
+	audit := []models.SettingAudit{}
+	if err := query.Find(&audit).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not fetch audit log"})
+	}
+	return c.JSON(audit)
+}
+
+// ReindexProfiles uploads every completed profile to the RAG backend again,
+// e.g. after switching backends or to add metadata older uploads lack
+func (h *AdminHandler) ReindexProfiles(c *fiber.Ctx) error {
+	queued, err := h.ragService.ReindexProfiles()
+	if errors.Is(err, services.ErrReindexRunning) {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to queue profiles"})
+	}
+	return c.Status(fiber.StatusAccepted).JSON(fiber.Map{"queued": queued})
+}
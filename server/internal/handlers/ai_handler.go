@@ -1,103 +1,64 @@
 package handlers
 
 import (
-	"bytes"
-	"encoding/json"
-	"io"
-	"log"
-	"net/http"
-	"os"
 	"rag-agent-server/internal/database"
 	"rag-agent-server/internal/models"
-	"sync"
+	"rag-agent-server/internal/services"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
 )
 
-type AiHandler struct{}
-
-func NewAiHandler() *AiHandler {
-	return &AiHandler{}
-}
-
-type ExternalModel struct {
-	ID       string `json:"id"`
-	Provider string `json:"provider"`
-	Category string `json:"category"`
-	Created  int64  `json:"created"`
+type AiHandler struct {
+	aiService *services.AiChatService
+	health    *services.ModelHealthChecker
+	sync      *services.ModelSyncService
 }
 
-type ExternalModelsResponse struct {
-	Data []ExternalModel `json:"data"`
+func NewAiHandler(aiService *services.AiChatService, health *services.ModelHealthChecker, sync *services.ModelSyncService) *AiHandler {
+	return &AiHandler{aiService: aiService, health: health, sync: sync}
 }
 
-// SyncModels syncs models from external API to local database
+// SyncModels syncs models from the gateway's catalogue. With ?dryRun=true it
+// only previews what would change.
 func (h *AiHandler) SyncModels(c *fiber.Ctx) error {
-	apiKey := os.Getenv("API_OPEN_AI")
-	if apiKey == "" {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "API_OPEN_AI key not set"})
-	}
-
-	url := "https://rvlautoai.ru/webhook/v1/models"
-	req, err := http.NewRequest("GET", url, nil)
+	dryRun := c.QueryBool("dryRun")
+	result, err := h.sync.Sync(c.Context(), services.ModelSyncManual, dryRun)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to create request"})
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{"error": err.Error()})
 	}
-	req.Header.Set("Authorization", "Bearer "+apiKey)
 
-	client := &http.Client{Timeout: 10 * time.Second}
-	resp, err := client.Do(req)
-	if err != nil {
-		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{"error": "Failed to fetch models from API"})
-	}
-	defer resp.Body.Close()
-
-	var apiResp ExternalModelsResponse
-	if err := json.NewDecoder(resp.Body).Decode(&apiResp); err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to decode API response"})
-	}
-
-	now := time.Now()
-	newCount := 0
-	updatedCount := 0
-
-	for _, m := range apiResp.Data {
-		var existing models.AiModel
-		result := database.DB.Where("model_id = ?", m.ID).First(&existing)
-
-		if result.Error != nil {
-			// New model
-			newModel := models.AiModel{
-				ModelID:      m.ID,
-				Name:         m.ID, // Or derive name if possible
-				Provider:     m.Provider,
-				Category:     m.Category,
-				IsEnabled:    false, // Disabled by default until admin reviews? Or enabled? User said "add/remove", maybe disabled by default if new.
-				IsNew:        true,
-				IsRagEnabled: false,
-				LastSyncDate: now,
-			}
-			database.DB.Create(&newModel)
-			newCount++
-		} else {
-			// Update existing
-			existing.Provider = m.Provider
-			existing.Category = m.Category
-			existing.LastSyncDate = now
-			database.DB.Save(&existing)
-			updatedCount++
-		}
+	message := "Synchronization complete"
+	if dryRun {
+		message = "Dry run, nothing was changed"
 	}
-
 	return c.JSON(fiber.Map{
-		"message":       "Synchronization complete",
-		"newModels":     newCount,
-		"updatedModels": updatedCount,
-		"syncDate":      now,
+		"message":          message,
+		"dryRun":           dryRun,
+		"newModels":        result.Count(models.ModelChangeAdded),
+		"updatedModels":    result.Count(models.ModelChangeUpdated),
+		"deprecatedModels": result.Count(models.ModelChangeDeprecated),
+		"restoredModels":   result.Count(models.ModelChangeRestored),
+		"changes":          result.Changes,
+		"syncDate":         result.SyncDate,
 	})
 }
 
+// GetSyncLogs returns the most recent catalogue syncs (?limit=, default 50)
+func (h *AiHandler) GetSyncLogs(c *fiber.Ctx) error {
+	limit := c.QueryInt("limit", 50)
+	if limit < 1 || limit > 500 {
+		limit = 50
+	}
+	logs := []models.ModelSyncLog{}
+	if err := database.DB.Order("created_at desc").Limit(limit).Find(&logs).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch sync logs"})
+	}
+	return c.JSON(logs)
+}
+
 // GetAdminModels returns all models for admin panel
 func (h *AiHandler) GetAdminModels(c *fiber.Ctx) error {
 	var aiModels []models.AiModel
@@ -113,6 +74,11 @@ func (h *AiHandler) GetAdminModels(c *fiber.Ctx) error {
 		query = query.Where("model_id LIKE ? OR name LIKE ?", "%"+search+"%", "%"+search+"%")
 	}
 
+	// Deprecated models are hidden unless asked for
+	if !c.QueryBool("includeDeprecated") {
+		query = query.Where("is_deprecated = ?", false)
+	}
+
 	if err := query.Find(&aiModels).Error; err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch models"})
 	}
@@ -120,10 +86,85 @@ func (h *AiHandler) GetAdminModels(c *fiber.Ctx) error {
 	return c.JSON(aiModels)
 }
 
+// GetCircuitStatus returns the circuit breaker state of every model the
+// server has called since it started
+func (h *AiHandler) GetCircuitStatus(c *fiber.Ctx) error {
+	circuits := h.aiService.CircuitStatus()
+	sort.Slice(circuits, func(i, j int) bool { return circuits[i].ModelID < circuits[j].ModelID })
+	return c.JSON(circuits)
+}
+
+// GetCacheStats returns the response cache hit, miss and deduplication
+// counters per feature
+func (h *AiHandler) GetCacheStats(c *fiber.Ctx) error {
+	return c.JSON(h.aiService.CacheReport())
+}
+
+// ClearCache drops every cached AI response, e.g. after a prompt was fixed
+func (h *AiHandler) ClearCache(c *fiber.Ctx) error {
+	return c.JSON(fiber.Map{"cleared": h.aiService.ClearCache()})
+}
+
+// GetFeatureModels lists the model assignment of every AI feature
+func (h *AiHandler) GetFeatureModels(c *fiber.Ctx) error {
+	assignments := make([]services.FeatureModels, 0, len(services.AiFeatures))
+	for _, feature := range services.AiFeatures {
+		assignments = append(assignments, h.aiService.FeatureModels(feature))
+	}
+	return c.JSON(assignments)
+}
+
+// UpdateFeatureModels assigns a primary model and ordered fallbacks to a
+// feature. An empty primary model and fallback list restores the defaults.
+func (h *AiHandler) UpdateFeatureModels(c *fiber.Ctx) error {
+	feature := c.Params("feature")
+	if !services.IsAiFeature(feature) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Unknown feature"})
+	}
+
+	var body struct {
+		PrimaryModelID   string   `json:"primaryModelId"`
+		FallbackModelIDs []string `json:"fallbackModelIds"`
+	}
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+
+	body.PrimaryModelID = strings.TrimSpace(body.PrimaryModelID)
+	fallbacks := services.SplitModelList(strings.Join(body.FallbackModelIDs, ","))
+	if body.PrimaryModelID == "" && len(fallbacks) == 0 {
+		database.DB.Unscoped().Where("feature = ?", feature).Delete(&models.AiFeatureModel{})
+		return c.JSON(h.aiService.FeatureModels(feature))
+	}
+
+	ids := fallbacks
+	if body.PrimaryModelID != "" {
+		ids = append([]string{body.PrimaryModelID}, fallbacks...)
+	}
+	for _, id := range ids {
+		var aiModel models.AiModel
+		if err := database.DB.Where("model_id = ? AND is_deprecated = ?", id, false).First(&aiModel).Error; err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Unknown model: " + id})
+		}
+		if aiModel.Category != "" && aiModel.Category != "text" {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Only text models can be assigned: " + id})
+		}
+	}
+
+	assignment := models.AiFeatureModel{Feature: feature}
+	database.DB.Where("feature = ?", feature).First(&assignment)
+	assignment.PrimaryModelID = body.PrimaryModelID
+	assignment.FallbackModelIDs = strings.Join(fallbacks, ",")
+	if err := database.DB.Save(&assignment).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to save assignment"})
+	}
+	return c.JSON(h.aiService.FeatureModels(feature))
+}
+
 // GetClientModels returns only enabled models for mobile client
 func (h *AiHandler) GetClientModels(c *fiber.Ctx) error {
 	var aiModels []models.AiModel
-	if err := database.DB.Where("is_enabled = ?", true).Find(&aiModels).Error; err != nil {
+	if err := database.DB.Where("is_enabled = ? AND is_deprecated = ?", true, false).Find(&aiModels).Error; err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch models"})
 	}
 
@@ -144,6 +185,9 @@ func (h *AiHandler) UpdateModel(c *fiber.Ctx) error {
 		IsNew         *bool  `json:"isNew"`
 		IsRecommended *bool  `json:"isRecommended"`
 		IsRagEnabled  *bool  `json:"isRagEnabled"`
+		// Prices in USD per 1000 tokens for usage cost estimates
+		InputPricePer1K  *float64 `json:"inputPricePer1k"`
+		OutputPricePer1K *float64 `json:"outputPricePer1k"`
 	}
 
 	if err := c.BodyParser(&body); err != nil {
@@ -156,7 +200,9 @@ func (h *AiHandler) UpdateModel(c *fiber.Ctx) error {
 	}
 
 	if body.IsEnabled != nil {
+		// An admin decision overrides the health checker's
 		aiModel.IsEnabled = *body.IsEnabled
+		aiModel.AutoDisabled = false
 	}
 	if body.Name != "" {
 		aiModel.Name = body.Name
@@ -170,6 +216,18 @@ func (h *AiHandler) UpdateModel(c *fiber.Ctx) error {
 	if body.IsRagEnabled != nil {
 		aiModel.IsRagEnabled = *body.IsRagEnabled
 	}
+	if body.InputPricePer1K != nil {
+		if *body.InputPricePer1K < 0 {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Prices must not be negative"})
+		}
+		aiModel.InputPricePer1K = *body.InputPricePer1K
+	}
+	if body.OutputPricePer1K != nil {
+		if *body.OutputPricePer1K < 0 {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Prices must not be negative"})
+		}
+		aiModel.OutputPricePer1K = *body.OutputPricePer1K
+	}
 
 	if err := database.DB.Save(&aiModel).Error; err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update model"})
@@ -195,148 +253,78 @@ func (h *AiHandler) TestModel(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Model not found"})
 	}
 
-	apiKey := os.Getenv("API_OPEN_AI")
-	if apiKey == "" {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "API_OPEN_AI key not set"})
-	}
+	result := h.health.Check(c.Context(), aiModel, services.HealthCheckManual)
+	database.DB.First(&aiModel, aiModel.ID)
 
-	// Prepare a simple chat completion request
-	testURL := "https://rvlautoai.ru/webhook/v1/chat/completions"
-	testBody := map[string]interface{}{
-		"model":    aiModel.ModelID,
-		"provider": aiModel.Provider,
-		"messages": []map[string]string{
-			{"role": "user", "content": "hi"},
-		},
-		"max_tokens": 5,
-	}
+	return c.JSON(fiber.Map{
+		"status":       result.Status,
+		"responseTime": result.ResponseTime,
+		"error":        result.Error,
+		"model":        aiModel,
+	})
+}
 
-	jsonBody, _ := json.Marshal(testBody)
-	req, _ := http.NewRequest("POST", testURL, bytes.NewBuffer(jsonBody))
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+apiKey)
+// BulkTestModels tests all enabled models, a few at a time
+func (h *AiHandler) BulkTestModels(c *fiber.Ctx) error {
+	results := h.health.RunOnce(c.Context(), services.HealthCheckManual)
 
-	start := time.Now()
-	client := &http.Client{Timeout: 30 * time.Second}
-	resp, err := client.Do(req)
-	duration := time.Since(start).Milliseconds()
+	return c.JSON(fiber.Map{
+		"tested":  len(results),
+		"results": results,
+	})
+}
 
-	status := "online"
+// GetModelsHealth returns probe statistics of every model over the last
+// ?hours= hours (default 24)
+func (h *AiHandler) GetModelsHealth(c *fiber.Ctx) error {
+	hours := c.QueryInt("hours", 24)
+	if hours < 1 {
+		hours = 24
+	}
+	stats, err := services.ModelLatencyStats(time.Now().Add(-time.Duration(hours)*time.Hour), "")
 	if err != nil {
-		log.Printf("Test error for model %s: %v", aiModel.ModelID, err)
-		status = "offline"
-	} else if resp.StatusCode != http.StatusOK {
-		respBody, _ := io.ReadAll(resp.Body)
-		log.Printf("Test failed with status %d for model %s: %s", resp.StatusCode, aiModel.ModelID, string(respBody))
-		status = "error"
-		resp.Body.Close()
-	} else {
-		resp.Body.Close()
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch health statistics"})
 	}
-
-	aiModel.LastTestStatus = status
-	aiModel.LastResponseTime = duration
-	database.DB.Save(&aiModel)
-
-	return c.JSON(fiber.Map{
-		"status":       status,
-		"responseTime": duration,
-		"model":        aiModel,
-	})
+	return c.JSON(fiber.Map{"hours": hours, "models": stats})
 }
 
-// BulkTestModels tests all enabled models in parallel
-func (h *AiHandler) BulkTestModels(c *fiber.Ctx) error {
-	var aiModels []models.AiModel
-	if err := database.DB.Where("is_enabled = ?", true).Find(&aiModels).Error; err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch models"})
+// GetModelHealth returns a model's recent probes (?limit=, default 100) and
+// its statistics over the last ?hours= hours
+func (h *AiHandler) GetModelHealth(c *fiber.Ctx) error {
+	var aiModel models.AiModel
+	if err := database.DB.First(&aiModel, c.Params("id")).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Model not found"})
 	}
 
-	apiKey := os.Getenv("API_OPEN_AI")
-	if apiKey == "" {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "API_OPEN_AI key not set"})
-	}
-
-	type TestResult struct {
-		ModelID      string `json:"modelId"`
-		Status       string `json:"status"`
-		ResponseTime int64  `json:"responseTime"`
-	}
-
-	resultsChan := make(chan TestResult, len(aiModels))
-	testURL := "https://rvlautoai.ru/webhook/v1/chat/completions"
-
-	var wg sync.WaitGroup
-	for _, m := range aiModels {
-		wg.Add(1)
-		go func(model models.AiModel) {
-			defer wg.Done()
-
-			testBody := map[string]interface{}{
-				"model":      model.ModelID,
-				"provider":   model.Provider,
-				"messages":   []map[string]string{{"role": "user", "content": "hi"}},
-				"max_tokens": 5,
-			}
-
-			jsonBody, _ := json.Marshal(testBody)
-			req, _ := http.NewRequest("POST", testURL, bytes.NewBuffer(jsonBody))
-			req.Header.Set("Content-Type", "application/json")
-			req.Header.Set("Authorization", "Bearer "+apiKey)
-
-			start := time.Now()
-			client := &http.Client{Timeout: 30 * time.Second}
-			resp, err := client.Do(req)
-			duration := time.Since(start).Milliseconds()
-
-			status := "online"
-			if err != nil {
-				status = "offline"
-			} else if resp.StatusCode != http.StatusOK {
-				status = "error"
-				if resp.Body != nil {
-					resp.Body.Close()
-				}
-			} else {
-				resp.Body.Close()
-			}
-
-			// Update in DB (careful with concurrent writes if using same DB connection,
-			// but GORM/Go sql.DB handles connection pooling)
-			database.DB.Model(&models.AiModel{}).Where("id = ?", model.ID).Updates(map[string]interface{}{
-				"last_test_status":   status,
-				"last_response_time": duration,
-			})
-
-			resultsChan <- TestResult{
-				ModelID:      model.ModelID,
-				Status:       status,
-				ResponseTime: duration,
-			}
-		}(m)
-	}
-
-	// Wait for all tests to finish in a separate goroutine
-	go func() {
-		wg.Wait()
-		close(resultsChan)
-	}()
-
-	results := make([]TestResult, 0, len(aiModels))
-	for res := range resultsChan {
-		results = append(results, res)
+	limit := c.QueryInt("limit", 100)
+	if limit < 1 || limit > 1000 {
+		limit = 100
+	}
+	hours := c.QueryInt("hours", 24)
+	if hours < 1 {
+		hours = 24
+	}
+
+	history, err := services.ModelHealthHistory(aiModel.ModelID, limit)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch health history"})
+	}
+	stats := services.LatencyStats{ModelID: aiModel.ModelID}
+	if all, err := services.ModelLatencyStats(time.Now().Add(-time.Duration(hours)*time.Hour), aiModel.ModelID); err == nil && len(all) > 0 {
+		stats = all[0]
 	}
 
 	return c.JSON(fiber.Map{
-		"tested":  len(results),
-		"results": results,
+		"model":   aiModel,
+		"stats":   stats,
+		"history": history,
 	})
 }
 
 // GetRecommendedModels returns recommended models for the client
 func (h *AiHandler) GetRecommendedModels(c *fiber.Ctx) error {
 	var aiModels []models.AiModel
-	if err := database.DB.Where("is_recommended = ? AND is_enabled = ?", true, true).Order("last_response_time asc").Find(&aiModels).Error; err != nil {
+	if err := database.DB.Where("is_recommended = ? AND is_enabled = ? AND is_deprecated = ?", true, true, false).Order("last_response_time asc").Find(&aiModels).Error; err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch models"})
 	}
 
@@ -0,0 +1,191 @@
+package handlers
+
+import (
+	"rag-agent-server/internal/database"
+	"rag-agent-server/internal/models"
+	"rag-agent-server/internal/services"
+	"sort"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+type AiUsageHandler struct {
+	usage *services.UsageMeter
+}
+
+func NewAiUsageHandler(usage *services.UsageMeter) *AiUsageHandler {
+	return &AiUsageHandler{usage: usage}
+}
+
+// usageGroupColumns maps the groupBy parameter to the SQL expression grouped on
+var usageGroupColumns = map[string]string{
+	"feature": "feature",
+	"model":   "model_id",
+	"user":    "CAST(user_id AS TEXT)",
+	"day":     "TO_CHAR(created_at, 'YYYY-MM-DD')",
+}
+
+type usageReportRow struct {
+	Key              string  `json:"key"`
+	Requests         int64   `json:"requests"`
+	Failures         int64   `json:"failures"`
+	PromptTokens     int64   `json:"promptTokens"`
+	CompletionTokens int64   `json:"completionTokens"`
+	TotalTokens      int64   `json:"totalTokens"`
+	Cost             float64 `json:"cost"`
+	AvgLatencyMs     float64 `json:"avgLatencyMs"`
+}
+
+const usageReportColumns = `COUNT(*) AS requests,
+	SUM(CASE WHEN success THEN 0 ELSE 1 END) AS failures,
+	COALESCE(SUM(prompt_tokens), 0) AS prompt_tokens,
+	COALESCE(SUM(completion_tokens), 0) AS completion_tokens,
+	COALESCE(SUM(total_tokens), 0) AS total_tokens,
+	COALESCE(SUM(cost), 0) AS cost,
+	COALESCE(AVG(latency_ms), 0) AS avg_latency_ms`
+
+// GetUsageReport aggregates AI usage.
+// Query params: from, to (YYYY-MM-DD, default last 30 days),
+// groupBy (feature|model|user|day, default feature), userId, feature, model.
+func (h *AiUsageHandler) GetUsageReport(c *fiber.Ctx) error {
+	groupBy := c.Query("groupBy", "feature")
+	column, ok := usageGroupColumns[groupBy]
+	if !ok {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "groupBy must be one of feature, model, user, day"})
+	}
+
+	to := time.Now()
+	from := to.AddDate(0, 0, -30)
+	if value := c.Query("from"); value != "" {
+		parsed, err := time.Parse("2006-01-02", value)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "from must be YYYY-MM-DD"})
+		}
+		from = parsed
+	}
+	if value := c.Query("to"); value != "" {
+		parsed, err := time.Parse("2006-01-02", value)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "to must be YYYY-MM-DD"})
+		}
+		to = parsed.AddDate(0, 0, 1) // inclusive
+	}
+
+	query := database.DB.Model(&models.AiUsage{}).Where("created_at >= ? AND created_at < ?", from, to)
+	if userID := c.QueryInt("userId"); userID > 0 {
+		query = query.Where("user_id = ?", userID)
+	}
+	if feature := c.Query("feature"); feature != "" {
+		query = query.Where("feature = ?", feature)
+	}
+	if model := c.Query("model"); model != "" {
+		query = query.Where("model_id = ?", model)
+	}
+
+	// Allow the filtered query to be reused for rows and totals
+	query = query.Session(&gorm.Session{})
+
+	rows := []usageReportRow{}
+	if err := query.Select(column + " AS key, " + usageReportColumns).Group(column).Order("cost DESC, requests DESC").Scan(&rows).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not build usage report"})
+	}
+
+	var totals usageReportRow
+	if err := query.Select("'total' AS key, " + usageReportColumns).Scan(&totals).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not build usage report"})
+	}
+
+	return c.JSON(fiber.Map{
+		"from":    from,
+		"to":      to,
+		"groupBy": groupBy,
+		"rows":    rows,
+		"totals":  totals,
+	})
+}
+
+// GetUserUsage returns a user's quota status and most recent AI calls
+func (h *AiUsageHandler) GetUserUsage(c *fiber.Ctx) error {
+	userID := parseUint(c.Params("id"))
+	status, err := h.usage.Status(userID)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "User not found"})
+	}
+
+	recent := []models.AiUsage{}
+	database.DB.Where("user_id = ?", userID).Order("created_at desc").Limit(50).Find(&recent)
+
+	return c.JSON(fiber.Map{
+		"status": status,
+		"recent": recent,
+	})
+}
+
+// GetMyUsage returns the caller's quota status
+func (h *AiUsageHandler) GetMyUsage(c *fiber.Ctx) error {
+	userID := requesterID(c)
+	if userID == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "User ID is required"})
+	}
+	status, err := h.usage.Status(userID)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "User not found"})
+	}
+	return c.JSON(status)
+}
+
+// GetQuotas lists the quota of every known plan
+func (h *AiUsageHandler) GetQuotas(c *fiber.Ctx) error {
+	plans := map[string]bool{models.PlanTrial: true, models.PlanFree: true, models.PlanPremium: true}
+
+	var userPlans []string
+	database.DB.Model(&models.User{}).Distinct("current_plan").Pluck("current_plan", &userPlans)
+	var storedPlans []string
+	database.DB.Model(&models.AiPlanQuota{}).Pluck("plan", &storedPlans)
+	for _, plan := range append(userPlans, storedPlans...) {
+		if plan != "" {
+			plans[plan] = true
+		}
+	}
+
+	quotas := make([]models.AiPlanQuota, 0, len(plans))
+	for plan := range plans {
+		quotas = append(quotas, h.usage.PlanQuota(plan))
+	}
+	sort.Slice(quotas, func(i, j int) bool { return quotas[i].Plan < quotas[j].Plan })
+	return c.JSON(quotas)
+}
+
+// UpdateQuota sets the limits of a plan. Zero means unlimited.
+func (h *AiUsageHandler) UpdateQuota(c *fiber.Ctx) error {
+	plan := c.Params("plan")
+	body := struct {
+		DailyRequests  *int     `json:"dailyRequests"`
+		MonthlyTokens  *int     `json:"monthlyTokens"`
+		MonthlyCostUSD *float64 `json:"monthlyCostUsd"`
+	}{}
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Cannot parse JSON"})
+	}
+
+	quota := h.usage.PlanQuota(plan)
+	if body.DailyRequests != nil {
+		quota.DailyRequests = *body.DailyRequests
+	}
+	if body.MonthlyTokens != nil {
+		quota.MonthlyTokens = *body.MonthlyTokens
+	}
+	if body.MonthlyCostUSD != nil {
+		quota.MonthlyCostUSD = *body.MonthlyCostUSD
+	}
+	if quota.DailyRequests < 0 || quota.MonthlyTokens < 0 || quota.MonthlyCostUSD < 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Limits must not be negative"})
+	}
+
+	if err := database.DB.Save(&quota).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not save quota"})
+	}
+	return c.JSON(quota)
+}
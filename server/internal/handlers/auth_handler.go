@@ -16,11 +16,13 @@ import (
 
 type AuthHandler struct {
 	ragService *services.RAGService
+	tokens     *services.TokenIssuer
 }
 
-func NewAuthHandler() *AuthHandler {
+func NewAuthHandler(ragService *services.RAGService, tokens *services.TokenIssuer) *AuthHandler {
 	return &AuthHandler{
-		ragService: services.NewRAGService(),
+		ragService: ragService,
+		tokens:     tokens,
 	}
 }
 
@@ -59,9 +61,12 @@ func (h *AuthHandler) Register(c *fiber.Ctx) error {
 	}
 
 	user.Password = ""
+	token, expiresAt := h.tokens.Issue(user.ID)
 	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
-		"message": "User registered successfully",
-		"user":    user,
+		"message":        "User registered successfully",
+		"user":           user,
+		"token":          token,
+		"tokenExpiresAt": expiresAt,
 	})
 }
 
@@ -105,9 +110,12 @@ func (h *AuthHandler) Login(c *fiber.Ctx) error {
 	}
 
 	user.Password = ""
+	token, expiresAt := h.tokens.Issue(user.ID)
 	return c.Status(fiber.StatusOK).JSON(fiber.Map{
-		"message": "Login successful",
-		"user":    user,
+		"message":        "Login successful",
+		"user":           user,
+		"token":          token,
+		"tokenExpiresAt": expiresAt,
 	})
 }
 
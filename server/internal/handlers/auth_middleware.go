@@ -0,0 +1,56 @@
+package handlers
+
+import (
+	"rag-agent-server/internal/database"
+	"rag-agent-server/internal/models"
+	"rag-agent-server/internal/services"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// fiber.Ctx locals set for authenticated requests
+const (
+	localUserID   = "userID"
+	localUserRole = "userRole"
+)
+
+// RequireAuth rejects requests without a valid "Authorization: Bearer <token>"
+// session token, as issued by Login, and remembers the authenticated user for
+// requesterID. Blocked users are rejected too.
+func RequireAuth(tokens *services.TokenIssuer) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		token, ok := strings.CutPrefix(c.Get(fiber.HeaderAuthorization), "Bearer ")
+		if !ok || token == "" {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Authentication required"})
+		}
+		userID, err := tokens.Verify(strings.TrimSpace(token))
+		if err != nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid session: " + err.Error()})
+		}
+
+		var user models.User
+		if err := database.DB.Select("id", "role", "is_blocked").First(&user, userID).Error; err != nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "User not found"})
+		}
+		if user.IsBlocked {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "User is blocked"})
+		}
+
+		c.Locals(localUserID, userID)
+		c.Locals(localUserRole, user.Role)
+		return c.Next()
+	}
+}
+
+// RequireAdmin rejects authenticated users who are not admins. It must run
+// after RequireAuth.
+func RequireAdmin() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		role, _ := c.Locals(localUserRole).(string)
+		if role != "admin" && role != "superadmin" {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Admin privileges required"})
+		}
+		return c.Next()
+	}
+}
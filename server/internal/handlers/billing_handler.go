@@ -0,0 +1,232 @@
+package handlers
+
+import (
+	"errors"
+	"rag-agent-server/internal/database"
+	"rag-agent-server/internal/models"
+	"rag-agent-server/internal/services"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+type BillingHandler struct {
+	billing *services.BillingService
+}
+
+func NewBillingHandler(billing *services.BillingService) *BillingHandler {
+	return &BillingHandler{billing: billing}
+}
+
+// GetPlans lists the active plans with prices for ?region= (default: the
+// caller's region, then "global")
+func (h *BillingHandler) GetPlans(c *fiber.Ctx) error {
+	region := c.Query("region")
+	if region == "" {
+		var user models.User
+		if userID := requesterID(c); userID != 0 && database.DB.First(&user, userID).Error == nil {
+			region = user.Region
+		}
+	}
+	if region == "" {
+		region = "global"
+	}
+
+	offers, err := h.billing.Offers(region)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not fetch plans"})
+	}
+	return c.JSON(fiber.Map{"region": region, "plans": offers})
+}
+
+// GetMyBilling returns the caller's effective plan, its expiry, entitlement
+// usage and subscription
+func (h *BillingHandler) GetMyBilling(c *fiber.Ctx) error {
+	userID := requesterID(c)
+	if userID == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "User ID is required"})
+	}
+
+	plan, entitlements, err := h.billing.Entitlements(userID)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "User not found"})
+	}
+
+	var user models.User
+	database.DB.First(&user, userID)
+
+	var subscription *models.Subscription
+	var sub models.Subscription
+	if database.DB.Where("user_id = ?", userID).Order("updated_at desc").First(&sub).Error == nil {
+		subscription = &sub
+	}
+
+	return c.JSON(fiber.Map{
+		"plan":         plan,
+		"expiresAt":    user.PlanExpiresAt,
+		"entitlements": entitlements,
+		"subscription": subscription,
+	})
+}
+
+// Checkout starts the purchase of a plan
+func (h *BillingHandler) Checkout(c *fiber.Ctx) error {
+	userID := requesterID(c)
+	if userID == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "User ID is required"})
+	}
+
+	var body struct {
+		Plan     string `json:"plan"`
+		Interval string `json:"interval"`
+	}
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Cannot parse JSON"})
+	}
+	if body.Interval == "" {
+		body.Interval = "month"
+	}
+
+	session, err := h.billing.Checkout(userID, body.Plan, body.Interval)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(session)
+}
+
+// HandleWebhook receives payment notifications. Providers retry on non-2xx
+// responses, so already processed events still answer 200.
+func (h *BillingHandler) HandleWebhook(c *fiber.Ctx) error {
+	headers := make(map[string]string)
+	c.Request().Header.VisitAll(func(key, value []byte) {
+		headers[string(key)] = string(value)
+	})
+
+	if err := h.billing.HandleWebhook(c.Params("provider"), c.Body(), headers); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(fiber.Map{"received": true})
+}
+
+// CompleteFakeCheckout pays one of the caller's fake provider checkouts
+func (h *BillingHandler) CompleteFakeCheckout(c *fiber.Ctx) error {
+	err := h.billing.CompleteFakeCheckout(c.Params("id"), requesterID(c))
+	if errors.Is(err, services.ErrCheckoutNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(fiber.Map{"paid": true})
+}
+
+// UpdatePlan changes a plan's name, description, availability, trial length
+// or entitlements. Unknown codes create a new plan.
+func (h *BillingHandler) UpdatePlan(c *fiber.Ctx) error {
+	code := strings.TrimSpace(c.Params("code"))
+	var body struct {
+		Name                    *string `json:"name"`
+		Description             *string `json:"description"`
+		IsActive                *bool   `json:"isActive"`
+		SortOrder               *int    `json:"sortOrder"`
+		TrialDays               *int    `json:"trialDays"`
+		MaxCompatibilityReports *int    `json:"maxCompatibilityReports"`
+		MaxAiRooms              *int    `json:"maxAiRooms"`
+		MaxPhotos               *int    `json:"maxPhotos"`
+	}
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Cannot parse JSON"})
+	}
+
+	plan, err := h.billing.Plan(code)
+	if err != nil {
+		plan = models.Plan{Code: code, Name: code, IsActive: true}
+	}
+	if body.Name != nil {
+		plan.Name = *body.Name
+	}
+	if body.Description != nil {
+		plan.Description = *body.Description
+	}
+	if body.IsActive != nil {
+		plan.IsActive = *body.IsActive
+	}
+	if body.SortOrder != nil {
+		plan.SortOrder = *body.SortOrder
+	}
+	if body.TrialDays != nil {
+		plan.TrialDays = *body.TrialDays
+	}
+	if body.MaxCompatibilityReports != nil {
+		plan.MaxCompatibilityReports = *body.MaxCompatibilityReports
+	}
+	if body.MaxAiRooms != nil {
+		plan.MaxAiRooms = *body.MaxAiRooms
+	}
+	if body.MaxPhotos != nil {
+		plan.MaxPhotos = *body.MaxPhotos
+	}
+
+	if code == "" || plan.TrialDays < 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Plan code is required and trial days must not be negative"})
+	}
+	for _, limit := range []int{plan.MaxCompatibilityReports, plan.MaxAiRooms, plan.MaxPhotos} {
+		if limit < models.Unlimited {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Limits must be -1 (unlimited) or more"})
+		}
+	}
+
+	if err := database.DB.Omit("Prices").Save(&plan).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not save plan"})
+	}
+	return c.JSON(plan)
+}
+
+// UpdatePlanPrices replaces the prices of a plan
+func (h *BillingHandler) UpdatePlanPrices(c *fiber.Ctx) error {
+	plan, err := h.billing.Plan(c.Params("code"))
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Plan not found"})
+	}
+
+	var prices []models.PlanPrice
+	if err := c.BodyParser(&prices); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Cannot parse JSON"})
+	}
+	for i := range prices {
+		price := &prices[i]
+		price.ID = 0
+		price.PlanID = plan.ID
+		price.Region = strings.ToLower(strings.TrimSpace(price.Region))
+		if price.Region == "" {
+			price.Region = "global"
+		}
+		if price.Interval == "" {
+			price.Interval = "month"
+		}
+		if price.Interval != "month" && price.Interval != "year" {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Interval must be month or year"})
+		}
+		if price.Currency == "" || price.AmountCents < 0 {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Every price needs a currency and a non-negative amount"})
+		}
+		price.Currency = strings.ToUpper(price.Currency)
+	}
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Where("plan_id = ?", plan.ID).Delete(&models.PlanPrice{}).Error; err != nil {
+			return err
+		}
+		if len(prices) == 0 {
+			return nil
+		}
+		return tx.Create(&prices).Error
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not save prices"})
+	}
+
+	plan.Prices = prices
+	return c.JSON(plan)
+}
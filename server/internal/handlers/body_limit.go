@@ -0,0 +1,20 @@
+package handlers
+
+import "github.com/gofiber/fiber/v2"
+
+// LimitBody rejects request bodies over limit, except on the routes given a
+// larger allowance in exceptions, keyed by "METHOD /path". fasthttp enforces
+// one limit for the whole server, so the server's BodyLimit must be the
+// largest allowance; this narrows it for every other route.
+func LimitBody(limit int, exceptions map[string]int) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		allowed := limit
+		if n, ok := exceptions[c.Method()+" "+c.Path()]; ok {
+			allowed = n
+		}
+		if len(c.Request().Body()) > allowed {
+			return c.Status(fiber.StatusRequestEntityTooLarge).JSON(fiber.Map{"error": "Request body is too large"})
+		}
+		return c.Next()
+	}
+}
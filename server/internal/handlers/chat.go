@@ -1,90 +1,233 @@
 package handlers
 
 import (
-	"bytes"
+	"bufio"
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
 	"log"
 	"net/http"
-	"os"
+	"rag-agent-server/internal/config"
+	"rag-agent-server/internal/database"
+	"rag-agent-server/internal/models"
+	"rag-agent-server/internal/services"
+	"strings"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
 )
 
-type ChatHandler struct{}
+type ChatHandler struct {
+	cfg       *config.Store
+	usage     *services.UsageMeter
+	aiService *services.AiChatService
+}
+
+func NewChatHandler(cfg *config.Store, usage *services.UsageMeter, aiService *services.AiChatService) *ChatHandler {
+	return &ChatHandler{cfg: cfg, usage: usage, aiService: aiService}
+}
 
-func NewChatHandler() *ChatHandler {
-	return &ChatHandler{}
+// chatCompletionRequest is the subset of the OpenAI chat completions request
+// the gateway supports
+type chatCompletionRequest struct {
+	Model    string `json:"model"`
+	Messages []struct {
+		Role string `json:"role"`
+		// Content is a string, or an array of parts of which the text is used
+		Content json.RawMessage `json:"content"`
+	} `json:"messages"`
+	Temperature *float64 `json:"temperature"`
+	MaxTokens   int      `json:"max_tokens"`
+	Stream      bool     `json:"stream"`
 }
 
+// messageText flattens OpenAI message content to plain text
+func messageText(content json.RawMessage) (string, error) {
+	var text string
+	if err := json.Unmarshal(content, &text); err == nil {
+		return text, nil
+	}
+	var parts []struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	}
+	if err := json.Unmarshal(content, &parts); err != nil {
+		return "", err
+	}
+	var texts []string
+	for _, part := range parts {
+		if part.Type == "text" {
+			texts = append(texts, part.Text)
+		}
+	}
+	return strings.Join(texts, "\n"), nil
+}
+
+// HandleChat serves OpenAI-style chat completions to signed-in users. Only
+// enabled text models can be requested, max_tokens is capped, the user's plan
+// quota applies and failures fall back to other models like every other AI
+// feature. Requests without a model use the one assigned to chat_proxy.
 func (h *ChatHandler) HandleChat(c *fiber.Ctx) error {
-	// Parse request body
-	var body map[string]interface{}
-	if err := c.BodyParser(&body); err != nil {
+	var req chatCompletionRequest
+	if err := c.BodyParser(&req); err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 			"error": "Cannot parse JSON",
 		})
 	}
 
-	// Get API Key from env
-	apiKey := os.Getenv("API_OPEN_AI")
-	if apiKey == "" {
-		log.Println("Error: API_OPEN_AI is not set in environment")
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Server configuration error",
-		})
+	if len(req.Messages) == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "messages must not be empty"})
+	}
+	messages := make([]map[string]string, 0, len(req.Messages))
+	for _, m := range req.Messages {
+		if m.Role != "system" && m.Role != "user" && m.Role != "assistant" {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Unsupported message role: " + m.Role})
+		}
+		text, err := messageText(m.Content)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Unsupported message content"})
+		}
+		messages = append(messages, map[string]string{"role": m.Role, "content": text})
 	}
 
-	// Prepare request to external API
-	externalURL := "https://rvlautoai.ru/webhook/v1/chat/completions"
-	jsonBody, err := json.Marshal(body)
-	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to marshal request",
-		})
+	modelID := strings.TrimSpace(req.Model)
+	if modelID == "auto" {
+		modelID = ""
+	}
+	if modelID != "" {
+		var aiModel models.AiModel
+		if err := database.DB.Where("model_id = ? AND is_enabled = ? AND is_deprecated = ?", modelID, true, false).First(&aiModel).Error; err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Model is not available: " + modelID})
+		}
+		if aiModel.Category != "" && aiModel.Category != "text" {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Model is not a chat model: " + modelID})
+		}
 	}
 
-	req, err := http.NewRequest("POST", externalURL, bytes.NewBuffer(jsonBody))
-	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to create request",
-		})
+	if req.Temperature != nil && (*req.Temperature < 0 || *req.Temperature > 2) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "temperature must be between 0 and 2"})
+	}
+	maxTokens := h.cfg.Get().AI.MaxCompletionTokens
+	if req.MaxTokens > 0 && req.MaxTokens < maxTokens {
+		maxTokens = req.MaxTokens
 	}
 
-	// Set headers
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+apiKey)
+	// Check the plan quota up front so streams aren't started just to fail
+	usage := services.UsageContext{UserID: requesterID(c), Feature: services.FeatureChatProxy}
+	if h.usage != nil {
+		if err := h.usage.CheckQuota(usage); err != nil {
+			return sendAiError(c, err)
+		}
+	}
 
-	// Send request
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		log.Printf("Error forwarding request to AI API: %v", err)
-		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{
-			"error": "Failed to contact AI service",
-		})
+	opts := services.CompletionOptions{Temperature: req.Temperature, MaxTokens: maxTokens}
+	id := fmt.Sprintf("chatcmpl-%d", time.Now().UnixNano())
+	if req.Stream {
+		displayModel := modelID
+		if displayModel == "" {
+			displayModel = h.aiService.FeatureModels(services.FeatureChatProxy).PrimaryModelID
+		}
+		return h.streamCompletion(c, id, displayModel, usage, modelID, messages, opts)
 	}
-	defer resp.Body.Close()
 
-	// Read response
-	respBody, err := io.ReadAll(resp.Body)
+	ctx, cancel := aiContext(c)
+	defer cancel()
+	completion, err := h.aiService.Complete(ctx, usage, modelID, messages, opts)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to read response",
-		})
+		if _, ok := err.(*services.QuotaError); ok {
+			return sendAiError(c, err)
+		}
+		log.Printf("[Chat] Completion failed for user %d: %v", usage.UserID, err)
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{"error": "Failed to contact AI service"})
 	}
 
-	// Forward status code and body
-	c.Status(resp.StatusCode)
-	c.Set("Content-Type", "application/json")
-	return c.Send(respBody)
+	return c.JSON(fiber.Map{
+		"id":      id,
+		"object":  "chat.completion",
+		"created": time.Now().Unix(),
+		"model":   completion.ModelID,
+		"choices": []fiber.Map{{
+			"index":         0,
+			"message":       fiber.Map{"role": "assistant", "content": completion.Content},
+			"finish_reason": "stop",
+		}},
+		"usage": fiber.Map{
+			"prompt_tokens":     completion.Usage.PromptTokens,
+			"completion_tokens": completion.Usage.CompletionTokens,
+			"total_tokens":      completion.Usage.PromptTokens + completion.Usage.CompletionTokens,
+		},
+	})
+}
+
+// streamCompletion sends the reply as OpenAI-style Server-Sent Events,
+// flushing every chunk. When the client goes away the request is cancelled,
+// which also stops any further fallback attempts. Like buffered calls, the
+// stream is bounded by aiRequestTimeout, so a provider that stalls without
+// closing the connection can't hold it open.
+func (h *ChatHandler) streamCompletion(c *fiber.Ctx, id, displayModel string, usage services.UsageContext, modelID string, messages []map[string]string, opts services.CompletionOptions) error {
+	c.Set("Content-Type", "text/event-stream")
+	c.Set("Cache-Control", "no-cache")
+	c.Set("Connection", "keep-alive")
+	c.Set("X-Accel-Buffering", "no")
+
+	created := time.Now().Unix()
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		ctx, cancel := context.WithTimeout(context.Background(), aiRequestTimeout)
+		defer cancel()
+
+		send := func(payload interface{}) {
+			data, _ := json.Marshal(payload)
+			if _, err := fmt.Fprintf(w, "data: %s\n\n", data); err != nil {
+				cancel()
+				return
+			}
+			if err := w.Flush(); err != nil {
+				// Client went away
+				cancel()
+			}
+		}
+		chunk := func(delta fiber.Map, finishReason interface{}) fiber.Map {
+			return fiber.Map{
+				"id":      id,
+				"object":  "chat.completion.chunk",
+				"created": created,
+				"model":   displayModel,
+				"choices": []fiber.Map{{"index": 0, "delta": delta, "finish_reason": finishReason}},
+			}
+		}
+
+		opts.OnDelta = func(delta string) {
+			if ctx.Err() == nil {
+				send(chunk(fiber.Map{"content": delta}, nil))
+			}
+		}
+		send(chunk(fiber.Map{"role": "assistant"}, nil))
+
+		if _, err := h.aiService.Complete(ctx, usage, modelID, messages, opts); err != nil {
+			if errors.Is(ctx.Err(), context.Canceled) {
+				log.Printf("[Chat] Client of stream %s disconnected", id)
+				return
+			}
+			log.Printf("[Chat] Stream %s failed for user %d: %v", id, usage.UserID, err)
+			send(fiber.Map{"error": fiber.Map{"message": "AI reply was interrupted"}})
+			return
+		}
+		send(chunk(fiber.Map{}, "stop"))
+		if ctx.Err() == nil {
+			fmt.Fprint(w, "data: [DONE]\n\n")
+			w.Flush()
+		}
+	})
+	return nil
 }
 
 func (h *ChatHandler) HandleModels(c *fiber.Ctx) error {
-	// Get API Key from env
-	apiKey := os.Getenv("API_OPEN_AI")
+	ai := h.cfg.Get().AI
+	apiKey := ai.GatewayAPIKey
 	if apiKey == "" {
-		log.Println("Error: API_OPEN_AI is not set in environment")
+		log.Println("Error: API_OPEN_AI is not configured")
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Server configuration error",
 		})
@@ -92,7 +235,7 @@ func (h *ChatHandler) HandleModels(c *fiber.Ctx) error {
 
 	// Get provider query parameter if present
 	provider := c.Query("provider")
-	externalURL := "https://rvlautoai.ru/webhook/v1/models"
+	externalURL := ai.ModelsURL()
 	if provider != "" {
 		externalURL += "?provider=" + provider
 	}
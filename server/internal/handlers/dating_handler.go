@@ -1,10 +1,12 @@
 package handlers
 
 import (
+	"encoding/json"
 	"fmt"
 	"rag-agent-server/internal/database"
 	"rag-agent-server/internal/models"
 	"rag-agent-server/internal/services"
+	"strings"
 	"time"
 
 	"regexp"
@@ -14,11 +16,15 @@ import (
 
 type DatingHandler struct {
 	aiService *services.AiChatService
+	billing   *services.BillingService
+	prompts   *services.PromptService
 }
 
-func NewDatingHandler(aiService *services.AiChatService) *DatingHandler {
+func NewDatingHandler(aiService *services.AiChatService, billing *services.BillingService, prompts *services.PromptService) *DatingHandler {
 	return &DatingHandler{
 		aiService: aiService,
+		billing:   billing,
+		prompts:   prompts,
 	}
 }
 
@@ -130,12 +136,29 @@ func (h *DatingHandler) GetCompatibility(c *fiber.Ctx) error {
 	var userID, candidateID uint
 	fmt.Sscanf(userIDStr, "%d", &userID)
 	fmt.Sscanf(candidateIDStr, "%d", &candidateID)
+	// Reports are billed to the user they are written for
+	if userID != requesterID(c) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "You can only request your own compatibility reports"})
+	}
+
+	// Reports are written in Russian unless the app asks for another language
+	// the report prompt has text for. Anything else would cache and bill a
+	// separate report for every string sent.
+	language := strings.ToLower(strings.TrimSpace(c.Query("lang", "ru")))
+	if def, _ := services.PromptDefinitionFor(services.PromptDatingCompatibility); !def.HasLanguage(language) {
+		language = "ru"
+	}
 
 	// Check cache first
 	var cached models.DatingCompatibility
-	if err := database.DB.Where("user_id = ? AND candidate_id = ?", userID, candidateID).First(&cached).Error; err == nil {
+	if err := database.DB.Where("user_id = ? AND candidate_id = ? AND language = ?", userID, candidateID, language).First(&cached).Error; err == nil {
+		citations := []services.Citation{}
+		if cached.Citations != "" {
+			json.Unmarshal([]byte(cached.Citations), &citations)
+		}
 		return c.JSON(fiber.Map{
 			"compatibility": cached.CompatibilityText,
+			"citations":     citations,
 		})
 	}
 
@@ -151,69 +174,65 @@ func (h *DatingHandler) GetCompatibility(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "AI service not available"})
 	}
 
-	prompt := fmt.Sprintf(`Ты — потомственный ведический астролог (Джйотиш).
-Твоя задача — дать глубокий, но лаконичный анализ совместимости для %s.
-
-Важное правило: Обращайся к вопрошающему и партнеру на "Вы". Пиши "Ваш союз", "Ваша совместимость", "Вам". Не используй третье лицо ("Их союз", "У них").
-
-Структура ответа (начинай СРАЗУ с пункта 1, без приветствия):
-1. **Астрологический срез**: Кратко (2-3 предложения) опиши ВАШ союз через призму 7-го дома (партнерство) и лунных знаков (Раши). Упомяни синастрию (Куты) и накшатры, если это уместно.
-2. **Благословение звезд**: Ваша совместимость по гунам и варнам.
-3. **Гармония сердец**: Как ваше служение дополняет друг друга 🪷.
-4. **Практические советы**: 2-3 важных совета для развития ваших отношений, методов упай (коррекции) 📿.
-5. **Заключение**: Теплое пожелание вам ❤️.
-
-Используй термины джйотиш (Бхава, Раши, Накшатра) профессионально, но понятно.
-ОБЯЗАТЕЛЬНО начни ответ сразу с текста анализа. НЕ пиши приветствие, оно будет добавлено автоматически.
-СТРОГО ЗАПРЕЩЕНО: Не генерируй аудио, ссылки или HTML-теги. ТОЛЬКО ТЕКСТ. Не используй TTS.
-
-Данные для анализа:
----
-ПОЛЬЗОВАТЕЛЬ 1 (Кандидат):
-- Духовное имя: %s
-- Интересы: %s
-- Традиция: %s
-- Дата рождения: %s
-- Время рождения: %s
-- Место рождения: %s
-- О себе: %s
-
-ПОЛЬЗОВАТЕЛЬ 2 (Партнер):
-- Духовное имя: %s
-- Интересы: %s
-- Традиция: %s
-- Дата рождения: %s
-- Время рождения: %s
-- Место рождения: %s
-- О себе: %s
----`,
-		user.SpiritualName,
-		user.SpiritualName, user.Interests, user.Madh, user.Dob, user.BirthTime, user.BirthPlaceLink, user.Bio,
-		candidate.SpiritualName, candidate.Interests, candidate.Madh, candidate.Dob, candidate.BirthTime, candidate.BirthPlaceLink, candidate.Bio)
-
-	resp, err := h.aiService.GenerateSimpleResponse(prompt)
+	// Cached reports are free; only new ones count against the plan
+	if err := h.billing.CheckEntitlement(userID, services.EntitlementCompatibilityReports); err != nil {
+		return sendError(c, err)
+	}
+
+	data := services.PromptData{
+		"User":      services.NewPromptUser(user),
+		"Candidate": services.NewPromptUser(candidate),
+	}
+	prompt, err := h.prompts.Render(services.PromptDatingCompatibility, language, data)
+	if err != nil {
+		return sendError(c, err)
+	}
+
+	// RAG-enabled models also see what the two profiles and the knowledge
+	// documents say about the question
+	usage := services.UsageContext{UserID: userID, Feature: services.FeatureDatingCompatibility}
+	ctx, cancel := aiContext(c)
+	defer cancel()
+	completion, err := h.aiService.Complete(ctx, usage, "", []map[string]string{{"role": "user", "content": prompt}}, services.CompletionOptions{
+		Retrieval: &services.RetrievalQuery{
+			Text:      "Compatibility, birth data and spiritual practice of " + user.SpiritualName + " and " + candidate.SpiritualName,
+			UserIDs:   []uint{user.ID, candidate.ID},
+			Knowledge: true,
+		},
+	})
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		return sendAiError(c, err)
+	}
+	citations := completion.Citations
+	if citations == nil {
+		citations = []services.Citation{}
 	}
 
 	// Clean up response from potential hallucinations (audio tags, etc.)
 	// This removes <audio ...> tags and any lines starting with http
-	compatibilityAI := cleanResponse(resp)
+	compatibilityAI := services.WithCitations(cleanResponse(completion.Content), citations)
 
 	// Manually prepend the greeting to ensure it's never truncated
-	greeting := fmt.Sprintf("Харе Кришна, дорогой %s! 🌟\n\n", user.SpiritualName)
+	greeting, err := h.prompts.Render(services.PromptDatingGreeting, language, data)
+	if err != nil {
+		return sendError(c, err)
+	}
 	compatibility := greeting + compatibilityAI
 
 	// Save to cache
+	citationsJSON, _ := json.Marshal(citations)
 	newCache := models.DatingCompatibility{
 		UserID:            userID,
 		CandidateID:       candidateID,
+		Language:          language,
 		CompatibilityText: compatibility,
+		Citations:         string(citationsJSON),
 	}
 	database.DB.Create(&newCache)
 
 	return c.JSON(fiber.Map{
 		"compatibility": compatibility,
+		"citations":     citations,
 	})
 }
 
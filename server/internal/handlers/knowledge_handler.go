@@ -0,0 +1,146 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"rag-agent-server/internal/database"
+	"rag-agent-server/internal/models"
+	"rag-agent-server/internal/services"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type KnowledgeHandler struct {
+	knowledge *services.KnowledgeService
+}
+
+func NewKnowledgeHandler(knowledge *services.KnowledgeService) *KnowledgeHandler {
+	return &KnowledgeHandler{knowledge: knowledge}
+}
+
+// findDocument loads the document named by the :id param
+func findDocument(c *fiber.Ctx) (models.KnowledgeDocument, error) {
+	var doc models.KnowledgeDocument
+	if err := database.DB.First(&doc, c.Params("id")).Error; err != nil {
+		return doc, fiber.NewError(fiber.StatusNotFound, "Document not found")
+	}
+	return doc, nil
+}
+
+// GetCollections lists the knowledge collections with document counts
+func (h *KnowledgeHandler) GetCollections(c *fiber.Ctx) error {
+	collections, err := services.KnowledgeCollections()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch collections"})
+	}
+	return c.JSON(collections)
+}
+
+// GetDocuments lists knowledge documents, optionally filtered by
+// ?collection= and ?status=
+func (h *KnowledgeHandler) GetDocuments(c *fiber.Ctx) error {
+	docs, err := services.KnowledgeDocuments(c.Query("collection"), c.Query("status"))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch documents"})
+	}
+	return c.JSON(docs)
+}
+
+// GetDocument returns one document with its ingestion status
+func (h *KnowledgeHandler) GetDocument(c *fiber.Ctx) error {
+	doc, err := findDocument(c)
+	if err != nil {
+		return sendError(c, err)
+	}
+	return c.JSON(doc)
+}
+
+// UploadDocument accepts a PDF, Markdown or text file in the "file" form
+// field, with optional "title" and "collection" fields, and queues it for
+// indexing. Poll the document for its status.
+func (h *KnowledgeHandler) UploadDocument(c *fiber.Ctx) error {
+	file, err := c.FormFile("file")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "No file provided"})
+	}
+	if file.Size > services.MaxKnowledgeFileSize {
+		return c.Status(fiber.StatusRequestEntityTooLarge).JSON(fiber.Map{"error": "File is too large"})
+	}
+
+	f, err := file.Open()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not read file"})
+	}
+	defer f.Close()
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not read file"})
+	}
+
+	doc, err := h.knowledge.Create(c.FormValue("title"), c.FormValue("collection"), file.Filename, data, requesterID(c))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.Status(fiber.StatusAccepted).JSON(doc)
+}
+
+// UpdateDocument changes a document's title or collection
+func (h *KnowledgeHandler) UpdateDocument(c *fiber.Ctx) error {
+	doc, err := findDocument(c)
+	if err != nil {
+		return sendError(c, err)
+	}
+
+	var body struct {
+		Title      *string `json:"title"`
+		Collection *string `json:"collection"`
+	}
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+
+	doc, err = h.knowledge.Update(doc.ID, body.Title, body.Collection)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(doc)
+}
+
+// DeleteDocument removes a document from the index and the database. When
+// the index is unavailable it answers 502 unless ?force=true, which deletes
+// the document anyway.
+func (h *KnowledgeHandler) DeleteDocument(c *fiber.Ctx) error {
+	doc, err := findDocument(c)
+	if err != nil {
+		return sendError(c, err)
+	}
+	if err := h.knowledge.Delete(doc.ID, c.QueryBool("force")); err != nil {
+		if errors.Is(err, services.ErrIndexUnavailable) {
+			return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{"error": err.Error() + "; retry with ?force=true to delete it anyway"})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to delete document"})
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// ReindexDocument queues a document for indexing again
+func (h *KnowledgeHandler) ReindexDocument(c *fiber.Ctx) error {
+	doc, err := findDocument(c)
+	if err != nil {
+		return sendError(c, err)
+	}
+	doc, err = h.knowledge.Reindex(doc.ID)
+	if err != nil {
+		return sendError(c, err)
+	}
+	return c.Status(fiber.StatusAccepted).JSON(doc)
+}
+
+// ReindexAll queues every document, or those of ?collection=
+func (h *KnowledgeHandler) ReindexAll(c *fiber.Ctx) error {
+	queued, err := h.knowledge.ReindexAll(c.Query("collection"))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to queue documents"})
+	}
+	return c.Status(fiber.StatusAccepted).JSON(fiber.Map{"queued": queued})
+}
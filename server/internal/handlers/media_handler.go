@@ -6,20 +6,27 @@ import (
 	"path/filepath"
 	"rag-agent-server/internal/database"
 	"rag-agent-server/internal/models"
+	"rag-agent-server/internal/services"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
 )
 
-type MediaHandler struct{}
+type MediaHandler struct {
+	billing *services.BillingService
+}
 
-func NewMediaHandler() *MediaHandler {
-	return &MediaHandler{}
+func NewMediaHandler(billing *services.BillingService) *MediaHandler {
+	return &MediaHandler{billing: billing}
 }
 
 func (h *MediaHandler) UploadPhoto(c *fiber.Ctx) error {
 	userID := c.Params("userId")
 
+	if err := h.billing.CheckEntitlement(parseUint(userID), services.EntitlementPhotos); err != nil {
+		return sendError(c, err)
+	}
+
 	file, err := c.FormFile("photo")
 	if err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
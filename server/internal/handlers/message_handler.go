@@ -11,100 +11,147 @@ import (
 )
 
 type MessageHandler struct {
-	aiService *services.AiChatService
-	hub       *websocket.Hub
+	aiService    *services.AiChatService
+	hub          *websocket.Hub
+	moderation   *services.ModerationService
+	aiDispatcher *services.AiReplyDispatcher
 }
 
-func NewMessageHandler(aiService *services.AiChatService, hub *websocket.Hub) *MessageHandler {
+func NewMessageHandler(aiService *services.AiChatService, hub *websocket.Hub, moderation *services.ModerationService, aiDispatcher *services.AiReplyDispatcher) *MessageHandler {
 	return &MessageHandler{
-		aiService: aiService,
-		hub:       hub,
+		aiService:    aiService,
+		hub:          hub,
+		moderation:   moderation,
+		aiDispatcher: aiDispatcher,
 	}
 }
 
+// sendMessageRequest is what a client may set on a message; the sender,
+// moderation status and system flag are decided by the server
+type sendMessageRequest struct {
+	RecipientID uint   `json:"recipientId"`
+	RoomID      uint   `json:"roomId"`
+	Content     string `json:"content"`
+	Type        string `json:"type"`
+}
+
 func (h *MessageHandler) SendMessage(c *fiber.Ctx) error {
-	var msg models.Message
-	if err := c.BodyParser(&msg); err != nil {
+	var body sendMessageRequest
+	if err := c.BodyParser(&body); err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 			"error": "Cannot parse JSON",
 		})
 	}
 
-	if msg.SenderID == 0 || (msg.RecipientID == 0 && msg.RoomID == 0) || msg.Content == "" {
+	// Messages are always sent as the authenticated user
+	msg := models.Message{
+		SenderID:    requesterID(c),
+		RecipientID: body.RecipientID,
+		RoomID:      body.RoomID,
+		Content:     body.Content,
+		Type:        body.Type,
+	}
+	if (msg.RecipientID == 0 && msg.RoomID == 0) || msg.Content == "" {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "SenderID, Content and either RecipientID or RoomID are required",
+			"error": "Content and either RecipientID or RoomID are required",
 		})
 	}
 
-	if err := database.DB.Create(&msg).Error; err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Could not save message",
-		})
+	if msg.RoomID != 0 {
+		room, err := requireRoomMember(c, msg.RoomID)
+		if err != nil {
+			return sendError(c, err)
+		}
+		if room.IsArchived {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": "Room is archived and read-only",
+			})
+		}
 	}
 
-	// Broadcast via WebSocket
-	if h.hub != nil {
-		h.hub.Broadcast(msg)
+	// Pre-send moderation
+	verdict := services.ModerationVerdict{Action: services.ModerationAllow}
+	if h.moderation != nil {
+		verdict = h.moderation.Check(msg)
 	}
 
-	// Trigger AI if it's a room message and AI is enabled
-	if msg.RoomID != 0 && h.aiService != nil {
-		go h.handleAiResponse(msg.RoomID)
+	msg.ModerationStatus = "approved"
+	switch verdict.Action {
+	case services.ModerationBlock:
+		log.Printf("[Moderation] Blocked message from user %d (%s: %s)", msg.SenderID, verdict.Filter, verdict.Reason)
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error":  "Message was blocked by moderation",
+			"reason": verdict.Reason,
+		})
+	case services.ModerationHold:
+		msg.ModerationStatus = "held"
+	case services.ModerationFlag:
+		msg.ModerationStatus = "flagged"
 	}
 
-	return c.Status(fiber.StatusCreated).JSON(msg)
-}
-
-func (h *MessageHandler) handleAiResponse(roomID uint) {
-	var room models.Room
-	if err := database.DB.First(&room, roomID).Error; err != nil || !room.AiEnabled {
-		return
+	if err := database.DB.Create(&msg).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Could not save message",
+		})
 	}
 
-	// Fetch last messages for context
-	var lastMessages []models.Message
-	database.DB.Where("room_id = ?", roomID).Order("created_at desc").Limit(10).Find(&lastMessages)
-
-	// Reverse to get chronological order
-	for i, j := 0, len(lastMessages)-1; i < j; i, j = i+1, j-1 {
-		lastMessages[i], lastMessages[j] = lastMessages[j], lastMessages[i]
+	if verdict.Action != services.ModerationAllow {
+		report := models.Report{
+			TargetType: "message",
+			TargetID:   msg.ID,
+			Reason:     verdict.Reason,
+			Details:    "Automatic " + verdict.Action.String() + " by " + verdict.Filter + " filter",
+			Source:     "filter",
+			Status:     "pending",
+		}
+		database.DB.Create(&report)
 	}
 
-	reply, err := h.aiService.GenerateReply(room, lastMessages)
-	if err != nil {
-		log.Printf("AI Reply Error: %v", err)
-		return
+	// Held messages stay hidden until a moderator reviews them
+	if msg.ModerationStatus == "held" {
+		return c.Status(fiber.StatusAccepted).JSON(msg)
 	}
 
-	aiMsg := models.Message{
-		SenderID: 0, // 0 for AI/System
-		RoomID:   roomID,
-		Content:  reply,
-		Type:     "text",
+	if msg.RoomID != 0 {
+		database.DB.Model(&models.Room{}).Where("id = ?", msg.RoomID).Update("last_activity_at", msg.CreatedAt)
 	}
-	database.DB.Create(&aiMsg)
 
-	// Broadcast AI response
+	// Broadcast via WebSocket
 	if h.hub != nil {
-		h.hub.Broadcast(aiMsg)
+		h.hub.Broadcast(msg)
+	}
+
+	// Let the assistant decide whether this room message needs a reply
+	if msg.RoomID != 0 && h.aiDispatcher != nil {
+		go h.aiDispatcher.Enqueue(msg)
 	}
+
+	return c.Status(fiber.StatusCreated).JSON(msg)
 }
 
 func (h *MessageHandler) GetRoomSummary(c *fiber.Ctx) error {
 	roomID := c.Params("id")
-	var room models.Room
-	if err := database.DB.First(&room, roomID).Error; err != nil {
-		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Room not found"})
+	room, err := requireRoomMember(c, roomID)
+	if err != nil {
+		return sendError(c, err)
 	}
 
 	var lastMessages []models.Message
-	if err := database.DB.Where("room_id = ?", roomID).Order("created_at desc").Limit(50).Find(&lastMessages).Error; err != nil {
+	if err := database.DB.Where("room_id = ? AND moderation_status NOT IN ?", roomID, []string{"held", "removed"}).Order("created_at desc").Limit(50).Find(&lastMessages).Error; err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not fetch messages"})
 	}
 
-	summary, err := h.aiService.GetSummary(room.Name, lastMessages)
+	// Reverse to get chronological order
+	for i, j := 0, len(lastMessages)-1; i < j; i, j = i+1, j-1 {
+		lastMessages[i], lastMessages[j] = lastMessages[j], lastMessages[i]
+	}
+
+	usage := services.UsageContext{UserID: requesterID(c), Feature: services.FeatureRoomSummary}
+	ctx, cancel := aiContext(c)
+	defer cancel()
+	summary, err := h.aiService.GetSummary(ctx, usage, *room, lastMessages)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		return sendAiError(c, err)
 	}
 
 	return c.JSON(fiber.Map{"summary": summary})
@@ -114,15 +161,26 @@ func (h *MessageHandler) GetMessages(c *fiber.Ctx) error {
 	userId := c.Params("userId")
 	recipientId := c.Params("recipientId")
 	roomId := c.Query("roomId")
+	if parseUint(userId) != requesterID(c) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "You can only read your own conversations",
+		})
+	}
 
 	query := database.DB.Order("created_at asc")
 	if roomId != "" {
+		if _, err := requireRoomMember(c, parseUint(roomId)); err != nil {
+			return sendError(c, err)
+		}
 		query = query.Where("room_id = ?", roomId)
 	} else {
 		query = query.Where("(sender_id = ? AND recipient_id = ?) OR (sender_id = ? AND recipient_id = ?)",
 			userId, recipientId, recipientId, userId)
 	}
 
+	// Hide messages that are awaiting review or were removed by a moderator
+	query = query.Where("moderation_status NOT IN ?", []string{"held", "removed"})
+
 	var messages []models.Message
 	if err := query.Find(&messages).Error; err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
@@ -0,0 +1,273 @@
+package handlers
+
+import (
+	"rag-agent-server/internal/database"
+	"rag-agent-server/internal/models"
+	"rag-agent-server/internal/websocket"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type ModerationHandler struct {
+	hub *websocket.Hub
+}
+
+func NewModerationHandler(hub *websocket.Hub) *ModerationHandler {
+	return &ModerationHandler{hub: hub}
+}
+
+// CreateReport lets the authenticated user report an abusive message or user
+func (h *ModerationHandler) CreateReport(c *fiber.Ctx) error {
+	reporterID := requesterID(c)
+	var body struct {
+		TargetType string `json:"targetType"`
+		TargetID   uint   `json:"targetId"`
+		Reason     string `json:"reason"`
+		Details    string `json:"details"`
+	}
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Cannot parse JSON"})
+	}
+
+	if body.TargetID == 0 || strings.TrimSpace(body.Reason) == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "targetId and reason are required"})
+	}
+
+	switch body.TargetType {
+	case "message":
+		var msg models.Message
+		if err := database.DB.First(&msg, body.TargetID).Error; err != nil {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Message not found"})
+		}
+	case "user":
+		if body.TargetID == reporterID {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "You cannot report yourself"})
+		}
+		var user models.User
+		if err := database.DB.First(&user, body.TargetID).Error; err != nil {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "User not found"})
+		}
+	default:
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "targetType must be 'message' or 'user'"})
+	}
+
+	// One pending report per reporter and target
+	var existing models.Report
+	if err := database.DB.Where("reporter_id = ? AND target_type = ? AND target_id = ? AND status = ?",
+		reporterID, body.TargetType, body.TargetID, "pending").First(&existing).Error; err == nil {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "You have already reported this"})
+	}
+
+	report := models.Report{
+		ReporterID: reporterID,
+		TargetType: body.TargetType,
+		TargetID:   body.TargetID,
+		Reason:     body.Reason,
+		Details:    body.Details,
+		Source:     "user",
+		Status:     "pending",
+	}
+	if err := database.DB.Create(&report).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not create report"})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(report)
+}
+
+// GetReports returns the moderation queue (pending by default) with the reported content
+func (h *ModerationHandler) GetReports(c *fiber.Ctx) error {
+	status := c.Query("status", "pending")
+	query := database.DB.Order("created_at asc")
+	if status != "all" {
+		query = query.Where("status = ?", status)
+	}
+	if targetType := c.Query("targetType"); targetType != "" {
+		query = query.Where("target_type = ?", targetType)
+	}
+	if source := c.Query("source"); source != "" {
+		query = query.Where("source = ?", source)
+	}
+
+	var reports []models.Report
+	if err := query.Find(&reports).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not fetch reports"})
+	}
+
+	var messageIDs, userIDs []uint
+	for _, r := range reports {
+		if r.TargetType == "message" {
+			messageIDs = append(messageIDs, r.TargetID)
+		} else {
+			userIDs = append(userIDs, r.TargetID)
+		}
+	}
+
+	messagesByID := make(map[uint]models.Message)
+	if len(messageIDs) > 0 {
+		var messages []models.Message
+		database.DB.Where("id IN ?", messageIDs).Find(&messages)
+		for _, m := range messages {
+			messagesByID[m.ID] = m
+		}
+	}
+
+	usersByID := make(map[uint]models.User)
+	if len(userIDs) > 0 {
+		var users []models.User
+		database.DB.Where("id IN ?", userIDs).Find(&users)
+		for _, u := range users {
+			u.Password = ""
+			usersByID[u.ID] = u
+		}
+	}
+
+	response := make([]fiber.Map, 0, len(reports))
+	for _, r := range reports {
+		item := fiber.Map{"report": r}
+		if r.TargetType == "message" {
+			if m, ok := messagesByID[r.TargetID]; ok {
+				item["message"] = m
+			}
+		} else if u, ok := usersByID[r.TargetID]; ok {
+			item["user"] = u
+		}
+		response = append(response, item)
+	}
+
+	return c.JSON(response)
+}
+
+// ResolveReport applies a moderation action and closes all pending reports on the same target
+func (h *ModerationHandler) ResolveReport(c *fiber.Ctx) error {
+	var body struct {
+		Action string `json:"action"` // remove_message, approve_message, block_user, flag_user, none
+		Note   string `json:"note"`
+	}
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Cannot parse JSON"})
+	}
+
+	report, err := h.findPendingReport(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	switch body.Action {
+	case "remove_message", "approve_message":
+		if report.TargetType != "message" {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Action applies to message reports only"})
+		}
+		status := "removed"
+		if body.Action == "approve_message" {
+			status = "approved"
+		}
+		if err := h.setMessageStatus(report.TargetID, status); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not update message"})
+		}
+	case "block_user", "flag_user":
+		userID := report.TargetID
+		if report.TargetType == "message" {
+			var msg models.Message
+			if err := database.DB.First(&msg, report.TargetID).Error; err != nil {
+				return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Message not found"})
+			}
+			userID = msg.SenderID
+		}
+		updates := map[string]interface{}{"is_blocked": true}
+		if body.Action == "flag_user" {
+			updates = map[string]interface{}{"is_flagged": true, "flag_reason": report.Reason}
+		}
+		if err := database.DB.Model(&models.User{}).Where("id = ?", userID).Updates(updates).Error; err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not update user"})
+		}
+	case "none", "":
+		body.Action = "none"
+	default:
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid action"})
+	}
+
+	resolution := body.Action
+	if body.Note != "" {
+		resolution += ": " + body.Note
+	}
+	if err := h.closeReports(report, "resolved", resolution, requesterID(c)); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not resolve report"})
+	}
+
+	return c.JSON(fiber.Map{"message": "Report resolved"})
+}
+
+// DismissReport closes a report without action. A held message is released.
+func (h *ModerationHandler) DismissReport(c *fiber.Ctx) error {
+	var body struct {
+		Note string `json:"note"`
+	}
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Cannot parse JSON"})
+	}
+
+	report, err := h.findPendingReport(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	if report.TargetType == "message" {
+		var msg models.Message
+		if err := database.DB.First(&msg, report.TargetID).Error; err == nil && msg.ModerationStatus != "removed" {
+			if err := h.setMessageStatus(msg.ID, "approved"); err != nil {
+				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not update message"})
+			}
+		}
+	}
+
+	if err := h.closeReports(report, "dismissed", body.Note, requesterID(c)); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not dismiss report"})
+	}
+
+	return c.JSON(fiber.Map{"message": "Report dismissed"})
+}
+
+func (h *ModerationHandler) findPendingReport(id string) (*models.Report, error) {
+	var report models.Report
+	if err := database.DB.First(&report, id).Error; err != nil {
+		return nil, fiber.NewError(fiber.StatusNotFound, "Report not found")
+	}
+	if report.Status != "pending" {
+		return nil, fiber.NewError(fiber.StatusNotFound, "Report is already closed")
+	}
+	return &report, nil
+}
+
+// setMessageStatus updates a message's moderation status. A held message that
+// gets approved is broadcast now, since it was never delivered.
+func (h *ModerationHandler) setMessageStatus(messageID uint, status string) error {
+	var msg models.Message
+	if err := database.DB.First(&msg, messageID).Error; err != nil {
+		return err
+	}
+
+	wasHeld := msg.ModerationStatus == "held"
+	if err := database.DB.Model(&msg).Update("moderation_status", status).Error; err != nil {
+		return err
+	}
+
+	if wasHeld && status == "approved" && h.hub != nil {
+		msg.ModerationStatus = status
+		h.hub.Broadcast(msg)
+	}
+	return nil
+}
+
+func (h *ModerationHandler) closeReports(report *models.Report, status, resolution string, adminID uint) error {
+	now := time.Now()
+	return database.DB.Model(&models.Report{}).
+		Where("target_type = ? AND target_id = ? AND status = ?", report.TargetType, report.TargetID, "pending").
+		Updates(map[string]interface{}{
+			"status":      status,
+			"resolution":  resolution,
+			"resolved_by": adminID,
+			"resolved_at": now,
+		}).Error
+}
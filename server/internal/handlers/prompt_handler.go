@@ -0,0 +1,133 @@
+package handlers
+
+import (
+	"rag-agent-server/internal/models"
+	"rag-agent-server/internal/services"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type PromptHandler struct {
+	prompts *services.PromptService
+}
+
+func NewPromptHandler(prompts *services.PromptService) *PromptHandler {
+	return &PromptHandler{prompts: prompts}
+}
+
+type promptSummary struct {
+	services.PromptDefinition
+	// Active maps each language to its active version
+	Active map[string]models.PromptTemplate `json:"active"`
+}
+
+// GetPrompts lists every editable prompt with its variables, sample data and
+// the active version per language
+func (h *PromptHandler) GetPrompts(c *fiber.Ctx) error {
+	summaries := make([]promptSummary, 0, len(services.PromptDefinitions))
+	for _, def := range services.PromptDefinitions {
+		versions, err := services.PromptVersions(def.Key, "")
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch prompts"})
+		}
+		summary := promptSummary{PromptDefinition: def, Active: make(map[string]models.PromptTemplate)}
+		for _, v := range versions {
+			if v.IsActive {
+				summary.Active[v.Language] = v
+			}
+		}
+		summaries = append(summaries, summary)
+	}
+	return c.JSON(summaries)
+}
+
+// GetPromptVersions returns the version history of a prompt, optionally
+// filtered by ?language=
+func (h *PromptHandler) GetPromptVersions(c *fiber.Ctx) error {
+	key := c.Params("key")
+	if _, ok := services.PromptDefinitionFor(key); !ok {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Unknown prompt"})
+	}
+
+	versions, err := services.PromptVersions(key, c.Query("language"))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch versions"})
+	}
+	return c.JSON(versions)
+}
+
+// SavePromptVersion stores an edited prompt as a new version, activating it
+// unless "activate" is false
+func (h *PromptHandler) SavePromptVersion(c *fiber.Ctx) error {
+	key := c.Params("key")
+	if _, ok := services.PromptDefinitionFor(key); !ok {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Unknown prompt"})
+	}
+
+	var body struct {
+		Language string `json:"language"`
+		Body     string `json:"body"`
+		Comment  string `json:"comment"`
+		Activate *bool  `json:"activate"`
+	}
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+	activate := body.Activate == nil || *body.Activate
+
+	version, err := h.prompts.SaveVersion(key, body.Language, body.Body, body.Comment, requesterID(c), activate)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.Status(fiber.StatusCreated).JSON(version)
+}
+
+// PreviewPrompt renders a draft body, a stored version or the active version
+// against the prompt's sample data, or against "data" when given
+func (h *PromptHandler) PreviewPrompt(c *fiber.Ctx) error {
+	key := c.Params("key")
+	if _, ok := services.PromptDefinitionFor(key); !ok {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Unknown prompt"})
+	}
+
+	var body struct {
+		Language string              `json:"language"`
+		Body     string              `json:"body"`
+		Version  int                 `json:"version"`
+		Data     services.PromptData `json:"data"`
+	}
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+	if body.Language == "" {
+		body.Language = services.PromptFallbackLanguage
+	}
+
+	rendered, err := h.prompts.Preview(key, body.Language, body.Body, body.Version, body.Data)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(fiber.Map{"rendered": rendered})
+}
+
+// RollbackPrompt makes an earlier version of a prompt the active one
+func (h *PromptHandler) RollbackPrompt(c *fiber.Ctx) error {
+	key := c.Params("key")
+	if _, ok := services.PromptDefinitionFor(key); !ok {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Unknown prompt"})
+	}
+
+	var body struct {
+		Language string `json:"language"`
+		Version  int    `json:"version"`
+	}
+	if err := c.BodyParser(&body); err != nil || body.Language == "" || body.Version <= 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "language and version are required"})
+	}
+
+	version, err := h.prompts.ActivateVersion(key, body.Language, body.Version)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(version)
+}
@@ -0,0 +1,57 @@
+package handlers
+
+import (
+	"context"
+	"rag-agent-server/internal/services"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// requesterID returns the ID of the user authenticated by RequireAuth, or 0
+// on routes without it. Client-supplied IDs are never trusted for this.
+func requesterID(c *fiber.Ctx) uint {
+	id, _ := c.Locals(localUserID).(uint)
+	return id
+}
+
+// sendError writes a *fiber.Error as the usual {"error": ...} JSON response,
+// with 402 when the user's plan doesn't include the action
+func sendError(c *fiber.Ctx, err error) error {
+	switch e := err.(type) {
+	case *fiber.Error:
+		return c.Status(e.Code).JSON(fiber.Map{"error": e.Message})
+	case *services.EntitlementError:
+		return c.Status(fiber.StatusPaymentRequired).JSON(fiber.Map{
+			"error":       e.Error(),
+			"code":        "entitlement_exceeded",
+			"entitlement": e.Entitlement,
+			"plan":        e.Plan,
+			"limit":       e.Limit,
+		})
+	}
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+}
+
+// sendAiError reports a failed AI call, with 429 when the user's plan quota is used up
+func sendAiError(c *fiber.Ctx, err error) error {
+	if quotaErr, ok := err.(*services.QuotaError); ok {
+		return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{
+			"error": quotaErr.Error(),
+			"code":  "quota_exceeded",
+		})
+	}
+	return sendError(c, err)
+}
+
+// aiRequestTimeout bounds an AI call made while the client waits, buffered
+// or streamed
+const aiRequestTimeout = 2 * time.Minute
+
+// aiContext is the context for an AI call answered in one response. fasthttp
+// does not report a client that disconnects mid-request, so such calls run
+// until they finish or time out; only streamed replies, which notice failed
+// writes, stop early.
+func aiContext(c *fiber.Ctx) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(c.Context(), aiRequestTimeout)
+}
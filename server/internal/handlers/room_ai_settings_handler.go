@@ -0,0 +1,129 @@
+package handlers
+
+import (
+	"rag-agent-server/internal/database"
+	"rag-agent-server/internal/models"
+	"rag-agent-server/internal/services"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const maxSystemPromptLength = 4000
+
+// GetRoomAiSettings returns the AI persona configuration of a room
+func (h *RoomHandler) GetRoomAiSettings(c *fiber.Ctx) error {
+	var room models.Room
+	if err := database.DB.First(&room, c.Params("id")).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Room not found"})
+	}
+
+	settings := models.RoomAiSettings{RoomID: room.ID, TriggerMode: models.AiTriggerMention}
+	database.DB.Where("room_id = ?", room.ID).First(&settings)
+
+	return c.JSON(settings)
+}
+
+// UpdateRoomAiSettings lets room admins configure the assistant's persona,
+// model, temperature, language, trigger mode and knowledge collections
+func (h *RoomHandler) UpdateRoomAiSettings(c *fiber.Ctx) error {
+	room, _, _, err := authorizeRoom(c, c.Params("id"), permEditSettings)
+	if err != nil {
+		return sendError(c, err)
+	}
+
+	var body struct {
+		Persona      *string  `json:"persona"`
+		SystemPrompt *string  `json:"systemPrompt"`
+		ModelID      *string  `json:"modelId"`
+		Temperature  *float64 `json:"temperature"`
+		Language     *string  `json:"language"`
+		TriggerMode  *string  `json:"triggerMode"`
+		// Seconds between assistant replies, 0 = server default
+		CooldownSeconds    *int  `json:"cooldownSeconds"`
+		ContextTokenBudget *int  `json:"contextTokenBudget"`
+		RollingSummary     *bool `json:"rollingSummary"`
+		// Knowledge collections to draw on, empty for all of them
+		KnowledgeCollections *[]string `json:"knowledgeCollections"`
+		// Explicitly reset temperature to the model default
+		ResetTemperature bool `json:"resetTemperature"`
+	}
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Cannot parse JSON"})
+	}
+
+	settings := models.RoomAiSettings{RoomID: room.ID, TriggerMode: models.AiTriggerMention}
+	database.DB.Where("room_id = ?", room.ID).First(&settings)
+
+	if body.Persona != nil {
+		settings.Persona = strings.TrimSpace(*body.Persona)
+	}
+	if body.SystemPrompt != nil {
+		if len(*body.SystemPrompt) > maxSystemPromptLength {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "System prompt is too long"})
+		}
+		settings.SystemPrompt = strings.TrimSpace(*body.SystemPrompt)
+	}
+	if body.ModelID != nil {
+		modelID := strings.TrimSpace(*body.ModelID)
+		if modelID != "" {
+			var aiModel models.AiModel
+			if err := database.DB.Where("model_id = ? AND is_enabled = ? AND is_deprecated = ?", modelID, true, false).First(&aiModel).Error; err != nil {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Model is not available"})
+			}
+			if aiModel.Category != "" && aiModel.Category != "text" {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Only text models can be used in rooms"})
+			}
+		}
+		settings.ModelID = modelID
+	}
+	if body.Temperature != nil {
+		if *body.Temperature < 0 || *body.Temperature > 2 {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Temperature must be between 0 and 2"})
+		}
+		settings.Temperature = body.Temperature
+	}
+	if body.ResetTemperature {
+		settings.Temperature = nil
+	}
+	if body.Language != nil {
+		language := strings.ToLower(strings.TrimSpace(*body.Language))
+		if len(language) > 10 {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid language"})
+		}
+		settings.Language = language
+	}
+	if body.TriggerMode != nil {
+		switch *body.TriggerMode {
+		case models.AiTriggerEvery, models.AiTriggerMention, models.AiTriggerCommand:
+			settings.TriggerMode = *body.TriggerMode
+		default:
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid trigger mode"})
+		}
+	}
+
+	if body.CooldownSeconds != nil {
+		if *body.CooldownSeconds < 0 || *body.CooldownSeconds > 3600 {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Cooldown must be between 0 and 3600 seconds"})
+		}
+		settings.CooldownSeconds = *body.CooldownSeconds
+	}
+	if body.ContextTokenBudget != nil {
+		if *body.ContextTokenBudget < 0 || *body.ContextTokenBudget > 100000 {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Context token budget must be between 0 and 100000"})
+		}
+		settings.ContextTokenBudget = *body.ContextTokenBudget
+	}
+	if body.RollingSummary != nil {
+		settings.RollingSummary = *body.RollingSummary
+	}
+	if body.KnowledgeCollections != nil {
+		settings.KnowledgeCollections = strings.Join(services.ParseCollections(strings.Join(*body.KnowledgeCollections, ",")), ",")
+	}
+
+	if err := database.DB.Save(&settings).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not save AI settings"})
+	}
+
+	return c.JSON(settings)
+}
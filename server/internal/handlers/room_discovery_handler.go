@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"rag-agent-server/internal/database"
+	"rag-agent-server/internal/models"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// roomListing is a room with its computed member count
+type roomListing struct {
+	models.Room
+	MemberCount int64 `json:"memberCount"`
+}
+
+// normalizeRoomTags lowercases, trims and de-duplicates a comma-separated tag list
+func normalizeRoomTags(tags string) string {
+	seen := make(map[string]bool)
+	var result []string
+	for _, tag := range strings.Split(tags, ",") {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		result = append(result, tag)
+	}
+	return strings.Join(result, ",")
+}
+
+// GetRoomCategories returns the categories rooms can be filed under
+func (h *RoomHandler) GetRoomCategories(c *fiber.Ctx) error {
+	return c.JSON(models.RoomCategories)
+}
+
+// DiscoverRooms searches public rooms with filters, sorting and pagination.
+// Query params: search, category, tag, language, city,
+// sort (activity|members|newest|name), page, limit.
+func (h *RoomHandler) DiscoverRooms(c *fiber.Ctx) error {
+	page := c.QueryInt("page", 1)
+	if page < 1 {
+		page = 1
+	}
+	limit := c.QueryInt("limit", 20)
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+
+	filter := func(query *gorm.DB) *gorm.DB {
+		query = query.Where("rooms.is_public = ? AND rooms.is_archived = ?", true, false)
+
+		if search := c.Query("search"); search != "" {
+			searchTerm := "%" + strings.ToLower(search) + "%"
+			query = query.Where("LOWER(rooms.name) LIKE ? OR LOWER(rooms.description) LIKE ? OR LOWER(rooms.tags) LIKE ?", searchTerm, searchTerm, searchTerm)
+		}
+		if category := c.Query("category"); category != "" {
+			query = query.Where("rooms.category = ?", category)
+		}
+		if tag := normalizeRoomTags(c.Query("tag")); tag != "" {
+			query = query.Where("(',' || rooms.tags || ',') LIKE ?", "%,"+tag+",%")
+		}
+		if language := c.Query("language"); language != "" {
+			query = query.Where("rooms.language = ?", language)
+		}
+		if city := c.Query("city"); city != "" {
+			query = query.Where("LOWER(rooms.city) = ?", strings.ToLower(city))
+		}
+		return query
+	}
+
+	var total int64
+	if err := filter(database.DB.Model(&models.Room{})).Count(&total).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not fetch rooms"})
+	}
+
+	order := "rooms.last_activity_at DESC NULLS LAST, rooms.id DESC"
+	switch c.Query("sort", "activity") {
+	case "members":
+		order = "member_count DESC, rooms.id DESC"
+	case "newest":
+		order = "rooms.created_at DESC"
+	case "name":
+		order = "rooms.name ASC"
+	}
+
+	rooms := []roomListing{}
+	err := filter(database.DB.Model(&models.Room{})).
+		Select("rooms.*, (SELECT COUNT(*) FROM room_members WHERE room_members.room_id = rooms.id AND room_members.deleted_at IS NULL) AS member_count").
+		Order(order).
+		Offset((page - 1) * limit).
+		Limit(limit).
+		Scan(&rooms).Error
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not fetch rooms"})
+	}
+
+	return c.JSON(fiber.Map{
+		"rooms": rooms,
+		"total": total,
+		"page":  page,
+		"limit": limit,
+	})
+}
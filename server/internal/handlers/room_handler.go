@@ -2,19 +2,26 @@ package handlers
 
 import (
 	"fmt"
+	"log"
 	"os"
 	"path/filepath"
 	"rag-agent-server/internal/database"
 	"rag-agent-server/internal/models"
+	"rag-agent-server/internal/services"
+	"rag-agent-server/internal/websocket"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
 )
 
-type RoomHandler struct{}
+type RoomHandler struct {
+	hub     *websocket.Hub
+	billing *services.BillingService
+}
 
-func NewRoomHandler() *RoomHandler {
-	return &RoomHandler{}
+func NewRoomHandler(hub *websocket.Hub, billing *services.BillingService) *RoomHandler {
+	return &RoomHandler{hub: hub, billing: billing}
 }
 
 func (h *RoomHandler) CreateRoom(c *fiber.Ctx) error {
@@ -31,6 +38,22 @@ func (h *RoomHandler) CreateRoom(c *fiber.Ctx) error {
 		})
 	}
 
+	room.OwnerID = requesterID(c)
+
+	if room.Category != "" && !models.IsValidRoomCategory(room.Category) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid room category",
+		})
+	}
+	room.Tags = normalizeRoomTags(room.Tags)
+	if room.AiEnabled {
+		if err := h.billing.CheckEntitlement(room.OwnerID, services.EntitlementAiRooms); err != nil {
+			return sendError(c, err)
+		}
+	}
+	now := time.Now()
+	room.LastActivityAt = &now
+
 	// Save room to DB
 	if err := database.DB.Create(&room).Error; err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
@@ -38,11 +61,11 @@ func (h *RoomHandler) CreateRoom(c *fiber.Ctx) error {
 		})
 	}
 
-	// Add creator as admin
+	// Add creator as owner
 	member := models.RoomMember{
 		RoomID: room.ID,
 		UserID: room.OwnerID,
-		Role:   "admin",
+		Role:   models.RoomRoleOwner,
 	}
 	database.DB.Create(&member)
 
@@ -51,8 +74,8 @@ func (h *RoomHandler) CreateRoom(c *fiber.Ctx) error {
 
 func (h *RoomHandler) GetRooms(c *fiber.Ctx) error {
 	var rooms []models.Room
-	// For now, return all public rooms
-	if err := database.DB.Where("is_public = ?", true).Find(&rooms).Error; err != nil {
+	// For now, return all public rooms that are still active
+	if err := database.DB.Where("is_public = ? AND is_archived = ?", true, false).Find(&rooms).Error; err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Could not fetch rooms",
 		})
@@ -72,6 +95,10 @@ func (h *RoomHandler) InviteUser(c *fiber.Ctx) error {
 		})
 	}
 
+	if _, _, _, err := authorizeRoom(c, body.RoomID, permInviteMembers); err != nil {
+		return sendError(c, err)
+	}
+
 	// Check if already a member
 	var existing models.RoomMember
 	if err := database.DB.Where("room_id = ? AND user_id = ?", body.RoomID, body.UserID).First(&existing).Error; err == nil {
@@ -83,7 +110,7 @@ func (h *RoomHandler) InviteUser(c *fiber.Ctx) error {
 	member := models.RoomMember{
 		RoomID: body.RoomID,
 		UserID: body.UserID,
-		Role:   "member",
+		Role:   models.RoomRoleMember,
 	}
 
 	if err := database.DB.Create(&member).Error; err != nil {
@@ -141,15 +168,47 @@ func (h *RoomHandler) UpdateMemberRole(c *fiber.Ctx) error {
 		})
 	}
 
-	if body.Role != "admin" && body.Role != "member" {
+	if !isValidRoomRole(body.Role) {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 			"error": "Invalid role",
 		})
 	}
 
-	if err := database.DB.Model(&models.RoomMember{}).
-		Where("room_id = ? AND user_id = ?", body.RoomID, body.UserID).
-		Update("role", body.Role).Error; err != nil {
+	room, _, callerRole, err := authorizeRoom(c, body.RoomID, permManageRoles)
+	if err != nil {
+		return sendError(c, err)
+	}
+
+	var target models.RoomMember
+	if err := database.DB.Where("room_id = ? AND user_id = ?", room.ID, body.UserID).First(&target).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "User is not a member of this room",
+		})
+	}
+
+	// Only owners can grant ownership; others can't promote to their own rank or act on peers
+	if body.Role == models.RoomRoleOwner && callerRole != models.RoomRoleOwner {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "Only owners can grant ownership",
+		})
+	}
+	if !canManageMember(callerRole, target.Role) || !canManageMember(callerRole, body.Role) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "You cannot change the role of this member",
+		})
+	}
+	if target.Role == models.RoomRoleOwner && body.Role != models.RoomRoleOwner && isLastOwner(room.ID, target.UserID) {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "The room must keep at least one owner",
+		})
+	}
+	if room.OwnerID == target.UserID && body.Role != models.RoomRoleOwner {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "Transfer ownership before changing the primary owner's role",
+		})
+	}
+
+	if err := database.DB.Model(&target).Update("role", body.Role).Error; err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Could not update role",
 		})
@@ -169,8 +228,36 @@ func (h *RoomHandler) RemoveUser(c *fiber.Ctx) error {
 		})
 	}
 
-	// Delete member
-	if err := database.DB.Where("room_id = ? AND user_id = ?", body.RoomID, body.UserID).Delete(&models.RoomMember{}).Error; err != nil {
+	room, _, callerRole, err := authorizeRoom(c, body.RoomID, permRemoveMembers)
+	if err != nil {
+		return sendError(c, err)
+	}
+
+	var target models.RoomMember
+	if err := database.DB.Where("room_id = ? AND user_id = ?", room.ID, body.UserID).First(&target).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "User is not a member of this room",
+		})
+	}
+
+	if !canManageMember(callerRole, target.Role) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "You cannot remove this member",
+		})
+	}
+	if target.Role == models.RoomRoleOwner && isLastOwner(room.ID, target.UserID) {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "The last owner cannot be removed",
+		})
+	}
+	if room.OwnerID == target.UserID {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "Transfer ownership before removing the primary owner",
+		})
+	}
+
+	// Delete member. Hard delete so the unique (room, user) index allows rejoining.
+	if err := database.DB.Unscoped().Delete(&target).Error; err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Could not remove user",
 		})
@@ -181,6 +268,9 @@ func (h *RoomHandler) RemoveUser(c *fiber.Ctx) error {
 
 func (h *RoomHandler) UpdateRoomImage(c *fiber.Ctx) error {
 	roomID := c.Params("id")
+	if _, _, _, err := authorizeRoom(c, roomID, permEditRoom); err != nil {
+		return sendError(c, err)
+	}
 
 	// Get uploaded file
 	file, err := c.FormFile("image")
@@ -225,14 +315,62 @@ func (h *RoomHandler) UpdateRoomImage(c *fiber.Ctx) error {
 
 func (h *RoomHandler) UpdateRoom(c *fiber.Ctx) error {
 	roomID := c.Params("id")
+	if _, _, _, err := authorizeRoom(c, roomID, permEditRoom); err != nil {
+		return sendError(c, err)
+	}
 
-	var updates map[string]interface{}
-	if err := c.BodyParser(&updates); err != nil {
+	// Only whitelisted fields can be changed here; ownership, visibility and
+	// AI settings have their own endpoints
+	var body struct {
+		Name        *string `json:"name"`
+		Description *string `json:"description"`
+		Category    *string `json:"category"`
+		Tags        *string `json:"tags"`
+		Language    *string `json:"language"`
+		City        *string `json:"city"`
+	}
+	if err := c.BodyParser(&body); err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 			"error": "Cannot parse JSON",
 		})
 	}
 
+	updates := make(map[string]interface{})
+	if body.Name != nil {
+		if *body.Name == "" {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Room name is required",
+			})
+		}
+		updates["name"] = *body.Name
+	}
+	if body.Description != nil {
+		updates["description"] = *body.Description
+	}
+	if body.Category != nil {
+		if *body.Category != "" && !models.IsValidRoomCategory(*body.Category) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid room category",
+			})
+		}
+		updates["category"] = *body.Category
+	}
+	if body.Tags != nil {
+		updates["tags"] = normalizeRoomTags(*body.Tags)
+	}
+	if body.Language != nil {
+		updates["language"] = *body.Language
+	}
+	if body.City != nil {
+		updates["city"] = *body.City
+	}
+
+	if len(updates) == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "No fields to update",
+		})
+	}
+
 	// Update room in database
 	if err := database.DB.Model(&models.Room{}).Where("id = ?", roomID).Updates(updates).Error; err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
@@ -245,6 +383,10 @@ func (h *RoomHandler) UpdateRoom(c *fiber.Ctx) error {
 
 func (h *RoomHandler) UpdateRoomSettings(c *fiber.Ctx) error {
 	roomID := c.Params("id")
+	room, _, _, err := authorizeRoom(c, roomID, permEditSettings)
+	if err != nil {
+		return sendError(c, err)
+	}
 
 	var body struct {
 		IsPublic  *bool `json:"isPublic"`
@@ -262,6 +404,12 @@ func (h *RoomHandler) UpdateRoomSettings(c *fiber.Ctx) error {
 		updates["is_public"] = *body.IsPublic
 	}
 	if body.AiEnabled != nil {
+		// AI rooms count against the owner's plan
+		if *body.AiEnabled && !room.AiEnabled {
+			if err := h.billing.CheckEntitlement(room.OwnerID, services.EntitlementAiRooms); err != nil {
+				return sendError(c, err)
+			}
+		}
 		updates["ai_enabled"] = *body.AiEnabled
 	}
 
@@ -279,3 +427,61 @@ func (h *RoomHandler) UpdateRoomSettings(c *fiber.Ctx) error {
 
 	return c.SendStatus(fiber.StatusOK)
 }
+
+// TransferOwnership hands the room over to another member. Only the primary
+// owner may do this, not co-owners. The previous primary owner stays in the
+// room as an admin.
+func (h *RoomHandler) TransferOwnership(c *fiber.Ctx) error {
+	var body struct {
+		UserID uint `json:"userId"`
+	}
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Cannot parse JSON",
+		})
+	}
+
+	room, callerID, _, err := authorizeRoom(c, c.Params("id"), permTransferOwnership)
+	if err != nil {
+		return sendError(c, err)
+	}
+	if callerID != room.OwnerID {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "Only the primary owner can transfer ownership",
+		})
+	}
+
+	if body.UserID == 0 || body.UserID == room.OwnerID {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "A different member must be chosen as the new owner",
+		})
+	}
+
+	var target models.RoomMember
+	if err := database.DB.Where("room_id = ? AND user_id = ?", room.ID, body.UserID).First(&target).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "User is not a member of this room",
+		})
+	}
+
+	previousOwnerID := room.OwnerID
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&target).Update("role", models.RoomRoleOwner).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(room).Update("owner_id", target.UserID).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.RoomMember{}).
+			Where("room_id = ? AND user_id = ?", room.ID, previousOwnerID).
+			Update("role", models.RoomRoleAdmin).Error
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Could not transfer ownership",
+		})
+	}
+
+	log.Printf("[Rooms] Room %d ownership transferred from %d to %d", room.ID, previousOwnerID, target.UserID)
+	return c.JSON(room)
+}
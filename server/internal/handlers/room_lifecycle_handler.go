@@ -0,0 +1,134 @@
+package handlers
+
+import (
+	"log"
+	"os"
+	"rag-agent-server/internal/database"
+	"rag-agent-server/internal/models"
+	"rag-agent-server/internal/websocket"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// notifyMembers sends a room event to the given users over the websocket hub
+func (h *RoomHandler) notifyMembers(userIDs []uint, event websocket.RoomEvent) {
+	if h.hub != nil {
+		h.hub.SendToUsers(userIDs, event)
+	}
+}
+
+// ArchiveRoom makes a room read-only, or restores it with {"archived": false}
+func (h *RoomHandler) ArchiveRoom(c *fiber.Ctx) error {
+	room, callerID, _, err := authorizeRoom(c, c.Params("id"), permArchiveRoom)
+	if err != nil {
+		return sendError(c, err)
+	}
+
+	body := struct {
+		Archived *bool `json:"archived"`
+	}{}
+	c.BodyParser(&body)
+	archived := body.Archived == nil || *body.Archived
+
+	updates := map[string]interface{}{"is_archived": archived, "archived_at": nil}
+	if archived {
+		updates["archived_at"] = time.Now()
+	}
+	if err := database.DB.Model(room).Updates(updates).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Could not update room",
+		})
+	}
+
+	event := "room_archived"
+	if !archived {
+		event = "room_unarchived"
+	}
+	h.notifyMembers(RoomMemberIDs(room.ID), websocket.RoomEvent{Event: event, RoomID: room.ID, UserID: callerID})
+
+	return c.JSON(room)
+}
+
+// DeleteRoom removes a room together with its members, messages, invites,
+// join requests, scheduled messages, AI settings, context summaries and
+// uploaded image
+func (h *RoomHandler) DeleteRoom(c *fiber.Ctx) error {
+	room, callerID, _, err := authorizeRoom(c, c.Params("id"), permDeleteRoom)
+	if err != nil {
+		return sendError(c, err)
+	}
+
+	// Collect members before they are deleted so they can be notified
+	memberIDs := RoomMemberIDs(room.ID)
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		cascade := []interface{}{
+			&models.RoomMember{},
+			&models.Message{},
+			&models.RoomInvite{},
+			&models.RoomJoinRequest{},
+			&models.ScheduledMessage{},
+			&models.RoomAiSettings{},
+			&models.RoomContextSummary{},
+		}
+		for _, model := range cascade {
+			if err := tx.Unscoped().Where("room_id = ?", room.ID).Delete(model).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Unscoped().Delete(room).Error
+	})
+	if err != nil {
+		log.Printf("[Rooms] Failed to delete room %d: %v", room.ID, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Could not delete room",
+		})
+	}
+
+	if strings.HasPrefix(room.ImageURL, "/uploads/rooms/") {
+		if err := os.Remove("." + room.ImageURL); err != nil && !os.IsNotExist(err) {
+			log.Printf("[Rooms] Failed to remove image for room %d: %v", room.ID, err)
+		}
+	}
+
+	h.notifyMembers(memberIDs, websocket.RoomEvent{Event: "room_deleted", RoomID: room.ID, UserID: callerID})
+	log.Printf("[Rooms] Room %d deleted by user %d", room.ID, callerID)
+
+	return c.SendStatus(fiber.StatusOK)
+}
+
+// LeaveRoom removes the caller from a room. Owners must hand over ownership first.
+func (h *RoomHandler) LeaveRoom(c *fiber.Ctx) error {
+	callerID := requesterID(c)
+	if callerID == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "User ID is required"})
+	}
+
+	var room models.Room
+	if err := database.DB.First(&room, c.Params("id")).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Room not found"})
+	}
+
+	var member models.RoomMember
+	if err := database.DB.Where("room_id = ? AND user_id = ?", room.ID, callerID).First(&member).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "You are not a member of this room"})
+	}
+
+	if room.OwnerID == callerID || (member.Role == models.RoomRoleOwner && isLastOwner(room.ID, callerID)) {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "Transfer ownership or delete the room before leaving",
+		})
+	}
+
+	if err := database.DB.Unscoped().Delete(&member).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not leave room"})
+	}
+
+	recipients := append(RoomMemberIDs(room.ID), callerID)
+	h.notifyMembers(recipients, websocket.RoomEvent{Event: "member_left", RoomID: room.ID, UserID: callerID})
+
+	return c.SendStatus(fiber.StatusOK)
+}
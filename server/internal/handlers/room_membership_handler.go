@@ -0,0 +1,376 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"rag-agent-server/internal/database"
+	"rag-agent-server/internal/models"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// addRoomMember adds the user to the room unless they are already a member
+func addRoomMember(roomID, userID uint, role string) (*models.RoomMember, error) {
+	var member models.RoomMember
+	err := database.DB.Where("room_id = ? AND user_id = ?", roomID, userID).First(&member).Error
+	if err == nil {
+		return &member, nil
+	}
+
+	member = models.RoomMember{RoomID: roomID, UserID: userID, Role: role}
+	if err := database.DB.Create(&member).Error; err != nil {
+		return nil, err
+	}
+	return &member, nil
+}
+
+func generateInviteCode() (string, error) {
+	buf := make([]byte, 9)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// JoinRoom adds the caller to a public room, or files a join request for a private one
+func (h *RoomHandler) JoinRoom(c *fiber.Ctx) error {
+	userID := requesterID(c)
+	if userID == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "User ID is required"})
+	}
+
+	var room models.Room
+	if err := database.DB.First(&room, c.Params("id")).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Room not found"})
+	}
+	if room.IsArchived {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Room is archived"})
+	}
+
+	var existing models.RoomMember
+	if err := database.DB.Where("room_id = ? AND user_id = ?", room.ID, userID).First(&existing).Error; err == nil {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "You are already a member of this room"})
+	}
+
+	if room.IsPublic {
+		member, err := addRoomMember(room.ID, userID, models.RoomRoleMember)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not join room"})
+		}
+		return c.Status(fiber.StatusCreated).JSON(member)
+	}
+
+	var body struct {
+		Message string `json:"message"`
+	}
+	c.BodyParser(&body)
+
+	var pending models.RoomJoinRequest
+	if err := database.DB.Where("room_id = ? AND user_id = ? AND status = ?", room.ID, userID, "pending").First(&pending).Error; err == nil {
+		return c.Status(fiber.StatusAccepted).JSON(pending)
+	}
+
+	request := models.RoomJoinRequest{
+		RoomID:  room.ID,
+		UserID:  userID,
+		Message: body.Message,
+		Status:  "pending",
+	}
+	if err := database.DB.Create(&request).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not create join request"})
+	}
+
+	return c.Status(fiber.StatusAccepted).JSON(request)
+}
+
+// GetMyRooms lists the rooms the caller is a member of, with their role
+func (h *RoomHandler) GetMyRooms(c *fiber.Ctx) error {
+	userID := requesterID(c)
+	if userID == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "User ID is required"})
+	}
+
+	var members []models.RoomMember
+	if err := database.DB.Where("user_id = ?", userID).Find(&members).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not fetch rooms"})
+	}
+
+	roleByRoom := make(map[uint]string)
+	var roomIDs []uint
+	for _, m := range members {
+		roomIDs = append(roomIDs, m.RoomID)
+		roleByRoom[m.RoomID] = m.Role
+	}
+
+	response := []fiber.Map{}
+	if len(roomIDs) == 0 {
+		return c.JSON(response)
+	}
+
+	var rooms []models.Room
+	if err := database.DB.Where("id IN ?", roomIDs).Order("name asc").Find(&rooms).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not fetch rooms"})
+	}
+
+	for _, room := range rooms {
+		response = append(response, fiber.Map{
+			"room": room,
+			"role": roleByRoom[room.ID],
+		})
+	}
+	return c.JSON(response)
+}
+
+// CreateInvite creates an invite link for a room
+func (h *RoomHandler) CreateInvite(c *fiber.Ctx) error {
+	room, callerID, _, err := authorizeRoom(c, c.Params("id"), permManageInvites)
+	if err != nil {
+		return sendError(c, err)
+	}
+
+	var body struct {
+		ExpiresInHours int `json:"expiresInHours"` // 0 = never expires
+		MaxUses        int `json:"maxUses"`        // 0 = unlimited
+	}
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Cannot parse JSON"})
+	}
+	if body.ExpiresInHours < 0 || body.MaxUses < 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "expiresInHours and maxUses cannot be negative"})
+	}
+
+	code, err := generateInviteCode()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not generate invite code"})
+	}
+
+	invite := models.RoomInvite{
+		RoomID:    room.ID,
+		Code:      code,
+		CreatedBy: callerID,
+		MaxUses:   body.MaxUses,
+	}
+	if body.ExpiresInHours > 0 {
+		expiresAt := time.Now().Add(time.Duration(body.ExpiresInHours) * time.Hour)
+		invite.ExpiresAt = &expiresAt
+	}
+
+	if err := database.DB.Create(&invite).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not create invite"})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(invite)
+}
+
+// GetInvites lists a room's invite links
+func (h *RoomHandler) GetInvites(c *fiber.Ctx) error {
+	room, _, _, err := authorizeRoom(c, c.Params("id"), permManageInvites)
+	if err != nil {
+		return sendError(c, err)
+	}
+
+	var invites []models.RoomInvite
+	if err := database.DB.Where("room_id = ?", room.ID).Order("created_at desc").Find(&invites).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not fetch invites"})
+	}
+	return c.JSON(invites)
+}
+
+// RevokeInvite disables an invite link
+func (h *RoomHandler) RevokeInvite(c *fiber.Ctx) error {
+	room, _, _, err := authorizeRoom(c, c.Params("id"), permManageInvites)
+	if err != nil {
+		return sendError(c, err)
+	}
+
+	result := database.DB.Model(&models.RoomInvite{}).
+		Where("id = ? AND room_id = ?", c.Params("inviteId"), room.ID).
+		Update("is_revoked", true)
+	if result.Error != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not revoke invite"})
+	}
+	if result.RowsAffected == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Invite not found"})
+	}
+	return c.SendStatus(fiber.StatusOK)
+}
+
+// findUsableInvite loads an invite by code and checks that it can still be used
+func findUsableInvite(code string) (*models.RoomInvite, error) {
+	var invite models.RoomInvite
+	if err := database.DB.Where("code = ?", code).First(&invite).Error; err != nil {
+		return nil, fiber.NewError(fiber.StatusNotFound, "Invite not found")
+	}
+	if invite.IsRevoked {
+		return nil, fiber.NewError(fiber.StatusGone, "Invite has been revoked")
+	}
+	if invite.ExpiresAt != nil && time.Now().After(*invite.ExpiresAt) {
+		return nil, fiber.NewError(fiber.StatusGone, "Invite has expired")
+	}
+	if invite.MaxUses > 0 && invite.Uses >= invite.MaxUses {
+		return nil, fiber.NewError(fiber.StatusGone, "Invite has reached its usage limit")
+	}
+	return &invite, nil
+}
+
+// GetInvitePreview shows which room an invite code leads to
+func (h *RoomHandler) GetInvitePreview(c *fiber.Ctx) error {
+	invite, err := findUsableInvite(c.Params("code"))
+	if err != nil {
+		return sendError(c, err)
+	}
+
+	var room models.Room
+	if err := database.DB.First(&room, invite.RoomID).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Room not found"})
+	}
+
+	var memberCount int64
+	database.DB.Model(&models.RoomMember{}).Where("room_id = ?", room.ID).Count(&memberCount)
+
+	return c.JSON(fiber.Map{
+		"room":        room,
+		"memberCount": memberCount,
+		"expiresAt":   invite.ExpiresAt,
+	})
+}
+
+// AcceptInvite joins the caller to the room behind an invite code
+func (h *RoomHandler) AcceptInvite(c *fiber.Ctx) error {
+	userID := requesterID(c)
+	if userID == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "User ID is required"})
+	}
+
+	invite, err := findUsableInvite(c.Params("code"))
+	if err != nil {
+		return sendError(c, err)
+	}
+
+	var room models.Room
+	if err := database.DB.First(&room, invite.RoomID).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Room not found"})
+	}
+	if room.IsArchived {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Room is archived"})
+	}
+
+	var existing models.RoomMember
+	if err := database.DB.Where("room_id = ? AND user_id = ?", invite.RoomID, userID).First(&existing).Error; err == nil {
+		return c.JSON(existing)
+	}
+
+	var member *models.RoomMember
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		// Claim a use atomically so concurrent accepts can't exceed MaxUses
+		result := tx.Model(&models.RoomInvite{}).
+			Where("id = ? AND (max_uses = 0 OR uses < max_uses)", invite.ID).
+			Update("uses", gorm.Expr("uses + 1"))
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return fiber.NewError(fiber.StatusGone, "Invite has reached its usage limit")
+		}
+
+		member = &models.RoomMember{RoomID: invite.RoomID, UserID: userID, Role: models.RoomRoleMember}
+		return tx.Create(member).Error
+	})
+	if err != nil {
+		if _, ok := err.(*fiber.Error); ok {
+			return sendError(c, err)
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not join room"})
+	}
+
+	// Any pending join request is fulfilled by the invite
+	database.DB.Model(&models.RoomJoinRequest{}).
+		Where("room_id = ? AND user_id = ? AND status = ?", invite.RoomID, userID, "pending").
+		Updates(map[string]interface{}{"status": "approved", "reviewed_at": time.Now()})
+
+	return c.Status(fiber.StatusCreated).JSON(member)
+}
+
+// GetJoinRequests lists join requests for a room (pending by default)
+func (h *RoomHandler) GetJoinRequests(c *fiber.Ctx) error {
+	room, _, _, err := authorizeRoom(c, c.Params("id"), permReviewJoinRequests)
+	if err != nil {
+		return sendError(c, err)
+	}
+
+	query := database.DB.Where("room_id = ?", room.ID).Order("created_at asc")
+	if status := c.Query("status", "pending"); status != "all" {
+		query = query.Where("status = ?", status)
+	}
+
+	var requests []models.RoomJoinRequest
+	if err := query.Find(&requests).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not fetch join requests"})
+	}
+
+	var userIDs []uint
+	for _, r := range requests {
+		userIDs = append(userIDs, r.UserID)
+	}
+	usersByID := make(map[uint]models.User)
+	if len(userIDs) > 0 {
+		var users []models.User
+		database.DB.Where("id IN ?", userIDs).Find(&users)
+		for _, u := range users {
+			u.Password = ""
+			usersByID[u.ID] = u
+		}
+	}
+
+	response := make([]fiber.Map, 0, len(requests))
+	for _, r := range requests {
+		response = append(response, fiber.Map{
+			"request": r,
+			"user":    usersByID[r.UserID],
+		})
+	}
+	return c.JSON(response)
+}
+
+// ApproveJoinRequest adds the requesting user to the room
+func (h *RoomHandler) ApproveJoinRequest(c *fiber.Ctx) error {
+	return h.reviewJoinRequest(c, "approved")
+}
+
+// RejectJoinRequest declines a join request
+func (h *RoomHandler) RejectJoinRequest(c *fiber.Ctx) error {
+	return h.reviewJoinRequest(c, "rejected")
+}
+
+func (h *RoomHandler) reviewJoinRequest(c *fiber.Ctx, status string) error {
+	room, callerID, _, err := authorizeRoom(c, c.Params("id"), permReviewJoinRequests)
+	if err != nil {
+		return sendError(c, err)
+	}
+
+	var request models.RoomJoinRequest
+	if err := database.DB.Where("room_id = ?", room.ID).First(&request, c.Params("requestId")).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Join request not found"})
+	}
+	if request.Status != "pending" {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "Join request was already reviewed"})
+	}
+
+	if status == "approved" {
+		if _, err := addRoomMember(room.ID, request.UserID, models.RoomRoleMember); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not add member"})
+		}
+	}
+
+	now := time.Now()
+	request.Status = status
+	request.ReviewedBy = callerID
+	request.ReviewedAt = &now
+	if err := database.DB.Save(&request).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not update join request"})
+	}
+
+	return c.JSON(request)
+}
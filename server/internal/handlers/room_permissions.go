@@ -0,0 +1,145 @@
+package handlers
+
+import (
+	"rag-agent-server/internal/database"
+	"rag-agent-server/internal/models"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type roomPermission string
+
+const (
+	permInviteMembers      roomPermission = "invite_members"
+	permRemoveMembers      roomPermission = "remove_members"
+	permManageRoles        roomPermission = "manage_roles"
+	permEditRoom           roomPermission = "edit_room"
+	permEditSettings       roomPermission = "edit_settings"
+	permManageInvites      roomPermission = "manage_invites"
+	permReviewJoinRequests roomPermission = "review_join_requests"
+	permTransferOwnership  roomPermission = "transfer_ownership"
+	permArchiveRoom        roomPermission = "archive_room"
+	permDeleteRoom         roomPermission = "delete_room"
+)
+
+// roomPermissionMatrix lists what each room role is allowed to do
+var roomPermissionMatrix = map[string]map[roomPermission]bool{
+	models.RoomRoleOwner: {
+		permInviteMembers:      true,
+		permRemoveMembers:      true,
+		permManageRoles:        true,
+		permEditRoom:           true,
+		permEditSettings:       true,
+		permManageInvites:      true,
+		permReviewJoinRequests: true,
+		permTransferOwnership:  true,
+		permArchiveRoom:        true,
+		permDeleteRoom:         true,
+	},
+	models.RoomRoleAdmin: {
+		permInviteMembers:      true,
+		permRemoveMembers:      true,
+		permManageRoles:        true,
+		permEditRoom:           true,
+		permEditSettings:       true,
+		permManageInvites:      true,
+		permReviewJoinRequests: true,
+	},
+	models.RoomRoleModerator: {
+		permInviteMembers:      true,
+		permRemoveMembers:      true,
+		permManageInvites:      true,
+		permReviewJoinRequests: true,
+	},
+	models.RoomRoleMember: {},
+}
+
+// roomRoleRank orders roles so that members can only act on lower-ranked members
+var roomRoleRank = map[string]int{
+	models.RoomRoleMember:    1,
+	models.RoomRoleModerator: 2,
+	models.RoomRoleAdmin:     3,
+	models.RoomRoleOwner:     4,
+}
+
+func isValidRoomRole(role string) bool {
+	_, ok := roomRoleRank[role]
+	return ok
+}
+
+// roomRoleOf returns the user's role in the room, or "" if they are not a member
+func roomRoleOf(room models.Room, userID uint) string {
+	if userID == 0 {
+		return ""
+	}
+	var member models.RoomMember
+	if err := database.DB.Where("room_id = ? AND user_id = ?", room.ID, userID).First(&member).Error; err != nil {
+		return ""
+	}
+	if room.OwnerID == userID {
+		return models.RoomRoleOwner
+	}
+	return member.Role
+}
+
+// RoomMemberIDs returns the user IDs of all members of a room
+func RoomMemberIDs(roomID uint) []uint {
+	var ids []uint
+	database.DB.Model(&models.RoomMember{}).Where("room_id = ?", roomID).Pluck("user_id", &ids)
+	return ids
+}
+
+func roomRoleCan(role string, perm roomPermission) bool {
+	return roomPermissionMatrix[role][perm]
+}
+
+// authorizeRoom loads the room and checks that the caller holds the permission.
+// It returns the room and the caller's ID and role.
+func authorizeRoom(c *fiber.Ctx, roomID interface{}, perm roomPermission) (*models.Room, uint, string, error) {
+	var room models.Room
+	if err := database.DB.First(&room, roomID).Error; err != nil {
+		return nil, 0, "", fiber.NewError(fiber.StatusNotFound, "Room not found")
+	}
+
+	callerID := requesterID(c)
+	if callerID == 0 {
+		return nil, 0, "", fiber.NewError(fiber.StatusUnauthorized, "User ID is required")
+	}
+
+	role := roomRoleOf(room, callerID)
+	if !roomRoleCan(role, perm) {
+		return nil, 0, "", fiber.NewError(fiber.StatusForbidden, "You don't have permission to do this in this room")
+	}
+	return &room, callerID, role, nil
+}
+
+// requireRoomMember loads the room and checks that the caller is a member;
+// reading, posting and summarising need no further permission
+func requireRoomMember(c *fiber.Ctx, roomID interface{}) (*models.Room, error) {
+	var room models.Room
+	if err := database.DB.First(&room, roomID).Error; err != nil {
+		return nil, fiber.NewError(fiber.StatusNotFound, "Room not found")
+	}
+	if roomRoleOf(room, requesterID(c)) == "" {
+		return nil, fiber.NewError(fiber.StatusForbidden, "You are not a member of this room")
+	}
+	return &room, nil
+}
+
+// canManageMember reports whether an actor may act on a member with the target role.
+// Owners may act on anyone, everybody else only on lower-ranked members.
+func canManageMember(actorRole, targetRole string) bool {
+	if actorRole == models.RoomRoleOwner {
+		return true
+	}
+	return roomRoleRank[actorRole] > roomRoleRank[targetRole]
+}
+
+// isLastOwner reports whether the user is the only owner left in the room
+func isLastOwner(roomID, userID uint) bool {
+	var owners int64
+	database.DB.Model(&models.RoomMember{}).
+		Where("room_id = ? AND role = ? AND user_id != ?", roomID, models.RoomRoleOwner, userID).
+		Count(&owners)
+	return owners == 0
+}
@@ -0,0 +1,191 @@
+package handlers
+
+import (
+	"rag-agent-server/internal/database"
+	"rag-agent-server/internal/models"
+	"rag-agent-server/internal/services"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type ScheduledMessageHandler struct{}
+
+func NewScheduledMessageHandler() *ScheduledMessageHandler {
+	return &ScheduledMessageHandler{}
+}
+
+type scheduledMessageRequest struct {
+	// SenderID is the caller's own ID, or 0 or omitted for a system message
+	SenderID *uint      `json:"senderId"`
+	Content  *string    `json:"content"`
+	Type     string     `json:"type"`
+	RunAt    *time.Time `json:"runAt"`
+	CronExpr *string    `json:"cronExpr"`
+	Timezone *string    `json:"timezone"`
+	IsActive *bool      `json:"isActive"`
+}
+
+// CreateScheduledMessage schedules a one-off (runAt) or recurring (cronExpr) message for a room
+func (h *ScheduledMessageHandler) CreateScheduledMessage(c *fiber.Ctx) error {
+	roomID := c.Params("id")
+	var room models.Room
+	if err := database.DB.First(&room, roomID).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Room not found"})
+	}
+
+	var body scheduledMessageRequest
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Cannot parse JSON"})
+	}
+
+	if body.Content == nil || strings.TrimSpace(*body.Content) == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Content is required"})
+	}
+
+	job := models.ScheduledMessage{
+		RoomID:    room.ID,
+		CreatedBy: requesterID(c),
+		Content:   *body.Content,
+		Type:      body.Type,
+		RunAt:     body.RunAt,
+		Timezone:  "UTC",
+		IsActive:  true,
+	}
+	if body.SenderID != nil {
+		if err := checkScheduledSender(c, *body.SenderID); err != nil {
+			return sendError(c, err)
+		}
+		job.SenderID = *body.SenderID
+	}
+	if job.Type == "" {
+		job.Type = "text"
+	}
+	if body.CronExpr != nil {
+		job.CronExpr = strings.TrimSpace(*body.CronExpr)
+	}
+	if body.Timezone != nil && *body.Timezone != "" {
+		job.Timezone = *body.Timezone
+	}
+
+	if (job.RunAt == nil) == (job.CronExpr == "") {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Exactly one of runAt or cronExpr is required"})
+	}
+
+	if err := h.schedule(&job); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	if err := database.DB.Create(&job).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not schedule message"})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(job)
+}
+
+// GetScheduledMessages lists scheduled messages of a room
+func (h *ScheduledMessageHandler) GetScheduledMessages(c *fiber.Ctx) error {
+	roomID := c.Params("id")
+	var jobs []models.ScheduledMessage
+	query := database.DB.Where("room_id = ?", roomID).Order("next_run_at asc")
+	if c.Query("active") == "true" {
+		query = query.Where("is_active = ?", true)
+	}
+	if err := query.Find(&jobs).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not fetch scheduled messages"})
+	}
+	return c.JSON(jobs)
+}
+
+// UpdateScheduledMessage changes content, schedule or pauses/resumes a job
+func (h *ScheduledMessageHandler) UpdateScheduledMessage(c *fiber.Ctx) error {
+	id := c.Params("jobId")
+	var job models.ScheduledMessage
+	if err := database.DB.Where("room_id = ?", c.Params("id")).First(&job, id).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Scheduled message not found"})
+	}
+
+	var body scheduledMessageRequest
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Cannot parse JSON"})
+	}
+
+	if body.Content != nil {
+		if strings.TrimSpace(*body.Content) == "" {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Content cannot be empty"})
+		}
+		job.Content = *body.Content
+	}
+	if body.Type != "" {
+		job.Type = body.Type
+	}
+	if body.SenderID != nil {
+		if err := checkScheduledSender(c, *body.SenderID); err != nil {
+			return sendError(c, err)
+		}
+		job.SenderID = *body.SenderID
+	}
+	if body.Timezone != nil && *body.Timezone != "" {
+		job.Timezone = *body.Timezone
+	}
+	// Switching between one-off and recurring clears the other schedule
+	if body.RunAt != nil {
+		job.RunAt = body.RunAt
+		job.CronExpr = ""
+	} else if body.CronExpr != nil {
+		job.CronExpr = strings.TrimSpace(*body.CronExpr)
+		job.RunAt = nil
+	}
+	if body.IsActive != nil {
+		job.IsActive = *body.IsActive
+	}
+
+	if job.IsActive {
+		if err := h.schedule(&job); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		}
+	}
+
+	if err := database.DB.Save(&job).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not update scheduled message"})
+	}
+
+	return c.JSON(job)
+}
+
+// DeleteScheduledMessage cancels a scheduled message
+func (h *ScheduledMessageHandler) DeleteScheduledMessage(c *fiber.Ctx) error {
+	id := c.Params("jobId")
+	if err := database.DB.Where("room_id = ?", c.Params("id")).Delete(&models.ScheduledMessage{}, id).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not delete scheduled message"})
+	}
+	return c.SendStatus(fiber.StatusOK)
+}
+
+// checkScheduledSender only lets a scheduled message be posted by the system
+// (0) or by the caller, so it can't be made to look like another user's
+func checkScheduledSender(c *fiber.Ctx, senderID uint) error {
+	if senderID != 0 && senderID != requesterID(c) {
+		return fiber.NewError(fiber.StatusForbidden, "Scheduled messages can only be sent as yourself or the system")
+	}
+	return nil
+}
+
+// schedule validates the job's timing and sets NextRunAt
+func (h *ScheduledMessageHandler) schedule(job *models.ScheduledMessage) error {
+	now := time.Now()
+	if job.CronExpr == "" && job.RunAt != nil && !job.RunAt.After(now) {
+		return fiber.NewError(fiber.StatusBadRequest, "runAt must be in the future")
+	}
+
+	next, err := services.NextScheduledRun(*job, now)
+	if err != nil {
+		return err
+	}
+	if next == nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Schedule has no upcoming runs")
+	}
+	job.NextRunAt = next
+	return nil
+}
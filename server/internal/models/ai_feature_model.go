@@ -0,0 +1,14 @@
+package models
+
+import "gorm.io/gorm"
+
+// AiFeatureModel assigns the models an AI feature uses. Features without a
+// row use the DEFAULT_ASTRO_MODEL setting and automatic fallbacks.
+type AiFeatureModel struct {
+	gorm.Model
+	Feature        string `json:"feature" gorm:"uniqueIndex"`
+	PrimaryModelID string `json:"primaryModelId"`
+	// FallbackModelIDs is an ordered, comma separated list of model IDs.
+	// Empty means fallbacks are picked automatically.
+	FallbackModelIDs string `json:"fallbackModelIds"`
+}
@@ -19,4 +19,63 @@ type AiModel struct {
 	LastResponseTime int64     `json:"lastResponseTime"` // ms
 	IsRecommended    bool      `json:"isRecommended" gorm:"default:false"`
 	IsRagEnabled     bool      `json:"isRagEnabled" gorm:"default:false"`
+	// Prices in USD per 1000 tokens, used to estimate usage cost
+	InputPricePer1K  float64 `json:"inputPricePer1k" gorm:"column:input_price_per_1k"`
+	OutputPricePer1K float64 `json:"outputPricePer1k" gorm:"column:output_price_per_1k"`
+	// Health checks: failures in a row, and whether the checker (rather than
+	// an admin) disabled the model, in which case it re-enables it on recovery
+	ConsecutiveFailures int  `json:"consecutiveFailures" gorm:"default:0"`
+	AutoDisabled        bool `json:"autoDisabled" gorm:"default:false"`
+	// IsDeprecated marks models that disappeared from the upstream catalogue.
+	// They are kept for history but never used as fallbacks or offered to clients.
+	IsDeprecated bool       `json:"isDeprecated" gorm:"default:false"`
+	DeprecatedAt *time.Time `json:"deprecatedAt"`
+	// Provider and category as last reported upstream. Sync only follows
+	// upstream changes while the model's own values still match these, so
+	// edits made by an admin are kept.
+	UpstreamProvider string `json:"upstreamProvider"`
+	UpstreamCategory string `json:"upstreamCategory"`
+}
+
+// Model test statuses
+const (
+	ModelStatusOnline  = "online"
+	ModelStatusOffline = "offline" // unreachable
+	ModelStatusError   = "error"   // reachable, but the request failed
+)
+
+// AiModelHealthCheck is the result of one probe of a model
+type AiModelHealthCheck struct {
+	ID           uint      `json:"id" gorm:"primarykey"`
+	CreatedAt    time.Time `json:"createdAt" gorm:"index"`
+	ModelID      string    `json:"modelId" gorm:"index"`
+	Status       string    `json:"status"`
+	ResponseTime int64     `json:"responseTime"` // ms
+	Error        string    `json:"error"`
+	// Source is "scheduled" for the background job and "manual" for admin tests
+	Source string `json:"source"`
+}
+
+// Model catalogue changes recorded by a sync
+const (
+	ModelChangeAdded      = "added"
+	ModelChangeUpdated    = "updated"
+	ModelChangeDeprecated = "deprecated"
+	ModelChangeRestored   = "restored"
+)
+
+// ModelSyncLog records what one catalogue sync changed
+type ModelSyncLog struct {
+	ID        uint      `json:"id" gorm:"primarykey"`
+	CreatedAt time.Time `json:"createdAt" gorm:"index"`
+	// Trigger is "scheduled" or "manual"
+	Trigger    string `json:"trigger"`
+	Upstream   int    `json:"upstream"` // models in the upstream catalogue
+	Added      int    `json:"added"`
+	Updated    int    `json:"updated"`
+	Deprecated int    `json:"deprecated"`
+	Restored   int    `json:"restored"`
+	// Changes is a JSON array of services.ModelChange
+	Changes string `json:"changes"`
+	Error   string `json:"error"`
 }
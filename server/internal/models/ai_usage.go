@@ -0,0 +1,34 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// AiUsage is one upstream AI call, successful or not
+type AiUsage struct {
+	ID               uint      `json:"id" gorm:"primarykey"`
+	CreatedAt        time.Time `json:"createdAt" gorm:"index"`
+	UserID           uint      `json:"userId" gorm:"index"` // 0 for calls made by the system
+	Feature          string    `json:"feature" gorm:"index"`
+	ModelID          string    `json:"modelId"`
+	Provider         string    `json:"provider"`
+	PromptTokens     int       `json:"promptTokens"`
+	CompletionTokens int       `json:"completionTokens"`
+	TotalTokens      int       `json:"totalTokens"`
+	Estimated        bool      `json:"estimated"` // token counts were estimated, not reported
+	LatencyMs        int64     `json:"latencyMs"`
+	Cost             float64   `json:"cost"` // USD
+	Success          bool      `json:"success"`
+	Error            string    `json:"error"`
+}
+
+// AiPlanQuota limits AI consumption for users of a plan. Zero means unlimited.
+type AiPlanQuota struct {
+	gorm.Model
+	Plan           string  `json:"plan" gorm:"uniqueIndex"`
+	DailyRequests  int     `json:"dailyRequests"`
+	MonthlyTokens  int     `json:"monthlyTokens"`
+	MonthlyCostUSD float64 `json:"monthlyCostUsd"`
+}
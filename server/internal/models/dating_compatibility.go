@@ -4,7 +4,11 @@ import "gorm.io/gorm"
 
 type DatingCompatibility struct {
 	gorm.Model
-	UserID            uint   `json:"userId" gorm:"index:idx_user_candidate"`
-	CandidateID       uint   `json:"candidateId" gorm:"index:idx_user_candidate"`
+	UserID      uint `json:"userId" gorm:"index:idx_user_candidate"`
+	CandidateID uint `json:"candidateId" gorm:"index:idx_user_candidate"`
+	// Language the report is written in; reports are cached per language
+	Language          string `json:"language" gorm:"index:idx_user_candidate;default:'ru'"`
 	CompatibilityText string `json:"compatibilityText"`
+	// Citations is the JSON list of sources the report cites
+	Citations string `json:"citations" gorm:"type:text"`
 }
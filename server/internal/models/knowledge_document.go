@@ -0,0 +1,35 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Knowledge document ingestion states
+const (
+	KnowledgePending  = "pending"
+	KnowledgeIndexing = "indexing"
+	KnowledgeReady    = "ready"
+	KnowledgeFailed   = "failed"
+)
+
+// KnowledgeDocument is an admin-uploaded text the AI can retrieve from, such
+// as scripture commentary, temple FAQs or event schedules
+type KnowledgeDocument struct {
+	gorm.Model
+	Title string `json:"title"`
+	// Collection tags the document so rooms can draw on specific sets
+	Collection  string `json:"collection" gorm:"index"`
+	FileName    string `json:"fileName"`
+	ContentType string `json:"contentType"` // "pdf", "markdown" or "text"
+	Size        int64  `json:"size"`
+	// Text is the extracted content; it is kept so documents can be
+	// re-indexed without the original file
+	Text       string     `json:"-" gorm:"type:text"`
+	Status     string     `json:"status" gorm:"index;default:'pending'"`
+	Error      string     `json:"error,omitempty"`
+	Chunks     int        `json:"chunks"`
+	IndexedAt  *time.Time `json:"indexedAt"`
+	UploadedBy uint       `json:"uploadedBy"`
+}
@@ -6,9 +6,13 @@ import (
 
 type Message struct {
 	gorm.Model
-	SenderID    uint   `json:"senderId" gorm:"index"`
-	RecipientID uint   `json:"recipientId" gorm:"index"` // For 1-on-1 chats
-	RoomID      uint   `json:"roomId" gorm:"index"`      // For group chats
-	Content     string `json:"content"`
-	Type        string `json:"type" gorm:"default:'text'"` // 'text', 'image'
+	SenderID         uint   `json:"senderId" gorm:"index"`
+	RecipientID      uint   `json:"recipientId" gorm:"index"` // For 1-on-1 chats
+	RoomID           uint   `json:"roomId" gorm:"index"`      // For group chats
+	Content          string `json:"content"`
+	Type             string `json:"type" gorm:"default:'text'"`                       // 'text', 'image'
+	ModerationStatus string `json:"moderationStatus" gorm:"default:'approved';index"` // 'approved', 'flagged', 'held', 'removed'
+	// System marks announcements posted without a sender, such as scheduled
+	// messages, as opposed to AI replies, which also have SenderID 0
+	System bool `json:"system,omitempty" gorm:"default:false"`
 }
@@ -0,0 +1,100 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Unlimited is the entitlement value for "no limit"
+const Unlimited = -1
+
+// Plan codes every installation has
+const (
+	PlanTrial   = "trial"
+	PlanFree    = "free"
+	PlanPremium = "premium"
+)
+
+// Plan is an entry of the subscription catalogue. Entitlement limits use
+// Unlimited (-1) for no limit and 0 for "not included".
+type Plan struct {
+	gorm.Model
+	Code        string `json:"code" gorm:"uniqueIndex"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	IsActive    bool   `json:"isActive" gorm:"default:true"`
+	SortOrder   int    `json:"sortOrder"`
+	// TrialDays is how long the plan lasts for new users; 0 for plans that don't expire
+	TrialDays int `json:"trialDays"`
+
+	// Entitlements
+	MaxCompatibilityReports int `json:"maxCompatibilityReports"` // per calendar month
+	MaxAiRooms              int `json:"maxAiRooms"`              // owned rooms with the assistant enabled
+	MaxPhotos               int `json:"maxPhotos"`
+
+	Prices []PlanPrice `json:"prices" gorm:"foreignKey:PlanID"`
+}
+
+// PlanPrice is the price of a plan in one region. The "global" region is
+// used when a user's region has no price of its own.
+type PlanPrice struct {
+	gorm.Model
+	PlanID      uint   `json:"planId" gorm:"uniqueIndex:idx_plan_price"`
+	Region      string `json:"region" gorm:"uniqueIndex:idx_plan_price;default:'global'"`
+	Interval    string `json:"interval" gorm:"uniqueIndex:idx_plan_price;default:'month'"` // month, year
+	Currency    string `json:"currency"`
+	AmountCents int64  `json:"amountCents"`
+}
+
+// Subscription statuses
+const (
+	SubscriptionActive   = "active"
+	SubscriptionPastDue  = "past_due"
+	SubscriptionCanceled = "canceled"
+	SubscriptionExpired  = "expired"
+)
+
+// Subscription is a paid plan bought through a payment provider
+type Subscription struct {
+	gorm.Model
+	UserID                 uint       `json:"userId" gorm:"index"`
+	PlanCode               string     `json:"planCode"`
+	Status                 string     `json:"status"`
+	Provider               string     `json:"provider"`
+	ProviderSubscriptionID string     `json:"providerSubscriptionId" gorm:"index"`
+	CurrentPeriodEnd       *time.Time `json:"currentPeriodEnd"`
+	CanceledAt             *time.Time `json:"canceledAt"`
+}
+
+// PaymentEvent is a processed payment provider webhook. The unique external
+// ID makes webhook handling idempotent.
+type PaymentEvent struct {
+	gorm.Model
+	Provider   string `json:"provider" gorm:"uniqueIndex:idx_payment_event"`
+	ExternalID string `json:"externalId" gorm:"uniqueIndex:idx_payment_event"`
+	Type       string `json:"type"`
+	UserID     uint   `json:"userId"`
+	Payload    string `json:"payload"`
+}
+
+// Checkout statuses
+const (
+	CheckoutPending   = "pending"
+	CheckoutCompleted = "completed"
+)
+
+// Checkout is a payment started by a user. It records what is being bought,
+// so completing it relies on our record rather than on the checkout ID.
+type Checkout struct {
+	gorm.Model
+	Provider    string     `json:"provider" gorm:"uniqueIndex:idx_checkout"`
+	ExternalID  string     `json:"externalId" gorm:"uniqueIndex:idx_checkout"`
+	UserID      uint       `json:"userId" gorm:"index"`
+	PlanCode    string     `json:"planCode"`
+	Interval    string     `json:"interval"`
+	Currency    string     `json:"currency"`
+	AmountCents int64      `json:"amountCents"`
+	Status      string     `json:"status" gorm:"default:'pending'"`
+	CompletedAt *time.Time `json:"completedAt"`
+}
@@ -0,0 +1,19 @@
+package models
+
+import "gorm.io/gorm"
+
+// PromptTemplate is one version of an AI prompt in one language. Versions are
+// never edited in place: saving creates the next version, and exactly one
+// version per key and language is active.
+type PromptTemplate struct {
+	gorm.Model
+	Key      string `json:"key" gorm:"uniqueIndex:idx_prompt_version"`
+	Language string `json:"language" gorm:"uniqueIndex:idx_prompt_version"`
+	Version  int    `json:"version" gorm:"uniqueIndex:idx_prompt_version"`
+	// Body is a Go text/template rendered with the prompt's variables
+	Body     string `json:"body" gorm:"type:text"`
+	IsActive bool   `json:"isActive" gorm:"index"`
+	Comment  string `json:"comment"`
+	// AuthorID is the admin who saved the version; 0 for built-in defaults
+	AuthorID uint `json:"authorId"`
+}
@@ -0,0 +1,23 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Report is an entry in the moderation queue. It is created either by a user
+// reporting a message/user or automatically by the message filter pipeline.
+type Report struct {
+	gorm.Model
+	ReporterID uint       `json:"reporterId" gorm:"index"`                   // 0 for automatic reports
+	TargetType string     `json:"targetType" gorm:"index:idx_report_target"` // message, user
+	TargetID   uint       `json:"targetId" gorm:"index:idx_report_target"`
+	Reason     string     `json:"reason"`
+	Details    string     `json:"details"`
+	Source     string     `json:"source" gorm:"default:'user'"`    // user, filter
+	Status     string     `json:"status" gorm:"default:'pending'"` // pending, resolved, dismissed
+	Resolution string     `json:"resolution"`                      // action taken by the moderator
+	ResolvedBy uint       `json:"resolvedBy"`
+	ResolvedAt *time.Time `json:"resolvedAt"`
+}
@@ -1,22 +1,61 @@
 package models
 
 import (
+	"time"
+
 	"gorm.io/gorm"
 )
 
 type Room struct {
 	gorm.Model
-	Name        string `json:"name"`
-	Description string `json:"description"`
-	OwnerID     uint   `json:"ownerId"`
-	IsPublic    bool   `json:"isPublic" gorm:"default:true"`
-	AiEnabled   bool   `json:"aiEnabled" gorm:"default:false"`
-	ImageURL    string `json:"imageUrl"`
+	Name        string     `json:"name"`
+	Description string     `json:"description"`
+	OwnerID     uint       `json:"ownerId"`
+	IsPublic    bool       `json:"isPublic" gorm:"default:true"`
+	AiEnabled   bool       `json:"aiEnabled" gorm:"default:false"`
+	ImageURL    string     `json:"imageUrl"`
+	IsArchived  bool       `json:"isArchived" gorm:"default:false"` // archived rooms are read-only
+	ArchivedAt  *time.Time `json:"archivedAt"`
+
+	// Discovery
+	Category       string     `json:"category" gorm:"index"`
+	Tags           string     `json:"tags"` // comma-separated, lowercase
+	Language       string     `json:"language" gorm:"index"`
+	City           string     `json:"city" gorm:"index"`
+	LastActivityAt *time.Time `json:"lastActivityAt" gorm:"index"`
+}
+
+// Room categories shown in discovery
+var RoomCategories = []string{
+	"study_group",
+	"city_community",
+	"kirtan",
+	"japa",
+	"festival",
+	"seva",
+	"other",
 }
 
+func IsValidRoomCategory(category string) bool {
+	for _, c := range RoomCategories {
+		if c == category {
+			return true
+		}
+	}
+	return false
+}
+
+// Room member roles, from most to least privileged
+const (
+	RoomRoleOwner     = "owner"
+	RoomRoleAdmin     = "admin"
+	RoomRoleModerator = "moderator"
+	RoomRoleMember    = "member"
+)
+
 type RoomMember struct {
 	gorm.Model
 	RoomID uint   `json:"roomId" gorm:"index:idx_room_user,unique"`
 	UserID uint   `json:"userId" gorm:"index:idx_room_user,unique"`
-	Role   string `json:"role" gorm:"default:'member'"` // 'admin', 'member'
+	Role   string `json:"role" gorm:"default:'member'"` // 'owner', 'admin', 'moderator', 'member'
 }
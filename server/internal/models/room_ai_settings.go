@@ -0,0 +1,34 @@
+package models
+
+import (
+	"gorm.io/gorm"
+)
+
+// AI trigger modes for rooms
+const (
+	AiTriggerEvery   = "every"   // reply to every message
+	AiTriggerMention = "mention" // reply only when @mentioned or to slash commands
+	AiTriggerCommand = "command" // reply only to slash commands (/ask, /summary)
+)
+
+// RoomAiSettings configures the AI assistant of a single room.
+// Empty fields fall back to the global defaults.
+type RoomAiSettings struct {
+	gorm.Model
+	RoomID       uint     `json:"roomId" gorm:"uniqueIndex"`
+	Persona      string   `json:"persona"` // display name of the assistant
+	SystemPrompt string   `json:"systemPrompt"`
+	ModelID      string   `json:"modelId"` // AiModel.ModelID, empty = DEFAULT_ASTRO_MODEL
+	Temperature  *float64 `json:"temperature"`
+	Language     string   `json:"language"` // e.g. "ru", "en"
+	TriggerMode  string   `json:"triggerMode" gorm:"default:'mention'"`
+	// Minimum pause between assistant replies, 0 = server default
+	CooldownSeconds int `json:"cooldownSeconds" gorm:"default:0"`
+	// Approximate prompt size for replies, 0 = server default
+	ContextTokenBudget int `json:"contextTokenBudget" gorm:"default:0"`
+	// Fold history that doesn't fit the budget into a rolling summary
+	RollingSummary bool `json:"rollingSummary" gorm:"default:false"`
+	// KnowledgeCollections is a comma separated list of the knowledge
+	// collections the assistant draws on; empty means all of them
+	KnowledgeCollections string `json:"knowledgeCollections"`
+}
@@ -0,0 +1,14 @@
+package models
+
+import (
+	"gorm.io/gorm"
+)
+
+// RoomContextSummary is the rolling summary of a room's older history that no
+// longer fits into the AI context window
+type RoomContextSummary struct {
+	gorm.Model
+	RoomID        uint   `json:"roomId" gorm:"uniqueIndex"`
+	Summary       string `json:"summary"`
+	UpToMessageID uint   `json:"upToMessageId"` // last message folded into the summary
+}
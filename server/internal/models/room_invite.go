@@ -0,0 +1,30 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// RoomInvite is a shareable link code granting membership to a room
+type RoomInvite struct {
+	gorm.Model
+	RoomID    uint       `json:"roomId" gorm:"index"`
+	Code      string     `json:"code" gorm:"uniqueIndex"`
+	CreatedBy uint       `json:"createdBy"`
+	ExpiresAt *time.Time `json:"expiresAt"`
+	MaxUses   int        `json:"maxUses" gorm:"default:0"` // 0 = unlimited
+	Uses      int        `json:"uses" gorm:"default:0"`
+	IsRevoked bool       `json:"isRevoked" gorm:"default:false"`
+}
+
+// RoomJoinRequest is a request to join a private room awaiting a room admin's decision
+type RoomJoinRequest struct {
+	gorm.Model
+	RoomID     uint       `json:"roomId" gorm:"index"`
+	UserID     uint       `json:"userId" gorm:"index"`
+	Message    string     `json:"message"`
+	Status     string     `json:"status" gorm:"default:'pending'"` // pending, approved, rejected
+	ReviewedBy uint       `json:"reviewedBy"`
+	ReviewedAt *time.Time `json:"reviewedAt"`
+}
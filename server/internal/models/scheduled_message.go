@@ -0,0 +1,25 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ScheduledMessage is a one-off or recurring message posted to a room by the
+// background scheduler. One-off jobs set RunAt, recurring jobs set CronExpr.
+type ScheduledMessage struct {
+	gorm.Model
+	RoomID    uint       `json:"roomId" gorm:"index"`
+	SenderID  uint       `json:"senderId"` // 0 for system
+	CreatedBy uint       `json:"createdBy"`
+	Content   string     `json:"content"`
+	Type      string     `json:"type" gorm:"default:'text'"`
+	RunAt     *time.Time `json:"runAt"`
+	CronExpr  string     `json:"cronExpr"`
+	Timezone  string     `json:"timezone" gorm:"default:'UTC'"`
+	NextRunAt *time.Time `json:"nextRunAt" gorm:"index"`
+	LastRunAt *time.Time `json:"lastRunAt"`
+	RunCount  int        `json:"runCount" gorm:"default:0"`
+	IsActive  bool       `json:"isActive" gorm:"default:true;index"`
+}
@@ -9,3 +9,23 @@ type SystemSetting struct {
 	Key   string `json:"key" gorm:"uniqueIndex"`
 	Value string `json:"value"`
 }
+
+// Setting audit actions
+const (
+	SettingAuditCreate = "create"
+	SettingAuditUpdate = "update"
+	SettingAuditDelete = "delete"
+	SettingAuditRotate = "rotate"
+)
+
+// SettingAudit records every change of a SystemSetting. Secret values are
+// never stored here, only their masked form.
+type SettingAudit struct {
+	gorm.Model
+	Key      string `json:"key" gorm:"index"`
+	Action   string `json:"action"`
+	ActorID  uint   `json:"actorId"` // 0 for changes made by the server itself
+	OldValue string `json:"oldValue"`
+	NewValue string `json:"newValue"`
+	IP       string `json:"ip"`
+}
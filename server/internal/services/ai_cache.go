@@ -0,0 +1,282 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// cacheTTLs is how long responses are reused per feature. Features that are
+// missing, like room replies and the chat proxy, are never cached: their
+// answers are meant to differ between calls.
+var cacheTTLs = map[string]time.Duration{
+	FeatureRoomSummary:         10 * time.Minute,
+	FeatureDatingCompatibility: 24 * time.Hour,
+	FeatureModeration:          time.Hour,
+}
+
+// CacheStats are the response cache counters of one feature
+type CacheStats struct {
+	Feature string `json:"feature"`
+	Hits    int64  `json:"hits"`
+	Misses  int64  `json:"misses"`
+	// Shared counts calls that waited for an identical call in flight
+	// instead of reaching the provider
+	Shared  int64   `json:"shared"`
+	HitRate float64 `json:"hitRate"`
+}
+
+// CacheReport is the state of the response cache
+type CacheReport struct {
+	Enabled    bool         `json:"enabled"`
+	Entries    int          `json:"entries"`
+	MaxEntries int          `json:"maxEntries"`
+	InFlight   int          `json:"inFlight"`
+	Features   []CacheStats `json:"features"`
+}
+
+type cacheEntry struct {
+	completion Completion
+	expires    time.Time
+}
+
+// responseCache keeps completions by request key until their TTL passes. When
+// full, expired entries go first, then the ones closest to expiring.
+type responseCache struct {
+	mu      sync.Mutex
+	entries map[string]cacheEntry
+	stats   map[string]*CacheStats
+	now     func() time.Time
+}
+
+func newResponseCache() *responseCache {
+	return &responseCache{
+		entries: make(map[string]cacheEntry),
+		stats:   make(map[string]*CacheStats),
+		now:     time.Now,
+	}
+}
+
+// cacheKey identifies a request by model, sampling options, retrieval query
+// and normalized messages, so whitespace differences don't defeat the cache
+func cacheKey(modelID string, messages []map[string]string, opts CompletionOptions) string {
+	temperature := "default"
+	if opts.Temperature != nil {
+		temperature = strconv.FormatFloat(*opts.Temperature, 'g', -1, 64)
+	}
+	// A nil query encodes as null; the fields are plain values, so this
+	// cannot fail
+	retrieval, _ := json.Marshal(opts.Retrieval)
+
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\x00%s\x00%d\x00%s\x00", modelID, temperature, opts.MaxTokens, retrieval)
+	for _, msg := range messages {
+		fmt.Fprintf(h, "%s\x00%s\x00", msg["role"], strings.Join(strings.Fields(msg["content"]), " "))
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func (c *responseCache) feature(feature string) *CacheStats {
+	s, ok := c.stats[feature]
+	if !ok {
+		s = &CacheStats{Feature: feature}
+		c.stats[feature] = s
+	}
+	return s
+}
+
+func (c *responseCache) Get(feature, key string) (Completion, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[key]
+	if ok && c.now().After(entry.expires) {
+		delete(c.entries, key)
+		ok = false
+	}
+	if ok {
+		c.feature(feature).Hits++
+	} else {
+		c.feature(feature).Misses++
+	}
+	return entry.completion, ok
+}
+
+func (c *responseCache) Set(key string, completion Completion, ttl time.Duration, maxEntries int) {
+	if maxEntries < 1 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	if _, exists := c.entries[key]; !exists && len(c.entries) >= maxEntries {
+		for k, e := range c.entries {
+			if now.After(e.expires) {
+				delete(c.entries, k)
+			}
+		}
+		if len(c.entries) >= maxEntries {
+			keys := make([]string, 0, len(c.entries))
+			for k := range c.entries {
+				keys = append(keys, k)
+			}
+			sort.Slice(keys, func(i, j int) bool { return c.entries[keys[i]].expires.Before(c.entries[keys[j]].expires) })
+			for _, k := range keys[:len(c.entries)-maxEntries+1] {
+				delete(c.entries, k)
+			}
+		}
+	}
+	c.entries[key] = cacheEntry{completion: completion, expires: now.Add(ttl)}
+}
+
+func (c *responseCache) Shared(feature string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.feature(feature).Shared++
+}
+
+// Clear drops every cached response; the counters are kept
+func (c *responseCache) Clear() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	n := len(c.entries)
+	c.entries = make(map[string]cacheEntry)
+	return n
+}
+
+func (c *responseCache) Report() (int, []CacheStats) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	stats := make([]CacheStats, 0, len(c.stats))
+	for _, s := range c.stats {
+		report := *s
+		if total := s.Hits + s.Misses; total > 0 {
+			report.HitRate = float64(s.Hits) / float64(total)
+		}
+		stats = append(stats, report)
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Feature < stats[j].Feature })
+	return len(c.entries), stats
+}
+
+type flightCall struct {
+	done       chan struct{}
+	completion Completion
+	err        error
+}
+
+// flightGroup runs one call per key at a time; identical calls arriving
+// while it runs wait for its result instead of making their own
+type flightGroup struct {
+	mu    sync.Mutex
+	calls map[string]*flightCall
+}
+
+func newFlightGroup() *flightGroup {
+	return &flightGroup{calls: make(map[string]*flightCall)}
+}
+
+// Do runs fn for key unless a call for key is already in flight, in which
+// case it waits for that call. shared reports whether the result came from
+// another caller. Waiting stops early when ctx is done.
+func (g *flightGroup) Do(ctx context.Context, key string, fn func() (Completion, error)) (completion Completion, err error, shared bool) {
+	g.mu.Lock()
+	if call, ok := g.calls[key]; ok {
+		g.mu.Unlock()
+		select {
+		case <-call.done:
+			return call.completion, call.err, true
+		case <-ctx.Done():
+			return Completion{}, ctx.Err(), true
+		}
+	}
+	call := &flightCall{done: make(chan struct{})}
+	g.calls[key] = call
+	g.mu.Unlock()
+
+	defer func() {
+		g.mu.Lock()
+		delete(g.calls, key)
+		g.mu.Unlock()
+		close(call.done)
+	}()
+	call.completion, call.err = fn()
+	return call.completion, call.err, false
+}
+
+// InFlight is the number of calls currently running
+func (g *flightGroup) InFlight() int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return len(g.calls)
+}
+
+// CacheReport returns the response cache counters per feature
+func (s *AiChatService) CacheReport() CacheReport {
+	ai := s.cfg.Get().AI
+	entries, features := s.cache.Report()
+	return CacheReport{
+		Enabled:    ai.ResponseCacheEnabled,
+		Entries:    entries,
+		MaxEntries: ai.ResponseCacheMaxEntries,
+		InFlight:   s.flights.InFlight(),
+		Features:   features,
+	}
+}
+
+// ClearCache drops every cached response and returns how many there were
+func (s *AiChatService) ClearCache() int {
+	return s.cache.Clear()
+}
+
+// cachedComplete serves non-streaming calls of cacheable features from the
+// response cache and merges identical calls in flight. Callers over their
+// quota are refused even when the answer is cached; cached and shared answers
+// don't reach the provider, so they are not recorded as usage.
+func (s *AiChatService) cachedComplete(ctx context.Context, usage UsageContext, primaryModelID string, messages []map[string]string, opts CompletionOptions) (Completion, error) {
+	ai := s.cfg.Get().AI
+	ttl, cacheable := cacheTTLs[usage.Feature]
+	if !cacheable || !ai.ResponseCacheEnabled || opts.OnDelta != nil {
+		return s.complete(ctx, usage, primaryModelID, messages, opts)
+	}
+
+	if primaryModelID == "" {
+		primaryModelID = s.FeatureModels(usage.Feature).PrimaryModelID
+	}
+	if s.usage != nil {
+		if err := s.usage.CheckQuota(usage); err != nil {
+			return Completion{}, err
+		}
+	}
+	key := cacheKey(primaryModelID, messages, opts)
+	if completion, ok := s.cache.Get(usage.Feature, key); ok {
+		return completion, nil
+	}
+
+	completion, err, shared := s.flights.Do(ctx, key, func() (Completion, error) {
+		completion, err := s.complete(ctx, usage, primaryModelID, messages, opts)
+		if err == nil {
+			s.cache.Set(key, completion, ttl, ai.ResponseCacheMaxEntries)
+		}
+		return completion, err
+	})
+	if shared {
+		s.cache.Shared(usage.Feature)
+		// The other caller's cancellation or quota says nothing about ours
+		var quotaErr *QuotaError
+		if err != nil && ctx.Err() == nil && (errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) || errors.As(err, &quotaErr)) {
+			return s.complete(ctx, usage, primaryModelID, messages, opts)
+		}
+	}
+	return completion, err
+}
@@ -0,0 +1,68 @@
+package services
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCacheKey(t *testing.T) {
+	messages := []map[string]string{{"role": "user", "content": "Who is  Arjuna?"}}
+	low, alsoLow, high := 0.2, 0.2, 0.9
+
+	base := cacheKey("gpt4o", messages, CompletionOptions{Temperature: &low})
+	tests := []struct {
+		name     string
+		modelID  string
+		messages []map[string]string
+		opts     CompletionOptions
+		same     bool
+	}{
+		{name: "equal temperature behind another pointer", opts: CompletionOptions{Temperature: &alsoLow}, same: true},
+		{name: "whitespace is normalized", messages: []map[string]string{{"role": "user", "content": "Who is Arjuna? "}}, opts: CompletionOptions{Temperature: &low}, same: true},
+		{name: "other temperature", opts: CompletionOptions{Temperature: &high}},
+		{name: "default temperature", opts: CompletionOptions{}},
+		{name: "other model", modelID: "claude", opts: CompletionOptions{Temperature: &low}},
+		{name: "other max tokens", opts: CompletionOptions{Temperature: &low, MaxTokens: 100}},
+		{name: "retrieval", opts: CompletionOptions{Temperature: &low, Retrieval: &RetrievalQuery{Text: "Arjuna", Knowledge: true}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			modelID, msgs := "gpt4o", messages
+			if tt.modelID != "" {
+				modelID = tt.modelID
+			}
+			if tt.messages != nil {
+				msgs = tt.messages
+			}
+			if got := cacheKey(modelID, msgs, tt.opts) == base; got != tt.same {
+				t.Errorf("same key = %v, want %v", got, tt.same)
+			}
+		})
+	}
+
+	mine := cacheKey("gpt4o", messages, CompletionOptions{Retrieval: &RetrievalQuery{Text: "Arjuna", UserIDs: []uint{1}}})
+	theirs := cacheKey("gpt4o", messages, CompletionOptions{Retrieval: &RetrievalQuery{Text: "Arjuna", UserIDs: []uint{2}}})
+	if mine == theirs {
+		t.Error("retrieval over different profiles must not share a key")
+	}
+}
+
+func TestResponseCacheExpiry(t *testing.T) {
+	cache := newResponseCache()
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	cache.now = func() time.Time { return now }
+
+	cache.Set("k", Completion{Content: "cached"}, time.Minute, 10)
+	if got, ok := cache.Get(FeatureModeration, "k"); !ok || got.Content != "cached" {
+		t.Fatalf("Get = %q, %v", got.Content, ok)
+	}
+	now = now.Add(2 * time.Minute)
+	if _, ok := cache.Get(FeatureModeration, "k"); ok {
+		t.Error("expired entry was served")
+	}
+
+	_, stats := cache.Report()
+	if len(stats) != 1 || stats[0].Hits != 1 || stats[0].Misses != 1 {
+		t.Errorf("stats = %+v", stats)
+	}
+}
@@ -1,60 +1,44 @@
 package services
 
 import (
-	"bytes"
-	"encoding/json"
+	"context"
 	"fmt"
-	"io"
 	"log"
-	"net/http"
-	"os"
+	"math/rand"
+	"rag-agent-server/internal/config"
 	"rag-agent-server/internal/database"
 	"rag-agent-server/internal/models"
 	"time"
 )
 
 type AiChatService struct {
-	apiURL string
+	cfg   *config.Store
+	usage *UsageMeter
+	// prompts renders the system and summary prompts
+	prompts *PromptService
+	// breakers track failing models across requests
+	breakers *circuitBreakers
+	// cache and flights spare the provider repeated identical calls
+	cache   *responseCache
+	flights *flightGroup
+	// providerOverride, when set, serves every model (see UseProvider)
+	providerOverride Provider
+	// retriever supplies context to RAG-enabled models (see UseRetriever)
+	retriever Retriever
 }
 
-func NewAiChatService() *AiChatService {
-	apiURL := os.Getenv("AI_API_URL")
-	if apiURL == "" {
-		apiURL = "https://rvlautoai.ru/webhook/v1/chat/completions"
+func NewAiChatService(cfg *config.Store, usage *UsageMeter, prompts *PromptService) *AiChatService {
+	service := &AiChatService{cfg: cfg, usage: usage, prompts: prompts,
+		breakers: newCircuitBreakers(),
+		cache:    newResponseCache(),
+		flights:  newFlightGroup(),
 	}
-
-	return &AiChatService{
-		apiURL: apiURL,
-	}
-}
-
-func (s *AiChatService) getApiKey(provider string) string {
-	// If provider is Google/Gemini, try to use specific key first
-	if provider == "Google" || provider == "Gemini" {
-		var setting models.SystemSetting
-		if err := database.DB.Where("key = ?", "GEMINI_API_KEY").First(&setting).Error; err == nil && setting.Value != "" {
-			return setting.Value
-		}
+	if cfg.Get().AI.Provider == "fake" {
+		// Offline development: canned replies instead of real vendors
+		log.Println("[AiChatService] AI_PROVIDER=fake, using the fake provider")
+		service.UseProvider(NewFakeProvider("This is a test reply from the fake AI provider."))
 	}
-
-	// Fallback to standard OpenAI key
-	var setting models.SystemSetting
-	if err := database.DB.Where("key = ?", "API_OPEN_AI").First(&setting).Error; err == nil && setting.Value != "" {
-		return setting.Value
-	}
-	key := os.Getenv("API_OPEN_AI")
-	if key == "" {
-		key = os.Getenv("GEMINI_API_KEY")
-	}
-	return key
-}
-
-func (s *AiChatService) getModel(defaultModel string) string {
-	var setting models.SystemSetting
-	if err := database.DB.Where("key = ?", "DEFAULT_ASTRO_MODEL").First(&setting).Error; err == nil && setting.Value != "" {
-		return setting.Value
-	}
-	return defaultModel
+	return service
 }
 
 func (s *AiChatService) getProvider(modelID string) string {
@@ -78,172 +62,326 @@ func (s *AiChatService) getProvider(modelID string) string {
 	return "OpenAI"
 }
 
-// getFallbackModels returns a list of enabled TEXT models excluding the failed one
-func (s *AiChatService) getFallbackModels(failedModelID string) []models.AiModel {
-	var models []models.AiModel
-	// Fetch all enabled TEXT models except the one that just failed
-	if err := database.DB.Where("is_enabled = ? AND model_id != ? AND category = ?", true, failedModelID, "text").Limit(3).Find(&models).Error; err != nil {
+const (
+	// maxFallbackModels is how many other models are tried after the primary
+	maxFallbackModels = 3
+	// maxAttemptsPerModel bounds retries of retryable errors on one model
+	maxAttemptsPerModel = 2
+	retryBaseDelay      = 500 * time.Millisecond
+)
+
+// getFallbackModels returns up to maxFallbackModels enabled text models other
+// than the excluded one, best first: recommended models, then by the result of
+// the last health check and by response time. Models whose circuit is open
+// are left out.
+func (s *AiChatService) getFallbackModels(excludedModelID string) []models.AiModel {
+	var candidates []models.AiModel
+	err := database.DB.Where("is_enabled = ? AND is_deprecated = ? AND model_id != ? AND category = ?", true, false, excludedModelID, "text").
+		Order("is_recommended DESC").
+		Order("CASE last_test_status WHEN 'online' THEN 0 WHEN '' THEN 1 ELSE 2 END").
+		Order("CASE WHEN last_response_time > 0 THEN last_response_time ELSE 2147483647 END").
+		Order("id").
+		Find(&candidates).Error
+	if err != nil {
 		log.Printf("[AiChatService] Failed to fetch fallback models: %v", err)
 		return nil
 	}
-	return models
-}
 
-// makeRequest handles the actual API call logic
-func (s *AiChatService) makeRequest(modelID string, messages []map[string]string) (string, error) {
-	provider := s.getProvider(modelID)
-	// Fix for provider specific model names if needed
-	apiModelID := modelID
-	if apiModelID == "gpt5" {
-		apiModelID = "gpt4o"
+	fallbacks := make([]models.AiModel, 0, maxFallbackModels)
+	for _, model := range candidates {
+		if len(fallbacks) == maxFallbackModels {
+			break
+		}
+		if s.breakers.Available(model.ModelID) {
+			fallbacks = append(fallbacks, model)
+		}
 	}
+	return fallbacks
+}
 
-	apiKey := s.getApiKey(provider)
-	if apiKey == "" {
-		return "", fmt.Errorf("API Key not found for provider: %s", provider)
-	}
+// CircuitStatus returns the circuit breaker state of every model called so far
+func (s *AiChatService) CircuitStatus() []CircuitStatus {
+	return s.breakers.Snapshot()
+}
 
-	requestBody := map[string]interface{}{
-		"model":    apiModelID,
-		"messages": messages,
-		"provider": provider,
+// Probe sends a tiny chat request to a model through its normal provider
+// route. Probes don't affect circuit breakers and are not subject to quotas,
+// but they do spend credits, so they are recorded as system usage of the
+// health_check feature.
+func (s *AiChatService) Probe(ctx context.Context, modelID string) error {
+	provider, err := s.resolveProvider(modelID)
+	if err != nil {
+		return err
+	}
+	messages := []map[string]string{{"role": "user", "content": "hi"}}
+	start := time.Now()
+	response, err := provider.Chat(ctx, ChatRequest{
+		Model:     modelID,
+		Messages:  messages,
+		MaxTokens: 5,
+	})
+	if s.usage != nil {
+		s.usage.Record(SystemUsage(FeatureHealthCheck), modelID, provider.Name(), messages, response.Content, response.Usage, time.Since(start), err)
 	}
+	return err
+}
 
-	jsonBody, _ := json.Marshal(requestBody)
-	req, err := http.NewRequest("POST", s.apiURL, bytes.NewBuffer(jsonBody))
+// CompletionOptions carries optional generation parameters
+type CompletionOptions struct {
+	Temperature *float64
+	// MaxTokens caps the reply length; 0 leaves it to the provider
+	MaxTokens int
+	// OnDelta switches the request to streaming mode and receives content chunks
+	OnDelta func(delta string)
+	// Retrieval grounds the call in retrieved passages when the primary model
+	// is RAG-enabled
+	Retrieval *RetrievalQuery
+}
+
+// Completion is a reply and the model that produced it
+type Completion struct {
+	ModelID string
+	Content string
+	// Usage is as reported by the provider, or estimated when it reported none
+	Usage TokenUsage
+	// Citations are the retrieved passages the reply refers to
+	Citations []Citation
+}
+
+// makeRequest sends the conversation to the provider serving modelID, records
+// the call against the usage context and feeds the outcome to the model's
+// circuit breaker
+func (s *AiChatService) makeRequest(ctx context.Context, usage UsageContext, modelID string, messages []map[string]string, opts CompletionOptions) (ChatResponse, error) {
+	provider, err := s.resolveProvider(modelID)
 	if err != nil {
-		return "", err
+		s.breakers.Failure(modelID, err)
+		return ChatResponse{}, err
 	}
 
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+apiKey)
-
-	client := &http.Client{
-		Timeout: 45 * time.Second, // Increased timeout for safety
+	start := time.Now()
+	response, err := provider.Chat(ctx, ChatRequest{
+		Model:       modelID,
+		Messages:    messages,
+		Temperature: opts.Temperature,
+		MaxTokens:   opts.MaxTokens,
+		OnDelta:     opts.OnDelta,
+	})
+	if s.usage != nil {
+		s.usage.Record(usage, modelID, provider.Name(), messages, response.Content, response.Usage, time.Since(start), err)
 	}
-	resp, err := client.Do(req)
 	if err != nil {
-		log.Printf("[AiChatService] Request failed for model %s: %v", modelID, err)
-		return "", err
+		if ctx.Err() != nil {
+			// The caller gave up; says nothing about the model
+			s.breakers.Release(modelID)
+			return ChatResponse{}, ctx.Err()
+		}
+		s.breakers.Failure(modelID, err)
+		log.Printf("[AiChatService] Request failed for model %s via %s: %v", modelID, provider.Name(), err)
+		return ChatResponse{}, err
 	}
-	defer resp.Body.Close()
+	s.breakers.Success(modelID)
+	return response, nil
+}
 
-	bodyBytes, _ := io.ReadAll(resp.Body)
+// tryModel calls one model, retrying retryable errors with jittered
+// exponential backoff. Nothing is retried once a stream has started.
+func (s *AiChatService) tryModel(ctx context.Context, usage UsageContext, modelID string, messages []map[string]string, opts CompletionOptions, streamed *bool) (ChatResponse, error) {
+	var err error
+	for attempt := 0; attempt < maxAttemptsPerModel; attempt++ {
+		if attempt > 0 {
+			if !s.breakers.Allow(modelID) {
+				break
+			}
+			delay := retryBaseDelay << (attempt - 1)
+			delay = delay/2 + time.Duration(rand.Int63n(int64(delay)))
+			log.Printf("[AiChatService] Retrying %s in %s after: %v", modelID, delay, err)
+			select {
+			case <-time.After(delay):
+			case <-ctx.Done():
+				s.breakers.Release(modelID)
+				return ChatResponse{}, ctx.Err()
+			}
+		}
 
-	if resp.StatusCode != 200 {
-		log.Printf("[AiChatService] Error from API (Model: %s): %s", modelID, string(bodyBytes))
-		// Check for specific error codes like "credits_exhausted" if possible, but
-		// for now any non-200 is a failure warranting fallback.
-		return "", fmt.Errorf("status %d", resp.StatusCode)
+		var response ChatResponse
+		response, err = s.makeRequest(ctx, usage, modelID, messages, opts)
+		if err == nil || *streamed || !isRetryable(err) {
+			return response, err
+		}
 	}
+	return ChatResponse{}, err
+}
 
-	var response struct {
-		Choices []struct {
-			Message struct {
-				Content string `json:"content"`
-			} `json:"message"`
-		} `json:"choices"`
-		Error interface{} `json:"error"`
+// complete checks the caller's quota, then tries the primary model and the
+// fallbacks of usage.Feature, skipping models whose circuit is open. An empty
+// primaryModelID uses the feature's assigned model. Once a streaming reply has
+// started, or ctx is cancelled, no other model is tried.
+func (s *AiChatService) complete(ctx context.Context, usage UsageContext, primaryModelID string, messages []map[string]string, opts CompletionOptions) (Completion, error) {
+	if s.usage != nil {
+		if err := s.usage.CheckQuota(usage); err != nil {
+			return Completion{}, err
+		}
 	}
 
-	if err := json.Unmarshal(bodyBytes, &response); err != nil {
-		return "", err
+	streamed := false
+	if onDelta := opts.OnDelta; onDelta != nil {
+		opts.OnDelta = func(delta string) {
+			streamed = true
+			onDelta(delta)
+		}
 	}
 
-	if len(response.Choices) > 0 {
-		return response.Choices[0].Message.Content, nil
+	if primaryModelID == "" {
+		primaryModelID = s.FeatureModels(usage.Feature).PrimaryModelID
 	}
+	candidates := append([]string{primaryModelID}, s.featureFallbacks(usage.Feature, primaryModelID)...)
+	messages, passages := s.ground(ctx, primaryModelID, opts.Retrieval, messages)
 
-	if response.Error != nil {
-		errJSON, _ := json.Marshal(response.Error)
-		return "", fmt.Errorf("API error: %s", string(errJSON))
+	for i, modelID := range candidates {
+		if err := ctx.Err(); err != nil {
+			return Completion{}, err
+		}
+		if !s.breakers.Allow(modelID) {
+			log.Printf("[AiChatService] Skipping %s, its circuit is open", modelID)
+			continue
+		}
+
+		if i == 0 {
+			log.Printf("[AiChatService] Attempting %s with primary model: %s", usage.Feature, modelID)
+		} else {
+			log.Printf("[AiChatService] Falling back to model: %s", modelID)
+		}
+		response, err := s.tryModel(ctx, usage, modelID, messages, opts, &streamed)
+		if err == nil {
+			if i > 0 {
+				log.Printf("[AiChatService] Fallback successful with model: %s", modelID)
+			}
+			completion := Completion{
+				ModelID:   modelID,
+				Content:   response.Content,
+				Usage:     response.Usage,
+				Citations: citationsFor(response.Content, passages),
+			}
+			if completion.Usage.PromptTokens == 0 && completion.Usage.CompletionTokens == 0 {
+				for _, msg := range messages {
+					completion.Usage.PromptTokens += estimateTokens(msg["content"])
+				}
+				completion.Usage.CompletionTokens = estimateTokens(response.Content)
+			}
+			return completion, nil
+		}
+		if ctx.Err() != nil {
+			return Completion{}, ctx.Err()
+		}
+		if streamed {
+			return Completion{}, fmt.Errorf("stream interrupted: %v", err)
+		}
+		log.Printf("[AiChatService] Model %s failed: %v", modelID, err)
 	}
 
-	return "", fmt.Errorf("empty response")
+	return Completion{}, fmt.Errorf("all AI models failed to generate a response")
 }
 
-func (s *AiChatService) GenerateReply(room models.Room, lastMessages []models.Message) (string, error) {
-	var messages []map[string]string
-
-	// Add system prompt
-	systemPrompt := fmt.Sprintf("You are an AI assistant in the chat room '%s'. %s. Be helpful and concise.", room.Name, room.Description)
-	messages = append(messages, map[string]string{"role": "system", "content": systemPrompt})
+// Complete answers a conversation with modelID, or with the model assigned
+// to usage.Feature when modelID is empty, falling back like every other AI
+// call. It is the entry point for callers that build their own messages.
+func (s *AiChatService) Complete(ctx context.Context, usage UsageContext, modelID string, messages []map[string]string, opts CompletionOptions) (Completion, error) {
+	return s.cachedComplete(ctx, usage, modelID, messages, opts)
+}
 
-	// Add context from last messages
-	for _, m := range lastMessages {
-		role := "user"
-		messages = append(messages, map[string]string{
-			"role":    role,
-			"content": fmt.Sprintf("User %d: %s", m.SenderID, m.Content),
-		})
+// GetRoomSettings returns the room's AI configuration, or defaults if none is stored
+func (s *AiChatService) GetRoomSettings(roomID uint) models.RoomAiSettings {
+	settings := models.RoomAiSettings{RoomID: roomID}
+	database.DB.Where("room_id = ?", roomID).First(&settings)
+	if settings.TriggerMode == "" {
+		settings.TriggerMode = models.AiTriggerMention
 	}
+	return settings
+}
 
-	// 1. Try Default Model
-	defaultModelID := s.getModel("gpt4o")
-	log.Printf("[AiChatService] Attempting to generate reply with primary model: %s", defaultModelID)
+var languageNames = map[string]string{
+	"ru": "Russian",
+	"en": "English",
+	"hi": "Hindi",
+	"uk": "Ukrainian",
+	"de": "German",
+	"es": "Spanish",
+}
 
-	content, err := s.makeRequest(defaultModelID, messages)
-	if err == nil {
-		return content, nil
+// buildRoomSystemPrompt renders the room_system prompt in the room's language
+// with its persona settings
+func (s *AiChatService) buildRoomSystemPrompt(room models.Room, settings models.RoomAiSettings) string {
+	language := settings.Language
+	if name, ok := languageNames[language]; ok {
+		language = name
 	}
-
-	log.Printf("[AiChatService] Primary model %s failed: %v. Initiating fallback...", defaultModelID, err)
-
-	// 2. Fallback Loop
-	fallbacks := s.getFallbackModels(defaultModelID)
-	for _, fbModel := range fallbacks {
-		log.Printf("[AiChatService] Retrying with fallback model: %s (%s)", fbModel.ModelID, fbModel.Provider)
-		content, err := s.makeRequest(fbModel.ModelID, messages)
-		if err == nil {
-			log.Printf("[AiChatService] Fallback successful with model: %s", fbModel.ModelID)
-			return content, nil
-		}
-		log.Printf("[AiChatService] Fallback model %s failed: %v", fbModel.ModelID, err)
+	prompt, err := s.prompts.Render(PromptRoomSystem, settings.Language, PromptData{
+		"Room":         PromptRoom{Name: room.Name, Description: room.Description},
+		"Persona":      settings.Persona,
+		"CustomPrompt": settings.SystemPrompt,
+		"Language":     language,
+	})
+	if err != nil {
+		log.Printf("[AiChatService] Failed to render system prompt for room %d: %v", room.ID, err)
 	}
+	return prompt
+}
 
-	return "", fmt.Errorf("all AI models failed to generate a response")
+// GenerateReply answers in a room given its recent history in chronological
+// order. The history is trimmed to the room's token budget.
+func (s *AiChatService) GenerateReply(ctx context.Context, usage UsageContext, room models.Room, lastMessages []models.Message) (string, error) {
+	return s.generateRoomReply(ctx, usage, room, lastMessages, nil)
 }
 
-func (s *AiChatService) GetSummary(roomName string, lastMessages []models.Message) (string, error) {
-	// For summary we just try the default model once for now, or could use same logic.
-	// Let's copy the logic to be safe.
+// GenerateReplyStream is GenerateReply delivering the answer incrementally to
+// onDelta. It returns the full reply once the stream is complete. Fallback
+// models are only tried while nothing has been streamed yet.
+func (s *AiChatService) GenerateReplyStream(ctx context.Context, usage UsageContext, room models.Room, lastMessages []models.Message, onDelta func(delta string)) (string, error) {
+	return s.generateRoomReply(ctx, usage, room, lastMessages, onDelta)
+}
 
-	var conversation string
-	for _, m := range lastMessages {
-		conversation += fmt.Sprintf("User %d: %s\n", m.SenderID, m.Content)
+func (s *AiChatService) generateRoomReply(ctx context.Context, usage UsageContext, room models.Room, lastMessages []models.Message, onDelta func(delta string)) (string, error) {
+	settings := s.GetRoomSettings(room.ID)
+	systemPrompt := s.buildRoomSystemPrompt(room, settings)
+	messages := s.buildRoomConversation(ctx, room, settings, systemPrompt, lastMessages)
+
+	// The room's own model wins over the feature's assignment, unless it has
+	// since been disabled or deprecated
+	modelID := settings.ModelID
+	if modelID != "" && !modelUsable(modelID) {
+		log.Printf("[AiChatService] Model %s of room %d is no longer available, using the default", modelID, room.ID)
+		modelID = ""
+	}
+	completion, err := s.complete(ctx, usage, modelID, messages, CompletionOptions{
+		Temperature: settings.Temperature,
+		OnDelta:     onDelta,
+		Retrieval:   roomRetrievalQuery(settings, lastMessages, usage.UserID),
+	})
+	if err != nil {
+		return "", err
 	}
+	return WithCitations(completion.Content, completion.Citations), nil
+}
 
-	prompt := fmt.Sprintf("Summarize the following conversation in the chat room '%s' in 2-3 sentences:\n\n%s", roomName, conversation)
+// GetSummary summarizes recent room messages in the room's language
+func (s *AiChatService) GetSummary(ctx context.Context, usage UsageContext, room models.Room, lastMessages []models.Message) (string, error) {
+	prompt, err := s.prompts.Render(PromptRoomSummary, s.GetRoomSettings(room.ID).Language, PromptData{
+		"Room":         PromptRoom{Name: room.Name, Description: room.Description},
+		"Conversation": formatConversation(lastMessages, senderNames(lastMessages), "AI"),
+	})
+	if err != nil {
+		return "", err
+	}
 
-	// Reuse GenerateSimpleResponse logic effectively by calling makeRequest loop
-	return s.GenerateSimpleResponse(prompt)
+	return s.GenerateSimpleResponse(ctx, usage, prompt)
 }
 
-func (s *AiChatService) GenerateSimpleResponse(prompt string) (string, error) {
+// GenerateSimpleResponse answers a single prompt with the models assigned to
+// usage.Feature
+func (s *AiChatService) GenerateSimpleResponse(ctx context.Context, usage UsageContext, prompt string) (string, error) {
 	messages := []map[string]string{
 		{"role": "user", "content": prompt},
 	}
-
-	// 1. Try Default Model
-	defaultModelID := s.getModel("gpt4o")
-	log.Printf("[AiChatService] Attempting simple response with primary model: %s", defaultModelID)
-
-	content, err := s.makeRequest(defaultModelID, messages)
-	if err == nil {
-		return content, nil
-	}
-
-	log.Printf("[AiChatService] Primary model %s failed: %v. Initiating fallback...", defaultModelID, err)
-
-	// 2. Fallback Loop
-	fallbacks := s.getFallbackModels(defaultModelID)
-	for _, fbModel := range fallbacks {
-		log.Printf("[AiChatService] Retrying with fallback model: %s", fbModel.ModelID)
-		content, err := s.makeRequest(fbModel.ModelID, messages)
-		if err == nil {
-			return content, nil
-		}
-	}
-
-	return "", fmt.Errorf("all AI models failed")
+	completion, err := s.cachedComplete(ctx, usage, "", messages, CompletionOptions{})
+	return completion.Content, err
 }
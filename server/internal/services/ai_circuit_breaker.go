@@ -0,0 +1,178 @@
+package services
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+// Circuit breaker states
+const (
+	CircuitClosed   = "closed"    // calls go through
+	CircuitOpen     = "open"      // calls are skipped until the cooldown ends
+	CircuitHalfOpen = "half_open" // one probe call decides whether to close again
+)
+
+const (
+	// circuitFailureThreshold consecutive failures open a model's circuit
+	circuitFailureThreshold = 3
+	// circuitBaseCooldown is the first open period; it doubles every time a
+	// probe fails, up to circuitMaxCooldown
+	circuitBaseCooldown = 30 * time.Second
+	circuitMaxCooldown  = 10 * time.Minute
+)
+
+// CircuitStatus is the breaker state of one model
+type CircuitStatus struct {
+	ModelID             string     `json:"modelId"`
+	State               string     `json:"state"`
+	ConsecutiveFailures int        `json:"consecutiveFailures"`
+	OpenUntil           *time.Time `json:"openUntil,omitempty"`
+	LastError           string     `json:"lastError,omitempty"`
+}
+
+type circuit struct {
+	state    string
+	failures int
+	cooldown time.Duration
+	until    time.Time
+	probing  bool
+	lastErr  string
+}
+
+// circuitBreakers keeps one breaker per model, fed by the outcome of real
+// calls, so a failing model is skipped instead of being retried by every
+// request.
+type circuitBreakers struct {
+	mu       sync.Mutex
+	circuits map[string]*circuit
+	now      func() time.Time
+}
+
+func newCircuitBreakers() *circuitBreakers {
+	return &circuitBreakers{circuits: make(map[string]*circuit), now: time.Now}
+}
+
+func (b *circuitBreakers) get(modelID string) *circuit {
+	c, ok := b.circuits[modelID]
+	if !ok {
+		c = &circuit{state: CircuitClosed, cooldown: circuitBaseCooldown}
+		b.circuits[modelID] = c
+	}
+	return c
+}
+
+// Allow reports whether a call to the model may be made. When the cooldown of
+// an open circuit has passed, exactly one caller is let through as a probe.
+func (b *circuitBreakers) Allow(modelID string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	c := b.get(modelID)
+	switch c.state {
+	case CircuitOpen:
+		if b.now().Before(c.until) {
+			return false
+		}
+		c.state = CircuitHalfOpen
+		c.probing = true
+		return true
+	case CircuitHalfOpen:
+		if c.probing {
+			return false
+		}
+		c.probing = true
+		return true
+	}
+	return true
+}
+
+// Available is Allow without claiming the probe, for ordering candidates
+func (b *circuitBreakers) Available(modelID string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	// Models never called have no circuit yet; don't create one just to look
+	c, ok := b.circuits[modelID]
+	if !ok {
+		return true
+	}
+	switch c.state {
+	case CircuitOpen:
+		return !b.now().Before(c.until)
+	case CircuitHalfOpen:
+		return !c.probing
+	}
+	return true
+}
+
+// Success closes the model's circuit
+func (b *circuitBreakers) Success(modelID string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	c := b.get(modelID)
+	if c.state != CircuitClosed {
+		log.Printf("[CircuitBreaker] %s recovered, closing circuit", modelID)
+	}
+	*c = circuit{state: CircuitClosed, cooldown: circuitBaseCooldown}
+}
+
+// Failure counts a failed call and opens the circuit once the threshold is
+// reached, or again straight away when a half-open probe fails
+func (b *circuitBreakers) Failure(modelID string, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	c := b.get(modelID)
+	c.failures++
+	c.lastErr = err.Error()
+
+	switch {
+	case c.state == CircuitHalfOpen:
+		c.cooldown *= 2
+		if c.cooldown > circuitMaxCooldown {
+			c.cooldown = circuitMaxCooldown
+		}
+	case c.failures < circuitFailureThreshold:
+		return
+	}
+
+	c.state = CircuitOpen
+	c.probing = false
+	c.until = b.now().Add(c.cooldown)
+	log.Printf("[CircuitBreaker] Opening circuit for %s for %s after %d failures: %v", modelID, c.cooldown, c.failures, err)
+}
+
+// Release gives up a claimed probe without an outcome, e.g. when the caller
+// cancelled the request
+func (b *circuitBreakers) Release(modelID string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if c, ok := b.circuits[modelID]; ok && c.state == CircuitHalfOpen {
+		c.probing = false
+	}
+}
+
+// Snapshot returns the state of every model that has been called
+func (b *circuitBreakers) Snapshot() []CircuitStatus {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	statuses := make([]CircuitStatus, 0, len(b.circuits))
+	for modelID, c := range b.circuits {
+		status := CircuitStatus{
+			ModelID:             modelID,
+			State:               c.state,
+			ConsecutiveFailures: c.failures,
+			LastError:           c.lastErr,
+		}
+		if c.state == CircuitOpen {
+			until := c.until
+			status.OpenUntil = &until
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
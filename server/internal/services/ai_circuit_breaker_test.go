@@ -0,0 +1,62 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreakerOpensAndProbes(t *testing.T) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	b := newCircuitBreakers()
+	b.now = func() time.Time { return now }
+	failure := errors.New("boom")
+
+	for i := 0; i < circuitFailureThreshold; i++ {
+		if !b.Allow("gpt4o") {
+			t.Fatalf("call %d was refused before the threshold", i)
+		}
+		b.Failure("gpt4o", failure)
+	}
+	if b.Allow("gpt4o") || b.Available("gpt4o") {
+		t.Fatal("circuit should be open after the threshold")
+	}
+
+	now = now.Add(circuitBaseCooldown)
+	if !b.Available("gpt4o") {
+		t.Error("circuit should be available once the cooldown has passed")
+	}
+	if !b.Allow("gpt4o") {
+		t.Fatal("one probe should be let through")
+	}
+	if b.Allow("gpt4o") || b.Available("gpt4o") {
+		t.Error("only one probe may run at a time")
+	}
+
+	b.Failure("gpt4o", failure)
+	now = now.Add(circuitBaseCooldown)
+	if b.Available("gpt4o") {
+		t.Error("a failed probe should double the cooldown")
+	}
+	now = now.Add(circuitBaseCooldown)
+	if !b.Allow("gpt4o") {
+		t.Fatal("probe after the doubled cooldown should be allowed")
+	}
+	b.Success("gpt4o")
+	if !b.Allow("gpt4o") || !b.Allow("gpt4o") {
+		t.Error("circuit should be closed after a successful probe")
+	}
+}
+
+func TestCircuitLookupsDoNotCreateCircuits(t *testing.T) {
+	b := newCircuitBreakers()
+	for _, modelID := range []string{"a", "b", "c"} {
+		if !b.Available(modelID) {
+			t.Errorf("%s: unknown models are available", modelID)
+		}
+		b.Release(modelID)
+	}
+	if got := len(b.Snapshot()); got != 0 {
+		t.Errorf("lookups created %d circuits", got)
+	}
+}
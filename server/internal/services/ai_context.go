@@ -0,0 +1,185 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"rag-agent-server/internal/database"
+	"rag-agent-server/internal/models"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	// defaultContextTokenBudget bounds the prompt size of room replies
+	defaultContextTokenBudget = 3000
+	// MaxContextMessages is how many recent messages callers should load;
+	// the token budget decides how many of them are actually sent
+	MaxContextMessages = 100
+	// rollingSummaryBatch is how many messages must fall out of the window
+	// before the rolling summary is refreshed
+	rollingSummaryBatch = 10
+)
+
+// estimateTokens is a cheap approximation that works for Latin and Cyrillic text
+func estimateTokens(text string) int {
+	return utf8.RuneCountInString(text)/3 + 4
+}
+
+// senderNames resolves message authors to display names, preferring the spiritual name
+func senderNames(messages []models.Message) map[uint]string {
+	var ids []uint
+	seen := make(map[uint]bool)
+	for _, m := range messages {
+		if m.SenderID != 0 && !seen[m.SenderID] {
+			seen[m.SenderID] = true
+			ids = append(ids, m.SenderID)
+		}
+	}
+
+	names := make(map[uint]string)
+	if len(ids) == 0 {
+		return names
+	}
+
+	var users []models.User
+	database.DB.Select("id", "spiritual_name", "karmic_name").Where("id IN ?", ids).Find(&users)
+	for _, u := range users {
+		switch {
+		case strings.TrimSpace(u.SpiritualName) != "":
+			names[u.ID] = strings.TrimSpace(u.SpiritualName)
+		case strings.TrimSpace(u.KarmicName) != "":
+			names[u.ID] = strings.TrimSpace(u.KarmicName)
+		}
+	}
+	for _, id := range ids {
+		if names[id] == "" {
+			names[id] = fmt.Sprintf("User %d", id)
+		}
+	}
+	return names
+}
+
+// chatMessage maps a stored room message to a chat completion message.
+// The assistant's own messages (SenderID 0) keep the assistant role and
+// system announcements get the system role, so the model doesn't take them
+// for its earlier replies. Everyone else speaks as a user prefixed with
+// their name.
+func chatMessage(m models.Message, names map[uint]string) map[string]string {
+	if m.System {
+		return map[string]string{"role": "system", "content": "Announcement: " + m.Content}
+	}
+	if m.SenderID == 0 {
+		return map[string]string{"role": "assistant", "content": m.Content}
+	}
+	return map[string]string{
+		"role":    "user",
+		"content": fmt.Sprintf("%s: %s", names[m.SenderID], m.Content),
+	}
+}
+
+// formatConversation renders messages as a plain "Name: text" transcript
+func formatConversation(messages []models.Message, names map[uint]string, assistantName string) string {
+	var b strings.Builder
+	for _, m := range messages {
+		name := names[m.SenderID]
+		if m.System {
+			name = "Announcement"
+		} else if m.SenderID == 0 {
+			name = assistantName
+		}
+		fmt.Fprintf(&b, "%s: %s\n", name, m.Content)
+	}
+	return b.String()
+}
+
+// buildRoomConversation turns the system prompt and chronological history into
+// chat messages that fit the room's token budget. Newest messages win; older
+// ones are folded into a rolling summary when the room has it enabled.
+func (s *AiChatService) buildRoomConversation(ctx context.Context, room models.Room, settings models.RoomAiSettings, systemPrompt string, history []models.Message) []map[string]string {
+	budget := settings.ContextTokenBudget
+	if budget <= 0 {
+		budget = defaultContextTokenBudget
+	}
+
+	historyBudget := budget - estimateTokens(systemPrompt)
+	if settings.RollingSummary {
+		// Leave room for the summary of older messages
+		historyBudget -= budget / 5
+	}
+
+	names := senderNames(history)
+	mapped := make([]map[string]string, len(history))
+	for i, m := range history {
+		mapped[i] = chatMessage(m, names)
+	}
+
+	// Walk back from the newest message; always keep at least one
+	start := len(history)
+	used := 0
+	for i := len(history) - 1; i >= 0; i-- {
+		cost := estimateTokens(mapped[i]["content"])
+		if used+cost > historyBudget && start < len(history) {
+			break
+		}
+		used += cost
+		start = i
+	}
+
+	messages := []map[string]string{{"role": "system", "content": systemPrompt}}
+
+	if settings.RollingSummary {
+		assistantName := settings.Persona
+		if assistantName == "" {
+			assistantName = "AI"
+		}
+		if summary := s.rollingSummary(ctx, room, settings.Language, history[:start], names, assistantName); summary != "" {
+			messages = append(messages, map[string]string{
+				"role":    "system",
+				"content": "Summary of the earlier conversation:\n" + summary,
+			})
+		}
+	}
+
+	return append(messages, mapped[start:]...)
+}
+
+// rollingSummary returns the stored summary of older room history, first
+// folding in dropped messages once enough of them have accumulated.
+func (s *AiChatService) rollingSummary(ctx context.Context, room models.Room, language string, dropped []models.Message, names map[uint]string, assistantName string) string {
+	stored := models.RoomContextSummary{RoomID: room.ID}
+	database.DB.Where("room_id = ?", room.ID).First(&stored)
+
+	var fresh []models.Message
+	for _, m := range dropped {
+		if m.ID > stored.UpToMessageID {
+			fresh = append(fresh, m)
+		}
+	}
+	if len(fresh) < rollingSummaryBatch {
+		return stored.Summary
+	}
+
+	prompt, err := s.prompts.Render(PromptContextSummary, language, PromptData{
+		"Room":         PromptRoom{Name: room.Name, Description: room.Description},
+		"Summary":      stored.Summary,
+		"Conversation": formatConversation(fresh, names, assistantName),
+	})
+	if err != nil {
+		log.Printf("[AiChatService] Failed to render rolling summary prompt for room %d: %v", room.ID, err)
+		return stored.Summary
+	}
+
+	summary, err := s.GenerateSimpleResponse(ctx, SystemUsage(FeatureContextSummary), prompt)
+	if err != nil {
+		log.Printf("[AiChatService] Failed to update rolling summary for room %d: %v", room.ID, err)
+		return stored.Summary
+	}
+
+	stored.Summary = strings.TrimSpace(summary)
+	stored.UpToMessageID = fresh[len(fresh)-1].ID
+	if err := database.DB.Save(&stored).Error; err != nil {
+		log.Printf("[AiChatService] Failed to save rolling summary for room %d: %v", room.ID, err)
+	}
+	return stored.Summary
+}
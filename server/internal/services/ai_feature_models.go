@@ -0,0 +1,108 @@
+package services
+
+import (
+	"rag-agent-server/internal/database"
+	"rag-agent-server/internal/models"
+	"strings"
+)
+
+// AiFeatures lists every feature models can be assigned to
+var AiFeatures = []string{
+	FeatureRoomReply,
+	FeatureRoomSummary,
+	FeatureContextSummary,
+	FeatureDatingCompatibility,
+	FeatureModeration,
+	FeatureChatProxy,
+}
+
+// IsAiFeature reports whether feature is one of AiFeatures
+func IsAiFeature(feature string) bool {
+	for _, f := range AiFeatures {
+		if f == feature {
+			return true
+		}
+	}
+	return false
+}
+
+// FeatureModels is the model assignment of one feature
+type FeatureModels struct {
+	Feature        string   `json:"feature"`
+	PrimaryModelID string   `json:"primaryModelId"`
+	Fallbacks      []string `json:"fallbackModelIds"`
+	// IsDefault is set when no assignment is stored and the defaults apply
+	IsDefault bool `json:"isDefault"`
+}
+
+// SplitModelList parses a comma separated list of model IDs
+func SplitModelList(list string) []string {
+	ids := []string{}
+	for _, id := range strings.Split(list, ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// FeatureModels returns the models assigned to a feature, falling back to
+// DEFAULT_ASTRO_MODEL with automatic fallbacks
+func (s *AiChatService) FeatureModels(feature string) FeatureModels {
+	assignment := FeatureModels{
+		Feature:        feature,
+		PrimaryModelID: s.cfg.Get().AI.DefaultModel,
+		Fallbacks:      []string{},
+		IsDefault:      true,
+	}
+
+	var stored models.AiFeatureModel
+	if err := database.DB.Where("feature = ?", feature).First(&stored).Error; err == nil {
+		assignment.IsDefault = false
+		if stored.PrimaryModelID != "" {
+			assignment.PrimaryModelID = stored.PrimaryModelID
+		}
+		assignment.Fallbacks = SplitModelList(stored.FallbackModelIDs)
+	}
+	return assignment
+}
+
+// modelUsable reports whether a model exists, is enabled and not deprecated
+func modelUsable(modelID string) bool {
+	var count int64
+	database.DB.Model(&models.AiModel{}).
+		Where("model_id = ? AND is_enabled = ? AND is_deprecated = ?", modelID, true, false).
+		Count(&count)
+	return count > 0
+}
+
+// featureFallbacks returns the fallback models for a call: the feature's
+// ordered list when one is assigned, otherwise automatically ranked models.
+// Models that are disabled, deprecated or have an open circuit are skipped.
+func (s *AiChatService) featureFallbacks(feature, primaryModelID string) []string {
+	assigned := s.FeatureModels(feature).Fallbacks
+	if len(assigned) == 0 {
+		var ids []string
+		for _, model := range s.getFallbackModels(primaryModelID) {
+			ids = append(ids, model.ModelID)
+		}
+		return ids
+	}
+
+	var usable []string
+	database.DB.Model(&models.AiModel{}).
+		Where("model_id IN ? AND is_enabled = ? AND is_deprecated = ?", assigned, true, false).
+		Pluck("model_id", &usable)
+	allowed := make(map[string]bool, len(usable))
+	for _, id := range usable {
+		allowed[id] = true
+	}
+
+	var ids []string
+	for _, id := range assigned {
+		if id != primaryModelID && allowed[id] && s.breakers.Available(id) {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
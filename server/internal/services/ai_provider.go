@@ -0,0 +1,211 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"rag-agent-server/internal/config"
+	"strings"
+	"time"
+)
+
+// ChatRequest is a provider-neutral chat completion request
+type ChatRequest struct {
+	Model       string
+	Messages    []map[string]string
+	Temperature *float64
+	// MaxTokens caps the length of the reply; 0 leaves it to the provider
+	MaxTokens int
+	// OnDelta switches the request to streaming mode and receives content chunks
+	OnDelta func(delta string)
+}
+
+// TokenUsage is the token count reported by a provider. Zero values mean the
+// provider did not report usage (e.g. for some streams) and it is estimated.
+type TokenUsage struct {
+	PromptTokens     int
+	CompletionTokens int
+}
+
+// ChatResponse is a provider-neutral chat completion result
+type ChatResponse struct {
+	Content string
+	Usage   TokenUsage
+}
+
+// Provider sends chat completions to one AI vendor using its native API
+type Provider interface {
+	// Name identifies the adapter in logs
+	Name() string
+	// Chat returns the full reply. When req.OnDelta is set the reply is also
+	// delivered incrementally as it is generated. Cancelling ctx aborts the
+	// request, including a stream in progress.
+	Chat(ctx context.Context, req ChatRequest) (ChatResponse, error)
+}
+
+// ProviderError is a non-2xx response from an AI vendor
+type ProviderError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *ProviderError) Error() string {
+	return fmt.Sprintf("status %d", e.StatusCode)
+}
+
+// isRetryable tells whether a failed call may succeed if repeated: rate
+// limits, server errors, timeouts and dropped connections. Client errors,
+// missing configuration and cancellations are final.
+func isRetryable(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var providerErr *ProviderError
+	if errors.As(err, &providerErr) {
+		return providerErr.StatusCode == http.StatusTooManyRequests ||
+			providerErr.StatusCode == http.StatusRequestTimeout ||
+			providerErr.StatusCode >= 500
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+	return errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF)
+}
+
+// Provider kinds an AiModel.Provider value is routed to
+const (
+	ProviderKindGateway    = "gateway"
+	ProviderKindOpenAI     = "openai"
+	ProviderKindAnthropic  = "anthropic"
+	ProviderKindGemini     = "gemini"
+	ProviderKindCompatible = "openai-compatible"
+)
+
+// providerKind maps the vendor name stored on an AiModel to an adapter kind
+func providerKind(provider string) string {
+	switch strings.ToLower(strings.TrimSpace(provider)) {
+	case "openai":
+		return ProviderKindOpenAI
+	case "anthropic":
+		return ProviderKindAnthropic
+	case "google", "gemini":
+		return ProviderKindGemini
+	case "ollama", "local", "lmstudio", "lm studio", "vllm", "openai-compatible":
+		return ProviderKindCompatible
+	}
+	return ProviderKindGateway
+}
+
+// resolveProvider picks the adapter for a model
+func (s *AiChatService) resolveProvider(modelID string) (Provider, error) {
+	if s.providerOverride != nil {
+		return s.providerOverride, nil
+	}
+	return selectProvider(s.cfg.Get().AI, s.getProvider(modelID))
+}
+
+// selectProvider routes a vendor to its adapter. Vendors listed in
+// AI_NATIVE_PROVIDERS whose key is configured are called natively, local
+// servers always are, and everything else goes through the gateway.
+func selectProvider(ai config.AIConfig, provider string) (Provider, error) {
+	switch kind := providerKind(provider); kind {
+	case ProviderKindOpenAI:
+		if ai.UsesNative(kind) && ai.OpenAIAPIKey != "" {
+			return NewOpenAIProvider("OpenAI", ai.OpenAIBaseURL, ai.OpenAIAPIKey), nil
+		}
+	case ProviderKindAnthropic:
+		if ai.UsesNative(kind) && ai.AnthropicAPIKey != "" {
+			return NewAnthropicProvider(ai.AnthropicBaseURL, ai.AnthropicAPIKey), nil
+		}
+	case ProviderKindGemini:
+		if ai.UsesNative(kind) && ai.GeminiAPIKey != "" {
+			return NewGeminiProvider(ai.GeminiBaseURL, ai.GeminiAPIKey), nil
+		}
+	case ProviderKindCompatible:
+		// Local servers usually need no key
+		return NewOpenAIProvider(provider, ai.LocalBaseURL, ai.LocalAPIKey), nil
+	}
+
+	if ai.GatewayAPIKey == "" {
+		return nil, fmt.Errorf("API Key not found for provider: %s", provider)
+	}
+	return &GatewayProvider{url: ai.ChatCompletionsURL(), apiKey: ai.GatewayAPIKey, provider: provider}, nil
+}
+
+// servedByGateway reports whether models of a vendor are called through the
+// gateway rather than natively or on a local server
+func servedByGateway(ai config.AIConfig, provider string) bool {
+	p, err := selectProvider(ai, provider)
+	if err != nil {
+		// Only the gateway route fails for lack of a key
+		return true
+	}
+	_, ok := p.(*GatewayProvider)
+	return ok
+}
+
+// UseProvider routes every request to p regardless of the model's vendor.
+// Passing nil restores normal routing.
+func (s *AiChatService) UseProvider(p Provider) {
+	s.providerOverride = p
+}
+
+func httpClientFor(req ChatRequest) *http.Client {
+	if req.OnDelta != nil {
+		// Streams may legitimately run longer than a buffered reply
+		return &http.Client{Timeout: 3 * time.Minute}
+	}
+	return &http.Client{Timeout: 45 * time.Second}
+}
+
+// postJSON sends a JSON body and returns the response if it succeeded.
+// Non-2xx responses are turned into errors carrying the status code.
+func postJSON(ctx context.Context, client *http.Client, url string, headers map[string]string, body interface{}) (*http.Response, error) {
+	jsonBody, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(jsonBody))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		log.Printf("[AiProvider] Error from %s: %s", url, string(bodyBytes))
+		return nil, &ProviderError{StatusCode: resp.StatusCode, Body: string(bodyBytes)}
+	}
+	return resp, nil
+}
+
+func isEventStream(resp *http.Response) bool {
+	return strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream")
+}
+
+// deliverWhole hands a buffered reply to a streaming caller as a single chunk
+func deliverWhole(req ChatRequest, content string) {
+	if req.OnDelta != nil && content != "" {
+		req.OnDelta(content)
+	}
+}
+
+// streamed wraps the result of reading a stream, which carries no usage
+func streamed(content string, err error) (ChatResponse, error) {
+	return ChatResponse{Content: content}, err
+}
@@ -0,0 +1,145 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+const (
+	anthropicVersion   = "2023-06-01"
+	anthropicMaxTokens = 2048
+)
+
+// AnthropicProvider speaks the Anthropic Messages API
+type AnthropicProvider struct {
+	baseURL string
+	apiKey  string
+}
+
+func NewAnthropicProvider(baseURL, apiKey string) *AnthropicProvider {
+	return &AnthropicProvider{baseURL: baseURL, apiKey: apiKey}
+}
+
+func (p *AnthropicProvider) Name() string {
+	return "Anthropic"
+}
+
+func (p *AnthropicProvider) Chat(ctx context.Context, req ChatRequest) (ChatResponse, error) {
+	// System prompts are a top-level field; the conversation must alternate
+	// user/assistant turns, so consecutive turns of one role are merged.
+	var system []string
+	var messages []map[string]string
+	for _, m := range req.Messages {
+		role := m["role"]
+		if role == "system" {
+			system = append(system, m["content"])
+			continue
+		}
+		if role != "assistant" {
+			role = "user"
+		}
+		if n := len(messages); n > 0 && messages[n-1]["role"] == role {
+			messages[n-1]["content"] += "\n" + m["content"]
+			continue
+		}
+		messages = append(messages, map[string]string{"role": role, "content": m["content"]})
+	}
+	if len(messages) == 0 || messages[0]["role"] != "user" {
+		messages = append([]map[string]string{{"role": "user", "content": "..."}}, messages...)
+	}
+
+	body := map[string]interface{}{
+		"model":      req.Model,
+		"messages":   messages,
+		"max_tokens": anthropicMaxTokens,
+	}
+	if req.MaxTokens > 0 {
+		body["max_tokens"] = req.MaxTokens
+	}
+	if len(system) > 0 {
+		body["system"] = strings.Join(system, "\n\n")
+	}
+	if req.Temperature != nil {
+		// Anthropic accepts 0..1
+		temperature := *req.Temperature
+		if temperature > 1 {
+			temperature = 1
+		}
+		body["temperature"] = temperature
+	}
+	if req.OnDelta != nil {
+		body["stream"] = true
+	}
+
+	headers := map[string]string{
+		"x-api-key":         p.apiKey,
+		"anthropic-version": anthropicVersion,
+	}
+	resp, err := postJSON(ctx, httpClientFor(req), p.baseURL+"/v1/messages", headers, body)
+	if err != nil {
+		return ChatResponse{}, err
+	}
+	defer resp.Body.Close()
+
+	if req.OnDelta != nil && isEventStream(resp) {
+		return streamed(readServerSentEvents(resp.Body, func(data []byte) (string, error) {
+			var event struct {
+				Type  string `json:"type"`
+				Delta struct {
+					Type string `json:"type"`
+					Text string `json:"text"`
+				} `json:"delta"`
+				Error interface{} `json:"error"`
+			}
+			if err := json.Unmarshal(data, &event); err != nil {
+				return "", nil
+			}
+			if event.Type == "error" {
+				errJSON, _ := json.Marshal(event.Error)
+				return "", fmt.Errorf("API error: %s", string(errJSON))
+			}
+			if event.Type == "content_block_delta" && event.Delta.Type == "text_delta" {
+				return event.Delta.Text, nil
+			}
+			return "", nil
+		}, req.OnDelta))
+	}
+
+	var response struct {
+		Content []struct {
+			Type string `json:"type"`
+			Text string `json:"text"`
+		} `json:"content"`
+		Usage struct {
+			InputTokens  int `json:"input_tokens"`
+			OutputTokens int `json:"output_tokens"`
+		} `json:"usage"`
+		Error interface{} `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return ChatResponse{}, err
+	}
+	var content strings.Builder
+	for _, block := range response.Content {
+		if block.Type == "text" {
+			content.WriteString(block.Text)
+		}
+	}
+	if content.Len() == 0 {
+		if response.Error != nil {
+			errJSON, _ := json.Marshal(response.Error)
+			return ChatResponse{}, fmt.Errorf("API error: %s", string(errJSON))
+		}
+		return ChatResponse{}, fmt.Errorf("empty response")
+	}
+	deliverWhole(req, content.String())
+	return ChatResponse{
+		Content: content.String(),
+		Usage: TokenUsage{
+			PromptTokens:     response.Usage.InputTokens,
+			CompletionTokens: response.Usage.OutputTokens,
+		},
+	}, nil
+}
@@ -0,0 +1,55 @@
+package services
+
+import (
+	"context"
+	"strings"
+	"sync"
+)
+
+// FakeProvider is an in-memory Provider for tests and local development.
+// It records every request and answers with Reply (or fails with Err).
+// Streaming requests receive the reply word by word.
+type FakeProvider struct {
+	Reply string
+	Err   error
+
+	mu    sync.Mutex
+	calls []ChatRequest
+}
+
+func NewFakeProvider(reply string) *FakeProvider {
+	return &FakeProvider{Reply: reply}
+}
+
+func (p *FakeProvider) Name() string {
+	return "fake"
+}
+
+func (p *FakeProvider) Chat(ctx context.Context, req ChatRequest) (ChatResponse, error) {
+	p.mu.Lock()
+	p.calls = append(p.calls, req)
+	p.mu.Unlock()
+
+	if p.Err != nil {
+		return ChatResponse{}, p.Err
+	}
+	if req.OnDelta != nil {
+		words := strings.SplitAfter(p.Reply, " ")
+		for _, word := range words {
+			if err := ctx.Err(); err != nil {
+				return ChatResponse{}, err
+			}
+			if word != "" {
+				req.OnDelta(word)
+			}
+		}
+	}
+	return ChatResponse{Content: p.Reply}, nil
+}
+
+// Calls returns the requests received so far
+func (p *FakeProvider) Calls() []ChatRequest {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]ChatRequest(nil), p.calls...)
+}
@@ -0,0 +1,139 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// GeminiProvider speaks the Google Generative Language (Gemini) API
+type GeminiProvider struct {
+	baseURL string
+	apiKey  string
+}
+
+func NewGeminiProvider(baseURL, apiKey string) *GeminiProvider {
+	return &GeminiProvider{baseURL: baseURL, apiKey: apiKey}
+}
+
+// geminiAuth sends the API key as a header, so it stays out of URLs that
+// end up in logs
+func geminiAuth(apiKey string) map[string]string {
+	return map[string]string{"x-goog-api-key": apiKey}
+}
+
+func (p *GeminiProvider) Name() string {
+	return "Gemini"
+}
+
+type geminiResponse struct {
+	Candidates []struct {
+		Content struct {
+			Parts []struct {
+				Text string `json:"text"`
+			} `json:"parts"`
+		} `json:"content"`
+	} `json:"candidates"`
+	UsageMetadata struct {
+		PromptTokenCount     int `json:"promptTokenCount"`
+		CandidatesTokenCount int `json:"candidatesTokenCount"`
+	} `json:"usageMetadata"`
+	Error interface{} `json:"error"`
+}
+
+func (r geminiResponse) text() (string, error) {
+	if r.Error != nil {
+		errJSON, _ := json.Marshal(r.Error)
+		return "", fmt.Errorf("API error: %s", string(errJSON))
+	}
+	var text strings.Builder
+	for _, candidate := range r.Candidates {
+		for _, part := range candidate.Content.Parts {
+			text.WriteString(part.Text)
+		}
+		break // only the first candidate is used
+	}
+	return text.String(), nil
+}
+
+func (p *GeminiProvider) Chat(ctx context.Context, req ChatRequest) (ChatResponse, error) {
+	type part struct {
+		Text string `json:"text"`
+	}
+	type content struct {
+		Role  string `json:"role,omitempty"`
+		Parts []part `json:"parts"`
+	}
+
+	var system []part
+	var contents []content
+	for _, m := range req.Messages {
+		switch m["role"] {
+		case "system":
+			system = append(system, part{Text: m["content"]})
+		case "assistant":
+			contents = append(contents, content{Role: "model", Parts: []part{{Text: m["content"]}}})
+		default:
+			contents = append(contents, content{Role: "user", Parts: []part{{Text: m["content"]}}})
+		}
+	}
+
+	body := map[string]interface{}{"contents": contents}
+	if len(system) > 0 {
+		body["systemInstruction"] = content{Parts: system}
+	}
+	generationConfig := map[string]interface{}{}
+	if req.Temperature != nil {
+		generationConfig["temperature"] = *req.Temperature
+	}
+	if req.MaxTokens > 0 {
+		generationConfig["maxOutputTokens"] = req.MaxTokens
+	}
+	if len(generationConfig) > 0 {
+		body["generationConfig"] = generationConfig
+	}
+
+	model := url.PathEscape(strings.TrimPrefix(req.Model, "models/"))
+	endpoint := fmt.Sprintf("%s/v1beta/models/%s:generateContent", p.baseURL, model)
+	if req.OnDelta != nil {
+		endpoint = fmt.Sprintf("%s/v1beta/models/%s:streamGenerateContent?alt=sse", p.baseURL, model)
+	}
+
+	resp, err := postJSON(ctx, httpClientFor(req), endpoint, geminiAuth(p.apiKey), body)
+	if err != nil {
+		return ChatResponse{}, err
+	}
+	defer resp.Body.Close()
+
+	if req.OnDelta != nil && isEventStream(resp) {
+		return streamed(readServerSentEvents(resp.Body, func(data []byte) (string, error) {
+			var chunk geminiResponse
+			if err := json.Unmarshal(data, &chunk); err != nil {
+				return "", nil
+			}
+			return chunk.text()
+		}, req.OnDelta))
+	}
+
+	var response geminiResponse
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return ChatResponse{}, err
+	}
+	text, err := response.text()
+	if err != nil {
+		return ChatResponse{}, err
+	}
+	if text == "" {
+		return ChatResponse{}, fmt.Errorf("empty response")
+	}
+	deliverWhole(req, text)
+	return ChatResponse{
+		Content: text,
+		Usage: TokenUsage{
+			PromptTokens:     response.UsageMetadata.PromptTokenCount,
+			CompletionTokens: response.UsageMetadata.CandidatesTokenCount,
+		},
+	}, nil
+}
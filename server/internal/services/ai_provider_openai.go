@@ -0,0 +1,153 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// openAIChatResponse is the non-streaming chat completion body shared by
+// OpenAI, the gateway and OpenAI-compatible servers
+type openAIChatResponse struct {
+	Choices []struct {
+		Message struct {
+			Content string `json:"content"`
+		} `json:"message"`
+	} `json:"choices"`
+	Usage struct {
+		PromptTokens     int `json:"prompt_tokens"`
+		CompletionTokens int `json:"completion_tokens"`
+	} `json:"usage"`
+	Error interface{} `json:"error"`
+}
+
+func parseOpenAIResponse(body io.Reader) (ChatResponse, error) {
+	bodyBytes, err := io.ReadAll(body)
+	if err != nil {
+		return ChatResponse{}, err
+	}
+
+	var response openAIChatResponse
+	if err := json.Unmarshal(bodyBytes, &response); err != nil {
+		return ChatResponse{}, err
+	}
+	if len(response.Choices) > 0 {
+		return ChatResponse{
+			Content: response.Choices[0].Message.Content,
+			Usage: TokenUsage{
+				PromptTokens:     response.Usage.PromptTokens,
+				CompletionTokens: response.Usage.CompletionTokens,
+			},
+		}, nil
+	}
+	if response.Error != nil {
+		errJSON, _ := json.Marshal(response.Error)
+		return ChatResponse{}, fmt.Errorf("API error: %s", string(errJSON))
+	}
+	return ChatResponse{}, fmt.Errorf("empty response")
+}
+
+// OpenAIProvider speaks the OpenAI chat completions API. It is also used for
+// OpenAI-compatible local servers such as Ollama, LM Studio or vLLM.
+type OpenAIProvider struct {
+	name    string
+	baseURL string
+	apiKey  string
+}
+
+func NewOpenAIProvider(name, baseURL, apiKey string) *OpenAIProvider {
+	return &OpenAIProvider{name: name, baseURL: baseURL, apiKey: apiKey}
+}
+
+func (p *OpenAIProvider) Name() string {
+	return p.name
+}
+
+func (p *OpenAIProvider) Chat(ctx context.Context, req ChatRequest) (ChatResponse, error) {
+	body := map[string]interface{}{
+		"model":    req.Model,
+		"messages": req.Messages,
+	}
+	if req.Temperature != nil {
+		body["temperature"] = *req.Temperature
+	}
+	if req.MaxTokens > 0 {
+		body["max_tokens"] = req.MaxTokens
+	}
+	if req.OnDelta != nil {
+		body["stream"] = true
+	}
+
+	headers := map[string]string{}
+	if p.apiKey != "" {
+		headers["Authorization"] = "Bearer " + p.apiKey
+	}
+
+	resp, err := postJSON(ctx, httpClientFor(req), p.baseURL+"/chat/completions", headers, body)
+	if err != nil {
+		return ChatResponse{}, err
+	}
+	defer resp.Body.Close()
+
+	if req.OnDelta != nil && isEventStream(resp) {
+		return streamed(readEventStream(resp.Body, req.OnDelta))
+	}
+	response, err := parseOpenAIResponse(resp.Body)
+	if err == nil {
+		deliverWhole(req, response.Content)
+	}
+	return response, err
+}
+
+// GatewayProvider posts to the shared completions webhook, which proxies to the
+// vendor named in the "provider" field. It is used for vendors without a key
+// of their own.
+type GatewayProvider struct {
+	url      string
+	apiKey   string
+	provider string
+}
+
+func (p *GatewayProvider) Name() string {
+	return "gateway/" + p.provider
+}
+
+func (p *GatewayProvider) Chat(ctx context.Context, req ChatRequest) (ChatResponse, error) {
+	// Fix for provider specific model names if needed
+	apiModelID := req.Model
+	if apiModelID == "gpt5" {
+		apiModelID = "gpt4o"
+	}
+
+	body := map[string]interface{}{
+		"model":    apiModelID,
+		"messages": req.Messages,
+		"provider": p.provider,
+	}
+	if req.Temperature != nil {
+		body["temperature"] = *req.Temperature
+	}
+	if req.MaxTokens > 0 {
+		body["max_tokens"] = req.MaxTokens
+	}
+	if req.OnDelta != nil {
+		body["stream"] = true
+	}
+
+	resp, err := postJSON(ctx, httpClientFor(req), p.url, map[string]string{"Authorization": "Bearer " + p.apiKey}, body)
+	if err != nil {
+		return ChatResponse{}, err
+	}
+	defer resp.Body.Close()
+
+	if req.OnDelta != nil && isEventStream(resp) {
+		return streamed(readEventStream(resp.Body, req.OnDelta))
+	}
+	response, err := parseOpenAIResponse(resp.Body)
+	if err == nil {
+		// Upstream ignored "stream": deliver the whole reply as one chunk
+		deliverWhole(req, response.Content)
+	}
+	return response, err
+}
@@ -0,0 +1,219 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"rag-agent-server/internal/config"
+	"strings"
+	"testing"
+)
+
+func testAIConfig() config.AIConfig {
+	return config.AIConfig{
+		GatewayURL:       "https://gateway.example/v1",
+		GatewayAPIKey:    "gateway-key",
+		OpenAIAPIKey:     "openai-key",
+		OpenAIBaseURL:    "https://api.openai.example/v1",
+		AnthropicAPIKey:  "anthropic-key",
+		AnthropicBaseURL: "https://api.anthropic.example",
+		GeminiAPIKey:     "gemini-key",
+		GeminiBaseURL:    "https://gemini.example",
+		LocalBaseURL:     "http://localhost:11434/v1",
+	}
+}
+
+func TestSelectProvider(t *testing.T) {
+	tests := []struct {
+		name     string
+		native   string
+		mutate   func(ai *config.AIConfig)
+		provider string
+		want     string
+	}{
+		{name: "gemini key alone keeps the gateway", provider: "Google", want: "gateway/Google"},
+		{name: "openai key alone keeps the gateway", provider: "OpenAI", want: "gateway/OpenAI"},
+		{name: "gemini opted in", native: "gemini", provider: "Google", want: "Gemini"},
+		{name: "anthropic opted in", native: "openai, Anthropic", provider: "anthropic", want: "Anthropic"},
+		{name: "opted in without a key", native: "openai", mutate: func(ai *config.AIConfig) { ai.OpenAIAPIKey = "" }, provider: "OpenAI", want: "gateway/OpenAI"},
+		{name: "local servers are always native", provider: "Ollama", want: "Ollama"},
+		{name: "unknown vendors use the gateway", native: "openai,anthropic,gemini", provider: "Perplexity", want: "gateway/Perplexity"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ai := testAIConfig()
+			ai.NativeProviders = tt.native
+			if tt.mutate != nil {
+				tt.mutate(&ai)
+			}
+			provider, err := selectProvider(ai, tt.provider)
+			if err != nil {
+				t.Fatalf("selectProvider: %v", err)
+			}
+			if provider.Name() != tt.want {
+				t.Errorf("got %s, want %s", provider.Name(), tt.want)
+			}
+		})
+	}
+}
+
+func TestSelectProviderWithoutGatewayKey(t *testing.T) {
+	ai := testAIConfig()
+	ai.GatewayAPIKey = ""
+	if _, err := selectProvider(ai, "Google"); err == nil {
+		t.Fatal("expected an error when neither a native nor a gateway key applies")
+	}
+}
+
+func newFakeChatService(fake *FakeProvider) *AiChatService {
+	s := &AiChatService{breakers: newCircuitBreakers()}
+	s.UseProvider(fake)
+	return s
+}
+
+func TestTryModelWithFakeProvider(t *testing.T) {
+	fake := NewFakeProvider("hello from the fake")
+	s := newFakeChatService(fake)
+	messages := []map[string]string{{"role": "user", "content": "hi"}}
+	temperature := 0.3
+
+	streamed := false
+	response, err := s.tryModel(context.Background(), UsageContext{}, "gpt4o", messages, CompletionOptions{Temperature: &temperature, MaxTokens: 50}, &streamed)
+	if err != nil {
+		t.Fatalf("tryModel: %v", err)
+	}
+	if response.Content != "hello from the fake" {
+		t.Errorf("content = %q", response.Content)
+	}
+
+	calls := fake.Calls()
+	if len(calls) != 1 {
+		t.Fatalf("got %d calls, want 1", len(calls))
+	}
+	if calls[0].Model != "gpt4o" || calls[0].MaxTokens != 50 || calls[0].Temperature == nil || *calls[0].Temperature != temperature {
+		t.Errorf("request not passed through: %+v", calls[0])
+	}
+}
+
+func TestTryModelStreamsFromFakeProvider(t *testing.T) {
+	fake := NewFakeProvider("one two three")
+	s := newFakeChatService(fake)
+
+	var deltas []string
+	streamed := false
+	response, err := s.tryModel(context.Background(), UsageContext{}, "gpt4o", nil, CompletionOptions{
+		OnDelta: func(delta string) { deltas = append(deltas, delta) },
+	}, &streamed)
+	if err != nil {
+		t.Fatalf("tryModel: %v", err)
+	}
+	if strings.Join(deltas, "") != response.Content || len(deltas) != 3 {
+		t.Errorf("deltas %q do not add up to %q", deltas, response.Content)
+	}
+}
+
+func TestTryModelRetries(t *testing.T) {
+	tests := []struct {
+		name  string
+		err   error
+		calls int
+	}{
+		{name: "server errors are retried", err: &ProviderError{StatusCode: http.StatusServiceUnavailable}, calls: maxAttemptsPerModel},
+		{name: "client errors are final", err: &ProviderError{StatusCode: http.StatusBadRequest}, calls: 1},
+		{name: "other errors are final", err: errors.New("misconfigured"), calls: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := NewFakeProvider("")
+			fake.Err = tt.err
+			s := newFakeChatService(fake)
+
+			streamed := false
+			_, err := s.tryModel(context.Background(), UsageContext{}, "gpt4o", nil, CompletionOptions{}, &streamed)
+			if !errors.Is(err, tt.err) {
+				t.Errorf("err = %v, want %v", err, tt.err)
+			}
+			if got := len(fake.Calls()); got != tt.calls {
+				t.Errorf("got %d calls, want %d", got, tt.calls)
+			}
+		})
+	}
+}
+
+func TestOpenAIProviderChat(t *testing.T) {
+	var body map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/chat/completions" {
+			t.Errorf("path = %s", r.URL.Path)
+		}
+		if got := r.Header.Get("Authorization"); got != "Bearer local-key" {
+			t.Errorf("Authorization = %q", got)
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"choices":[{"message":{"content":"pong"}}],"usage":{"prompt_tokens":3,"completion_tokens":1}}`))
+	}))
+	defer server.Close()
+
+	provider := NewOpenAIProvider("Ollama", server.URL, "local-key")
+	response, err := provider.Chat(context.Background(), ChatRequest{
+		Model:     "llama3",
+		Messages:  []map[string]string{{"role": "user", "content": "ping"}},
+		MaxTokens: 5,
+	})
+	if err != nil {
+		t.Fatalf("Chat: %v", err)
+	}
+	if response.Content != "pong" || response.Usage.PromptTokens != 3 || response.Usage.CompletionTokens != 1 {
+		t.Errorf("response = %+v", response)
+	}
+	if body["model"] != "llama3" || body["max_tokens"] != float64(5) {
+		t.Errorf("body = %v", body)
+	}
+}
+
+func TestProviderErrorStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "overloaded", http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	_, err := NewAnthropicProvider(server.URL, "key").Chat(context.Background(), ChatRequest{Model: "claude"})
+	var providerErr *ProviderError
+	if !errors.As(err, &providerErr) || providerErr.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("err = %v, want a 429 ProviderError", err)
+	}
+	if !isRetryable(err) {
+		t.Error("429 should be retryable")
+	}
+}
+
+func TestGeminiProviderSendsKeyInHeader(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("key") != "" {
+			t.Errorf("API key sent in the URL: %s", r.URL)
+		}
+		if got := r.Header.Get("x-goog-api-key"); got != "gemini-key" {
+			t.Errorf("x-goog-api-key = %q", got)
+		}
+		if r.URL.Path != "/v1beta/models/gemini-pro:generateContent" {
+			t.Errorf("path = %s", r.URL.Path)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"candidates":[{"content":{"parts":[{"text":"pong"}]}}]}`))
+	}))
+	defer server.Close()
+
+	response, err := NewGeminiProvider(server.URL, "gemini-key").Chat(context.Background(), ChatRequest{
+		Model:    "models/gemini-pro",
+		Messages: []map[string]string{{"role": "user", "content": "ping"}},
+	})
+	if err != nil {
+		t.Fatalf("Chat: %v", err)
+	}
+	if response.Content != "pong" {
+		t.Errorf("content = %q", response.Content)
+	}
+}
@@ -0,0 +1,322 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"rag-agent-server/internal/database"
+	"rag-agent-server/internal/models"
+	"rag-agent-server/internal/websocket"
+	"strings"
+	"sync"
+	"time"
+)
+
+// AiTriggerKind is what a room message asks the assistant to do
+type AiTriggerKind int
+
+const (
+	AiTriggerNone AiTriggerKind = iota
+	AiTriggerReply
+	AiTriggerSummary
+)
+
+// DetectAiTrigger decides whether a room message should wake up the assistant.
+// Slash commands (/ask, /summary) always work, @mentions work in "mention" and
+// "every" modes, and any message triggers a reply in "every" mode.
+func DetectAiTrigger(content string, settings models.RoomAiSettings) AiTriggerKind {
+	text := strings.ToLower(strings.TrimSpace(content))
+
+	if command := strings.Fields(text); len(command) > 0 {
+		switch command[0] {
+		case "/summary":
+			return AiTriggerSummary
+		case "/ask", "/ai":
+			return AiTriggerReply
+		}
+	}
+
+	if settings.TriggerMode == models.AiTriggerCommand {
+		return AiTriggerNone
+	}
+
+	mentions := []string{"@ai"}
+	if settings.Persona != "" {
+		mentions = append(mentions, "@"+strings.ToLower(strings.ReplaceAll(settings.Persona, " ", "")))
+	}
+	for _, mention := range mentions {
+		if strings.Contains(text, mention) {
+			return AiTriggerReply
+		}
+	}
+
+	if settings.TriggerMode == models.AiTriggerEvery {
+		return AiTriggerReply
+	}
+	return AiTriggerNone
+}
+
+// aiGenerationTimeout bounds one assistant reply or summary, fallbacks included
+const aiGenerationTimeout = 3 * time.Minute
+
+// roomAiQueue serializes assistant work for one room
+type roomAiQueue struct {
+	timer     *time.Timer
+	reply     bool // a reply is pending
+	summary   bool // a summary is pending
+	running   bool
+	lastReply time.Time
+	// requestedBy is the user whose message triggered the pending work;
+	// the AI usage is attributed to them
+	requestedBy uint
+}
+
+// AiReplyDispatcher debounces bursts of room messages, enforces a per-room
+// cooldown between assistant replies and makes sure only one reply per room
+// is being generated at a time. A room's queue is dropped once it has been
+// idle for a cooldown.
+type AiReplyDispatcher struct {
+	aiService *AiChatService
+	hub       *websocket.Hub
+	debounce  time.Duration
+	cooldown  time.Duration
+
+	mu    sync.Mutex
+	rooms map[uint]*roomAiQueue
+}
+
+func NewAiReplyDispatcher(aiService *AiChatService, hub *websocket.Hub) *AiReplyDispatcher {
+	return &AiReplyDispatcher{
+		aiService: aiService,
+		hub:       hub,
+		debounce:  3 * time.Second,
+		cooldown:  20 * time.Second,
+		rooms:     make(map[uint]*roomAiQueue),
+	}
+}
+
+// Enqueue inspects a freshly sent room message and schedules assistant work if needed
+func (d *AiReplyDispatcher) Enqueue(msg models.Message) {
+	if msg.RoomID == 0 || msg.SenderID == 0 {
+		return
+	}
+
+	var room models.Room
+	if err := database.DB.First(&room, msg.RoomID).Error; err != nil || !room.AiEnabled || room.IsArchived {
+		return
+	}
+
+	settings := d.aiService.GetRoomSettings(room.ID)
+	kind := DetectAiTrigger(msg.Content, settings)
+	if kind == AiTriggerNone {
+		return
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	q := d.queue(room.ID)
+	q.requestedBy = msg.SenderID
+	if kind == AiTriggerSummary {
+		q.summary = true
+	} else {
+		q.reply = true
+	}
+
+	// Debounce: wait for the burst of messages to settle
+	d.schedule(room.ID, q, d.debounce)
+}
+
+func (d *AiReplyDispatcher) queue(roomID uint) *roomAiQueue {
+	q, ok := d.rooms[roomID]
+	if !ok {
+		q = &roomAiQueue{}
+		d.rooms[roomID] = q
+	}
+	return q
+}
+
+// schedule (re)arms the room's timer. Must be called with d.mu held.
+func (d *AiReplyDispatcher) schedule(roomID uint, q *roomAiQueue, delay time.Duration) {
+	if q.timer != nil {
+		q.timer.Stop()
+	}
+	q.timer = time.AfterFunc(delay, func() { d.process(roomID) })
+}
+
+func (d *AiReplyDispatcher) cooldownFor(roomID uint) time.Duration {
+	settings := d.aiService.GetRoomSettings(roomID)
+	if settings.CooldownSeconds > 0 {
+		return time.Duration(settings.CooldownSeconds) * time.Second
+	}
+	return d.cooldown
+}
+
+func (d *AiReplyDispatcher) process(roomID uint) {
+	cooldown := d.cooldownFor(roomID)
+
+	d.mu.Lock()
+	q := d.queue(roomID)
+	if q.running {
+		// The running job re-checks the queue when it finishes
+		d.mu.Unlock()
+		return
+	}
+	if !q.reply && !q.summary {
+		// Nothing pending; forget the room once its cooldown is over
+		if time.Since(q.lastReply) >= cooldown {
+			delete(d.rooms, roomID)
+		}
+		d.mu.Unlock()
+		return
+	}
+	if wait := cooldown - time.Since(q.lastReply); wait > 0 {
+		d.schedule(roomID, q, wait)
+		d.mu.Unlock()
+		return
+	}
+	reply, summary, requestedBy := q.reply, q.summary, q.requestedBy
+	q.reply, q.summary = false, false
+	q.running = true
+	d.mu.Unlock()
+
+	posted := false
+	if summary && d.postSummary(roomID, requestedBy) {
+		posted = true
+	}
+	if reply && d.postReply(roomID, requestedBy) {
+		posted = true
+	}
+
+	d.mu.Lock()
+	q.running = false
+	// A failed call doesn't hold the room for a whole cooldown
+	if posted {
+		q.lastReply = time.Now()
+	}
+	if q.reply || q.summary {
+		// process waits out the cooldown itself
+		d.schedule(roomID, q, 0)
+	} else {
+		d.schedule(roomID, q, cooldown)
+	}
+	d.mu.Unlock()
+}
+
+func (d *AiReplyDispatcher) recentMessages(roomID uint, limit int) []models.Message {
+	var lastMessages []models.Message
+	database.DB.Where("room_id = ? AND moderation_status NOT IN ?", roomID, []string{"held", "removed"}).
+		Order("created_at desc").Limit(limit).Find(&lastMessages)
+
+	// Reverse to get chronological order
+	for i, j := 0, len(lastMessages)-1; i < j; i, j = i+1, j-1 {
+		lastMessages[i], lastMessages[j] = lastMessages[j], lastMessages[i]
+	}
+	return lastMessages
+}
+
+// reportError logs a failed assistant job and tells the requester when their
+// AI quota is the reason
+func (d *AiReplyDispatcher) reportError(kind string, roomID, requestedBy uint, err error) {
+	log.Printf("AI %s Error: %v", kind, err)
+	if quotaErr, ok := err.(*QuotaError); ok && d.hub != nil && requestedBy != 0 {
+		d.hub.SendToUsers([]uint{requestedBy}, websocket.RoomEvent{
+			Event:  "ai_quota_exceeded",
+			RoomID: roomID,
+			UserID: requestedBy,
+			Data:   quotaErr.Error(),
+		})
+	}
+}
+
+// postReply generates and posts a reply, reporting whether one was posted
+func (d *AiReplyDispatcher) postReply(roomID, requestedBy uint) bool {
+	var room models.Room
+	if err := database.DB.First(&room, roomID).Error; err != nil {
+		return false
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), aiGenerationTimeout)
+	defer cancel()
+	usage := UsageContext{UserID: requestedBy, Feature: FeatureRoomReply}
+	if d.hub == nil {
+		reply, err := d.aiService.GenerateReply(ctx, usage, room, d.recentMessages(roomID, MaxContextMessages))
+		if err != nil {
+			log.Printf("AI Reply Error: %v", err)
+			return false
+		}
+		d.post(roomID, reply)
+		return true
+	}
+
+	// Stream the reply as it is generated, then persist it as a regular message
+	streamID := fmt.Sprintf("%d-%d", roomID, time.Now().UnixNano())
+	started := false
+	reply, err := d.aiService.GenerateReplyStream(ctx, usage, room, d.recentMessages(roomID, MaxContextMessages), func(delta string) {
+		if !started {
+			started = true
+			d.streamEvent("ai_stream_start", roomID, websocket.AiStreamDelta{StreamID: streamID})
+		}
+		d.streamEvent("ai_stream_delta", roomID, websocket.AiStreamDelta{StreamID: streamID, Delta: delta})
+	})
+	if err != nil {
+		d.reportError("Reply", roomID, requestedBy, err)
+		if started {
+			d.streamEvent("ai_stream_error", roomID, websocket.AiStreamDelta{StreamID: streamID, Error: "AI reply was interrupted"})
+		}
+		return false
+	}
+
+	// Clients that followed the stream get the message once, with its end
+	aiMsg := d.save(roomID, reply)
+	if started {
+		d.streamEvent("ai_stream_end", roomID, websocket.AiStreamDelta{StreamID: streamID, Message: aiMsg})
+	} else {
+		d.hub.Broadcast(aiMsg)
+	}
+	return true
+}
+
+func (d *AiReplyDispatcher) streamEvent(event string, roomID uint, data websocket.AiStreamDelta) {
+	d.hub.SendToRoom(roomID, websocket.RoomEvent{Event: event, RoomID: roomID, Data: data})
+}
+
+// postSummary generates and posts a summary, reporting whether one was posted
+func (d *AiReplyDispatcher) postSummary(roomID, requestedBy uint) bool {
+	var room models.Room
+	if err := database.DB.First(&room, roomID).Error; err != nil {
+		return false
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), aiGenerationTimeout)
+	defer cancel()
+	usage := UsageContext{UserID: requestedBy, Feature: FeatureRoomSummary}
+	summary, err := d.aiService.GetSummary(ctx, usage, room, d.recentMessages(roomID, 50))
+	if err != nil {
+		d.reportError("Summary", roomID, requestedBy, err)
+		return false
+	}
+	d.post(roomID, "📋 "+summary)
+	return true
+}
+
+// save stores an assistant message in the room
+func (d *AiReplyDispatcher) save(roomID uint, content string) models.Message {
+	aiMsg := models.Message{
+		SenderID: 0, // 0 for AI
+		RoomID:   roomID,
+		Content:  content,
+		Type:     "text",
+	}
+	database.DB.Create(&aiMsg)
+	return aiMsg
+}
+
+// post stores an assistant message and broadcasts it to the room
+func (d *AiReplyDispatcher) post(roomID uint, content string) models.Message {
+	aiMsg := d.save(roomID, content)
+	if d.hub != nil {
+		d.hub.Broadcast(aiMsg)
+	}
+	return aiMsg
+}
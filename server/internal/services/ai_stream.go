@@ -0,0 +1,72 @@
+package services
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// readServerSentEvents consumes a Server-Sent Events body. Every data payload
+// is handed to parse, which extracts the content delta; non-empty deltas are
+// passed to onDelta. It returns the concatenated reply.
+func readServerSentEvents(body io.Reader, parse func(data []byte) (string, error), onDelta func(delta string)) (string, error) {
+	var full strings.Builder
+
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if !strings.HasPrefix(line, "data:") {
+			continue
+		}
+		data := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+		if data == "[DONE]" {
+			break
+		}
+
+		delta, err := parse([]byte(data))
+		if err != nil {
+			return full.String(), err
+		}
+		if delta != "" {
+			full.WriteString(delta)
+			onDelta(delta)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return full.String(), err
+	}
+	if full.Len() == 0 {
+		return "", fmt.Errorf("empty response")
+	}
+	return full.String(), nil
+}
+
+// readEventStream reads an OpenAI-style chat completion stream
+func readEventStream(body io.Reader, onDelta func(delta string)) (string, error) {
+	return readServerSentEvents(body, func(data []byte) (string, error) {
+		var chunk struct {
+			Choices []struct {
+				Delta struct {
+					Content string `json:"content"`
+				} `json:"delta"`
+			} `json:"choices"`
+			Error interface{} `json:"error"`
+		}
+		if err := json.Unmarshal(data, &chunk); err != nil {
+			// Keep-alive comments and vendor extensions are not fatal
+			return "", nil
+		}
+		if chunk.Error != nil {
+			errJSON, _ := json.Marshal(chunk.Error)
+			return "", fmt.Errorf("API error: %s", string(errJSON))
+		}
+		var delta strings.Builder
+		for _, choice := range chunk.Choices {
+			delta.WriteString(choice.Delta.Content)
+		}
+		return delta.String(), nil
+	}, onDelta)
+}
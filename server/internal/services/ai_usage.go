@@ -0,0 +1,194 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"rag-agent-server/internal/database"
+	"rag-agent-server/internal/models"
+	"time"
+)
+
+// AI features, used to attribute usage
+const (
+	FeatureRoomReply           = "room_reply"
+	FeatureRoomSummary         = "room_summary"
+	FeatureContextSummary      = "context_summary"
+	FeatureDatingCompatibility = "dating_compatibility"
+	FeatureModeration          = "moderation"
+	FeatureChatProxy           = "chat_proxy"
+	// FeatureHealthCheck is the model health probes; no model is assigned to it
+	FeatureHealthCheck = "health_check"
+)
+
+// UsageContext says who an AI call is made for and why. Work done by the
+// system itself is recorded with UserID 0 but not subject to quotas; any
+// other call must name the user it is made for.
+type UsageContext struct {
+	UserID  uint
+	Feature string
+	System  bool
+}
+
+// SystemUsage is the context for calls not made on behalf of a user
+func SystemUsage(feature string) UsageContext {
+	return UsageContext{Feature: feature, System: true}
+}
+
+// QuotaError is returned when a user has used up their plan's AI allowance
+type QuotaError struct {
+	Plan   string
+	Reason string
+}
+
+func (e *QuotaError) Error() string {
+	return fmt.Sprintf("AI quota exceeded for plan %s: %s", e.Plan, e.Reason)
+}
+
+// defaultPlanQuotas apply until an admin stores an AiPlanQuota for the plan.
+// They cover the plan codes every installation has; other plans fall back to
+// the trial quota.
+var defaultPlanQuotas = map[string]models.AiPlanQuota{
+	models.PlanTrial:   {Plan: models.PlanTrial, DailyRequests: 20, MonthlyTokens: 100000},
+	models.PlanFree:    {Plan: models.PlanFree, DailyRequests: 5, MonthlyTokens: 20000},
+	models.PlanPremium: {Plan: models.PlanPremium},
+}
+
+// QuotaStatus is a user's consumption against their plan's limits
+type QuotaStatus struct {
+	Plan           string             `json:"plan"`
+	Quota          models.AiPlanQuota `json:"quota"`
+	Unlimited      bool               `json:"unlimited"`
+	RequestsToday  int64              `json:"requestsToday"`
+	TokensMonth    int64              `json:"tokensMonth"`
+	CostMonthUSD   float64            `json:"costMonthUsd"`
+	DayResetsAt    time.Time          `json:"dayResetsAt"`
+	MonthResetsAt  time.Time          `json:"monthResetsAt"`
+	ExceededReason string             `json:"exceededReason,omitempty"`
+}
+
+// UsageMeter records AI calls and enforces per-plan quotas
+type UsageMeter struct{}
+
+func NewUsageMeter() *UsageMeter {
+	return &UsageMeter{}
+}
+
+// PlanQuota returns the stored quota for a plan, or the built-in default
+func (m *UsageMeter) PlanQuota(plan string) models.AiPlanQuota {
+	var quota models.AiPlanQuota
+	if err := database.DB.Where("plan = ?", plan).First(&quota).Error; err == nil {
+		return quota
+	}
+	if quota, ok := defaultPlanQuotas[plan]; ok {
+		return quota
+	}
+	quota = defaultPlanQuotas[models.PlanTrial]
+	quota.Plan = plan
+	return quota
+}
+
+// Status computes a user's current consumption. Admins are never limited.
+func (m *UsageMeter) Status(userID uint) (QuotaStatus, error) {
+	var user models.User
+	if err := database.DB.Select("id", "current_plan", "role").First(&user, userID).Error; err != nil {
+		return QuotaStatus{}, err
+	}
+
+	now := time.Now()
+	dayStart := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	monthStart := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+
+	status := QuotaStatus{
+		Plan:          user.CurrentPlan,
+		Quota:         m.PlanQuota(user.CurrentPlan),
+		DayResetsAt:   dayStart.AddDate(0, 0, 1),
+		MonthResetsAt: monthStart.AddDate(0, 1, 0),
+	}
+	status.Unlimited = user.Role == "admin" || user.Role == "superadmin" ||
+		(status.Quota.DailyRequests == 0 && status.Quota.MonthlyTokens == 0 && status.Quota.MonthlyCostUSD == 0)
+
+	database.DB.Model(&models.AiUsage{}).
+		Where("user_id = ? AND success = ? AND created_at >= ?", userID, true, dayStart).
+		Count(&status.RequestsToday)
+
+	var month struct {
+		Tokens int64
+		Cost   float64
+	}
+	database.DB.Model(&models.AiUsage{}).
+		Select("COALESCE(SUM(total_tokens), 0) AS tokens, COALESCE(SUM(cost), 0) AS cost").
+		Where("user_id = ? AND created_at >= ?", userID, monthStart).
+		Scan(&month)
+	status.TokensMonth = month.Tokens
+	status.CostMonthUSD = month.Cost
+
+	if !status.Unlimited {
+		quota := status.Quota
+		switch {
+		case quota.DailyRequests > 0 && status.RequestsToday >= int64(quota.DailyRequests):
+			status.ExceededReason = fmt.Sprintf("daily limit of %d requests reached", quota.DailyRequests)
+		case quota.MonthlyTokens > 0 && status.TokensMonth >= int64(quota.MonthlyTokens):
+			status.ExceededReason = fmt.Sprintf("monthly limit of %d tokens reached", quota.MonthlyTokens)
+		case quota.MonthlyCostUSD > 0 && status.CostMonthUSD >= quota.MonthlyCostUSD:
+			status.ExceededReason = fmt.Sprintf("monthly budget of $%.2f reached", quota.MonthlyCostUSD)
+		}
+	}
+	return status, nil
+}
+
+// CheckQuota must be called before spending upstream credits for a user.
+// Calls that are neither system work nor made for a known user are refused.
+func (m *UsageMeter) CheckQuota(usage UsageContext) error {
+	if usage.System {
+		return nil
+	}
+	if usage.UserID == 0 {
+		return &QuotaError{Plan: "unknown", Reason: "caller is not identified"}
+	}
+	status, err := m.Status(usage.UserID)
+	if err != nil {
+		// Unknown users cannot be billed
+		return &QuotaError{Plan: "unknown", Reason: "user not found"}
+	}
+	if status.ExceededReason != "" {
+		return &QuotaError{Plan: status.Plan, Reason: status.ExceededReason}
+	}
+	return nil
+}
+
+// Record stores one AI call. Missing token counts are estimated from the
+// prompt and reply, and the cost is derived from the model's prices.
+func (m *UsageMeter) Record(usage UsageContext, modelID, provider string, messages []map[string]string, reply string, tokens TokenUsage, latency time.Duration, callErr error) {
+	record := models.AiUsage{
+		UserID:           usage.UserID,
+		Feature:          usage.Feature,
+		ModelID:          modelID,
+		Provider:         provider,
+		PromptTokens:     tokens.PromptTokens,
+		CompletionTokens: tokens.CompletionTokens,
+		LatencyMs:        latency.Milliseconds(),
+		Success:          callErr == nil,
+	}
+	if callErr != nil {
+		record.Error = callErr.Error()
+	}
+
+	if record.PromptTokens == 0 && record.CompletionTokens == 0 && callErr == nil {
+		record.Estimated = true
+		for _, msg := range messages {
+			record.PromptTokens += estimateTokens(msg["content"])
+		}
+		record.CompletionTokens = estimateTokens(reply)
+	}
+	record.TotalTokens = record.PromptTokens + record.CompletionTokens
+
+	var model models.AiModel
+	if err := database.DB.Select("input_price_per_1k", "output_price_per_1k").Where("model_id = ?", modelID).First(&model).Error; err == nil {
+		record.Cost = float64(record.PromptTokens)/1000*model.InputPricePer1K +
+			float64(record.CompletionTokens)/1000*model.OutputPricePer1K
+	}
+
+	if err := database.DB.Create(&record).Error; err != nil {
+		log.Printf("[AiUsage] Failed to record usage: %v", err)
+	}
+}
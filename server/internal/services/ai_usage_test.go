@@ -0,0 +1,29 @@
+package services
+
+import (
+	"errors"
+	"rag-agent-server/internal/models"
+	"testing"
+)
+
+func TestCheckQuotaCallers(t *testing.T) {
+	meter := NewUsageMeter()
+
+	if err := meter.CheckQuota(SystemUsage(FeatureModeration)); err != nil {
+		t.Errorf("system work must not be limited: %v", err)
+	}
+
+	err := meter.CheckQuota(UsageContext{Feature: FeatureChatProxy})
+	var quotaErr *QuotaError
+	if !errors.As(err, &quotaErr) {
+		t.Fatalf("err = %v, want a QuotaError for an unidentified caller", err)
+	}
+}
+
+func TestDefaultPlanQuotasCoverPlans(t *testing.T) {
+	for _, plan := range []string{models.PlanTrial, models.PlanFree, models.PlanPremium} {
+		if quota, ok := defaultPlanQuotas[plan]; !ok || quota.Plan != plan {
+			t.Errorf("no default quota for plan %s", plan)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"log"
+	"rag-agent-server/internal/config"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TokenIssuer signs and verifies session tokens. A token is
+// "<userID>.<expiry unix>.<HMAC-SHA256 signature>" in base64url; it needs no
+// server-side storage.
+type TokenIssuer struct {
+	secret []byte
+	ttl    time.Duration
+}
+
+func NewTokenIssuer(cfg config.AuthConfig) *TokenIssuer {
+	secret := []byte(cfg.TokenSecret)
+	if len(secret) == 0 {
+		log.Println("[Auth] AUTH_TOKEN_SECRET is not set, sessions will not survive a restart")
+		secret = make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			log.Fatalf("[Auth] Failed to generate a token secret: %v", err)
+		}
+	}
+	return &TokenIssuer{secret: secret, ttl: time.Duration(cfg.TokenTTLHours) * time.Hour}
+}
+
+func (t *TokenIssuer) sign(payload string) string {
+	mac := hmac.New(sha256.New, t.secret)
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// Issue creates a token for the user and returns it with its expiry
+func (t *TokenIssuer) Issue(userID uint) (string, time.Time) {
+	expiresAt := time.Now().Add(t.ttl)
+	payload := fmt.Sprintf("%d.%d", userID, expiresAt.Unix())
+	return payload + "." + t.sign(payload), expiresAt
+}
+
+// Verify checks a token's signature and expiry and returns its user
+func (t *TokenIssuer) Verify(token string) (uint, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return 0, fmt.Errorf("malformed token")
+	}
+	payload := parts[0] + "." + parts[1]
+	if !hmac.Equal([]byte(parts[2]), []byte(t.sign(payload))) {
+		return 0, fmt.Errorf("invalid token signature")
+	}
+
+	userID, err := strconv.ParseUint(parts[0], 10, 64)
+	if err != nil || userID == 0 {
+		return 0, fmt.Errorf("malformed token")
+	}
+	expiry, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("malformed token")
+	}
+	if time.Now().Unix() >= expiry {
+		return 0, fmt.Errorf("token expired")
+	}
+	return uint(userID), nil
+}
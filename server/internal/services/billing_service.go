@@ -0,0 +1,541 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"rag-agent-server/internal/config"
+	"rag-agent-server/internal/database"
+	"rag-agent-server/internal/models"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Entitlements enforced by handlers
+const (
+	EntitlementCompatibilityReports = "compatibility_reports"
+	EntitlementAiRooms              = "ai_rooms"
+	EntitlementPhotos               = "photos"
+)
+
+// EntitlementError is returned when an action needs a higher plan
+type EntitlementError struct {
+	Entitlement string
+	Plan        string
+	Limit       int
+}
+
+func (e *EntitlementError) Error() string {
+	if e.Limit == 0 {
+		return fmt.Sprintf("%s are not included in the %s plan", e.Entitlement, e.Plan)
+	}
+	return fmt.Sprintf("the %s plan allows %d %s", e.Plan, e.Limit, e.Entitlement)
+}
+
+// EntitlementUsage is the limit and current use of one entitlement
+type EntitlementUsage struct {
+	Limit int   `json:"limit"` // models.Unlimited for no limit
+	Used  int64 `json:"used"`
+}
+
+// PlanOffer is a catalogue entry with the prices for one region
+type PlanOffer struct {
+	models.Plan
+	RegionPrices []models.PlanPrice `json:"regionPrices"`
+}
+
+// defaultPlans seed the catalogue of a fresh installation
+var defaultPlans = []models.Plan{
+	{
+		Code: models.PlanTrial, Name: "Trial", SortOrder: 0, IsActive: true,
+		Description:             "Everything you need to get started, free for two weeks",
+		TrialDays:               14,
+		MaxCompatibilityReports: 5, MaxAiRooms: 1, MaxPhotos: 10,
+	},
+	{
+		Code: models.PlanFree, Name: "Free", SortOrder: 1, IsActive: true,
+		Description:             "Basic access to the community",
+		MaxCompatibilityReports: 1, MaxAiRooms: 0, MaxPhotos: 3,
+	},
+	{
+		Code: models.PlanPremium, Name: "Premium", SortOrder: 2, IsActive: true,
+		Description:             "Unlimited compatibility reports, AI rooms and photos",
+		MaxCompatibilityReports: models.Unlimited, MaxAiRooms: models.Unlimited, MaxPhotos: models.Unlimited,
+		Prices: []models.PlanPrice{
+			{Region: "global", Interval: "month", Currency: "USD", AmountCents: 499},
+			{Region: "global", Interval: "year", Currency: "USD", AmountCents: 4990},
+			{Region: "ru", Interval: "month", Currency: "RUB", AmountCents: 39900},
+			{Region: "ru", Interval: "year", Currency: "RUB", AmountCents: 399000},
+			{Region: "in", Interval: "month", Currency: "INR", AmountCents: 29900},
+			{Region: "in", Interval: "year", Currency: "INR", AmountCents: 299000},
+		},
+	},
+}
+
+// BillingService owns the plan catalogue, resolves each user's effective plan
+// (expiring trials and lapsed subscriptions), checks entitlements and applies
+// payment provider webhooks.
+type BillingService struct {
+	cfg      *config.Store
+	interval time.Duration
+	stop     chan struct{}
+}
+
+func NewBillingService(cfg *config.Store) *BillingService {
+	return &BillingService{
+		cfg:      cfg,
+		interval: time.Hour,
+		stop:     make(chan struct{}),
+	}
+}
+
+// SeedDefaultPlans creates the built-in plans that don't exist yet
+func (s *BillingService) SeedDefaultPlans() {
+	for _, plan := range defaultPlans {
+		var count int64
+		database.DB.Model(&models.Plan{}).Where("code = ?", plan.Code).Count(&count)
+		if count > 0 {
+			continue
+		}
+		if err := database.DB.Create(&plan).Error; err != nil {
+			log.Printf("[Billing] Failed to seed plan %s: %v", plan.Code, err)
+		}
+	}
+}
+
+// Start periodically downgrades users whose plan has expired
+func (s *BillingService) Start() {
+	go func() {
+		ticker := time.NewTicker(s.interval)
+		defer ticker.Stop()
+
+		s.expirePlans(time.Now())
+		for {
+			select {
+			case now := <-ticker.C:
+				s.expirePlans(now)
+			case <-s.stop:
+				return
+			}
+		}
+	}()
+}
+
+func (s *BillingService) Stop() {
+	close(s.stop)
+}
+
+func (s *BillingService) expirePlans(now time.Time) {
+	var users []models.User
+	if err := database.DB.Where("plan_expires_at IS NOT NULL AND plan_expires_at <= ? AND current_plan <> ?", now, models.PlanFree).Find(&users).Error; err != nil {
+		log.Printf("[Billing] Failed to fetch expired plans: %v", err)
+		return
+	}
+	for i := range users {
+		s.ResolvePlan(&users[i])
+	}
+}
+
+// Plan returns a plan of the catalogue with its prices
+func (s *BillingService) Plan(code string) (models.Plan, error) {
+	var plan models.Plan
+	err := database.DB.Preload("Prices").Where("code = ?", code).First(&plan).Error
+	return plan, err
+}
+
+// Offers lists active plans with the prices that apply to a region
+func (s *BillingService) Offers(region string) ([]PlanOffer, error) {
+	var plans []models.Plan
+	if err := database.DB.Preload("Prices").Where("is_active = ?", true).Order("sort_order asc").Find(&plans).Error; err != nil {
+		return nil, err
+	}
+
+	offers := make([]PlanOffer, 0, len(plans))
+	for _, plan := range plans {
+		offer := PlanOffer{Plan: plan, RegionPrices: []models.PlanPrice{}}
+		for _, interval := range []string{"month", "year"} {
+			if price, ok := PriceFor(plan, region, interval); ok {
+				offer.RegionPrices = append(offer.RegionPrices, price)
+			}
+		}
+		offers = append(offers, offer)
+	}
+	return offers, nil
+}
+
+// PriceFor picks the plan's price for a region, falling back to "global"
+func PriceFor(plan models.Plan, region, interval string) (models.PlanPrice, bool) {
+	var global *models.PlanPrice
+	for i, price := range plan.Prices {
+		if price.Interval != interval {
+			continue
+		}
+		if price.Region == region {
+			return price, true
+		}
+		if price.Region == "global" {
+			global = &plan.Prices[i]
+		}
+	}
+	if global != nil {
+		return *global, true
+	}
+	return models.PlanPrice{}, false
+}
+
+// ResolvePlan returns the user's effective plan. Trials get their end date on
+// first use, and expired trials or paid periods are downgraded to free.
+func (s *BillingService) ResolvePlan(user *models.User) models.Plan {
+	code := user.CurrentPlan
+	if code == "" {
+		code = models.PlanTrial
+	}
+
+	plan, err := s.Plan(code)
+	if err != nil {
+		plan, err = s.Plan(models.PlanFree)
+		if err != nil {
+			return models.Plan{Code: models.PlanFree, MaxCompatibilityReports: 0, MaxAiRooms: 0, MaxPhotos: 0}
+		}
+	}
+
+	now := time.Now()
+	if user.PlanExpiresAt == nil && plan.TrialDays > 0 {
+		expiresAt := trialExpiry(*user, plan)
+		user.PlanExpiresAt = &expiresAt
+		database.DB.Model(user).Update("plan_expires_at", expiresAt)
+	}
+
+	if code != models.PlanFree && user.PlanExpiresAt != nil && !user.PlanExpiresAt.After(now) {
+		log.Printf("[Billing] Plan %s of user %d expired, downgrading to free", code, user.ID)
+		database.DB.Model(user).Updates(map[string]interface{}{
+			"current_plan":    models.PlanFree,
+			"plan_expires_at": nil,
+		})
+		database.DB.Model(&models.Subscription{}).
+			Where("user_id = ? AND status IN ?", user.ID, []string{models.SubscriptionActive, models.SubscriptionPastDue, models.SubscriptionCanceled}).
+			Update("status", models.SubscriptionExpired)
+		user.CurrentPlan = models.PlanFree
+		user.PlanExpiresAt = nil
+		if free, err := s.Plan(models.PlanFree); err == nil {
+			return free
+		}
+	}
+	return plan
+}
+
+// trialExpiry is when a trial plan ends for a user. Trials run from sign-up,
+// except for users who signed up before the plan existed: their trial starts
+// when the plan was introduced, so they are not downgraded on the spot.
+func trialExpiry(user models.User, plan models.Plan) time.Time {
+	start := user.CreatedAt
+	if plan.CreatedAt.After(start) {
+		start = plan.CreatedAt
+	}
+	return start.AddDate(0, 0, plan.TrialDays)
+}
+
+func entitlementLimit(plan models.Plan, entitlement string) int {
+	switch entitlement {
+	case EntitlementCompatibilityReports:
+		return plan.MaxCompatibilityReports
+	case EntitlementAiRooms:
+		return plan.MaxAiRooms
+	case EntitlementPhotos:
+		return plan.MaxPhotos
+	}
+	return 0
+}
+
+func entitlementUsed(userID uint, entitlement string) int64 {
+	var used int64
+	switch entitlement {
+	case EntitlementCompatibilityReports:
+		now := time.Now()
+		monthStart := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+		database.DB.Model(&models.DatingCompatibility{}).Where("user_id = ? AND created_at >= ?", userID, monthStart).Count(&used)
+	case EntitlementAiRooms:
+		database.DB.Model(&models.Room{}).Where("owner_id = ? AND ai_enabled = ? AND is_archived = ?", userID, true, false).Count(&used)
+	case EntitlementPhotos:
+		database.DB.Model(&models.Media{}).Where("user_id = ?", userID).Count(&used)
+	}
+	return used
+}
+
+// Entitlements returns the user's plan and the use of each entitlement
+func (s *BillingService) Entitlements(userID uint) (models.Plan, map[string]EntitlementUsage, error) {
+	var user models.User
+	if err := database.DB.First(&user, userID).Error; err != nil {
+		return models.Plan{}, nil, err
+	}
+	plan := s.ResolvePlan(&user)
+
+	usage := make(map[string]EntitlementUsage)
+	for _, entitlement := range []string{EntitlementCompatibilityReports, EntitlementAiRooms, EntitlementPhotos} {
+		usage[entitlement] = EntitlementUsage{
+			Limit: entitlementLimit(plan, entitlement),
+			Used:  entitlementUsed(userID, entitlement),
+		}
+	}
+	return plan, usage, nil
+}
+
+// CheckEntitlement returns an *EntitlementError if the user may not use one
+// more unit of the entitlement. Admins are never limited.
+func (s *BillingService) CheckEntitlement(userID uint, entitlement string) error {
+	var user models.User
+	if err := database.DB.First(&user, userID).Error; err != nil {
+		return &EntitlementError{Entitlement: entitlement, Plan: "unknown"}
+	}
+	if user.Role == "admin" || user.Role == "superadmin" {
+		return nil
+	}
+
+	plan := s.ResolvePlan(&user)
+	limit := entitlementLimit(plan, entitlement)
+	if limit == models.Unlimited {
+		return nil
+	}
+	if entitlementUsed(userID, entitlement) >= int64(limit) {
+		return &EntitlementError{Entitlement: entitlement, Plan: plan.Code, Limit: limit}
+	}
+	return nil
+}
+
+// PaymentProvider returns the configured payment integration
+func (s *BillingService) PaymentProvider(name string) (PaymentProvider, error) {
+	billing := s.cfg.Get().Billing
+	if billing.PaymentProvider == "" || (name != "" && name != billing.PaymentProvider) {
+		return nil, fmt.Errorf("payment provider %q is not enabled", name)
+	}
+	switch billing.PaymentProvider {
+	case "fake":
+		return NewFakePaymentProvider(billing.WebhookSecret), nil
+	}
+	return nil, fmt.Errorf("payment provider %q is not supported", billing.PaymentProvider)
+}
+
+// Checkout starts the purchase of a plan at the user's regional price
+func (s *BillingService) Checkout(userID uint, planCode, interval string) (CheckoutSession, error) {
+	provider, err := s.PaymentProvider("")
+	if err != nil {
+		return CheckoutSession{}, err
+	}
+
+	var user models.User
+	if err := database.DB.First(&user, userID).Error; err != nil {
+		return CheckoutSession{}, fmt.Errorf("user not found")
+	}
+	plan, err := s.Plan(planCode)
+	if err != nil || !plan.IsActive {
+		return CheckoutSession{}, fmt.Errorf("plan %q not found", planCode)
+	}
+	price, ok := PriceFor(plan, user.Region, interval)
+	if !ok {
+		return CheckoutSession{}, fmt.Errorf("plan %q has no %s price", planCode, interval)
+	}
+	session, err := provider.CreateCheckout(user, plan, price)
+	if err != nil {
+		return CheckoutSession{}, err
+	}
+
+	checkout := models.Checkout{
+		Provider:    provider.Name(),
+		ExternalID:  session.ID,
+		UserID:      user.ID,
+		PlanCode:    plan.Code,
+		Interval:    interval,
+		Currency:    price.Currency,
+		AmountCents: price.AmountCents,
+		Status:      models.CheckoutPending,
+	}
+	if err := database.DB.Create(&checkout).Error; err != nil {
+		return CheckoutSession{}, fmt.Errorf("could not store checkout: %v", err)
+	}
+	return session, nil
+}
+
+// HandleWebhook verifies and applies a payment provider notification. Events
+// already processed are acknowledged without being applied again.
+func (s *BillingService) HandleWebhook(providerName string, body []byte, headers map[string]string) error {
+	provider, err := s.PaymentProvider(providerName)
+	if err != nil {
+		return err
+	}
+	event, err := provider.ParseWebhook(body, headers)
+	if err != nil {
+		return err
+	}
+
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		return s.processPaymentEvent(tx, provider.Name(), event, body)
+	})
+}
+
+// processPaymentEvent records an event and applies it unless it was
+// processed before
+func (s *BillingService) processPaymentEvent(tx *gorm.DB, providerName string, event PaymentWebhookEvent, body []byte) error {
+	record := models.PaymentEvent{
+		Provider:   providerName,
+		ExternalID: event.ExternalID,
+		Type:       event.Type,
+		UserID:     event.UserID,
+		Payload:    string(body),
+	}
+	result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&record)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		log.Printf("[Billing] Webhook %s/%s already processed", providerName, event.ExternalID)
+		return nil
+	}
+	return s.applyPaymentEvent(tx, providerName, event)
+}
+
+func (s *BillingService) applyPaymentEvent(tx *gorm.DB, providerName string, event PaymentWebhookEvent) error {
+	var sub models.Subscription
+	found := event.ProviderSubscriptionID != "" &&
+		tx.Where("provider = ? AND provider_subscription_id = ?", providerName, event.ProviderSubscriptionID).First(&sub).Error == nil
+	if found {
+		event.UserID = sub.UserID
+		if event.PlanCode == "" {
+			event.PlanCode = sub.PlanCode
+		}
+	}
+
+	switch event.Type {
+	case PaymentSucceeded:
+		if event.CheckoutID != "" {
+			if err := completeWebhookCheckout(tx, providerName, &event); err != nil {
+				return err
+			}
+		}
+		if event.UserID == 0 || event.PlanCode == "" {
+			return fmt.Errorf("payment event without user or plan")
+		}
+		periodEnd := time.Now().AddDate(0, 1, 0)
+		if event.PeriodEnd != nil {
+			periodEnd = *event.PeriodEnd
+		}
+		if !found {
+			sub = models.Subscription{UserID: event.UserID, Provider: providerName, ProviderSubscriptionID: event.ProviderSubscriptionID}
+		}
+		sub.PlanCode = event.PlanCode
+		sub.Status = models.SubscriptionActive
+		sub.CurrentPeriodEnd = &periodEnd
+		if err := tx.Save(&sub).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.User{}).Where("id = ?", event.UserID).Updates(map[string]interface{}{
+			"current_plan":    event.PlanCode,
+			"plan_expires_at": periodEnd,
+		}).Error
+
+	case PaymentFailed:
+		// The user keeps the plan until the paid period ends
+		if found {
+			return tx.Model(&sub).Update("status", models.SubscriptionPastDue).Error
+		}
+
+	case SubscriptionCancelled:
+		if found {
+			now := time.Now()
+			return tx.Model(&sub).Updates(map[string]interface{}{
+				"status":      models.SubscriptionCanceled,
+				"canceled_at": now,
+			}).Error
+		}
+
+	default:
+		payload, _ := json.Marshal(event)
+		log.Printf("[Billing] Ignoring %s event: %s", event.Type, payload)
+	}
+	return nil
+}
+
+// completeWebhookCheckout marks the checkout a paid webhook refers to
+// completed. The user and plan come from our record when the event leaves
+// them out.
+func completeWebhookCheckout(tx *gorm.DB, providerName string, event *PaymentWebhookEvent) error {
+	var checkout models.Checkout
+	err := tx.Where("provider = ? AND external_id = ?", providerName, event.CheckoutID).First(&checkout).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		log.Printf("[Billing] Webhook %s/%s refers to unknown checkout %s", providerName, event.ExternalID, event.CheckoutID)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if event.UserID == 0 {
+		event.UserID = checkout.UserID
+	}
+	if event.PlanCode == "" {
+		event.PlanCode = checkout.PlanCode
+	}
+	_, err = completeCheckout(tx, checkout.ID, time.Now())
+	return err
+}
+
+// completeCheckout marks a pending checkout completed and reports whether it
+// was still pending. The status condition makes a concurrent completion lose
+// the race.
+func completeCheckout(tx *gorm.DB, id uint, now time.Time) (bool, error) {
+	result := tx.Model(&models.Checkout{}).
+		Where("id = ? AND status = ?", id, models.CheckoutPending).
+		Updates(map[string]interface{}{"status": models.CheckoutCompleted, "completed_at": now})
+	return result.RowsAffected > 0, result.Error
+}
+
+// ErrCheckoutNotFound is returned for checkouts that don't exist, belong to
+// another user or were already completed
+var ErrCheckoutNotFound = errors.New("checkout not found")
+
+// CompleteFakeCheckout pays a pending checkout of the fake provider, so the
+// whole purchase flow can be tried locally without a payment processor. The
+// checkout is consumed: completing it again fails.
+func (s *BillingService) CompleteFakeCheckout(checkoutID string, userID uint) error {
+	provider, err := s.PaymentProvider("fake")
+	if err != nil {
+		return err
+	}
+
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		var checkout models.Checkout
+		err := tx.Where("provider = ? AND external_id = ? AND user_id = ? AND status = ?", provider.Name(), checkoutID, userID, models.CheckoutPending).
+			First(&checkout).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrCheckoutNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+		completed, err := completeCheckout(tx, checkout.ID, now)
+		if err != nil {
+			return err
+		}
+		if !completed {
+			return ErrCheckoutNotFound
+		}
+
+		periodEnd := now.AddDate(0, 1, 0)
+		if checkout.Interval == "year" {
+			periodEnd = now.AddDate(1, 0, 0)
+		}
+		event := PaymentWebhookEvent{
+			ExternalID:             checkout.ExternalID,
+			Type:                   PaymentSucceeded,
+			UserID:                 checkout.UserID,
+			PlanCode:               checkout.PlanCode,
+			ProviderSubscriptionID: checkout.ExternalID,
+			PeriodEnd:              &periodEnd,
+		}
+		body, _ := json.Marshal(event)
+		return s.processPaymentEvent(tx, provider.Name(), event, body)
+	})
+}
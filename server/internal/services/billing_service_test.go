@@ -0,0 +1,264 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"rag-agent-server/internal/config"
+	"rag-agent-server/internal/database"
+	"rag-agent-server/internal/models"
+	"strings"
+	"testing"
+	"time"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+// openTestDB points database.DB at TEST_DATABASE_URL, skipping the test when
+// no database is configured
+func openTestDB(t *testing.T, tables ...interface{}) {
+	t.Helper()
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("connecting to test database: %v", err)
+	}
+	if err := db.AutoMigrate(tables...); err != nil {
+		t.Fatalf("migrating test database: %v", err)
+	}
+	previous := database.DB
+	database.DB = db
+	t.Cleanup(func() { database.DB = previous })
+}
+
+func TestTrialExpiry(t *testing.T) {
+	introduced := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	plan := models.Plan{Code: models.PlanTrial, TrialDays: 14}
+	plan.CreatedAt = introduced
+
+	newUser := models.User{}
+	newUser.CreatedAt = introduced.AddDate(0, 1, 0)
+	if got, want := trialExpiry(newUser, plan), newUser.CreatedAt.AddDate(0, 0, 14); !got.Equal(want) {
+		t.Errorf("new user: trial ends %v, want %v", got, want)
+	}
+
+	legacyUser := models.User{}
+	legacyUser.CreatedAt = introduced.AddDate(-1, 0, 0)
+	if got, want := trialExpiry(legacyUser, plan), introduced.AddDate(0, 0, 14); !got.Equal(want) {
+		t.Errorf("user from before the plan: trial ends %v, want %v", got, want)
+	}
+}
+
+func TestPriceFor(t *testing.T) {
+	plan := models.Plan{Prices: []models.PlanPrice{
+		{Region: "global", Interval: "month", Currency: "USD", AmountCents: 499},
+		{Region: "ru", Interval: "month", Currency: "RUB", AmountCents: 39900},
+		{Region: "global", Interval: "year", Currency: "USD", AmountCents: 4990},
+	}}
+
+	tests := []struct {
+		region, interval string
+		currency         string
+		ok               bool
+	}{
+		{region: "ru", interval: "month", currency: "RUB", ok: true},
+		{region: "in", interval: "month", currency: "USD", ok: true},
+		{region: "ru", interval: "year", currency: "USD", ok: true},
+		{region: "ru", interval: "week", ok: false},
+	}
+	for _, tt := range tests {
+		price, ok := PriceFor(plan, tt.region, tt.interval)
+		if ok != tt.ok || price.Currency != tt.currency {
+			t.Errorf("PriceFor(%s, %s) = %s %v, want %s %v", tt.region, tt.interval, price.Currency, ok, tt.currency, tt.ok)
+		}
+	}
+}
+
+func TestEntitlementLimit(t *testing.T) {
+	plan := models.Plan{MaxCompatibilityReports: 5, MaxAiRooms: models.Unlimited, MaxPhotos: 0}
+	tests := map[string]int{
+		EntitlementCompatibilityReports: 5,
+		EntitlementAiRooms:              models.Unlimited,
+		EntitlementPhotos:               0,
+		"unknown":                       0,
+	}
+	for entitlement, want := range tests {
+		if got := entitlementLimit(plan, entitlement); got != want {
+			t.Errorf("%s: limit %d, want %d", entitlement, got, want)
+		}
+	}
+}
+
+func TestFakeCheckoutIDsAreOpaque(t *testing.T) {
+	provider := NewFakePaymentProvider("secret")
+	user := models.User{}
+	user.ID = 42
+	plan := models.Plan{Code: "premium_family"}
+
+	first, err := provider.CreateCheckout(user, plan, models.PlanPrice{Currency: "USD", AmountCents: 499})
+	if err != nil {
+		t.Fatalf("CreateCheckout: %v", err)
+	}
+	second, _ := provider.CreateCheckout(user, plan, models.PlanPrice{Currency: "USD", AmountCents: 499})
+	if first.ID == second.ID {
+		t.Error("checkout IDs must be unique")
+	}
+	if strings.Contains(first.ID, plan.Code) || strings.Contains(first.ID, "42") {
+		t.Errorf("checkout ID %q must not carry the user or plan", first.ID)
+	}
+	if !strings.HasPrefix(first.URL, "/api/billing/fake-checkout/"+first.ID) {
+		t.Errorf("URL = %q", first.URL)
+	}
+}
+
+func TestFakeWebhookSignature(t *testing.T) {
+	provider := NewFakePaymentProvider("secret")
+	body, _ := json.Marshal(map[string]interface{}{"id": "evt_1", "type": PaymentSucceeded, "userId": 7, "planCode": "premium_family", "checkoutId": "fake_abc"})
+
+	event, err := provider.ParseWebhook(body, map[string]string{"X-Fake-Signature": provider.Sign(body)})
+	if err != nil {
+		t.Fatalf("ParseWebhook: %v", err)
+	}
+	if event.UserID != 7 || event.PlanCode != "premium_family" || event.CheckoutID != "fake_abc" {
+		t.Errorf("event = %+v", event)
+	}
+
+	if _, err := provider.ParseWebhook(body, map[string]string{"X-Fake-Signature": "forged"}); err == nil {
+		t.Error("a forged signature must be rejected")
+	}
+	if _, err := NewFakePaymentProvider("").ParseWebhook(body, map[string]string{"X-Fake-Signature": provider.Sign(body)}); err == nil {
+		t.Error("webhooks must be rejected without a secret")
+	}
+}
+
+func newTestBillingService(t *testing.T) *BillingService {
+	t.Helper()
+	t.Setenv("CONFIG_FILE", "")
+	t.Setenv("PAYMENT_PROVIDER", "fake")
+	t.Setenv("PAYMENT_WEBHOOK_SECRET", "secret")
+	cfg, err := config.Load()
+	if err != nil {
+		t.Fatalf("config.Load: %v", err)
+	}
+	return NewBillingService(config.NewStore(cfg))
+}
+
+func TestCheckoutAndCompletion(t *testing.T) {
+	openTestDB(t, &models.User{}, &models.Plan{}, &models.PlanPrice{}, &models.Subscription{}, &models.Checkout{}, &models.PaymentEvent{})
+	s := newTestBillingService(t)
+
+	// An underscore in the plan code used to break completion
+	code := "premium_test_" + time.Now().Format("150405.000000")
+	plan := models.Plan{Code: code, Name: "Premium test", IsActive: true, MaxAiRooms: models.Unlimited,
+		Prices: []models.PlanPrice{{Region: "global", Interval: "month", Currency: "USD", AmountCents: 499}}}
+	if err := database.DB.Create(&plan).Error; err != nil {
+		t.Fatalf("creating plan: %v", err)
+	}
+	buyer := models.User{Email: code + "@buyer.test", CurrentPlan: models.PlanFree}
+	other := models.User{Email: code + "@other.test", CurrentPlan: models.PlanFree}
+	database.DB.Create(&buyer)
+	database.DB.Create(&other)
+	t.Cleanup(func() {
+		database.DB.Unscoped().Where("user_id IN ?", []uint{buyer.ID, other.ID}).Delete(&models.Checkout{})
+		database.DB.Unscoped().Where("user_id IN ?", []uint{buyer.ID, other.ID}).Delete(&models.Subscription{})
+		database.DB.Unscoped().Where("user_id IN ?", []uint{buyer.ID, other.ID}).Delete(&models.PaymentEvent{})
+		database.DB.Unscoped().Delete(&buyer)
+		database.DB.Unscoped().Delete(&other)
+		database.DB.Unscoped().Where("plan_id = ?", plan.ID).Delete(&models.PlanPrice{})
+		database.DB.Unscoped().Delete(&plan)
+	})
+
+	session, err := s.Checkout(buyer.ID, code, "month")
+	if err != nil {
+		t.Fatalf("Checkout: %v", err)
+	}
+	var stored models.Checkout
+	if err := database.DB.Where("external_id = ?", session.ID).First(&stored).Error; err != nil {
+		t.Fatalf("checkout was not stored: %v", err)
+	}
+	if stored.UserID != buyer.ID || stored.PlanCode != code || stored.Status != models.CheckoutPending || stored.AmountCents != 499 {
+		t.Errorf("stored checkout = %+v", stored)
+	}
+
+	if err := s.CompleteFakeCheckout("fake_unknown", buyer.ID); !errors.Is(err, ErrCheckoutNotFound) {
+		t.Errorf("unknown checkout: err = %v", err)
+	}
+	if err := s.CompleteFakeCheckout(session.ID, other.ID); !errors.Is(err, ErrCheckoutNotFound) {
+		t.Errorf("another user's checkout: err = %v", err)
+	}
+	if err := s.CompleteFakeCheckout(session.ID, buyer.ID); err != nil {
+		t.Fatalf("CompleteFakeCheckout: %v", err)
+	}
+	if err := s.CompleteFakeCheckout(session.ID, buyer.ID); !errors.Is(err, ErrCheckoutNotFound) {
+		t.Errorf("completing twice: err = %v", err)
+	}
+
+	var paid models.User
+	database.DB.First(&paid, buyer.ID)
+	if paid.CurrentPlan != code || paid.PlanExpiresAt == nil || !paid.PlanExpiresAt.After(time.Now()) {
+		t.Errorf("buyer plan = %s until %v", paid.CurrentPlan, paid.PlanExpiresAt)
+	}
+	database.DB.First(&stored, stored.ID)
+	if stored.Status != models.CheckoutCompleted || stored.CompletedAt == nil {
+		t.Errorf("checkout not consumed: %+v", stored)
+	}
+
+	resolved := s.ResolvePlan(&paid)
+	if resolved.Code != code || entitlementLimit(resolved, EntitlementAiRooms) != models.Unlimited {
+		t.Errorf("resolved plan = %s", resolved.Code)
+	}
+
+	// A paid webhook completes the checkout it refers to, taking the user and
+	// plan from our record
+	session, err = s.Checkout(other.ID, code, "month")
+	if err != nil {
+		t.Fatalf("Checkout: %v", err)
+	}
+	provider := NewFakePaymentProvider("secret")
+	body, _ := json.Marshal(map[string]interface{}{"id": "evt_" + session.ID, "type": PaymentSucceeded, "checkoutId": session.ID})
+	if err := s.HandleWebhook("fake", body, map[string]string{"X-Fake-Signature": provider.Sign(body)}); err != nil {
+		t.Fatalf("HandleWebhook: %v", err)
+	}
+	var viaWebhook models.Checkout
+	database.DB.Where("external_id = ?", session.ID).First(&viaWebhook)
+	if viaWebhook.Status != models.CheckoutCompleted || viaWebhook.CompletedAt == nil {
+		t.Errorf("webhook left the checkout %+v", viaWebhook)
+	}
+	database.DB.First(&paid, other.ID)
+	if paid.CurrentPlan != code {
+		t.Errorf("webhook buyer plan = %s", paid.CurrentPlan)
+	}
+	if err := s.CompleteFakeCheckout(session.ID, other.ID); !errors.Is(err, ErrCheckoutNotFound) {
+		t.Errorf("completing a checkout paid by webhook: err = %v", err)
+	}
+}
+
+func TestResolvePlanGrandfathersTrials(t *testing.T) {
+	openTestDB(t, &models.User{}, &models.Plan{}, &models.PlanPrice{}, &models.Subscription{})
+	s := newTestBillingService(t)
+	s.SeedDefaultPlans()
+
+	trial, err := s.Plan(models.PlanTrial)
+	if err != nil {
+		t.Fatalf("trial plan: %v", err)
+	}
+
+	legacy := models.User{Email: time.Now().Format("150405.000000") + "@legacy.test", CurrentPlan: models.PlanTrial}
+	database.DB.Create(&legacy)
+	t.Cleanup(func() { database.DB.Unscoped().Delete(&legacy) })
+	// Signed up long before trials were enforced
+	legacy.CreatedAt = trial.CreatedAt.AddDate(-1, 0, 0)
+	database.DB.Model(&legacy).Update("created_at", legacy.CreatedAt)
+
+	resolved := s.ResolvePlan(&legacy)
+	if trial.CreatedAt.AddDate(0, 0, trial.TrialDays).After(time.Now()) && resolved.Code != models.PlanTrial {
+		t.Errorf("legacy user was downgraded to %s", resolved.Code)
+	}
+	if legacy.PlanExpiresAt == nil || !legacy.PlanExpiresAt.Equal(trialExpiry(legacy, trial)) {
+		t.Errorf("trial ends %v, want %v", legacy.PlanExpiresAt, trialExpiry(legacy, trial))
+	}
+}
@@ -0,0 +1,102 @@
+package services
+
+import (
+	"strings"
+	"unicode"
+)
+
+// ChunkText splits text into pieces of at most size characters for
+// embedding. Paragraphs are kept together where they fit, then sentences,
+// then words; consecutive chunks share up to overlap characters so a fact on
+// a boundary is found from either side.
+func ChunkText(text string, size, overlap int) []string {
+	if size <= 0 {
+		return nil
+	}
+	if overlap < 0 || overlap >= size {
+		overlap = 0
+	}
+
+	var chunks []string
+	var current []rune
+	flush := func() {
+		if chunk := strings.TrimSpace(string(current)); chunk != "" {
+			chunks = append(chunks, chunk)
+		}
+		if overlap == 0 || len(current) <= overlap {
+			current = nil
+			return
+		}
+		// Carry the tail over, starting at a word boundary
+		tail := current[len(current)-overlap:]
+		for i, r := range tail {
+			if unicode.IsSpace(r) {
+				tail = tail[i+1:]
+				break
+			}
+		}
+		current = append([]rune(nil), tail...)
+	}
+
+	for _, piece := range splitPieces(text, size) {
+		runes := []rune(piece)
+		if len(current)+len(runes) > size && len(strings.TrimSpace(string(current))) > 0 {
+			flush()
+			// The overlap must leave room for the piece
+			if len(current)+len(runes) > size {
+				current = nil
+			}
+		}
+		current = append(current, runes...)
+	}
+	if chunk := strings.TrimSpace(string(current)); chunk != "" {
+		chunks = append(chunks, chunk)
+	}
+	return chunks
+}
+
+// splitPieces breaks text into paragraphs, and paragraphs longer than size
+// into sentences and then words, keeping the separators so pieces can be
+// joined back
+func splitPieces(text string, size int) []string {
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	var pieces []string
+	for _, paragraph := range strings.SplitAfter(text, "\n\n") {
+		if len([]rune(paragraph)) <= size {
+			pieces = append(pieces, paragraph)
+			continue
+		}
+		for _, sentence := range splitSentences(paragraph) {
+			if len([]rune(sentence)) <= size {
+				pieces = append(pieces, sentence)
+				continue
+			}
+			for _, word := range strings.SplitAfter(sentence, " ") {
+				runes := []rune(word)
+				for len(runes) > size {
+					pieces = append(pieces, string(runes[:size]))
+					runes = runes[size:]
+				}
+				pieces = append(pieces, string(runes))
+			}
+		}
+	}
+	return pieces
+}
+
+// splitSentences splits after sentence-ending punctuation followed by a space
+func splitSentences(text string) []string {
+	var sentences []string
+	runes := []rune(text)
+	start := 0
+	for i := 0; i < len(runes)-1; i++ {
+		if strings.ContainsRune(".!?…", runes[i]) && unicode.IsSpace(runes[i+1]) {
+			sentences = append(sentences, string(runes[start:i+2]))
+			start = i + 2
+		}
+	}
+	if start < len(runes) {
+		sentences = append(sentences, string(runes[start:]))
+	}
+	return sentences
+}
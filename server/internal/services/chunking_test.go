@@ -0,0 +1,62 @@
+package services
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestChunkText(t *testing.T) {
+	tests := []struct {
+		name          string
+		text          string
+		size, overlap int
+		want          []string
+	}{
+		{name: "empty", text: "  \n\n ", size: 100, want: nil},
+		{name: "invalid size", text: "text", size: 0, want: nil},
+		{name: "fits in one chunk", text: "Short text.", size: 100, want: []string{"Short text."}},
+		{
+			name: "paragraphs are kept together",
+			text: "First paragraph here.\n\nSecond paragraph here.",
+			size: 30,
+			want: []string{"First paragraph here.", "Second paragraph here."},
+		},
+		{
+			name: "long paragraphs split at sentences",
+			text: "One two three. Four five six. Seven eight nine.",
+			size: 20,
+			want: []string{"One two three.", "Four five six.", "Seven eight nine."},
+		},
+		{
+			name: "long words are cut",
+			text: strings.Repeat("a", 25),
+			size: 10,
+			want: []string{strings.Repeat("a", 10), strings.Repeat("a", 10), strings.Repeat("a", 5)},
+		},
+		{
+			name:    "overlap carries whole words",
+			text:    "alpha beta gamma delta epsilon zeta",
+			size:    18,
+			overlap: 8,
+			want:    []string{"alpha beta gamma", "gamma delta", "delta epsilon zeta"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ChunkText(tt.text, tt.size, tt.overlap)
+			if strings.Join(got, "|") != strings.Join(tt.want, "|") || len(got) != len(tt.want) {
+				t.Errorf("ChunkText = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestChunkTextRespectsSize(t *testing.T) {
+	text := strings.Repeat("Кришна говорит Арджуне о долге. ", 40) + "\n\n" + strings.Repeat("word ", 300)
+	for _, chunk := range ChunkText(text, 120, 30) {
+		if n := utf8.RuneCountInString(chunk); n > 120 {
+			t.Errorf("chunk of %d characters exceeds the size: %q", n, chunk)
+		}
+	}
+}
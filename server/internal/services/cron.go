@@ -0,0 +1,148 @@
+package services
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CronSchedule is a parsed standard 5-field cron expression
+// (minute hour day-of-month month day-of-week).
+type CronSchedule struct {
+	minute, hour, dom, month, dow uint64
+	domAny, dowAny                bool
+}
+
+type cronField struct {
+	min, max int
+}
+
+var cronFields = []cronField{
+	{0, 59}, // minute
+	{0, 23}, // hour
+	{1, 31}, // day of month
+	{1, 12}, // month
+	{0, 6},  // day of week (0 = Sunday, 7 is accepted as Sunday too)
+}
+
+// ParseCron parses expressions like "0 7 * * 0" or "*/15 9-18 * * 1-5".
+func ParseCron(expr string) (*CronSchedule, error) {
+	parts := strings.Fields(expr)
+	if len(parts) != 5 {
+		return nil, fmt.Errorf("cron expression must have 5 fields, got %d", len(parts))
+	}
+
+	var bits [5]uint64
+	for i, part := range parts {
+		b, err := parseCronField(part, cronFields[i], i == 4)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cron field %q: %v", part, err)
+		}
+		bits[i] = b
+	}
+
+	return &CronSchedule{
+		minute: bits[0],
+		hour:   bits[1],
+		dom:    bits[2],
+		month:  bits[3],
+		dow:    bits[4],
+		domAny: parts[2] == "*",
+		dowAny: parts[4] == "*",
+	}, nil
+}
+
+func parseCronField(s string, f cronField, isDow bool) (uint64, error) {
+	var bits uint64
+	for _, item := range strings.Split(s, ",") {
+		step := 1
+		if idx := strings.Index(item, "/"); idx >= 0 {
+			n, err := strconv.Atoi(item[idx+1:])
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("bad step")
+			}
+			step = n
+			item = item[:idx]
+		}
+
+		lo, hi := f.min, f.max
+		if item != "*" {
+			if idx := strings.Index(item, "-"); idx >= 0 {
+				a, err1 := strconv.Atoi(item[:idx])
+				b, err2 := strconv.Atoi(item[idx+1:])
+				if err1 != nil || err2 != nil {
+					return 0, fmt.Errorf("bad range")
+				}
+				lo, hi = a, b
+			} else {
+				n, err := strconv.Atoi(item)
+				if err != nil {
+					return 0, fmt.Errorf("bad value")
+				}
+				lo = n
+				if step > 1 {
+					hi = f.max
+				} else {
+					hi = n
+				}
+			}
+		}
+
+		max := f.max
+		if isDow {
+			max = 7
+		}
+		if lo < f.min || hi > max || lo > hi {
+			return 0, fmt.Errorf("value out of range %d-%d", f.min, max)
+		}
+
+		for v := lo; v <= hi; v += step {
+			if isDow && v == 7 {
+				v = 0
+				bits |= 1 << uint(v)
+				break
+			}
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+func (s *CronSchedule) dayMatches(t time.Time) bool {
+	domOK := s.dom&(1<<uint(t.Day())) != 0
+	dowOK := s.dow&(1<<uint(t.Weekday())) != 0
+	// Classic cron semantics: if both fields are restricted, either may match
+	if !s.domAny && !s.dowAny {
+		return domOK || dowOK
+	}
+	return domOK && dowOK
+}
+
+// Next returns the first activation time strictly after t, in t's location.
+// It returns the zero time if nothing matches within the next five years.
+func (s *CronSchedule) Next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+
+	for t.Before(limit) {
+		if s.month&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if !s.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if s.hour&(1<<uint(t.Hour())) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+			continue
+		}
+		if s.minute&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
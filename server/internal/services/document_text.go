@@ -0,0 +1,173 @@
+package services
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Knowledge document content types
+const (
+	ContentPDF      = "pdf"
+	ContentMarkdown = "markdown"
+	ContentText     = "text"
+)
+
+// DocumentContentType derives the content type from a file name, or ""
+// when the format is not supported
+func DocumentContentType(fileName string) string {
+	switch strings.ToLower(filepath.Ext(fileName)) {
+	case ".pdf":
+		return ContentPDF
+	case ".md", ".markdown":
+		return ContentMarkdown
+	case ".txt", ".text":
+		return ContentText
+	}
+	return ""
+}
+
+// ExtractDocumentText returns the plain text of an uploaded document
+func ExtractDocumentText(contentType string, data []byte) (string, error) {
+	var text string
+	switch contentType {
+	case ContentPDF:
+		text = extractPDFText(data)
+	case ContentMarkdown, ContentText:
+		if !utf8.Valid(data) {
+			return "", fmt.Errorf("file is not UTF-8 text")
+		}
+		text = string(data)
+	default:
+		return "", fmt.Errorf("unsupported content type %q", contentType)
+	}
+
+	text = strings.TrimSpace(text)
+	if text == "" {
+		if contentType == ContentPDF {
+			return "", fmt.Errorf("no text could be extracted; scanned PDFs and PDFs with embedded font encodings are not supported")
+		}
+		return "", fmt.Errorf("file is empty")
+	}
+	return text, nil
+}
+
+var (
+	// pdfStream matches a stream and its dictionary, allowing one level of
+	// nested dictionaries so a match can't span several objects
+	pdfStream = regexp.MustCompile(`<<((?:[^<>]|<<[^<>]*>>|<[^<>]*>)*)>>\s*stream\r?\n`)
+	// pdfTextOp matches the string operands of the Tj, ', " and TJ operators
+	// and the operators that move to a new line
+	pdfTextOp = regexp.MustCompile(`(?s)(\((?:\\.|[^\\)])*\)|\[(?:\\.|[^\]])*\])\s*(Tj|TJ|'|")|(T\*|\bTd\b|\bTD\b|\bET\b)`)
+	// pdfArrayItem is a string or a kerning adjustment inside a TJ array
+	pdfArrayItem = regexp.MustCompile(`(?s)\((?:\\.|[^\\)])*\)|-?\d+(?:\.\d+)?`)
+)
+
+// extractPDFText pulls the text shown by the content streams of a PDF. It
+// handles uncompressed and Flate-compressed streams with standard single-byte
+// fonts, which covers PDFs exported from word processors; anything else
+// yields no text rather than garbage.
+func extractPDFText(data []byte) string {
+	var text strings.Builder
+	for _, loc := range pdfStream.FindAllSubmatchIndex(data, -1) {
+		dict := data[loc[2]:loc[3]]
+		start := loc[1]
+		end := bytes.Index(data[start:], []byte("endstream"))
+		if end < 0 {
+			break
+		}
+		content := data[start : start+end]
+
+		// Images, fonts, object and xref streams carry no page text
+		if bytes.Contains(dict, []byte("/Subtype")) || bytes.Contains(dict, []byte("/Type")) || bytes.Contains(dict, []byte("/Length1")) {
+			continue
+		}
+		if bytes.Contains(dict, []byte("/FlateDecode")) {
+			reader, err := zlib.NewReader(bytes.NewReader(content))
+			if err != nil {
+				continue
+			}
+			// Truncated streams still give what was inflated before the error
+			content, _ = io.ReadAll(reader)
+			reader.Close()
+		} else if bytes.Contains(dict, []byte("/Filter")) {
+			continue
+		}
+		appendPDFText(&text, content)
+	}
+	return text.String()
+}
+
+func appendPDFText(text *strings.Builder, content []byte) {
+	for _, match := range pdfTextOp.FindAllSubmatch(content, -1) {
+		if len(match[3]) > 0 {
+			// Line moves and the end of a text object
+			if text.Len() > 0 && !strings.HasSuffix(text.String(), "\n") {
+				text.WriteByte('\n')
+			}
+			continue
+		}
+
+		operand := match[1]
+		if operand[0] == '[' {
+			for _, item := range pdfArrayItem.FindAll(operand, -1) {
+				if item[0] == '(' {
+					text.WriteString(decodePDFString(item))
+				} else if adjustment, err := strconv.ParseFloat(string(item), 64); err == nil && adjustment < -200 {
+					// A wide gap between glyphs stands for a space
+					text.WriteByte(' ')
+				}
+			}
+		} else {
+			text.WriteString(decodePDFString(operand))
+		}
+		if op := string(match[2]); op == "'" || op == `"` {
+			text.WriteByte('\n')
+		}
+	}
+}
+
+// decodePDFString decodes a literal (...) string with its escapes, reading
+// bytes as Latin-1
+func decodePDFString(s []byte) string {
+	s = s[1 : len(s)-1]
+	var out []rune
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c != '\\' || i+1 == len(s) {
+			out = append(out, rune(c))
+			continue
+		}
+		i++
+		switch c = s[i]; c {
+		case 'n':
+			out = append(out, '\n')
+		case 'r':
+			out = append(out, '\r')
+		case 't':
+			out = append(out, '\t')
+		case 'b', 'f':
+		case '\r', '\n':
+			// Line continuation
+		default:
+			if c >= '0' && c <= '7' {
+				value := 0
+				for j := 0; j < 3 && i < len(s) && s[i] >= '0' && s[i] <= '7'; j++ {
+					value = value*8 + int(s[i]-'0')
+					i++
+				}
+				i--
+				out = append(out, rune(value))
+			} else {
+				out = append(out, rune(c))
+			}
+		}
+	}
+	return string(out)
+}
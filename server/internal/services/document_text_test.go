@@ -0,0 +1,123 @@
+package services
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// testPDF wraps stream objects in a minimal PDF
+func testPDF(streams ...string) []byte {
+	var b bytes.Buffer
+	b.WriteString("%PDF-1.4\n1 0 obj\n<< /Type /Catalog /Pages 2 0 R >>\nendobj\n")
+	for i, stream := range streams {
+		fmt.Fprintf(&b, "%d 0 obj\n%s\nendobj\n", i+3, stream)
+	}
+	b.WriteString("trailer\n<< /Root 1 0 R >>\n%%EOF\n")
+	return b.Bytes()
+}
+
+func plainStream(content string) string {
+	return fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", len(content), content)
+}
+
+func flateStream(content string) string {
+	var compressed bytes.Buffer
+	w := zlib.NewWriter(&compressed)
+	w.Write([]byte(content))
+	w.Close()
+	return fmt.Sprintf("<< /Length %d /Filter /FlateDecode >>\nstream\n%s\nendstream", compressed.Len(), compressed.String())
+}
+
+func TestExtractPDFText(t *testing.T) {
+	tests := []struct {
+		name string
+		pdf  []byte
+		want string
+	}{
+		{
+			name: "uncompressed",
+			pdf:  testPDF(plainStream("BT /F1 12 Tf 72 712 Td (Hello world) Tj ET")),
+			want: "Hello world",
+		},
+		{
+			name: "flate compressed",
+			pdf:  testPDF(flateStream("BT /F1 12 Tf (Compressed text) Tj ET")),
+			want: "Compressed text",
+		},
+		{
+			name: "new lines from operators",
+			pdf:  testPDF(plainStream("BT (First line) Tj 0 -14 Td (Second line) Tj T* (Third) ' ET")),
+			want: "First line\nSecond line\nThird",
+		},
+		{
+			name: "TJ kerning",
+			pdf:  testPDF(plainStream("BT [(Bha) -20 (gavad) -250 (Gita)] TJ ET")),
+			want: "Bhagavad Gita",
+		},
+		{
+			name: "escapes",
+			pdf:  testPDF(plainStream(`BT (Caf\351 \(open\) back\\slash \101) Tj ET`)),
+			want: `Café (open) back\slash A`,
+		},
+		{
+			name: "several streams",
+			pdf:  testPDF(plainStream("BT (Page one) Tj ET"), flateStream("BT (Page two) Tj ET")),
+			want: "Page one\nPage two",
+		},
+		{
+			name: "scanned page is only an image",
+			pdf:  testPDF("<< /Type /XObject /Subtype /Image /Width 1 /Height 1 /Length 3 >>\nstream\n\x00\x01\x02\nendstream"),
+			want: "",
+		},
+		{
+			name: "unsupported filter",
+			pdf:  testPDF("<< /Length 12 /Filter /LZWDecode >>\nstream\nBT (x) Tj ET\nendstream"),
+			want: "",
+		},
+		{
+			name: "not a pdf",
+			pdf:  []byte("just some bytes"),
+			want: "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := strings.TrimSpace(extractPDFText(tt.pdf)); got != tt.want {
+				t.Errorf("extractPDFText = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExtractDocumentText(t *testing.T) {
+	if _, err := ExtractDocumentText(ContentPDF, testPDF(plainStream("q 1 0 0 1 0 0 cm Q"))); err == nil || !strings.Contains(err.Error(), "scanned") {
+		t.Errorf("a PDF without text: err = %v", err)
+	}
+	if _, err := ExtractDocumentText(ContentText, []byte{0xff, 0xfe, 0x00}); err == nil {
+		t.Error("invalid UTF-8 must be rejected")
+	}
+	if _, err := ExtractDocumentText(ContentMarkdown, []byte("  \n")); err == nil {
+		t.Error("an empty file must be rejected")
+	}
+	if text, err := ExtractDocumentText(ContentMarkdown, []byte("# Title\n\nBody\n")); err != nil || text != "# Title\n\nBody" {
+		t.Errorf("markdown = %q, %v", text, err)
+	}
+}
+
+func TestDocumentContentType(t *testing.T) {
+	tests := map[string]string{
+		"gita.PDF":     ContentPDF,
+		"notes.md":     ContentMarkdown,
+		"readme.txt":   ContentText,
+		"image.png":    "",
+		"no-extension": "",
+	}
+	for name, want := range tests {
+		if got := DocumentContentType(name); got != want {
+			t.Errorf("DocumentContentType(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"net/http"
+	"rag-agent-server/internal/config"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Embedder turns texts into vectors whose distance reflects their meaning
+type Embedder interface {
+	Embed(ctx context.Context, texts []string) ([][]float32, error)
+	Dimensions() int
+}
+
+// NewEmbedder returns the embedder selected by RAG_EMBEDDINGS_PROVIDER
+func NewEmbedder(cfg *config.Store) Embedder {
+	rag := cfg.Get().RAG
+	switch rag.EmbeddingsProvider {
+	case "fake":
+		return NewFakeEmbedder(rag.EmbeddingsDimensions)
+	case "local":
+		return &RemoteEmbedder{cfg: cfg, local: true, dimensions: rag.EmbeddingsDimensions}
+	}
+	return &RemoteEmbedder{cfg: cfg, dimensions: rag.EmbeddingsDimensions}
+}
+
+// RemoteEmbedder calls an OpenAI-compatible /embeddings endpoint: OpenAI
+// itself, or a local server such as Ollama when local is set. Keys and URLs
+// are read per call so admin changes apply right away.
+type RemoteEmbedder struct {
+	cfg        *config.Store
+	local      bool
+	dimensions int
+}
+
+func (e *RemoteEmbedder) Dimensions() int {
+	return e.dimensions
+}
+
+func (e *RemoteEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	if len(texts) == 0 {
+		return nil, nil
+	}
+	current := e.cfg.Get()
+	baseURL, apiKey := current.AI.OpenAIBaseURL, current.AI.OpenAIAPIKey
+	if e.local {
+		baseURL, apiKey = current.AI.LocalBaseURL, current.AI.LocalAPIKey
+	} else if apiKey == "" {
+		return nil, fmt.Errorf("OPENAI_API_KEY is not set")
+	}
+
+	body := map[string]interface{}{
+		"model": current.RAG.EmbeddingsModel,
+		"input": texts,
+	}
+	if !e.local {
+		// OpenAI's v3 models can shorten their vectors to the column size
+		body["dimensions"] = e.dimensions
+	}
+	headers := map[string]string{}
+	if apiKey != "" {
+		headers["Authorization"] = "Bearer " + apiKey
+	}
+
+	resp, err := postJSON(ctx, &http.Client{Timeout: 60 * time.Second}, strings.TrimRight(baseURL, "/")+"/embeddings", headers, body)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var response struct {
+		Data []struct {
+			Index     int       `json:"index"`
+			Embedding []float32 `json:"embedding"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return nil, err
+	}
+	if len(response.Data) != len(texts) {
+		return nil, fmt.Errorf("expected %d embeddings, got %d", len(texts), len(response.Data))
+	}
+
+	vectors := make([][]float32, len(texts))
+	for _, item := range response.Data {
+		if item.Index < 0 || item.Index >= len(texts) {
+			return nil, fmt.Errorf("embedding index %d out of range", item.Index)
+		}
+		if len(item.Embedding) != e.dimensions {
+			return nil, fmt.Errorf("embedding has %d dimensions, RAG_EMBEDDINGS_DIMENSIONS is %d", len(item.Embedding), e.dimensions)
+		}
+		vectors[item.Index] = item.Embedding
+	}
+	return vectors, nil
+}
+
+// FakeEmbedder hashes words into a fixed number of buckets. The same text
+// always gets the same vector and texts sharing words are close, which is
+// enough to develop and test retrieval without an embeddings service.
+type FakeEmbedder struct {
+	dimensions int
+}
+
+func NewFakeEmbedder(dimensions int) *FakeEmbedder {
+	return &FakeEmbedder{dimensions: dimensions}
+}
+
+func (e *FakeEmbedder) Dimensions() int {
+	return e.dimensions
+}
+
+func (e *FakeEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	vectors := make([][]float32, len(texts))
+	for i, text := range texts {
+		vector := make([]float32, e.dimensions)
+		words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+		})
+		for _, word := range words {
+			h := fnv.New32a()
+			h.Write([]byte(word))
+			vector[h.Sum32()%uint32(e.dimensions)]++
+		}
+		normalize(vector)
+		vectors[i] = vector
+	}
+	return vectors, nil
+}
+
+// normalize scales a vector to unit length, leaving zero vectors alone
+func normalize(vector []float32) {
+	var sum float64
+	for _, v := range vector {
+		sum += float64(v) * float64(v)
+	}
+	if sum == 0 {
+		return
+	}
+	norm := float32(math.Sqrt(sum))
+	for i := range vector {
+		vector[i] /= norm
+	}
+}
@@ -0,0 +1,44 @@
+package services
+
+import (
+	"context"
+	"math"
+	"testing"
+)
+
+func dot(a, b []float32) float64 {
+	var sum float64
+	for i := range a {
+		sum += float64(a[i]) * float64(b[i])
+	}
+	return sum
+}
+
+func TestFakeEmbedder(t *testing.T) {
+	e := NewFakeEmbedder(64)
+	vectors, err := e.Embed(context.Background(), []string{
+		"Krishna speaks to Arjuna",
+		"krishna, SPEAKS to arjuna!",
+		"recipes for vegetarian cooking",
+		"",
+	})
+	if err != nil {
+		t.Fatalf("Embed: %v", err)
+	}
+	if len(vectors) != 4 || len(vectors[0]) != e.Dimensions() {
+		t.Fatalf("got %d vectors of %d dimensions", len(vectors), len(vectors[0]))
+	}
+
+	if norm := math.Sqrt(dot(vectors[0], vectors[0])); math.Abs(norm-1) > 1e-6 {
+		t.Errorf("vector is not normalized: %v", norm)
+	}
+	if same := dot(vectors[0], vectors[1]); math.Abs(same-1) > 1e-6 {
+		t.Errorf("case and punctuation changed the vector: similarity %v", same)
+	}
+	if unrelated := dot(vectors[0], vectors[2]); unrelated >= 0.5 {
+		t.Errorf("unrelated texts are too close: similarity %v", unrelated)
+	}
+	if empty := dot(vectors[3], vectors[3]); empty != 0 {
+		t.Errorf("empty text should embed to zeros, got norm %v", empty)
+	}
+}
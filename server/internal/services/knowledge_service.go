@@ -0,0 +1,549 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"rag-agent-server/internal/database"
+	"rag-agent-server/internal/models"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	// MaxKnowledgeFileSize bounds an uploaded knowledge document
+	MaxKnowledgeFileSize = 20 << 20
+	// knowledgeIndexTimeout bounds indexing one document
+	knowledgeIndexTimeout = 10 * time.Minute
+	// DefaultKnowledgeCollection holds documents uploaded without one
+	DefaultKnowledgeCollection = "general"
+)
+
+var collectionInvalid = regexp.MustCompile(`[^\p{L}\p{N}_-]+`)
+
+// NormalizeCollection turns a collection name into its stored form:
+// lowercase, with runs of other characters replaced by a dash
+func NormalizeCollection(name string) string {
+	name = collectionInvalid.ReplaceAllString(strings.ToLower(strings.TrimSpace(name)), "-")
+	return strings.Trim(name, "-")
+}
+
+// ParseCollections parses a comma separated list of collections
+func ParseCollections(list string) []string {
+	var collections []string
+	for _, name := range strings.Split(list, ",") {
+		if name = NormalizeCollection(name); name != "" {
+			collections = append(collections, name)
+		}
+	}
+	return collections
+}
+
+// knowledgeKey is the vector store key of a knowledge document
+func knowledgeKey(id uint) string {
+	return fmt.Sprintf("knowledge:%d", id)
+}
+
+// KnowledgeService manages the documents RAG answers from besides profiles.
+// Uploads are stored right away and indexed one at a time in the
+// background, so a large PDF doesn't hold the request or flood the
+// embeddings API.
+type KnowledgeService struct {
+	rag   *RAGService
+	queue chan uint
+}
+
+func NewKnowledgeService(rag *RAGService) *KnowledgeService {
+	s := &KnowledgeService{rag: rag, queue: make(chan uint, 256)}
+	go s.worker()
+	return s
+}
+
+// ResumeIndexing queues the documents a restart interrupted and prunes the
+// chunks of documents deleted while the index was unavailable
+func (s *KnowledgeService) ResumeIndexing() {
+	if pruned, err := s.rag.pruneKnowledge(); err != nil {
+		log.Printf("[Knowledge] Failed to prune deleted documents from the index: %v", err)
+	} else if pruned > 0 {
+		log.Printf("[Knowledge] Pruned %d chunks of deleted documents", pruned)
+	}
+
+	var ids []uint
+	database.DB.Model(&models.KnowledgeDocument{}).
+		Where("status IN ?", []string{models.KnowledgePending, models.KnowledgeIndexing}).
+		Pluck("id", &ids)
+	for _, id := range ids {
+		s.enqueue(id)
+	}
+	if len(ids) > 0 {
+		log.Printf("[Knowledge] Resumed indexing of %d documents", len(ids))
+	}
+}
+
+func (s *KnowledgeService) enqueue(id uint) {
+	database.DB.Model(&models.KnowledgeDocument{}).Where("id = ?", id).
+		Updates(map[string]interface{}{"status": models.KnowledgePending, "error": ""})
+	select {
+	case s.queue <- id:
+	default:
+		// Don't block the request when the queue is full
+		go func() { s.queue <- id }()
+	}
+}
+
+func (s *KnowledgeService) worker() {
+	for id := range s.queue {
+		s.index(id)
+	}
+}
+
+// index embeds or imports one document and records the outcome
+func (s *KnowledgeService) index(id uint) {
+	var doc models.KnowledgeDocument
+	if err := database.DB.First(&doc, id).Error; err != nil {
+		// Deleted while queued
+		return
+	}
+	database.DB.Model(&doc).Update("status", models.KnowledgeIndexing)
+
+	ctx, cancel := context.WithTimeout(context.Background(), knowledgeIndexTimeout)
+	defer cancel()
+	chunks, err := s.rag.IndexKnowledge(ctx, doc)
+	if err != nil {
+		log.Printf("[Knowledge] Failed to index document %d: %v", doc.ID, err)
+		database.DB.Model(&doc).Updates(map[string]interface{}{"status": models.KnowledgeFailed, "error": err.Error()})
+		return
+	}
+
+	now := time.Now()
+	database.DB.Model(&doc).Updates(map[string]interface{}{
+		"status":     models.KnowledgeReady,
+		"error":      "",
+		"chunks":     chunks,
+		"indexed_at": &now,
+	})
+	log.Printf("[Knowledge] Indexed document %d (%s) into %q", doc.ID, doc.Title, doc.Collection)
+}
+
+// Create stores an uploaded file and queues it for indexing
+func (s *KnowledgeService) Create(title, collection, fileName string, data []byte, uploadedBy uint) (models.KnowledgeDocument, error) {
+	contentType := DocumentContentType(fileName)
+	if contentType == "" {
+		return models.KnowledgeDocument{}, fmt.Errorf("only PDF, Markdown and text files are supported")
+	}
+	if len(data) > MaxKnowledgeFileSize {
+		return models.KnowledgeDocument{}, fmt.Errorf("file is larger than %d MB", MaxKnowledgeFileSize>>20)
+	}
+	text, err := ExtractDocumentText(contentType, data)
+	if err != nil {
+		return models.KnowledgeDocument{}, err
+	}
+
+	title = strings.TrimSpace(title)
+	if title == "" {
+		title = strings.TrimSuffix(fileName, filepath.Ext(fileName))
+	}
+	collection = NormalizeCollection(collection)
+	if collection == "" {
+		collection = DefaultKnowledgeCollection
+	}
+
+	doc := models.KnowledgeDocument{
+		Title:       title,
+		Collection:  collection,
+		FileName:    fileName,
+		ContentType: contentType,
+		Size:        int64(len(data)),
+		Text:        text,
+		Status:      models.KnowledgePending,
+		UploadedBy:  uploadedBy,
+	}
+	if err := database.DB.Create(&doc).Error; err != nil {
+		return models.KnowledgeDocument{}, err
+	}
+	s.enqueue(doc.ID)
+	return doc, nil
+}
+
+// Update renames or moves a document; the index holds both, so a change
+// re-indexes it
+func (s *KnowledgeService) Update(id uint, title, collection *string) (models.KnowledgeDocument, error) {
+	var doc models.KnowledgeDocument
+	if err := database.DB.First(&doc, id).Error; err != nil {
+		return doc, fmt.Errorf("document not found")
+	}
+
+	changed := false
+	if title != nil {
+		t := strings.TrimSpace(*title)
+		if t == "" {
+			return doc, fmt.Errorf("title cannot be empty")
+		}
+		changed = changed || t != doc.Title
+		doc.Title = t
+	}
+	if collection != nil {
+		c := NormalizeCollection(*collection)
+		if c == "" {
+			return doc, fmt.Errorf("invalid collection")
+		}
+		changed = changed || c != doc.Collection
+		doc.Collection = c
+	}
+	if !changed {
+		return doc, nil
+	}
+
+	if err := database.DB.Model(&doc).Updates(map[string]interface{}{"title": doc.Title, "collection": doc.Collection}).Error; err != nil {
+		return doc, err
+	}
+	s.enqueue(doc.ID)
+	doc.Status = models.KnowledgePending
+	return doc, nil
+}
+
+// Reindex queues a document for indexing again
+func (s *KnowledgeService) Reindex(id uint) (models.KnowledgeDocument, error) {
+	var doc models.KnowledgeDocument
+	if err := database.DB.First(&doc, id).Error; err != nil {
+		return doc, fmt.Errorf("document not found")
+	}
+	s.enqueue(doc.ID)
+	doc.Status = models.KnowledgePending
+	doc.Error = ""
+	return doc, nil
+}
+
+// ReindexAll queues every document, or those of one collection, and returns
+// how many were queued. Needed after switching RAG_BACKEND or the
+// embeddings model.
+func (s *KnowledgeService) ReindexAll(collection string) (int, error) {
+	query := database.DB.Model(&models.KnowledgeDocument{})
+	if collection != "" {
+		query = query.Where("collection = ?", NormalizeCollection(collection))
+	}
+	var ids []uint
+	if err := query.Pluck("id", &ids).Error; err != nil {
+		return 0, err
+	}
+	for _, id := range ids {
+		s.enqueue(id)
+	}
+	return len(ids), nil
+}
+
+// ErrIndexUnavailable is returned when a document could not be removed from
+// the index
+var ErrIndexUnavailable = errors.New("failed to remove document from the index")
+
+// Delete removes a document from the index and the database. When the index
+// can't be reached, force still deletes the row; pgvector chunks left behind
+// are pruned on the next start, Gemini store documents stay until the store
+// is cleaned up by hand.
+func (s *KnowledgeService) Delete(id uint, force bool) error {
+	var doc models.KnowledgeDocument
+	if err := database.DB.First(&doc, id).Error; err != nil {
+		return fmt.Errorf("document not found")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	if err := s.rag.RemoveKnowledge(ctx, doc); err != nil {
+		if !force {
+			return fmt.Errorf("%w: %v", ErrIndexUnavailable, err)
+		}
+		log.Printf("[Knowledge] Deleting document %d that is still in the index: %v", doc.ID, err)
+	}
+	// The extracted text can be large, so don't keep a soft-deleted copy
+	return database.DB.Unscoped().Delete(&doc).Error
+}
+
+// KnowledgeDocuments lists documents, newest first, optionally filtered by
+// collection and status
+func KnowledgeDocuments(collection, status string) ([]models.KnowledgeDocument, error) {
+	query := database.DB.Order("created_at desc")
+	if collection != "" {
+		query = query.Where("collection = ?", NormalizeCollection(collection))
+	}
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	docs := []models.KnowledgeDocument{}
+	err := query.Find(&docs).Error
+	return docs, err
+}
+
+// KnowledgeCollection summarizes the documents of a collection
+type KnowledgeCollection struct {
+	Name      string `json:"name"`
+	Documents int    `json:"documents"`
+	Ready     int    `json:"ready"`
+	Failed    int    `json:"failed"`
+	Chunks    int    `json:"chunks"`
+}
+
+// KnowledgeCollections lists the collections in use
+func KnowledgeCollections() ([]KnowledgeCollection, error) {
+	collections := []KnowledgeCollection{}
+	err := database.DB.Model(&models.KnowledgeDocument{}).
+		Select(`collection AS name, COUNT(*) AS documents,
+			SUM(CASE WHEN status = ? THEN 1 ELSE 0 END) AS ready,
+			SUM(CASE WHEN status = ? THEN 1 ELSE 0 END) AS failed,
+			COALESCE(SUM(chunks), 0) AS chunks`, models.KnowledgeReady, models.KnowledgeFailed).
+		Group("collection").
+		Order("collection").
+		Scan(&collections).Error
+	return collections, err
+}
+
+// IndexKnowledge makes a knowledge document retrievable with the configured
+// backend and returns the number of chunks stored. The Gemini store chunks
+// documents itself and doesn't report a count, so it returns 0.
+func (s *RAGService) IndexKnowledge(ctx context.Context, doc models.KnowledgeDocument) (int, error) {
+	if s.cfg.Get().RAG.Backend == "pgvector" {
+		if s.vectors == nil {
+			return 0, fmt.Errorf("pgvector backend is not available")
+		}
+		return s.vectors.Index(ctx, VectorDocument{
+			Key:        knowledgeKey(doc.ID),
+			Source:     SourceKnowledge,
+			Title:      doc.Title,
+			Collection: doc.Collection,
+			Text:       doc.Text,
+		})
+	}
+
+	// Drop what an earlier run imported so the store doesn't hold duplicates
+	if err := s.removeGeminiDocuments(ctx, "document_id", doc.ID); err != nil {
+		return 0, err
+	}
+	fileName, err := s.uploadGeminiFile(ctx, doc.Title, doc.Text)
+	if err != nil {
+		return 0, err
+	}
+	return 0, s.importGeminiFile(ctx, fileName, []map[string]interface{}{
+		{"key": "kind", "stringValue": SourceKnowledge},
+		{"key": "collection", "stringValue": doc.Collection},
+		{"key": "document_id", "numericValue": doc.ID},
+	})
+}
+
+// pruneKnowledge drops pgvector chunks whose knowledge document no longer
+// exists and returns how many there were
+func (s *RAGService) pruneKnowledge() (int64, error) {
+	if s.vectors == nil {
+		return 0, nil
+	}
+	result := database.DB.Exec(`DELETE FROM rag_chunks WHERE source = ? AND document_key NOT IN
+		(SELECT 'knowledge:' || id FROM knowledge_documents WHERE deleted_at IS NULL)`, SourceKnowledge)
+	return result.RowsAffected, result.Error
+}
+
+// RemoveKnowledge drops a knowledge document from the configured backend
+func (s *RAGService) RemoveKnowledge(ctx context.Context, doc models.KnowledgeDocument) error {
+	if s.cfg.Get().RAG.Backend == "pgvector" {
+		if s.vectors == nil {
+			return fmt.Errorf("pgvector backend is not available")
+		}
+		return s.vectors.Remove(ctx, knowledgeKey(doc.ID))
+	}
+	return s.removeGeminiDocuments(ctx, "document_id", doc.ID)
+}
+
+// uploadGeminiFile uploads text to the Gemini Files API and returns the file
+// resource name
+func (s *RAGService) uploadGeminiFile(ctx context.Context, displayName, text string) (string, error) {
+	ai := s.cfg.Get().AI
+	if ai.GeminiAPIKey == "" {
+		return "", fmt.Errorf("GEMINI_API_KEY is not set")
+	}
+
+	uploadURL := fmt.Sprintf("%s/upload/v1beta/files", ai.GeminiBaseURL)
+	req, err := http.NewRequestWithContext(ctx, "POST", uploadURL, bytes.NewBufferString(text))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("x-goog-api-key", ai.GeminiAPIKey)
+	req.Header.Set("X-Goog-Upload-Protocol", "raw")
+	req.Header.Set("X-Goog-Upload-Header-Content-Type", "text/plain")
+	req.Header.Set("X-Goog-Upload-Header-Content-DisplayName", displayName)
+	req.Header.Set("Content-Type", "text/plain")
+
+	resp, err := (&http.Client{Timeout: 2 * time.Minute}).Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to upload file: %v", err)
+	}
+	defer resp.Body.Close()
+	bodyBytes, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("upload failed with status %d: %s", resp.StatusCode, string(bodyBytes))
+	}
+
+	var uploadResp UploadResponse
+	if err := json.Unmarshal(bodyBytes, &uploadResp); err != nil {
+		return "", fmt.Errorf("failed to parse upload response: %v", err)
+	}
+	return uploadResp.File.Name, nil
+}
+
+// geminiOperationPollInterval is how often a long-running import is checked
+var geminiOperationPollInterval = 2 * time.Second
+
+// geminiOperation is a long-running operation of the Gemini API
+type geminiOperation struct {
+	Name  string `json:"name"`
+	Done  bool   `json:"done"`
+	Error *struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// importGeminiFile imports an uploaded file into the file search store with
+// the metadata retrieval filters on. The import runs as a long-running
+// operation, which is waited for so the document is only reported ready once
+// it can be retrieved.
+func (s *RAGService) importGeminiFile(ctx context.Context, fileName string, metadata []map[string]interface{}) error {
+	ai := s.cfg.Get().AI
+	if ai.GeminiCorpusID == "" {
+		return fmt.Errorf("GEMINI_CORPUS_ID is not set")
+	}
+
+	client := &http.Client{Timeout: time.Minute}
+	importURL := fmt.Sprintf("%s/v1beta/%s:importFile", ai.GeminiBaseURL, geminiStoreName(ai.GeminiCorpusID))
+	resp, err := postJSON(ctx, client, importURL, geminiAuth(ai.GeminiAPIKey), map[string]interface{}{
+		"fileName":       fileName,
+		"customMetadata": metadata,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to import file: %v", err)
+	}
+	var operation geminiOperation
+	err = json.NewDecoder(resp.Body).Decode(&operation)
+	resp.Body.Close()
+	if err != nil {
+		return fmt.Errorf("failed to parse import operation: %v", err)
+	}
+
+	for !operation.Done {
+		if operation.Name == "" {
+			return fmt.Errorf("import returned no operation to wait for")
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("import of %s did not finish: %v", fileName, ctx.Err())
+		case <-time.After(geminiOperationPollInterval):
+		}
+
+		req, err := http.NewRequestWithContext(ctx, "GET", fmt.Sprintf("%s/v1beta/%s", ai.GeminiBaseURL, operation.Name), nil)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("x-goog-api-key", ai.GeminiAPIKey)
+		resp, err := client.Do(req)
+		if err != nil {
+			return fmt.Errorf("failed to check import: %v", err)
+		}
+		if resp.StatusCode != http.StatusOK {
+			bodyBytes, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			return fmt.Errorf("checking import failed with status %d: %s", resp.StatusCode, string(bodyBytes))
+		}
+		err = json.NewDecoder(resp.Body).Decode(&operation)
+		resp.Body.Close()
+		if err != nil {
+			return fmt.Errorf("failed to parse import operation: %v", err)
+		}
+	}
+	if operation.Error != nil {
+		return fmt.Errorf("import failed: %s", operation.Error.Message)
+	}
+	return nil
+}
+
+// removeGeminiDocuments deletes the store documents whose numeric metadata
+// key equals id, such as the copies imported for a knowledge document or a
+// profile. The store can only be listed, not queried by metadata, so it pages
+// through all of it.
+func (s *RAGService) removeGeminiDocuments(ctx context.Context, key string, id uint) error {
+	ai := s.cfg.Get().AI
+	if ai.GeminiAPIKey == "" || ai.GeminiCorpusID == "" {
+		return fmt.Errorf("GEMINI_API_KEY and GEMINI_CORPUS_ID are required")
+	}
+	client := &http.Client{Timeout: 30 * time.Second}
+
+	var names []string
+	pageToken := ""
+	for {
+		listURL := fmt.Sprintf("%s/v1beta/%s/documents?pageSize=20&pageToken=%s",
+			ai.GeminiBaseURL, geminiStoreName(ai.GeminiCorpusID), url.QueryEscape(pageToken))
+		req, err := http.NewRequestWithContext(ctx, "GET", listURL, nil)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("x-goog-api-key", ai.GeminiAPIKey)
+		resp, err := client.Do(req)
+		if err != nil {
+			return fmt.Errorf("failed to list store documents: %v", err)
+		}
+		var page struct {
+			Documents []struct {
+				Name           string `json:"name"`
+				CustomMetadata []struct {
+					Key          string  `json:"key"`
+					NumericValue float64 `json:"numericValue"`
+				} `json:"customMetadata"`
+			} `json:"documents"`
+			NextPageToken string `json:"nextPageToken"`
+		}
+		if resp.StatusCode != http.StatusOK {
+			bodyBytes, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			return fmt.Errorf("listing store documents failed with status %d: %s", resp.StatusCode, string(bodyBytes))
+		}
+		err = json.NewDecoder(resp.Body).Decode(&page)
+		resp.Body.Close()
+		if err != nil {
+			return err
+		}
+
+		for _, document := range page.Documents {
+			for _, m := range document.CustomMetadata {
+				if m.Key == key && uint(m.NumericValue) == id {
+					names = append(names, document.Name)
+				}
+			}
+		}
+		if page.NextPageToken == "" {
+			break
+		}
+		pageToken = page.NextPageToken
+	}
+
+	for _, name := range names {
+		// force also deletes the document's chunks
+		deleteURL := fmt.Sprintf("%s/v1beta/%s?force=true", ai.GeminiBaseURL, name)
+		req, err := http.NewRequestWithContext(ctx, "DELETE", deleteURL, nil)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("x-goog-api-key", ai.GeminiAPIKey)
+		resp, err := client.Do(req)
+		if err != nil {
+			return fmt.Errorf("failed to delete %s: %v", name, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNotFound {
+			return fmt.Errorf("deleting %s failed with status %d", name, resp.StatusCode)
+		}
+	}
+	return nil
+}
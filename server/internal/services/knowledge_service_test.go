@@ -0,0 +1,155 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"rag-agent-server/internal/config"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestNormalizeCollection(t *testing.T) {
+	tests := map[string]string{
+		"Gita":              "gita",
+		"  Bhagavad Gita  ": "bhagavad-gita",
+		"Śrīmad/Bhāgavatam": "śrīmad-bhāgavatam",
+		"Веды":              "веды",
+		"under_score-dash":  "under_score-dash",
+		"--a!!b--":          "a-b",
+		" !? ":              "",
+	}
+	for name, want := range tests {
+		if got := NormalizeCollection(name); got != want {
+			t.Errorf("NormalizeCollection(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestParseCollections(t *testing.T) {
+	tests := []struct {
+		list string
+		want []string
+	}{
+		{list: "", want: nil},
+		{list: "Gita", want: []string{"gita"}},
+		{list: "Gita, Vedas ,,  Bhagavad Gita", want: []string{"gita", "vedas", "bhagavad-gita"}},
+		{list: " , !", want: nil},
+	}
+	for _, tt := range tests {
+		if got := ParseCollections(tt.list); !slices.Equal(got, tt.want) {
+			t.Errorf("ParseCollections(%q) = %q, want %q", tt.list, got, tt.want)
+		}
+	}
+}
+
+func newTestGeminiRAG(t *testing.T, baseURL string) *RAGService {
+	t.Helper()
+	t.Setenv("CONFIG_FILE", "")
+	t.Setenv("RAG_BACKEND", "gemini")
+	t.Setenv("GEMINI_API_KEY", "secret-key")
+	t.Setenv("GEMINI_BASE_URL", baseURL)
+	t.Setenv("GEMINI_CORPUS_ID", "store-1")
+	cfg, err := config.Load()
+	if err != nil {
+		t.Fatalf("config.Load: %v", err)
+	}
+	rag, err := NewRAGService(config.NewStore(cfg))
+	if err != nil {
+		t.Fatalf("NewRAGService: %v", err)
+	}
+	return rag
+}
+
+func TestImportGeminiFileWaitsForOperation(t *testing.T) {
+	previous := geminiOperationPollInterval
+	geminiOperationPollInterval = time.Millisecond
+	t.Cleanup(func() { geminiOperationPollInterval = previous })
+
+	tests := []struct {
+		name    string
+		polls   []string
+		wantErr string
+	}{
+		{name: "done right away", polls: nil},
+		{name: "done after polling", polls: []string{`{"name":"op","done":false}`, `{"name":"op","done":true}`}},
+		{name: "failed operation", polls: []string{`{"name":"op","done":true,"error":{"code":3,"message":"bad file"}}`}, wantErr: "bad file"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var mu sync.Mutex
+			var paths []string
+			polls := tt.polls
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				mu.Lock()
+				defer mu.Unlock()
+				paths = append(paths, r.Method+" "+r.URL.Path)
+				if r.URL.Query().Get("key") != "" {
+					t.Errorf("API key sent in the URL: %s", r.URL)
+				}
+				if r.Header.Get("x-goog-api-key") != "secret-key" {
+					t.Errorf("missing API key header on %s", r.URL.Path)
+				}
+
+				if r.Method == http.MethodPost {
+					var body map[string]interface{}
+					json.NewDecoder(r.Body).Decode(&body)
+					if body["fileName"] != "files/abc" {
+						t.Errorf("import body = %v", body)
+					}
+					if len(polls) == 0 {
+						w.Write([]byte(`{"name":"fileSearchStores/store-1/operations/op","done":true}`))
+						return
+					}
+					w.Write([]byte(`{"name":"fileSearchStores/store-1/operations/op","done":false}`))
+					return
+				}
+				next := polls[0]
+				polls = polls[1:]
+				w.Write([]byte(strings.Replace(next, `"name":"op"`, `"name":"fileSearchStores/store-1/operations/op"`, 1)))
+			}))
+			defer server.Close()
+
+			rag := newTestGeminiRAG(t, server.URL)
+			err := rag.importGeminiFile(context.Background(), "files/abc", nil)
+			if tt.wantErr == "" && err != nil {
+				t.Fatalf("importGeminiFile: %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Fatalf("err = %v, want %q", err, tt.wantErr)
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			if paths[0] != "POST /v1beta/fileSearchStores/store-1:importFile" {
+				t.Errorf("import path = %s", paths[0])
+			}
+			if len(paths) != 1+len(tt.polls) {
+				t.Errorf("made %d requests, want %d: %v", len(paths), 1+len(tt.polls), paths)
+			}
+			for _, path := range paths[1:] {
+				if path != "GET /v1beta/fileSearchStores/store-1/operations/op" {
+					t.Errorf("poll path = %s", path)
+				}
+			}
+		})
+	}
+}
+
+func TestImportGeminiFileStopsWithContext(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"name":"fileSearchStores/store-1/operations/op","done":false}`))
+	}))
+	defer server.Close()
+
+	rag := newTestGeminiRAG(t, server.URL)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := rag.importGeminiFile(ctx, "files/abc", nil); err == nil {
+		t.Fatal("an import that never finishes must fail once the context is done")
+	}
+}
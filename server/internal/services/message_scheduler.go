@@ -0,0 +1,164 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"rag-agent-server/internal/database"
+	"rag-agent-server/internal/models"
+	"rag-agent-server/internal/websocket"
+	"time"
+)
+
+// MessageScheduler periodically posts due ScheduledMessage jobs to their rooms.
+// Jobs are persisted in the DB, so the schedule survives restarts. Every run is
+// claimed with a conditional update on next_run_at before the message is sent,
+// which guarantees a job fires at most once per slot even if several API
+// processes are running.
+type MessageScheduler struct {
+	hub      *websocket.Hub
+	interval time.Duration
+	stop     chan struct{}
+}
+
+func NewMessageScheduler(hub *websocket.Hub) *MessageScheduler {
+	return &MessageScheduler{
+		hub:      hub,
+		interval: 30 * time.Second,
+		stop:     make(chan struct{}),
+	}
+}
+
+func (s *MessageScheduler) Start() {
+	log.Printf("[Scheduler] Started (interval %s)", s.interval)
+	go func() {
+		ticker := time.NewTicker(s.interval)
+		defer ticker.Stop()
+
+		s.runDue(time.Now())
+		for {
+			select {
+			case now := <-ticker.C:
+				s.runDue(now)
+			case <-s.stop:
+				return
+			}
+		}
+	}()
+}
+
+func (s *MessageScheduler) Stop() {
+	close(s.stop)
+}
+
+func (s *MessageScheduler) runDue(now time.Time) {
+	var jobs []models.ScheduledMessage
+	if err := database.DB.Where("is_active = ? AND next_run_at <= ?", true, now).Find(&jobs).Error; err != nil {
+		log.Printf("[Scheduler] Failed to fetch due jobs: %v", err)
+		return
+	}
+
+	for _, job := range jobs {
+		if !s.claim(job, now) {
+			continue
+		}
+		s.deliver(job)
+	}
+}
+
+// claim advances the job to its next slot. Only the caller whose update
+// affected the row may send the message.
+func (s *MessageScheduler) claim(job models.ScheduledMessage, now time.Time) bool {
+	updates := map[string]interface{}{
+		"last_run_at": now,
+		"run_count":   job.RunCount + 1,
+	}
+
+	next, err := NextScheduledRun(job, now)
+	if err != nil || next == nil {
+		if err != nil {
+			log.Printf("[Scheduler] Job %d has invalid schedule, deactivating: %v", job.ID, err)
+		}
+		updates["next_run_at"] = nil
+		updates["is_active"] = false
+	} else {
+		updates["next_run_at"] = *next
+	}
+
+	result := database.DB.Model(&models.ScheduledMessage{}).
+		Where("id = ? AND is_active = ? AND next_run_at = ?", job.ID, true, job.NextRunAt).
+		Updates(updates)
+	if result.Error != nil {
+		log.Printf("[Scheduler] Failed to claim job %d: %v", job.ID, result.Error)
+		return false
+	}
+	return result.RowsAffected == 1 && err == nil
+}
+
+func (s *MessageScheduler) deliver(job models.ScheduledMessage) {
+	var room models.Room
+	if err := database.DB.First(&room, job.RoomID).Error; err != nil {
+		log.Printf("[Scheduler] Room %d for job %d not found, skipping", job.RoomID, job.ID)
+		return
+	}
+	if room.IsArchived {
+		log.Printf("[Scheduler] Room %d is archived, skipping job %d", job.RoomID, job.ID)
+		return
+	}
+
+	msg := models.Message{
+		SenderID: job.SenderID,
+		RoomID:   job.RoomID,
+		Content:  job.Content,
+		Type:     job.Type,
+		System:   job.SenderID == 0,
+	}
+	if msg.Type == "" {
+		msg.Type = "text"
+	}
+
+	if err := database.DB.Create(&msg).Error; err != nil {
+		log.Printf("[Scheduler] Failed to save message for job %d: %v", job.ID, err)
+		return
+	}
+	database.DB.Model(&room).Update("last_activity_at", msg.CreatedAt)
+
+	if s.hub != nil {
+		s.hub.Broadcast(msg)
+	}
+	log.Printf("[Scheduler] Job %d posted to room %d", job.ID, job.RoomID)
+}
+
+// NextScheduledRun computes when a job should fire next, strictly after
+// `after`. Missed slots (e.g. while the server was down) are collapsed into a
+// single run. It returns nil when a one-off job has already fired.
+func NextScheduledRun(job models.ScheduledMessage, after time.Time) (*time.Time, error) {
+	if job.CronExpr == "" {
+		if job.RunAt == nil {
+			return nil, fmt.Errorf("either runAt or cronExpr is required")
+		}
+		if job.RunAt.After(after) {
+			runAt := *job.RunAt
+			return &runAt, nil
+		}
+		return nil, nil
+	}
+
+	schedule, err := ParseCron(job.CronExpr)
+	if err != nil {
+		return nil, err
+	}
+
+	loc := time.UTC
+	if job.Timezone != "" {
+		if loc, err = time.LoadLocation(job.Timezone); err != nil {
+			return nil, fmt.Errorf("unknown timezone %q", job.Timezone)
+		}
+	}
+
+	next := schedule.Next(after.In(loc))
+	if next.IsZero() {
+		return nil, fmt.Errorf("cron expression %q never fires", job.CronExpr)
+	}
+	next = next.UTC()
+	return &next, nil
+}
@@ -0,0 +1,267 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log"
+	"math"
+	"rag-agent-server/internal/config"
+	"rag-agent-server/internal/database"
+	"rag-agent-server/internal/models"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Health check sources
+const (
+	HealthCheckScheduled = "scheduled"
+	HealthCheckManual    = "manual"
+)
+
+const (
+	healthProbeTimeout = 30 * time.Second
+	// healthHistoryRetention is how long probe results are kept
+	healthHistoryRetention = 30 * 24 * time.Hour
+)
+
+// HealthResult is the outcome of probing one model
+type HealthResult struct {
+	ModelID      string `json:"modelId"`
+	Status       string `json:"status"`
+	ResponseTime int64  `json:"responseTime"`
+	Error        string `json:"error,omitempty"`
+}
+
+// LatencyStats summarizes the probes of a model over a period. Percentiles
+// only include successful probes.
+type LatencyStats struct {
+	ModelID     string  `json:"modelId"`
+	Checks      int     `json:"checks"`
+	Failures    int     `json:"failures"`
+	SuccessRate float64 `json:"successRate"`
+	P50         int64   `json:"p50"`
+	P90         int64   `json:"p90"`
+	P99         int64   `json:"p99"`
+}
+
+// ModelHealthChecker probes AI models in the background, keeps a history of
+// the results, disables models that keep failing and re-enables the ones it
+// disabled once they recover.
+type ModelHealthChecker struct {
+	cfg       *config.Store
+	aiService *AiChatService
+	stop      chan struct{}
+
+	mu      sync.Mutex
+	lastRun time.Time
+}
+
+func NewModelHealthChecker(cfg *config.Store, aiService *AiChatService) *ModelHealthChecker {
+	return &ModelHealthChecker{
+		cfg:       cfg,
+		aiService: aiService,
+		stop:      make(chan struct{}),
+	}
+}
+
+// Start runs the checks every AI_HEALTH_CHECK_INTERVAL_MINUTES. The interval
+// is re-read every minute so changes in the admin panel apply without a restart.
+func (h *ModelHealthChecker) Start() {
+	go func() {
+		ticker := time.NewTicker(time.Minute)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case now := <-ticker.C:
+				interval := time.Duration(h.cfg.Get().AI.HealthCheckIntervalMinutes) * time.Minute
+				h.mu.Lock()
+				due := interval > 0 && now.Sub(h.lastRun) >= interval
+				h.mu.Unlock()
+				if due {
+					h.RunOnce(context.Background(), HealthCheckScheduled)
+				}
+			case <-h.stop:
+				return
+			}
+		}
+	}()
+}
+
+func (h *ModelHealthChecker) Stop() {
+	close(h.stop)
+}
+
+// isChatModel reports whether a model answers the chat request used as a
+// probe. Image, audio and other models can't be checked this way.
+func isChatModel(model models.AiModel) bool {
+	return model.Category == "" || model.Category == "text"
+}
+
+// RunOnce probes every enabled chat model and every one the checker
+// disabled, except deprecated ones, with at most AI_HEALTH_CHECK_CONCURRENCY
+// probes in flight
+func (h *ModelHealthChecker) RunOnce(ctx context.Context, source string) []HealthResult {
+	h.mu.Lock()
+	h.lastRun = time.Now()
+	h.mu.Unlock()
+
+	var aiModels []models.AiModel
+	if err := database.DB.Where("(is_enabled = ? OR auto_disabled = ?) AND is_deprecated = ? AND (category IN ? OR category IS NULL)", true, true, false, []string{"", "text"}).Find(&aiModels).Error; err != nil {
+		log.Printf("[ModelHealth] Failed to fetch models: %v", err)
+		return nil
+	}
+
+	concurrency := h.cfg.Get().AI.HealthCheckConcurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	slots := make(chan struct{}, concurrency)
+	results := make([]HealthResult, len(aiModels))
+
+	var wg sync.WaitGroup
+	for i, model := range aiModels {
+		wg.Add(1)
+		go func(i int, model models.AiModel) {
+			defer wg.Done()
+			select {
+			case slots <- struct{}{}:
+				defer func() { <-slots }()
+			case <-ctx.Done():
+				results[i] = HealthResult{ModelID: model.ModelID, Status: models.ModelStatusOffline, Error: ctx.Err().Error()}
+				return
+			}
+			results[i] = h.Check(ctx, model, source)
+		}(i, model)
+	}
+	wg.Wait()
+
+	database.DB.Where("created_at < ?", time.Now().Add(-healthHistoryRetention)).Delete(&models.AiModelHealthCheck{})
+
+	online := 0
+	for _, result := range results {
+		if result.Status == models.ModelStatusOnline {
+			online++
+		}
+	}
+	log.Printf("[ModelHealth] Checked %d models (%s), %d online", len(results), source, online)
+	return results
+}
+
+// Check probes one model, stores the result in its history and applies the
+// automatic disable/enable rules. Models other than chat models are never
+// disabled automatically, since a chat probe says nothing about them.
+func (h *ModelHealthChecker) Check(ctx context.Context, model models.AiModel, source string) HealthResult {
+	ctx, cancel := context.WithTimeout(ctx, healthProbeTimeout)
+	defer cancel()
+
+	start := time.Now()
+	err := h.aiService.Probe(ctx, model.ModelID)
+	result := HealthResult{
+		ModelID:      model.ModelID,
+		Status:       models.ModelStatusOnline,
+		ResponseTime: time.Since(start).Milliseconds(),
+	}
+	if err != nil {
+		result.Error = err.Error()
+		result.Status = models.ModelStatusOffline
+		var providerErr *ProviderError
+		if errors.As(err, &providerErr) {
+			result.Status = models.ModelStatusError
+		}
+		log.Printf("[ModelHealth] %s is %s: %v", model.ModelID, result.Status, err)
+	}
+
+	database.DB.Create(&models.AiModelHealthCheck{
+		ModelID:      model.ModelID,
+		Status:       result.Status,
+		ResponseTime: result.ResponseTime,
+		Error:        result.Error,
+		Source:       source,
+	})
+
+	updates := map[string]interface{}{
+		"last_test_status":   result.Status,
+		"last_response_time": result.ResponseTime,
+	}
+	if result.Status == models.ModelStatusOnline {
+		updates["consecutive_failures"] = 0
+		if model.AutoDisabled {
+			log.Printf("[ModelHealth] %s recovered, re-enabling it", model.ModelID)
+			updates["is_enabled"] = true
+			updates["auto_disabled"] = false
+		}
+	} else {
+		failures := model.ConsecutiveFailures + 1
+		updates["consecutive_failures"] = failures
+		if model.IsEnabled && isChatModel(model) && failures >= h.cfg.Get().AI.HealthCheckFailureThreshold {
+			log.Printf("[ModelHealth] %s failed %d checks in a row, disabling it", model.ModelID, failures)
+			updates["is_enabled"] = false
+			updates["auto_disabled"] = true
+		}
+	}
+	database.DB.Model(&models.AiModel{}).Where("id = ?", model.ID).Updates(updates)
+
+	return result
+}
+
+// ModelHealthHistory returns the most recent probes of a model
+func ModelHealthHistory(modelID string, limit int) ([]models.AiModelHealthCheck, error) {
+	history := []models.AiModelHealthCheck{}
+	err := database.DB.Where("model_id = ?", modelID).Order("created_at desc").Limit(limit).Find(&history).Error
+	return history, err
+}
+
+// ModelLatencyStats summarizes the probes since the given time, per model
+func ModelLatencyStats(since time.Time, modelID string) ([]LatencyStats, error) {
+	var checks []models.AiModelHealthCheck
+	query := database.DB.Select("model_id, status, response_time").Where("created_at >= ?", since)
+	if modelID != "" {
+		query = query.Where("model_id = ?", modelID)
+	}
+	if err := query.Find(&checks).Error; err != nil {
+		return nil, err
+	}
+
+	stats := make(map[string]*LatencyStats)
+	latencies := make(map[string][]int64)
+	for _, check := range checks {
+		s, ok := stats[check.ModelID]
+		if !ok {
+			s = &LatencyStats{ModelID: check.ModelID}
+			stats[check.ModelID] = s
+		}
+		s.Checks++
+		if check.Status == models.ModelStatusOnline {
+			latencies[check.ModelID] = append(latencies[check.ModelID], check.ResponseTime)
+		} else {
+			s.Failures++
+		}
+	}
+
+	result := make([]LatencyStats, 0, len(stats))
+	for id, s := range stats {
+		times := latencies[id]
+		sort.Slice(times, func(i, j int) bool { return times[i] < times[j] })
+		s.SuccessRate = float64(s.Checks-s.Failures) / float64(s.Checks)
+		s.P50 = percentile(times, 50)
+		s.P90 = percentile(times, 90)
+		s.P99 = percentile(times, 99)
+		result = append(result, *s)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].ModelID < result[j].ModelID })
+	return result, nil
+}
+
+// percentile uses the nearest-rank method on sorted values
+func percentile(sorted []int64, p float64) int64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
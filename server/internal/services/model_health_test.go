@@ -0,0 +1,27 @@
+package services
+
+import (
+	"rag-agent-server/internal/models"
+	"testing"
+)
+
+func TestIsChatModel(t *testing.T) {
+	for category, want := range map[string]bool{"": true, "text": true, "image": false, "audio": false, "video": false} {
+		if got := isChatModel(models.AiModel{Category: category}); got != want {
+			t.Errorf("category %q: got %v, want %v", category, got, want)
+		}
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	sorted := []int64{100, 200, 300, 400, 500, 600, 700, 800, 900, 1000}
+	tests := map[float64]int64{50: 500, 90: 900, 99: 1000}
+	for p, want := range tests {
+		if got := percentile(sorted, p); got != want {
+			t.Errorf("p%v = %d, want %d", p, got, want)
+		}
+	}
+	if got := percentile(nil, 50); got != 0 {
+		t.Errorf("empty p50 = %d", got)
+	}
+}
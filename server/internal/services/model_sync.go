@@ -0,0 +1,280 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"rag-agent-server/internal/config"
+	"rag-agent-server/internal/database"
+	"rag-agent-server/internal/models"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Model sync triggers
+const (
+	ModelSyncScheduled = "scheduled"
+	ModelSyncManual    = "manual"
+)
+
+// UpstreamModel is an entry of the gateway's model catalogue
+type UpstreamModel struct {
+	ID       string `json:"id"`
+	Provider string `json:"provider"`
+	Category string `json:"category"`
+	Created  int64  `json:"created"`
+}
+
+// ModelChange is one difference between the upstream catalogue and ours
+type ModelChange struct {
+	ModelID string `json:"modelId"`
+	Change  string `json:"change"` // models.ModelChange*
+	Details string `json:"details,omitempty"`
+}
+
+// ModelSyncResult is what a sync changed, or would change in a dry run
+type ModelSyncResult struct {
+	DryRun   bool          `json:"dryRun"`
+	SyncDate time.Time     `json:"syncDate"`
+	Upstream int           `json:"upstream"`
+	Changes  []ModelChange `json:"changes"`
+	// LogID is the ModelSyncLog written for a real run
+	LogID uint `json:"logId,omitempty"`
+}
+
+// Count returns how many changes of one kind the result holds
+func (r ModelSyncResult) Count(change string) int {
+	n := 0
+	for _, c := range r.Changes {
+		if c.Change == change {
+			n++
+		}
+	}
+	return n
+}
+
+// ModelSyncService keeps the AiModel table in line with the gateway's
+// catalogue: new models are added disabled for review, changed ones updated
+// unless an admin edited them, and models served through the gateway that
+// are gone upstream are deprecated and restored if they come back. Native
+// and local models are not in the catalogue and are left alone.
+type ModelSyncService struct {
+	cfg  *config.Store
+	stop chan struct{}
+
+	// mu serializes syncs so a scheduled run never overlaps a manual one
+	mu      sync.Mutex
+	lastRun time.Time
+}
+
+func NewModelSyncService(cfg *config.Store) *ModelSyncService {
+	return &ModelSyncService{cfg: cfg, stop: make(chan struct{})}
+}
+
+// Start syncs every AI_MODEL_SYNC_INTERVAL_HOURS, re-reading the interval
+// every few minutes so admin changes apply without a restart
+func (s *ModelSyncService) Start() {
+	go func() {
+		ticker := time.NewTicker(5 * time.Minute)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case now := <-ticker.C:
+				interval := time.Duration(s.cfg.Get().AI.ModelSyncIntervalHours) * time.Hour
+				s.mu.Lock()
+				due := interval > 0 && now.Sub(s.lastRun) >= interval
+				s.mu.Unlock()
+				if due {
+					if _, err := s.Sync(context.Background(), ModelSyncScheduled, false); err != nil {
+						log.Printf("[ModelSync] Scheduled sync failed: %v", err)
+					}
+				}
+			case <-s.stop:
+				return
+			}
+		}
+	}()
+}
+
+func (s *ModelSyncService) Stop() {
+	close(s.stop)
+}
+
+// fetchCatalogue downloads the gateway's model list
+func (s *ModelSyncService) fetchCatalogue(ctx context.Context) ([]UpstreamModel, error) {
+	ai := s.cfg.Get().AI
+	if ai.GatewayAPIKey == "" {
+		return nil, fmt.Errorf("API_OPEN_AI key not set")
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", ai.ModelsURL(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+ai.GatewayAPIKey)
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch models from API: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, &ProviderError{StatusCode: resp.StatusCode}
+	}
+
+	var catalogue struct {
+		Data []UpstreamModel `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&catalogue); err != nil {
+		return nil, fmt.Errorf("failed to decode API response: %v", err)
+	}
+	return catalogue.Data, nil
+}
+
+// Sync compares the upstream catalogue with the database. A dry run only
+// reports the changes; a real run applies them and writes a ModelSyncLog.
+func (s *ModelSyncService) Sync(ctx context.Context, trigger string, dryRun bool) (ModelSyncResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !dryRun {
+		s.lastRun = time.Now()
+	}
+
+	result := ModelSyncResult{DryRun: dryRun, SyncDate: time.Now(), Changes: []ModelChange{}}
+	upstream, err := s.fetchCatalogue(ctx)
+	if err != nil {
+		if !dryRun {
+			database.DB.Create(&models.ModelSyncLog{Trigger: trigger, Error: err.Error()})
+		}
+		return result, err
+	}
+	// An empty catalogue is far more likely an upstream hiccup than every
+	// model being withdrawn; don't deprecate everything because of it
+	if len(upstream) == 0 {
+		return result, fmt.Errorf("upstream catalogue is empty")
+	}
+	result.Upstream = len(upstream)
+
+	var existing []models.AiModel
+	if err := database.DB.Find(&existing).Error; err != nil {
+		return result, err
+	}
+	known := make(map[string]models.AiModel, len(existing))
+	for _, m := range existing {
+		known[m.ModelID] = m
+	}
+
+	seen := make(map[string]bool, len(upstream))
+	var toCreate []models.AiModel
+	updates := make(map[uint]map[string]interface{})
+	for _, m := range upstream {
+		if m.ID == "" || seen[m.ID] {
+			continue
+		}
+		seen[m.ID] = true
+
+		current, ok := known[m.ID]
+		if !ok {
+			result.Changes = append(result.Changes, ModelChange{ModelID: m.ID, Change: models.ModelChangeAdded})
+			toCreate = append(toCreate, models.AiModel{
+				ModelID:          m.ID,
+				Name:             m.ID,
+				Provider:         m.Provider,
+				Category:         m.Category,
+				UpstreamProvider: m.Provider,
+				UpstreamCategory: m.Category,
+				IsEnabled:        false, // new models wait for an admin to review them
+				IsNew:            true,
+				LastSyncDate:     result.SyncDate,
+			})
+			continue
+		}
+
+		fields := map[string]interface{}{"last_sync_date": result.SyncDate}
+		if current.IsDeprecated {
+			result.Changes = append(result.Changes, ModelChange{ModelID: m.ID, Change: models.ModelChangeRestored})
+			fields["is_deprecated"] = false
+			fields["deprecated_at"] = nil
+		}
+		if details := syncedFields(current, m, fields); details != "" {
+			result.Changes = append(result.Changes, ModelChange{ModelID: m.ID, Change: models.ModelChangeUpdated, Details: details})
+		}
+		updates[current.ID] = fields
+	}
+
+	ai := s.cfg.Get().AI
+	var toDeprecate []uint
+	for _, m := range existing {
+		if !seen[m.ModelID] && !m.IsDeprecated && servedByGateway(ai, m.Provider) {
+			result.Changes = append(result.Changes, ModelChange{ModelID: m.ModelID, Change: models.ModelChangeDeprecated})
+			toDeprecate = append(toDeprecate, m.ID)
+		}
+	}
+
+	if dryRun {
+		return result, nil
+	}
+
+	for _, m := range toCreate {
+		if err := database.DB.Create(&m).Error; err != nil {
+			log.Printf("[ModelSync] Failed to add %s: %v", m.ModelID, err)
+		}
+	}
+	for id, fields := range updates {
+		database.DB.Model(&models.AiModel{}).Where("id = ?", id).Updates(fields)
+	}
+	if len(toDeprecate) > 0 {
+		database.DB.Model(&models.AiModel{}).Where("id IN ?", toDeprecate).Updates(map[string]interface{}{
+			"is_deprecated": true,
+			"deprecated_at": result.SyncDate,
+		})
+	}
+
+	changes, _ := json.Marshal(result.Changes)
+	entry := models.ModelSyncLog{
+		Trigger:    trigger,
+		Upstream:   result.Upstream,
+		Added:      result.Count(models.ModelChangeAdded),
+		Updated:    result.Count(models.ModelChangeUpdated),
+		Deprecated: result.Count(models.ModelChangeDeprecated),
+		Restored:   result.Count(models.ModelChangeRestored),
+		Changes:    string(changes),
+	}
+	database.DB.Create(&entry)
+	result.LogID = entry.ID
+
+	log.Printf("[ModelSync] %s sync: %d added, %d updated, %d deprecated, %d restored",
+		trigger, entry.Added, entry.Updated, entry.Deprecated, entry.Restored)
+	return result, nil
+}
+
+// syncedFields adds the upstream provider and category of a model to fields
+// and describes what changed. A value is only taken over while the model's
+// own value still matches what upstream reported last time; otherwise an
+// admin changed it and it is kept. Models synced before upstream values were
+// tracked count as edited unless their value is empty.
+func syncedFields(current models.AiModel, upstream UpstreamModel, fields map[string]interface{}) string {
+	var details []string
+	follow := func(name, column, value, last, upstreamValue string) {
+		if upstreamValue == last {
+			return
+		}
+		fields["upstream_"+column] = upstreamValue
+		switch {
+		case value == upstreamValue:
+		case value == last:
+			details = append(details, fmt.Sprintf("%s %q -> %q", name, value, upstreamValue))
+			fields[column] = upstreamValue
+		default:
+			details = append(details, fmt.Sprintf("upstream %s is now %q, keeping %q set by an admin", name, upstreamValue, value))
+		}
+	}
+	follow("provider", "provider", current.Provider, current.UpstreamProvider, upstream.Provider)
+	follow("category", "category", current.Category, current.UpstreamCategory, upstream.Category)
+	return strings.Join(details, "; ")
+}
@@ -0,0 +1,90 @@
+package services
+
+import (
+	"rag-agent-server/internal/models"
+	"testing"
+)
+
+func TestSyncedFields(t *testing.T) {
+	tests := []struct {
+		name     string
+		current  models.AiModel
+		upstream UpstreamModel
+		want     map[string]interface{}
+		changed  bool
+	}{
+		{
+			name:     "unchanged upstream",
+			current:  models.AiModel{Provider: "OpenAI", Category: "text", UpstreamProvider: "OpenAI", UpstreamCategory: "text"},
+			upstream: UpstreamModel{Provider: "OpenAI", Category: "text"},
+			want:     map[string]interface{}{},
+		},
+		{
+			name:     "upstream change is followed",
+			current:  models.AiModel{Provider: "OpenAI", Category: "text", UpstreamProvider: "OpenAI", UpstreamCategory: "text"},
+			upstream: UpstreamModel{Provider: "Azure", Category: "text"},
+			want:     map[string]interface{}{"provider": "Azure", "upstream_provider": "Azure"},
+			changed:  true,
+		},
+		{
+			name:     "admin edit is kept",
+			current:  models.AiModel{Provider: "ollama", Category: "text", UpstreamProvider: "OpenAI", UpstreamCategory: "text"},
+			upstream: UpstreamModel{Provider: "Azure", Category: "text"},
+			want:     map[string]interface{}{"upstream_provider": "Azure"},
+			changed:  true,
+		},
+		{
+			name:     "admin edit is kept while upstream stays the same",
+			current:  models.AiModel{Provider: "ollama", Category: "image", UpstreamProvider: "OpenAI", UpstreamCategory: "text"},
+			upstream: UpstreamModel{Provider: "OpenAI", Category: "text"},
+			want:     map[string]interface{}{},
+		},
+		{
+			name:     "untracked model matching upstream",
+			current:  models.AiModel{Provider: "OpenAI", Category: "text"},
+			upstream: UpstreamModel{Provider: "OpenAI", Category: "text"},
+			want:     map[string]interface{}{"upstream_provider": "OpenAI", "upstream_category": "text"},
+		},
+		{
+			name:     "untracked model with empty values takes upstream",
+			current:  models.AiModel{Provider: "Google"},
+			upstream: UpstreamModel{Provider: "OpenAI", Category: "text"},
+			want:     map[string]interface{}{"upstream_provider": "OpenAI", "upstream_category": "text", "category": "text"},
+			changed:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fields := map[string]interface{}{}
+			details := syncedFields(tt.current, tt.upstream, fields)
+			if (details != "") != tt.changed {
+				t.Errorf("details = %q, changed = %v", details, tt.changed)
+			}
+			if len(fields) != len(tt.want) {
+				t.Fatalf("fields = %v, want %v", fields, tt.want)
+			}
+			for k, v := range tt.want {
+				if fields[k] != v {
+					t.Errorf("fields[%s] = %v, want %v", k, fields[k], v)
+				}
+			}
+		})
+	}
+}
+
+func TestServedByGateway(t *testing.T) {
+	ai := testAIConfig()
+	ai.NativeProviders = "anthropic"
+	tests := map[string]bool{
+		"OpenAI":     true,
+		"Perplexity": true,
+		"Anthropic":  false,
+		"ollama":     false,
+		"lmstudio":   false,
+	}
+	for provider, want := range tests {
+		if got := servedByGateway(ai, provider); got != want {
+			t.Errorf("%s: got %v, want %v", provider, got, want)
+		}
+	}
+}
@@ -0,0 +1,180 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"rag-agent-server/internal/config"
+	"rag-agent-server/internal/models"
+	"strings"
+	"time"
+)
+
+// ModerationAction is the outcome of running a message through the filters.
+// Actions are ordered by severity, the strictest verdict wins.
+type ModerationAction int
+
+const (
+	ModerationAllow ModerationAction = iota
+	ModerationFlag                   // deliver, but queue for review
+	ModerationHold                   // save hidden until a moderator reviews it
+	ModerationBlock                  // reject outright
+)
+
+func (a ModerationAction) String() string {
+	switch a {
+	case ModerationFlag:
+		return "flag"
+	case ModerationHold:
+		return "hold"
+	case ModerationBlock:
+		return "block"
+	}
+	return "allow"
+}
+
+type ModerationVerdict struct {
+	Action ModerationAction
+	Reason string
+	Filter string
+}
+
+// MessageFilter is a single step of the pre-send moderation pipeline
+type MessageFilter interface {
+	Name() string
+	Check(msg models.Message) (ModerationVerdict, error)
+}
+
+type ModerationService struct {
+	filters []MessageFilter
+}
+
+func NewModerationService(cfg *config.Store, aiService *AiChatService) *ModerationService {
+	s := &ModerationService{}
+	s.AddFilter(&KeywordFilter{cfg: cfg})
+	if aiService != nil {
+		s.AddFilter(&AiModerationFilter{cfg: cfg, aiService: aiService})
+	}
+	return s
+}
+
+func (s *ModerationService) AddFilter(f MessageFilter) {
+	s.filters = append(s.filters, f)
+}
+
+// Check runs all filters and returns the strictest verdict. A failing filter
+// is logged and skipped so that moderation outages don't block chat.
+func (s *ModerationService) Check(msg models.Message) ModerationVerdict {
+	result := ModerationVerdict{Action: ModerationAllow}
+	for _, f := range s.filters {
+		verdict, err := f.Check(msg)
+		if err != nil {
+			log.Printf("[Moderation] Filter %s failed: %v", f.Name(), err)
+			continue
+		}
+		if verdict.Action > result.Action {
+			verdict.Filter = f.Name()
+			result = verdict
+		}
+		if result.Action == ModerationBlock {
+			break
+		}
+	}
+	return result
+}
+
+// KeywordFilter matches message content against the configured keyword lists
+// (MODERATION_BLOCK_KEYWORDS, MODERATION_HOLD_KEYWORDS, MODERATION_FLAG_KEYWORDS)
+type KeywordFilter struct {
+	cfg *config.Store
+}
+
+func (f *KeywordFilter) Name() string {
+	return "keywords"
+}
+
+func (f *KeywordFilter) Check(msg models.Message) (ModerationVerdict, error) {
+	moderation := f.cfg.Get().Moderation
+
+	content := strings.ToLower(msg.Content)
+	checks := []struct {
+		list   string
+		action ModerationAction
+	}{
+		{moderation.BlockKeywords, ModerationBlock},
+		{moderation.HoldKeywords, ModerationHold},
+		{moderation.FlagKeywords, ModerationFlag},
+	}
+	for _, check := range checks {
+		if word := matchKeyword(content, check.list); word != "" {
+			return ModerationVerdict{
+				Action: check.action,
+				Reason: fmt.Sprintf("Contains keyword %q", word),
+			}, nil
+		}
+	}
+
+	return ModerationVerdict{Action: ModerationAllow}, nil
+}
+
+func matchKeyword(content, list string) string {
+	for _, word := range strings.FieldsFunc(list, func(r rune) bool { return r == ',' || r == '\n' }) {
+		word = strings.ToLower(strings.TrimSpace(word))
+		if word != "" && strings.Contains(content, word) {
+			return word
+		}
+	}
+	return ""
+}
+
+// AiModerationFilter asks the default model to classify the message. It only
+// runs when the MODERATION_AI_ENABLED setting is "true".
+// aiModerationTimeout bounds the AI verdict on a single message
+const aiModerationTimeout = 20 * time.Second
+
+type AiModerationFilter struct {
+	cfg       *config.Store
+	aiService *AiChatService
+}
+
+func (f *AiModerationFilter) Name() string {
+	return "ai"
+}
+
+func (f *AiModerationFilter) Check(msg models.Message) (ModerationVerdict, error) {
+	if !f.cfg.Get().Moderation.AiEnabled {
+		return ModerationVerdict{Action: ModerationAllow}, nil
+	}
+
+	prompt := fmt.Sprintf(`You are a content moderator for a spiritual community chat.
+Classify the message below. Answer with exactly one word:
+ALLOW - normal message
+FLAG - borderline, a human should review it
+HOLD - likely abusive, hide until reviewed
+BLOCK - clearly abusive, spam or threatening
+
+Message:
+"""
+%s
+"""`, msg.Content)
+
+	// Messages wait for the verdict, so don't let a slow model hold them up
+	ctx, cancel := context.WithTimeout(context.Background(), aiModerationTimeout)
+	defer cancel()
+	resp, err := f.aiService.GenerateSimpleResponse(ctx, SystemUsage(FeatureModeration), prompt)
+	if err != nil {
+		return ModerationVerdict{}, err
+	}
+
+	answer := strings.ToUpper(strings.TrimSpace(resp))
+	verdict := ModerationVerdict{Action: ModerationAllow, Reason: "AI classification"}
+	switch {
+	case strings.HasPrefix(answer, "BLOCK"):
+		verdict.Action = ModerationBlock
+	case strings.HasPrefix(answer, "HOLD"):
+		verdict.Action = ModerationHold
+	case strings.HasPrefix(answer, "FLAG"):
+		verdict.Action = ModerationFlag
+	}
+	return verdict, nil
+}
@@ -0,0 +1,117 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"rag-agent-server/internal/models"
+	"time"
+)
+
+// Payment event types understood by BillingService
+const (
+	PaymentSucceeded      = "payment_succeeded"
+	PaymentFailed         = "payment_failed"
+	SubscriptionCancelled = "subscription_canceled"
+)
+
+// CheckoutSession is where the user is sent to pay
+type CheckoutSession struct {
+	ID  string `json:"id"`
+	URL string `json:"url"`
+}
+
+// PaymentWebhookEvent is a provider notification translated to our terms
+type PaymentWebhookEvent struct {
+	ExternalID             string
+	Type                   string
+	UserID                 uint
+	PlanCode               string
+	ProviderSubscriptionID string
+	// CheckoutID is the CheckoutSession the payment completes, when the
+	// provider reports it
+	CheckoutID string
+	PeriodEnd  *time.Time
+}
+
+// PaymentProvider integrates a payment processor
+type PaymentProvider interface {
+	Name() string
+	// CreateCheckout starts a payment for the plan at the given price
+	CreateCheckout(user models.User, plan models.Plan, price models.PlanPrice) (CheckoutSession, error)
+	// ParseWebhook verifies the signature of a webhook request and decodes it
+	ParseWebhook(body []byte, headers map[string]string) (PaymentWebhookEvent, error)
+}
+
+// FakePaymentProvider is a PaymentProvider for tests and local development.
+// Checkouts are never charged; webhooks are JSON PaymentWebhookEvent-like
+// bodies signed with HMAC-SHA256 of the body in the X-Fake-Signature header.
+type FakePaymentProvider struct {
+	secret []byte
+}
+
+func NewFakePaymentProvider(secret string) *FakePaymentProvider {
+	return &FakePaymentProvider{secret: []byte(secret)}
+}
+
+func (p *FakePaymentProvider) Name() string {
+	return "fake"
+}
+
+// CreateCheckout returns an opaque checkout ID. Completing it is a POST to
+// the URL by the same user (see BillingService.CompleteFakeCheckout).
+func (p *FakePaymentProvider) CreateCheckout(user models.User, plan models.Plan, price models.PlanPrice) (CheckoutSession, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return CheckoutSession{}, err
+	}
+	id := "fake_" + hex.EncodeToString(buf)
+	return CheckoutSession{
+		ID:  id,
+		URL: fmt.Sprintf("/api/billing/fake-checkout/%s?amount=%d&currency=%s", id, price.AmountCents, price.Currency),
+	}, nil
+}
+
+// Sign returns the signature a webhook body must carry
+func (p *FakePaymentProvider) Sign(body []byte) string {
+	mac := hmac.New(sha256.New, p.secret)
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (p *FakePaymentProvider) ParseWebhook(body []byte, headers map[string]string) (PaymentWebhookEvent, error) {
+	if len(p.secret) == 0 {
+		return PaymentWebhookEvent{}, fmt.Errorf("webhook secret is not configured")
+	}
+	if !hmac.Equal([]byte(headers["X-Fake-Signature"]), []byte(p.Sign(body))) {
+		return PaymentWebhookEvent{}, fmt.Errorf("invalid signature")
+	}
+
+	var payload struct {
+		ID             string     `json:"id"`
+		Type           string     `json:"type"`
+		UserID         uint       `json:"userId"`
+		PlanCode       string     `json:"planCode"`
+		SubscriptionID string     `json:"subscriptionId"`
+		CheckoutID     string     `json:"checkoutId"`
+		PeriodEnd      *time.Time `json:"periodEnd"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return PaymentWebhookEvent{}, fmt.Errorf("invalid payload: %v", err)
+	}
+	if payload.ID == "" || payload.Type == "" {
+		return PaymentWebhookEvent{}, fmt.Errorf("id and type are required")
+	}
+	return PaymentWebhookEvent{
+		ExternalID:             payload.ID,
+		Type:                   payload.Type,
+		UserID:                 payload.UserID,
+		PlanCode:               payload.PlanCode,
+		ProviderSubscriptionID: payload.SubscriptionID,
+		CheckoutID:             payload.CheckoutID,
+		PeriodEnd:              payload.PeriodEnd,
+	}, nil
+}
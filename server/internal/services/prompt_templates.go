@@ -0,0 +1,462 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"rag-agent-server/internal/database"
+	"rag-agent-server/internal/models"
+	"strings"
+	"sync"
+	"text/template"
+
+	"gorm.io/gorm"
+)
+
+// Prompt keys
+const (
+	PromptDatingCompatibility = "dating_compatibility"
+	PromptDatingGreeting      = "dating_greeting"
+	PromptRoomSystem          = "room_system"
+	PromptRoomSummary         = "room_summary"
+	PromptContextSummary      = "context_summary"
+)
+
+// PromptFallbackLanguage is used when a prompt has no variant in the
+// requested language
+const PromptFallbackLanguage = "en"
+
+// PromptData holds the variables a prompt is rendered with
+type PromptData map[string]interface{}
+
+// PromptUser is the user profile as seen by prompts
+type PromptUser struct {
+	SpiritualName string `json:"SpiritualName"`
+	KarmicName    string `json:"KarmicName"`
+	Interests     string `json:"Interests"`
+	Tradition     string `json:"Tradition"`
+	Dob           string `json:"Dob"`
+	BirthTime     string `json:"BirthTime"`
+	BirthPlace    string `json:"BirthPlace"`
+	Bio           string `json:"Bio"`
+}
+
+// NewPromptUser binds the profile fields prompts may use
+func NewPromptUser(user models.User) PromptUser {
+	return PromptUser{
+		SpiritualName: user.SpiritualName,
+		KarmicName:    user.KarmicName,
+		Interests:     user.Interests,
+		Tradition:     user.Madh,
+		Dob:           user.Dob,
+		BirthTime:     user.BirthTime,
+		BirthPlace:    user.BirthPlaceLink,
+		Bio:           user.Bio,
+	}
+}
+
+// PromptRoom is the room as seen by prompts
+type PromptRoom struct {
+	Name        string `json:"Name"`
+	Description string `json:"Description"`
+}
+
+// PromptDefinition describes a prompt the code renders: its variables, sample
+// data for previews and the built-in text per language
+type PromptDefinition struct {
+	Key         string            `json:"key"`
+	Description string            `json:"description"`
+	Variables   []string          `json:"variables"`
+	Sample      PromptData        `json:"sample"`
+	Defaults    map[string]string `json:"-"`
+}
+
+var sampleUser = PromptUser{
+	SpiritualName: "Radha Dasi",
+	KarmicName:    "Anna",
+	Interests:     "kirtan, cooking",
+	Tradition:     "Gaudiya",
+	Dob:           "1994-03-21",
+	BirthTime:     "06:45",
+	BirthPlace:    "Vrindavan",
+	Bio:           "Serving in the temple kitchen",
+}
+
+var sampleCandidate = PromptUser{
+	SpiritualName: "Govinda Das",
+	KarmicName:    "Ivan",
+	Interests:     "japa, books",
+	Tradition:     "Gaudiya",
+	Dob:           "1991-11-02",
+	BirthTime:     "14:10",
+	BirthPlace:    "Mayapur",
+	Bio:           "Book distributor",
+}
+
+var sampleRoom = PromptRoom{Name: "Bhagavad Gita study", Description: "Daily reading of the Gita"}
+
+const sampleConversation = "Radha Dasi: Which chapter do we read today?\nGovinda Das: Chapter 2, verse 47."
+
+// PromptDefinitions lists every prompt that can be edited
+var PromptDefinitions = []PromptDefinition{
+	{
+		Key:         PromptDatingCompatibility,
+		Description: "Astrological compatibility report for two dating profiles",
+		Variables:   []string{"User", "Candidate"},
+		Sample:      PromptData{"User": sampleUser, "Candidate": sampleCandidate},
+		Defaults: map[string]string{
+			"ru": `Ты — потомственный ведический астролог (Джйотиш).
+Твоя задача — дать глубокий, но лаконичный анализ совместимости для {{.User.SpiritualName}}.
+
+Важное правило: Обращайся к вопрошающему и партнеру на "Вы". Пиши "Ваш союз", "Ваша совместимость", "Вам". Не используй третье лицо ("Их союз", "У них").
+
+Структура ответа (начинай СРАЗУ с пункта 1, без приветствия):
+1. **Астрологический срез**: Кратко (2-3 предложения) опиши ВАШ союз через призму 7-го дома (партнерство) и лунных знаков (Раши). Упомяни синастрию (Куты) и накшатры, если это уместно.
+2. **Благословение звезд**: Ваша совместимость по гунам и варнам.
+3. **Гармония сердец**: Как ваше служение дополняет друг друга 🪷.
+4. **Практические советы**: 2-3 важных совета для развития ваших отношений, методов упай (коррекции) 📿.
+5. **Заключение**: Теплое пожелание вам ❤️.
+
+Используй термины джйотиш (Бхава, Раши, Накшатра) профессионально, но понятно.
+ОБЯЗАТЕЛЬНО начни ответ сразу с текста анализа. НЕ пиши приветствие, оно будет добавлено автоматически.
+СТРОГО ЗАПРЕЩЕНО: Не генерируй аудио, ссылки или HTML-теги. ТОЛЬКО ТЕКСТ. Не используй TTS.
+
+Данные для анализа:
+---
+ПОЛЬЗОВАТЕЛЬ 1 (Кандидат):
+- Духовное имя: {{.User.SpiritualName}}
+- Интересы: {{.User.Interests}}
+- Традиция: {{.User.Tradition}}
+- Дата рождения: {{.User.Dob}}
+- Время рождения: {{.User.BirthTime}}
+- Место рождения: {{.User.BirthPlace}}
+- О себе: {{.User.Bio}}
+
+ПОЛЬЗОВАТЕЛЬ 2 (Партнер):
+- Духовное имя: {{.Candidate.SpiritualName}}
+- Интересы: {{.Candidate.Interests}}
+- Традиция: {{.Candidate.Tradition}}
+- Дата рождения: {{.Candidate.Dob}}
+- Время рождения: {{.Candidate.BirthTime}}
+- Место рождения: {{.Candidate.BirthPlace}}
+- О себе: {{.Candidate.Bio}}
+---`,
+			"en": `You are a hereditary Vedic astrologer (Jyotish).
+Your task is to give a deep but concise compatibility analysis for {{.User.SpiritualName}}.
+
+Important rule: address the person asking and their partner directly. Write "your union", "your compatibility", never "their union".
+
+Structure of the answer (start RIGHT AWAY with point 1, no greeting):
+1. **Astrological view**: briefly (2-3 sentences) describe YOUR union through the 7th house (partnership) and the moon signs (Rashi). Mention synastry (Kutas) and nakshatras where relevant.
+2. **Blessing of the stars**: your compatibility by gunas and varnas.
+3. **Harmony of hearts**: how your service complements each other 🪷.
+4. **Practical advice**: 2-3 important tips for your relationship and remedies (upayas) 📿.
+5. **Conclusion**: a warm wish for you ❤️.
+
+Use Jyotish terms (Bhava, Rashi, Nakshatra) professionally but clearly.
+Start the answer directly with the analysis. Do NOT write a greeting, it is added automatically.
+STRICTLY FORBIDDEN: no audio, links or HTML tags. TEXT ONLY.
+
+Data for the analysis:
+---
+USER 1 (Candidate):
+- Spiritual name: {{.User.SpiritualName}}
+- Interests: {{.User.Interests}}
+- Tradition: {{.User.Tradition}}
+- Date of birth: {{.User.Dob}}
+- Time of birth: {{.User.BirthTime}}
+- Place of birth: {{.User.BirthPlace}}
+- About: {{.User.Bio}}
+
+USER 2 (Partner):
+- Spiritual name: {{.Candidate.SpiritualName}}
+- Interests: {{.Candidate.Interests}}
+- Tradition: {{.Candidate.Tradition}}
+- Date of birth: {{.Candidate.Dob}}
+- Time of birth: {{.Candidate.BirthTime}}
+- Place of birth: {{.Candidate.BirthPlace}}
+- About: {{.Candidate.Bio}}
+---`,
+		},
+	},
+	{
+		Key:         PromptDatingGreeting,
+		Description: "Greeting prepended to every compatibility report",
+		Variables:   []string{"User"},
+		Sample:      PromptData{"User": sampleUser},
+		Defaults: map[string]string{
+			"ru": "Харе Кришна, дорогой {{.User.SpiritualName}}! 🌟\n\n",
+			"en": "Hare Krishna, dear {{.User.SpiritualName}}! 🌟\n\n",
+		},
+	},
+	{
+		Key:         PromptRoomSystem,
+		Description: "System prompt of the room assistant",
+		Variables:   []string{"Room", "Persona", "CustomPrompt", "Language"},
+		Sample: PromptData{
+			"Room": sampleRoom, "Persona": "Gita teacher", "CustomPrompt": "", "Language": "English",
+		},
+		Defaults: map[string]string{
+			"en": `{{if .Persona}}Your name is {{.Persona}}.
+{{end}}{{if .CustomPrompt}}{{.CustomPrompt}}{{else}}You are an AI assistant in the chat room '{{.Room.Name}}'. {{.Room.Description}}. Be helpful and concise.{{end}}{{if .Language}}
+Always answer in {{.Language}}.{{end}}`,
+			"ru": `{{if .Persona}}Тебя зовут {{.Persona}}.
+{{end}}{{if .CustomPrompt}}{{.CustomPrompt}}{{else}}Ты — ИИ-ассистент в чат-комнате '{{.Room.Name}}'. {{.Room.Description}}. Отвечай по делу и кратко.{{end}}{{if .Language}}
+Всегда отвечай на языке: {{.Language}}.{{end}}`,
+		},
+	},
+	{
+		Key:         PromptRoomSummary,
+		Description: "Summary of recent room messages requested by members",
+		Variables:   []string{"Room", "Conversation"},
+		Sample:      PromptData{"Room": sampleRoom, "Conversation": sampleConversation},
+		Defaults: map[string]string{
+			"en": "Summarize the following conversation in the chat room '{{.Room.Name}}' in 2-3 sentences:\n\n{{.Conversation}}",
+			"ru": "Кратко перескажи следующий разговор в чат-комнате '{{.Room.Name}}' в 2-3 предложениях на русском языке:\n\n{{.Conversation}}",
+		},
+	},
+	{
+		Key:         PromptContextSummary,
+		Description: "Rolling summary of older room history kept for the assistant",
+		Variables:   []string{"Room", "Summary", "Conversation"},
+		Sample: PromptData{
+			"Room": sampleRoom, "Summary": "The group agreed to read one verse a day.", "Conversation": sampleConversation,
+		},
+		Defaults: map[string]string{
+			"en": `You maintain a running summary of the chat room '{{.Room.Name}}'.
+Update the summary with the new messages. Keep who said what, open questions and decisions. At most 8 sentences.
+
+Current summary:
+{{.Summary}}
+
+New messages:
+{{.Conversation}}`,
+		},
+	},
+}
+
+// PromptDefinitionFor returns the definition of a prompt key
+func PromptDefinitionFor(key string) (PromptDefinition, bool) {
+	for _, def := range PromptDefinitions {
+		if def.Key == key {
+			return def, true
+		}
+	}
+	return PromptDefinition{}, false
+}
+
+// HasLanguage reports whether the prompt has built-in text in the language
+func (d PromptDefinition) HasLanguage(language string) bool {
+	_, ok := d.Defaults[language]
+	return ok
+}
+
+// PromptService renders prompts from the versioned templates in the database,
+// falling back to the built-in text when a stored template is missing or
+// broken.
+type PromptService struct {
+	mu sync.Mutex
+	// parsed caches templates by row ID; versions are immutable once saved
+	parsed map[uint]*template.Template
+}
+
+func NewPromptService() *PromptService {
+	return &PromptService{parsed: make(map[uint]*template.Template)}
+}
+
+func parsePrompt(key, body string) (*template.Template, error) {
+	return template.New(key).Option("missingkey=error").Parse(body)
+}
+
+func executePrompt(tmpl *template.Template, data PromptData) (string, error) {
+	var b strings.Builder
+	if err := tmpl.Execute(&b, data); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// SeedDefaultPrompts stores the built-in text as version 1 of every prompt
+// language that has no versions yet. Where a built-in text is still the
+// active version but has since changed, the new text is saved and activated
+// as the next version; versions saved by admins are left alone.
+func (p *PromptService) SeedDefaultPrompts() {
+	for _, def := range PromptDefinitions {
+		for language, body := range def.Defaults {
+			var count int64
+			database.DB.Model(&models.PromptTemplate{}).Where("key = ? AND language = ?", def.Key, language).Count(&count)
+			if count > 0 {
+				p.upgradeDefaultPrompt(def.Key, language, body)
+				continue
+			}
+			row := models.PromptTemplate{Key: def.Key, Language: language, Version: 1, Body: body, IsActive: true, Comment: "Built-in default"}
+			if err := database.DB.Create(&row).Error; err != nil {
+				log.Printf("[Prompts] Failed to seed %s/%s: %v", def.Key, language, err)
+			}
+		}
+	}
+}
+
+func (p *PromptService) upgradeDefaultPrompt(key, language, body string) {
+	var active models.PromptTemplate
+	err := database.DB.Where("key = ? AND language = ? AND is_active = ?", key, language, true).First(&active).Error
+	if err != nil || active.AuthorID != 0 || active.Body == body {
+		return
+	}
+	row, err := p.SaveVersion(key, language, body, "Built-in default", 0, true)
+	if err != nil {
+		log.Printf("[Prompts] Failed to update built-in %s/%s: %v", key, language, err)
+		return
+	}
+	log.Printf("[Prompts] Updated built-in %s/%s to version %d", key, language, row.Version)
+}
+
+// Render renders the active version of a prompt in the given language, or in
+// PromptFallbackLanguage when there is no variant for it
+func (p *PromptService) Render(key, language string, data PromptData) (string, error) {
+	def, ok := PromptDefinitionFor(key)
+	if !ok {
+		return "", fmt.Errorf("unknown prompt %q", key)
+	}
+
+	for _, lang := range []string{language, PromptFallbackLanguage} {
+		if lang == "" {
+			continue
+		}
+		var row models.PromptTemplate
+		if err := database.DB.Where("key = ? AND language = ? AND is_active = ?", key, lang, true).First(&row).Error; err != nil {
+			continue
+		}
+		text, err := p.renderRow(row, data)
+		if err == nil {
+			return text, nil
+		}
+		// Keep the feature working on the built-in text while the template is fixed
+		log.Printf("[Prompts] Version %d of %s/%s failed to render: %v", row.Version, key, lang, err)
+		break
+	}
+
+	body, ok := def.Defaults[language]
+	if !ok {
+		body = def.Defaults[PromptFallbackLanguage]
+	}
+	tmpl, err := parsePrompt(key, body)
+	if err != nil {
+		return "", err
+	}
+	return executePrompt(tmpl, data)
+}
+
+func (p *PromptService) renderRow(row models.PromptTemplate, data PromptData) (string, error) {
+	p.mu.Lock()
+	tmpl, ok := p.parsed[row.ID]
+	p.mu.Unlock()
+	if !ok {
+		var err error
+		if tmpl, err = parsePrompt(row.Key, row.Body); err != nil {
+			return "", err
+		}
+		p.mu.Lock()
+		p.parsed[row.ID] = tmpl
+		p.mu.Unlock()
+	}
+	return executePrompt(tmpl, data)
+}
+
+// Preview renders a draft body, a stored version or the active version with
+// the given data, or the prompt's sample data when data is nil
+func (p *PromptService) Preview(key, language, body string, version int, data PromptData) (string, error) {
+	def, ok := PromptDefinitionFor(key)
+	if !ok {
+		return "", fmt.Errorf("unknown prompt %q", key)
+	}
+	if data == nil {
+		data = def.Sample
+	}
+	if body == "" && version > 0 {
+		var row models.PromptTemplate
+		if err := database.DB.Where("key = ? AND language = ? AND version = ?", key, language, version).First(&row).Error; err != nil {
+			return "", fmt.Errorf("version %d not found", version)
+		}
+		body = row.Body
+	}
+	if body == "" {
+		return p.Render(key, language, data)
+	}
+
+	tmpl, err := parsePrompt(key, body)
+	if err != nil {
+		return "", err
+	}
+	return executePrompt(tmpl, data)
+}
+
+// PromptVersions lists the versions of a prompt, newest first, optionally for
+// one language
+func PromptVersions(key, language string) ([]models.PromptTemplate, error) {
+	versions := []models.PromptTemplate{}
+	query := database.DB.Where("key = ?", key)
+	if language != "" {
+		query = query.Where("language = ?", language)
+	}
+	err := query.Order("language, version desc").Find(&versions).Error
+	return versions, err
+}
+
+// SaveVersion stores a new version of a prompt after checking it renders with
+// the sample data. The first version of a language is always activated.
+func (p *PromptService) SaveVersion(key, language, body, comment string, authorID uint, activate bool) (models.PromptTemplate, error) {
+	def, ok := PromptDefinitionFor(key)
+	if !ok {
+		return models.PromptTemplate{}, fmt.Errorf("unknown prompt %q", key)
+	}
+	language = strings.ToLower(strings.TrimSpace(language))
+	if language == "" || len(language) > 8 {
+		return models.PromptTemplate{}, fmt.Errorf("invalid language %q", language)
+	}
+	if strings.TrimSpace(body) == "" {
+		return models.PromptTemplate{}, fmt.Errorf("body is required")
+	}
+	tmpl, err := parsePrompt(key, body)
+	if err != nil {
+		return models.PromptTemplate{}, err
+	}
+	if _, err := executePrompt(tmpl, def.Sample); err != nil {
+		return models.PromptTemplate{}, err
+	}
+
+	row := models.PromptTemplate{Key: key, Language: language, Body: body, Comment: comment, AuthorID: authorID}
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		var latest models.PromptTemplate
+		if err := tx.Unscoped().Where("key = ? AND language = ?", key, language).Order("version desc").First(&latest).Error; err == nil {
+			row.Version = latest.Version + 1
+		} else {
+			row.Version = 1
+			activate = true
+		}
+		row.IsActive = activate
+		if activate {
+			if err := tx.Model(&models.PromptTemplate{}).Where("key = ? AND language = ?", key, language).Update("is_active", false).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Create(&row).Error
+	})
+	return row, err
+}
+
+// ActivateVersion makes a stored version the active one, which is how
+// prompts are rolled back
+func (p *PromptService) ActivateVersion(key, language string, version int) (models.PromptTemplate, error) {
+	var row models.PromptTemplate
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("key = ? AND language = ? AND version = ?", key, language, version).First(&row).Error; err != nil {
+			return fmt.Errorf("version %d not found", version)
+		}
+		if err := tx.Model(&models.PromptTemplate{}).Where("key = ? AND language = ?", key, language).Update("is_active", false).Error; err != nil {
+			return err
+		}
+		row.IsActive = true
+		return tx.Model(&row).Update("is_active", true).Error
+	})
+	return row, err
+}
@@ -0,0 +1,53 @@
+package services
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDefaultPromptsRender(t *testing.T) {
+	for _, def := range PromptDefinitions {
+		for language, body := range def.Defaults {
+			tmpl, err := parsePrompt(def.Key, body)
+			if err != nil {
+				t.Errorf("%s/%s: %v", def.Key, language, err)
+				continue
+			}
+			if _, err := executePrompt(tmpl, def.Sample); err != nil {
+				t.Errorf("%s/%s: %v", def.Key, language, err)
+			}
+		}
+	}
+}
+
+func TestRoomSystemPromptFollowsLanguage(t *testing.T) {
+	def, _ := PromptDefinitionFor(PromptRoomSystem)
+	for language, body := range def.Defaults {
+		tmpl, err := parsePrompt(def.Key, body)
+		if err != nil {
+			t.Fatalf("%s: %v", language, err)
+		}
+		data := PromptData{"Room": sampleRoom, "Persona": "", "CustomPrompt": "", "Language": "Deutsch"}
+		out, err := executePrompt(tmpl, data)
+		if err != nil || !strings.Contains(out, "Deutsch") {
+			t.Errorf("%s: room language ignored: %q %v", language, out, err)
+		}
+		data["Language"] = ""
+		out, err = executePrompt(tmpl, data)
+		if err != nil || strings.Contains(out, "русском") {
+			t.Errorf("%s: language is hardcoded: %q %v", language, out, err)
+		}
+	}
+}
+
+func TestPromptHasLanguage(t *testing.T) {
+	def, _ := PromptDefinitionFor(PromptDatingCompatibility)
+	if !def.HasLanguage("ru") || !def.HasLanguage("en") {
+		t.Error("the compatibility prompt must have Russian and English text")
+	}
+	for _, language := range []string{"", "xx", "RU", "en-us"} {
+		if def.HasLanguage(language) {
+			t.Errorf("HasLanguage(%q) = true", language)
+		}
+	}
+}
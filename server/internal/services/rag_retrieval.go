@@ -0,0 +1,279 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"rag-agent-server/internal/config"
+	"rag-agent-server/internal/database"
+	"rag-agent-server/internal/models"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Passage sources
+const (
+	SourceProfile   = "profile"
+	SourceKnowledge = "knowledge"
+)
+
+const (
+	// retrievalTimeout bounds the lookup so a slow store only costs the context
+	retrievalTimeout = 10 * time.Second
+	// defaultRetrievalLimit is how many passages are added to a prompt
+	defaultRetrievalLimit = 5
+)
+
+// RetrievalQuery is what to look up and where it may come from
+type RetrievalQuery struct {
+	Text string
+	// UserIDs are the users whose profiles may be used
+	UserIDs []uint
+	// Knowledge allows passages from knowledge documents
+	Knowledge bool
+	// Collections limits knowledge documents to these collections; empty
+	// means every collection
+	Collections []string
+	Limit       int
+}
+
+// Passage is a piece of retrieved context
+type Passage struct {
+	Source string
+	Title  string
+	Text   string
+	Score  float64
+}
+
+// Citation credits a passage the reply used, by its [n] marker
+type Citation struct {
+	Index  int    `json:"index"`
+	Title  string `json:"title"`
+	Source string `json:"source"`
+}
+
+// Retriever finds the passages most relevant to a query
+type Retriever interface {
+	Retrieve(ctx context.Context, query RetrievalQuery) ([]Passage, error)
+}
+
+// UseRetriever enables grounding for RAG-enabled models. Passing nil turns
+// retrieval off.
+func (s *AiChatService) UseRetriever(r Retriever) {
+	s.retriever = r
+}
+
+// ragEnabled reports whether a model is flagged to receive retrieved context
+func ragEnabled(modelID string) bool {
+	var model models.AiModel
+	if err := database.DB.Select("is_rag_enabled").Where("model_id = ?", modelID).First(&model).Error; err != nil {
+		return false
+	}
+	return model.IsRagEnabled
+}
+
+// ground adds the passages relevant to query as a system message after the
+// leading system prompt. Retrieval failures only cost the extra context.
+func (s *AiChatService) ground(ctx context.Context, modelID string, query *RetrievalQuery, messages []map[string]string) ([]map[string]string, []Passage) {
+	if s.retriever == nil || query == nil || strings.TrimSpace(query.Text) == "" || !ragEnabled(modelID) {
+		return messages, nil
+	}
+	q := *query
+	if q.Limit <= 0 {
+		q.Limit = defaultRetrievalLimit
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, retrievalTimeout)
+	defer cancel()
+	passages, err := s.retriever.Retrieve(ctx, q)
+	if err != nil {
+		log.Printf("[RAG] Retrieval failed, answering without context: %v", err)
+		return messages, nil
+	}
+	if len(passages) == 0 {
+		return messages, nil
+	}
+	if len(passages) > q.Limit {
+		passages = passages[:q.Limit]
+	}
+
+	var b strings.Builder
+	b.WriteString("Relevant context. Use it when it helps and cite each fact you take from it with its number, like [1]. Ignore it when it is unrelated.\n")
+	for i, p := range passages {
+		fmt.Fprintf(&b, "\n[%d] %s\n%s\n", i+1, p.Title, strings.TrimSpace(p.Text))
+	}
+	contextMessage := map[string]string{"role": "system", "content": b.String()}
+
+	at := 0
+	for at < len(messages) && messages[at]["role"] == "system" {
+		at++
+	}
+	grounded := make([]map[string]string, 0, len(messages)+1)
+	grounded = append(grounded, messages[:at]...)
+	grounded = append(grounded, contextMessage)
+	grounded = append(grounded, messages[at:]...)
+	return grounded, passages
+}
+
+// roomRetrievalQuery looks up context for the latest member messages in the
+// room's knowledge collections and in the profile of the member who asked for
+// the reply. The reply is posted to the whole room, so other members'
+// profiles are never searched.
+func roomRetrievalQuery(settings models.RoomAiSettings, history []models.Message, requesterID uint) *RetrievalQuery {
+	query := &RetrievalQuery{Knowledge: true, Collections: ParseCollections(settings.KnowledgeCollections)}
+	if requesterID != 0 {
+		query.UserIDs = []uint{requesterID}
+	}
+	var recent []string
+	for i := len(history) - 1; i >= 0 && len(recent) < 3; i-- {
+		if m := history[i]; m.SenderID != 0 {
+			recent = append([]string{m.Content}, recent...)
+		}
+	}
+	query.Text = strings.Join(recent, "\n")
+	return query
+}
+
+var citationMarker = regexp.MustCompile(`\[(\d{1,2})\]`)
+
+// citationsFor returns the passages the reply cites, in marker order
+func citationsFor(reply string, passages []Passage) []Citation {
+	var citations []Citation
+	seen := make(map[int]bool)
+	for _, match := range citationMarker.FindAllStringSubmatch(reply, -1) {
+		n, _ := strconv.Atoi(match[1])
+		if n < 1 || n > len(passages) || seen[n] {
+			continue
+		}
+		seen[n] = true
+		p := passages[n-1]
+		citations = append(citations, Citation{Index: n, Title: p.Title, Source: p.Source})
+	}
+	return citations
+}
+
+// WithCitations appends a numbered source list to a reply that cites any
+func WithCitations(reply string, citations []Citation) string {
+	if len(citations) == 0 {
+		return reply
+	}
+	var b strings.Builder
+	b.WriteString(strings.TrimRight(reply, "\n "))
+	b.WriteString("\n\nSources:")
+	for _, c := range citations {
+		fmt.Fprintf(&b, "\n[%d] %s", c.Index, c.Title)
+	}
+	return b.String()
+}
+
+// GeminiFileSearchRetriever looks passages up in the Gemini file search store
+// profiles are imported into. The store has no plain query endpoint, so it
+// asks a small model with the file search tool and keeps the grounding chunks.
+type GeminiFileSearchRetriever struct {
+	cfg *config.Store
+}
+
+func NewGeminiFileSearchRetriever(cfg *config.Store) *GeminiFileSearchRetriever {
+	return &GeminiFileSearchRetriever{cfg: cfg}
+}
+
+// geminiStoreName returns the resource name of the file search store, which
+// GEMINI_CORPUS_ID may give with or without its prefix
+func geminiStoreName(id string) string {
+	if strings.HasPrefix(id, "fileSearchStores/") {
+		return id
+	}
+	return "fileSearchStores/" + id
+}
+
+// metadataFilter limits the search to the allowed profiles and knowledge
+func (r *GeminiFileSearchRetriever) metadataFilter(query RetrievalQuery) string {
+	var clauses []string
+	if query.Knowledge {
+		clause := fmt.Sprintf("kind = %q", SourceKnowledge)
+		if len(query.Collections) > 0 {
+			var collections []string
+			for _, collection := range query.Collections {
+				collections = append(collections, fmt.Sprintf("collection = %q", collection))
+			}
+			clause = fmt.Sprintf("(%s AND (%s))", clause, strings.Join(collections, " OR "))
+		}
+		clauses = append(clauses, clause)
+	}
+	for _, id := range query.UserIDs {
+		clauses = append(clauses, fmt.Sprintf("user_id = %d", id))
+	}
+	return strings.Join(clauses, " OR ")
+}
+
+func (r *GeminiFileSearchRetriever) Retrieve(ctx context.Context, query RetrievalQuery) ([]Passage, error) {
+	ai := r.cfg.Get().AI
+	if ai.GeminiAPIKey == "" || ai.GeminiCorpusID == "" {
+		return nil, fmt.Errorf("GEMINI_API_KEY and GEMINI_CORPUS_ID are required for retrieval")
+	}
+	filter := r.metadataFilter(query)
+	if filter == "" {
+		return nil, nil
+	}
+
+	store := geminiStoreName(ai.GeminiCorpusID)
+	body := map[string]interface{}{
+		"contents": []map[string]interface{}{
+			{"role": "user", "parts": []map[string]string{{"text": query.Text}}},
+		},
+		"tools": []map[string]interface{}{
+			{"fileSearch": map[string]interface{}{
+				"fileSearchStoreNames": []string{store},
+				"metadataFilter":       filter,
+				"topK":                 query.Limit,
+			}},
+		},
+		"generationConfig": map[string]interface{}{"maxOutputTokens": 64},
+	}
+
+	model := url.PathEscape(strings.TrimPrefix(ai.GeminiRetrievalModel, "models/"))
+	endpoint := fmt.Sprintf("%s/v1beta/models/%s:generateContent", ai.GeminiBaseURL, model)
+	resp, err := postJSON(ctx, &http.Client{Timeout: retrievalTimeout}, endpoint, geminiAuth(ai.GeminiAPIKey), body)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var response struct {
+		Candidates []struct {
+			GroundingMetadata struct {
+				GroundingChunks []struct {
+					RetrievedContext struct {
+						Title string `json:"title"`
+						Text  string `json:"text"`
+					} `json:"retrievedContext"`
+				} `json:"groundingChunks"`
+			} `json:"groundingMetadata"`
+		} `json:"candidates"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return nil, err
+	}
+	if len(response.Candidates) == 0 {
+		return nil, nil
+	}
+
+	var passages []Passage
+	for _, chunk := range response.Candidates[0].GroundingMetadata.GroundingChunks {
+		retrieved := chunk.RetrievedContext
+		if strings.TrimSpace(retrieved.Text) == "" {
+			continue
+		}
+		source := SourceKnowledge
+		if strings.HasPrefix(retrieved.Title, profileTitlePrefix) {
+			source = SourceProfile
+		}
+		passages = append(passages, Passage{Source: source, Title: retrieved.Title, Text: retrieved.Text})
+	}
+	return passages, nil
+}
@@ -0,0 +1,51 @@
+package services
+
+import (
+	"rag-agent-server/internal/models"
+	"reflect"
+	"testing"
+)
+
+func TestRoomRetrievalQuery(t *testing.T) {
+	history := []models.Message{
+		{SenderID: 1, Content: "first"},
+		{SenderID: 2, Content: "second"},
+		{SenderID: 0, Content: "assistant reply"},
+		{SenderID: 3, Content: "third"},
+		{SenderID: 2, Content: "fourth"},
+	}
+	settings := models.RoomAiSettings{KnowledgeCollections: "gita, Vedas"}
+
+	query := roomRetrievalQuery(settings, history, 2)
+	if !reflect.DeepEqual(query.UserIDs, []uint{2}) {
+		t.Errorf("UserIDs = %v, want only the requester", query.UserIDs)
+	}
+	if query.Text != "second\nthird\nfourth" {
+		t.Errorf("Text = %q", query.Text)
+	}
+	if !query.Knowledge || len(query.Collections) != 2 {
+		t.Errorf("knowledge = %v %v", query.Knowledge, query.Collections)
+	}
+
+	if query := roomRetrievalQuery(settings, history, 0); len(query.UserIDs) != 0 {
+		t.Errorf("replies nobody asked for searched profiles %v", query.UserIDs)
+	}
+}
+
+func TestGeminiMetadataFilter(t *testing.T) {
+	r := &GeminiFileSearchRetriever{}
+	tests := []struct {
+		query RetrievalQuery
+		want  string
+	}{
+		{query: RetrievalQuery{UserIDs: []uint{7}}, want: "user_id = 7"},
+		{query: RetrievalQuery{Knowledge: true}, want: `kind = "knowledge"`},
+		{query: RetrievalQuery{Knowledge: true, Collections: []string{"gita"}, UserIDs: []uint{7}}, want: `(kind = "knowledge" AND (collection = "gita")) OR user_id = 7`},
+		{query: RetrievalQuery{}, want: ""},
+	}
+	for _, tt := range tests {
+		if got := r.metadataFilter(tt.query); got != tt.want {
+			t.Errorf("metadataFilter(%+v) = %q, want %q", tt.query, got, tt.want)
+		}
+	}
+}
@@ -1,40 +1,56 @@
 package services
 
 import (
-	"bytes"
-	"encoding/json"
+	"context"
+	"errors"
 	"fmt"
-	"io"
 	"log"
-	"net/http"
-	"os"
+	"rag-agent-server/internal/config"
+	"rag-agent-server/internal/database"
 	"rag-agent-server/internal/models"
+	"sync"
 	"time"
+
+	"gorm.io/gorm"
 )
 
 type RAGService struct {
-	apiKey   string
-	corpusID string // Often referred to as "Store ID" or "Corpus Name"
-	baseURL  string
+	cfg *config.Store
+	// vectors is set when RAG_BACKEND=pgvector
+	vectors *VectorRetriever
+
+	mu         sync.Mutex
+	reindexing bool
 }
 
-func NewRAGService() *RAGService {
-	baseURL := os.Getenv("GEMINI_BASE_URL")
-	if baseURL == "" {
-		baseURL = "https://generativelanguage.googleapis.com"
-	}
-	// Remove trailing slash if present
-	if len(baseURL) > 0 && baseURL[len(baseURL)-1] == '/' {
-		baseURL = baseURL[:len(baseURL)-1]
+// NewRAGService prepares the configured backend. With RAG_BACKEND=pgvector
+// it fails when the store can't be prepared rather than running with
+// retrieval silently off.
+func NewRAGService(cfg *config.Store) (*RAGService, error) {
+	service := &RAGService{cfg: cfg}
+	if rag := cfg.Get().RAG; rag.Backend == "pgvector" {
+		store, err := NewPgVectorStore(database.DB, rag.EmbeddingsDimensions)
+		if err != nil {
+			return nil, err
+		}
+		log.Printf("[RAG] Using pgvector with %s embeddings", rag.EmbeddingsProvider)
+		service.vectors = NewVectorRetriever(cfg, store, NewEmbedder(cfg))
 	}
+	return service, nil
+}
 
-	return &RAGService{
-		apiKey:   os.Getenv("GEMINI_API_KEY"),
-		corpusID: os.Getenv("GEMINI_CORPUS_ID"),
-		baseURL:  baseURL,
+// Retriever returns what AI calls are grounded with for the configured backend
+func (s *RAGService) Retriever() Retriever {
+	if s.vectors != nil {
+		return s.vectors
 	}
+	return NewGeminiFileSearchRetriever(s.cfg)
 }
 
+// profileTitlePrefix starts the display name of uploaded profiles, which is
+// what retrieved profile passages are cited by
+const profileTitlePrefix = "Profile: "
+
 // UploadResponse represents the response from the upload endpoint
 type UploadResponse struct {
 	File struct {
@@ -44,19 +60,11 @@ type UploadResponse struct {
 	} `json:"file"`
 }
 
-// UploadProfile generates a text representation of the user profile,
-// uploads it to Google Gemini, and imports it into the configured Corpus.
-// It returns the File ID (handle) from the RAG system.
-func (s *RAGService) UploadProfile(user models.User) (string, error) {
-	if s.apiKey == "" {
-		return "", fmt.Errorf("GEMINI_API_KEY is not set")
-	}
-
-	// 1. Format Profile Data
-	profileText := fmt.Sprintf(`Профиль пользователя:
+// formatProfile is the text a profile is retrieved by
+func formatProfile(user models.User) string {
+	return fmt.Sprintf(`Профиль пользователя:
 Имя (кармическое): %s
 Духовное имя: %s
-Email: %s
 Пол: %s
 Страна: %s
 Город: %s
@@ -72,136 +80,130 @@ Email: %s
 Время рождения: %s
 Место рождения (линк): %s
 Знакомства включены: %v`,
-		user.KarmicName, user.SpiritualName, user.Email, user.Gender, user.Country,
+		user.KarmicName, user.SpiritualName, user.Gender, user.Country,
 		user.City, user.Dob, user.Identity, user.Diet, user.Madh, user.Mentor,
 		user.Bio, user.Interests, user.LookingFor, user.MaritalStatus, user.BirthTime, user.BirthPlaceLink, user.DatingEnabled)
+}
 
-	// 2. Upload to Google Gemini (Media Upload)
-	// Endpoint: POST /upload/v1beta/files
-	uploadURL := fmt.Sprintf("%s/upload/v1beta/files?key=%s", s.baseURL, s.apiKey)
-
-	// We need to send:
-	// 1. Metadata (display name)
-	// 2. File content
-	// For simplicity, we can use the 'multipart' upload or just 'media' upload if we only send content.
-	// But giving it a display name is nice. The simple 'media' upload with metadata requires the 'uploadType=multipart' param
-	// and a multipart body.
-	//
-	// However, to keep it simple and robust like the previous attempt tried to be (but failed),
-	// let's usage the 'resumable' or simply just send the JSON metadata + content?
-	// actually the simplest "upload" for text is creating a File resource with specific fields.
-	//
-	// Let's use the straightforward approach used by many Google client libs:
-	// Send a POST with JSON body containing "metadata" and "display_name", but wait...
-	// The `upload` endpoint expects raw bytes or multipart.
-	//
-	// Let's check if there is a `createmedia` style.
-	// Official docs say: POST /upload/v1beta/files
-	// Headers: X-Goog-Upload-Protocol: raw (if just sending bytes)
-	// X-Goog-Upload-Header-Content-DisplayName: ... (custom header might work?)
-	//
-	// Let's try the Multipart approach which is standard.
-
-	// body := &bytes.Buffer{}
-	// writer := io.MultiWriter(body) // Placeholder if we used multipart writer
-
-	// Actually, let's use the "Initial Resumable Request" pattern or just straight JSON if creating without bytes?
-	// No, we need to upload content.
-	//
-	// Let's stick to the simplest working method for text:
-	// Just upload raw text.
-	// Name will be auto-generated.
-
-	req, err := http.NewRequest("POST", uploadURL, bytes.NewBufferString(profileText))
-	if err != nil {
-		return "", fmt.Errorf("failed to create upload request: %v", err)
-	}
+// profileIndexTimeout bounds making one profile retrievable, including the
+// wait for a Gemini import to finish
+const profileIndexTimeout = 3 * time.Minute
 
-	// Set headers for raw upload
-	req.Header.Set("X-Goog-Upload-Protocol", "raw")
-	req.Header.Set("X-Goog-Upload-Header-Content-Type", "text/plain")
-	req.Header.Set("X-Goog-Upload-Header-Content-DisplayName", fmt.Sprintf("UserProfile_%s", user.Email)) // Try to set name
-	req.Header.Set("Content-Type", "text/plain")
+// profileTitle is what retrieved profile passages are cited by. It must not
+// reveal the email.
+func profileTitle(user models.User) string {
+	name := user.SpiritualName
+	if name == "" {
+		name = user.KarmicName
+	}
+	return profileTitlePrefix + name
+}
 
-	client := &http.Client{Timeout: 30 * time.Second}
-	resp, err := client.Do(req)
+// indexProfile stores the profile in the vector store under a stable key,
+// which is returned as the profile's RAG file ID
+func (s *RAGService) indexProfile(ctx context.Context, user models.User) (string, error) {
+	if s.vectors == nil {
+		return "", fmt.Errorf("pgvector backend is not available")
+	}
+	key := fmt.Sprintf("profile:%d", user.ID)
+	_, err := s.vectors.Index(ctx, VectorDocument{
+		Key:    key,
+		Source: SourceProfile,
+		Title:  profileTitle(user),
+		UserID: user.ID,
+		Text:   formatProfile(user),
+	})
 	if err != nil {
-		return "", fmt.Errorf("failed to upload file: %v", err)
+		return "", err
 	}
-	defer resp.Body.Close()
+	return key, nil
+}
 
-	bodyBytes, _ := io.ReadAll(resp.Body)
-	if resp.StatusCode != 200 {
-		return "", fmt.Errorf("rag upload failed with status %d: %s", resp.StatusCode, string(bodyBytes))
+// UploadProfile makes the profile retrievable with the configured backend and
+// returns its RAG file ID: the uploaded Gemini file, or the pgvector key. In
+// the Gemini store the copies imported earlier are replaced.
+func (s *RAGService) UploadProfile(user models.User) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), profileIndexTimeout)
+	defer cancel()
+	if s.cfg.Get().RAG.Backend == "pgvector" {
+		return s.indexProfile(ctx, user)
 	}
 
-	var uploadResp UploadResponse
-	if err := json.Unmarshal(bodyBytes, &uploadResp); err != nil {
-		return "", fmt.Errorf("failed to parse upload response: %v", err)
+	// Drop what an earlier save imported so the store doesn't hold duplicates
+	if err := s.removeGeminiDocuments(ctx, "user_id", user.ID); err != nil {
+		return "", err
 	}
+	fileName, err := s.uploadGeminiFile(ctx, profileTitle(user), formatProfile(user))
+	if err != nil {
+		return "", err
+	}
+	// The metadata lets retrieval limit itself to the profiles a request may see
+	err = s.importGeminiFile(ctx, fileName, []map[string]interface{}{
+		{"key": "kind", "stringValue": SourceProfile},
+		{"key": "user_id", "numericValue": user.ID},
+	})
+	if err != nil {
+		return "", err
+	}
+	return fileName, nil
+}
 
-	log.Printf("File uploaded to Gemini: %s (%s)", uploadResp.File.Name, uploadResp.File.Uri)
-	uploadedFileName := uploadResp.File.Name // e.g. "files/abc12345"
-
-	// Only proceed to import if we have a corpus ID
-	if s.corpusID != "" {
-		// 3. Import to RAG Store (Corpus)
-		// API: POST https://generativelanguage.googleapis.com/v1beta/{parent=corpora/*}/documents
-		// Wait, "importFile" might be for the older "FileSearchStores" or specific semantic retrieval tools.
-		// If using "Corpora" (Semantic Retriever), we create a 'Document' inside a Corpus.
-		// If using the newer "File API" for "Flash" models, we might just need the File URI to pass to the model.
-		//
-		// The requirement said: "data registration must fall into DB and from there into RAG ... so ML can access it".
-		// ML usually accesses it via:
-		// A) Semantic Retrieval (Corpus) -> specialized RAG
-		// B) Long Context Window (passing file URI) -> "Many-shot" or just Context
-		//
-		// Given the `rag_service.go` mentioned `fileSearchStores`, it likely targets the Knowledge Base feature (A).
-		//
-		// Let's try to retain the logic of `importFile` into `fileSearchStores` if that's what was intended,
-		// OR upgrade to `corpora` if we know that's the modern way.
-		// The previous code had `https://generativelanguage.googleapis.com/v1beta/fileSearchStores/...`.
-		// Let's stick to that URL pattern but fix the implementation.
-
-		// Ensure corpusID format. If it's just "my-store...", we might need to prepend "fileSearchStores/"?
-		// The config said "GEMINI_IMPORT_URL" was "fileSearchStores/my-store...:importFile".
-		// So `s.corpusID` should probably be the full resource name or just the ID.
-		// Let's assume s.corpusID is "my-store-..." and we construct the URL.
-
-		// Check if s.corpusID already contains "fileSearchStores/"
-		// If the user put the full URL in .env (unlikely for an ID), we handle it.
-		// Let's construct a standard URL.
-		importURL := fmt.Sprintf("%s/v1beta/fileSearchStores/%s:importFile?key=%s", s.baseURL, s.corpusID, s.apiKey)
-
-		importBody := map[string]string{
-			"fileName": uploadedFileName, // The resource name from upload response
-		}
-		importJson, _ := json.Marshal(importBody)
+// ErrReindexRunning is returned when profiles are already being reindexed
+var ErrReindexRunning = errors.New("profiles are already being reindexed")
 
-		importReq, err := http.NewRequest("POST", importURL, bytes.NewBuffer(importJson))
-		if err != nil {
-			return uploadedFileName, fmt.Errorf("failed to create import request: %v", err)
-		}
-		importReq.Header.Set("Content-Type", "application/json")
+// ReindexProfiles uploads every completed profile again in the background and
+// returns how many are queued. Profiles uploaded before retrieval filtered by
+// profile carry no kind or user_id metadata, so no query can reach them until
+// they are uploaded again; the copies without metadata stay unreachable.
+func (s *RAGService) ReindexProfiles() (int, error) {
+	return s.reindexProfiles(database.DB.Where("is_profile_complete = ?", true))
+}
 
-		importResp, err := client.Do(importReq)
-		if err != nil {
-			return uploadedFileName, fmt.Errorf("failed to import file: %v", err)
-		}
-		defer importResp.Body.Close()
-
-		importRespBytes, _ := io.ReadAll(importResp.Body)
-		if importResp.StatusCode != 200 {
-			// Don't fail the whole process if import fails, but log it.
-			// Return the uploaded file name anyway so we have a reference.
-			log.Printf("RAG Import failed (status %d): %s", importResp.StatusCode, string(importRespBytes))
-			// return uploadedFileName, fmt.Errorf("rag import failed") // Optional: strictly fail or soft fail?
-		} else {
-			log.Println("File imported to RAG Store successfully")
-		}
-	} else {
-		log.Println("GEMINI_CORPUS_ID not set, skipping import to store.")
+// IndexMissingProfiles indexes the completed profiles the pgvector store has
+// no chunks for, such as those from before the backend was switched. The
+// Gemini store can't be listed by user, so there it does nothing.
+func (s *RAGService) IndexMissingProfiles() (int, error) {
+	if s.vectors == nil {
+		return 0, nil
 	}
+	return s.reindexProfiles(database.DB.
+		Where("is_profile_complete = ?", true).
+		Where("NOT EXISTS (SELECT 1 FROM rag_chunks WHERE rag_chunks.document_key = 'profile:' || users.id)"))
+}
 
-	return uploadedFileName, nil
+// reindexProfiles uploads the users matched by query in the background
+func (s *RAGService) reindexProfiles(query *gorm.DB) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.reindexing {
+		return 0, ErrReindexRunning
+	}
+
+	var users []models.User
+	if err := query.Order("id").Find(&users).Error; err != nil {
+		return 0, err
+	}
+	if len(users) == 0 {
+		return 0, nil
+	}
+	s.reindexing = true
+	go func() {
+		defer func() {
+			s.mu.Lock()
+			s.reindexing = false
+			s.mu.Unlock()
+		}()
+		failed := 0
+		for _, u := range users {
+			fileID, err := s.UploadProfile(u)
+			if err != nil {
+				failed++
+				log.Printf("[RAG] Reindexing profile of user %d failed: %v", u.ID, err)
+				continue
+			}
+			database.DB.Model(&u).Update("rag_file_id", fileID)
+		}
+		log.Printf("[RAG] Reindexed %d of %d profiles", len(users)-failed, len(users))
+	}()
+	return len(users), nil
 }
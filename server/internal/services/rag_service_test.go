@@ -0,0 +1,89 @@
+package services
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"rag-agent-server/internal/models"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestUploadProfileReplacesGeminiCopies(t *testing.T) {
+	tests := []struct {
+		name         string
+		importStatus int
+		wantErr      bool
+	}{
+		{name: "imported", importStatus: http.StatusOK},
+		{name: "import rejected", importStatus: http.StatusBadRequest, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var mu sync.Mutex
+			var requests []string
+			var metadata []map[string]interface{}
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				mu.Lock()
+				defer mu.Unlock()
+				requests = append(requests, r.Method+" "+r.URL.Path)
+				switch {
+				case r.Method == http.MethodGet && strings.HasSuffix(r.URL.Path, "/documents"):
+					w.Write([]byte(`{"documents":[
+						{"name":"fileSearchStores/store-1/documents/old","customMetadata":[{"key":"kind","stringValue":"profile"},{"key":"user_id","numericValue":7}]},
+						{"name":"fileSearchStores/store-1/documents/other","customMetadata":[{"key":"user_id","numericValue":8}]},
+						{"name":"fileSearchStores/store-1/documents/knowledge","customMetadata":[{"key":"document_id","numericValue":7}]}
+					]}`))
+				case r.Method == http.MethodDelete:
+					w.Write([]byte(`{}`))
+				case r.URL.Path == "/upload/v1beta/files":
+					if got := r.Header.Get("X-Goog-Upload-Header-Content-DisplayName"); got != "Profile: Arjuna" {
+						t.Errorf("display name = %q", got)
+					}
+					w.Write([]byte(`{"file":{"name":"files/profile-7"}}`))
+				case strings.HasSuffix(r.URL.Path, ":importFile"):
+					var body struct {
+						CustomMetadata []map[string]interface{} `json:"customMetadata"`
+					}
+					json.NewDecoder(r.Body).Decode(&body)
+					metadata = body.CustomMetadata
+					w.WriteHeader(tt.importStatus)
+					w.Write([]byte(`{"name":"fileSearchStores/store-1/operations/op","done":true}`))
+				default:
+					t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+					w.WriteHeader(http.StatusNotFound)
+				}
+			}))
+			defer server.Close()
+
+			rag := newTestGeminiRAG(t, server.URL)
+			user := models.User{SpiritualName: "Arjuna", Email: "arjuna@example.com"}
+			user.ID = 7
+			fileID, err := rag.UploadProfile(user)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("a rejected import must fail the upload")
+				}
+				return
+			}
+			if err != nil || fileID != "files/profile-7" {
+				t.Fatalf("UploadProfile = %q, %v", fileID, err)
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			deleted := slices.DeleteFunc(slices.Clone(requests), func(r string) bool { return !strings.HasPrefix(r, "DELETE ") })
+			if !slices.Equal(deleted, []string{"DELETE /v1beta/fileSearchStores/store-1/documents/old"}) {
+				t.Fatalf("deleted %v, want only the earlier copy of the profile", deleted)
+			}
+			if i, j := slices.Index(requests, deleted[0]), slices.Index(requests, "POST /v1beta/fileSearchStores/store-1:importFile"); j < i {
+				t.Errorf("the old copy must be removed before importing: %v", requests)
+			}
+			if len(metadata) != 2 || metadata[0]["stringValue"] != SourceProfile || metadata[1]["key"] != "user_id" || metadata[1]["numericValue"] != float64(7) {
+				t.Errorf("import metadata = %v", metadata)
+			}
+		})
+	}
+}
@@ -0,0 +1,280 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"rag-agent-server/internal/config"
+	"strconv"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// VectorChunk is one embedded piece of a document
+type VectorChunk struct {
+	DocumentKey string
+	Source      string
+	Title       string
+	// UserID is the profile owner for profile chunks
+	UserID uint
+	// Collection groups knowledge chunks
+	Collection string
+	Index      int
+	Content    string
+	Embedding  []float32
+}
+
+// VectorFilter limits a search to what the request may see
+type VectorFilter struct {
+	UserIDs   []uint
+	Knowledge bool
+	// Collections limits knowledge chunks; empty means all of them
+	Collections []string
+}
+
+// VectorMatch is a chunk found by a search, with its cosine similarity
+type VectorMatch struct {
+	VectorChunk
+	Score float64
+}
+
+// VectorStore keeps embedded chunks and finds the ones nearest to a vector
+type VectorStore interface {
+	// Replace swaps all chunks of a document for the given ones
+	Replace(ctx context.Context, documentKey string, chunks []VectorChunk) error
+	Delete(ctx context.Context, documentKey string) error
+	Search(ctx context.Context, embedding []float32, filter VectorFilter, limit int) ([]VectorMatch, error)
+}
+
+// PgVectorStore keeps chunks in the rag_chunks table of our own Postgres,
+// using the pgvector extension for the similarity search. The table is
+// managed with raw SQL since GORM has no vector type.
+type PgVectorStore struct {
+	db         *gorm.DB
+	dimensions int
+}
+
+// NewPgVectorStore creates the extension, table and index when missing. The
+// embedding column size is fixed at creation; changing
+// RAG_EMBEDDINGS_DIMENSIONS afterwards needs the table re-created and every
+// document re-indexed.
+func NewPgVectorStore(db *gorm.DB, dimensions int) (*PgVectorStore, error) {
+	statements := []string{
+		`CREATE EXTENSION IF NOT EXISTS vector`,
+		fmt.Sprintf(`CREATE TABLE IF NOT EXISTS rag_chunks (
+			id BIGSERIAL PRIMARY KEY,
+			document_key TEXT NOT NULL,
+			source TEXT NOT NULL,
+			title TEXT NOT NULL DEFAULT '',
+			user_id BIGINT NOT NULL DEFAULT 0,
+			chunk_index INT NOT NULL,
+			content TEXT NOT NULL,
+			embedding vector(%d) NOT NULL,
+			created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+		)`, dimensions),
+		`ALTER TABLE rag_chunks ADD COLUMN IF NOT EXISTS collection TEXT NOT NULL DEFAULT ''`,
+		`CREATE INDEX IF NOT EXISTS idx_rag_chunks_document ON rag_chunks (document_key)`,
+		`CREATE INDEX IF NOT EXISTS idx_rag_chunks_embedding ON rag_chunks USING hnsw (embedding vector_cosine_ops)`,
+	}
+	for _, statement := range statements {
+		if err := db.Exec(statement).Error; err != nil {
+			return nil, fmt.Errorf("failed to prepare pgvector store: %v", err)
+		}
+	}
+
+	var existing int
+	db.Raw(`SELECT atttypmod FROM pg_attribute WHERE attrelid = 'rag_chunks'::regclass AND attname = 'embedding'`).Scan(&existing)
+	if existing > 0 && existing != dimensions {
+		return nil, fmt.Errorf("rag_chunks stores %d-dimensional vectors but RAG_EMBEDDINGS_DIMENSIONS is %d", existing, dimensions)
+	}
+	return &PgVectorStore{db: db, dimensions: dimensions}, nil
+}
+
+// vectorLiteral formats a vector the way pgvector parses it: [1,2,3]
+func vectorLiteral(vector []float32) string {
+	parts := make([]string, len(vector))
+	for i, v := range vector {
+		parts[i] = strconv.FormatFloat(float64(v), 'f', -1, 32)
+	}
+	return "[" + strings.Join(parts, ",") + "]"
+}
+
+func (s *PgVectorStore) Replace(ctx context.Context, documentKey string, chunks []VectorChunk) error {
+	for _, chunk := range chunks {
+		if len(chunk.Embedding) != s.dimensions {
+			return fmt.Errorf("chunk %d has %d dimensions, the store has %d", chunk.Index, len(chunk.Embedding), s.dimensions)
+		}
+	}
+
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec(`DELETE FROM rag_chunks WHERE document_key = ?`, documentKey).Error; err != nil {
+			return err
+		}
+		for _, chunk := range chunks {
+			err := tx.Exec(`INSERT INTO rag_chunks (document_key, source, title, user_id, collection, chunk_index, content, embedding)
+				VALUES (?, ?, ?, ?, ?, ?, ?, ?::vector)`,
+				documentKey, chunk.Source, chunk.Title, chunk.UserID, chunk.Collection, chunk.Index, chunk.Content, vectorLiteral(chunk.Embedding)).Error
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *PgVectorStore) Delete(ctx context.Context, documentKey string) error {
+	return s.db.WithContext(ctx).Exec(`DELETE FROM rag_chunks WHERE document_key = ?`, documentKey).Error
+}
+
+func (s *PgVectorStore) Search(ctx context.Context, embedding []float32, filter VectorFilter, limit int) ([]VectorMatch, error) {
+	var conditions []string
+	var args []interface{}
+	if filter.Knowledge {
+		if len(filter.Collections) > 0 {
+			conditions = append(conditions, "(source = ? AND collection IN ?)")
+			args = append(args, SourceKnowledge, filter.Collections)
+		} else {
+			conditions = append(conditions, "source = ?")
+			args = append(args, SourceKnowledge)
+		}
+	}
+	if len(filter.UserIDs) > 0 {
+		conditions = append(conditions, "(source = ? AND user_id IN ?)")
+		args = append(args, SourceProfile, filter.UserIDs)
+	}
+	if len(conditions) == 0 {
+		return nil, nil
+	}
+
+	vector := vectorLiteral(embedding)
+	query := `SELECT document_key, source, title, user_id, collection, chunk_index, content, 1 - (embedding <=> ?::vector) AS score
+		FROM rag_chunks
+		WHERE ` + strings.Join(conditions, " OR ") + `
+		ORDER BY embedding <=> ?::vector
+		LIMIT ?`
+	args = append([]interface{}{vector}, args...)
+	args = append(args, vector, limit)
+
+	var rows []struct {
+		DocumentKey string
+		Source      string
+		Title       string
+		UserID      uint
+		Collection  string
+		ChunkIndex  int
+		Content     string
+		Score       float64
+	}
+	if err := s.db.WithContext(ctx).Raw(query, args...).Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	matches := make([]VectorMatch, len(rows))
+	for i, row := range rows {
+		matches[i] = VectorMatch{
+			VectorChunk: VectorChunk{
+				DocumentKey: row.DocumentKey,
+				Source:      row.Source,
+				Title:       row.Title,
+				UserID:      row.UserID,
+				Collection:  row.Collection,
+				Index:       row.ChunkIndex,
+				Content:     row.Content,
+			},
+			Score: row.Score,
+		}
+	}
+	return matches, nil
+}
+
+// embedBatchSize bounds the texts sent in one embeddings request
+const embedBatchSize = 64
+
+// VectorDocument is a text to index under a stable key
+type VectorDocument struct {
+	Key        string
+	Source     string
+	Title      string
+	UserID     uint
+	Collection string
+	Text       string
+}
+
+// VectorRetriever indexes documents into a VectorStore and retrieves from
+// it, so RAG can run without the Gemini file search store
+type VectorRetriever struct {
+	cfg      *config.Store
+	store    VectorStore
+	embedder Embedder
+}
+
+func NewVectorRetriever(cfg *config.Store, store VectorStore, embedder Embedder) *VectorRetriever {
+	return &VectorRetriever{cfg: cfg, store: store, embedder: embedder}
+}
+
+// Index chunks, embeds and stores a document, replacing what was indexed
+// under its key before. It returns the number of chunks stored.
+func (r *VectorRetriever) Index(ctx context.Context, doc VectorDocument) (int, error) {
+	rag := r.cfg.Get().RAG
+	texts := ChunkText(doc.Text, rag.ChunkSize, rag.ChunkOverlap)
+	if len(texts) == 0 {
+		return 0, fmt.Errorf("document %s has no text", doc.Key)
+	}
+
+	chunks := make([]VectorChunk, 0, len(texts))
+	for start := 0; start < len(texts); start += embedBatchSize {
+		end := start + embedBatchSize
+		if end > len(texts) {
+			end = len(texts)
+		}
+		embeddings, err := r.embedder.Embed(ctx, texts[start:end])
+		if err != nil {
+			return 0, fmt.Errorf("failed to embed %s: %v", doc.Key, err)
+		}
+		for i, embedding := range embeddings {
+			chunks = append(chunks, VectorChunk{
+				DocumentKey: doc.Key,
+				Source:      doc.Source,
+				Title:       doc.Title,
+				UserID:      doc.UserID,
+				Collection:  doc.Collection,
+				Index:       start + i,
+				Content:     texts[start+i],
+				Embedding:   embedding,
+			})
+		}
+	}
+
+	if err := r.store.Replace(ctx, doc.Key, chunks); err != nil {
+		return 0, err
+	}
+	log.Printf("[RAG] Indexed %s in %d chunks", doc.Key, len(chunks))
+	return len(chunks), nil
+}
+
+// Remove drops a document from the index
+func (r *VectorRetriever) Remove(ctx context.Context, key string) error {
+	return r.store.Delete(ctx, key)
+}
+
+func (r *VectorRetriever) Retrieve(ctx context.Context, query RetrievalQuery) ([]Passage, error) {
+	embeddings, err := r.embedder.Embed(ctx, []string{query.Text})
+	if err != nil {
+		return nil, err
+	}
+	matches, err := r.store.Search(ctx, embeddings[0], VectorFilter{
+		UserIDs:     query.UserIDs,
+		Knowledge:   query.Knowledge,
+		Collections: query.Collections,
+	}, query.Limit)
+	if err != nil {
+		return nil, err
+	}
+
+	passages := make([]Passage, len(matches))
+	for i, m := range matches {
+		passages[i] = Passage{Source: m.Source, Title: m.Title, Text: m.Content, Score: m.Score}
+	}
+	return passages, nil
+}
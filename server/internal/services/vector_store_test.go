@@ -0,0 +1,152 @@
+package services
+
+import (
+	"context"
+	"rag-agent-server/internal/config"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// memoryVectorStore is a VectorStore kept in memory for tests
+type memoryVectorStore struct {
+	mu     sync.Mutex
+	chunks map[string][]VectorChunk
+}
+
+func newMemoryVectorStore() *memoryVectorStore {
+	return &memoryVectorStore{chunks: make(map[string][]VectorChunk)}
+}
+
+func (s *memoryVectorStore) Replace(ctx context.Context, documentKey string, chunks []VectorChunk) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.chunks[documentKey] = chunks
+	return nil
+}
+
+func (s *memoryVectorStore) Delete(ctx context.Context, documentKey string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.chunks, documentKey)
+	return nil
+}
+
+func (s *memoryVectorStore) Search(ctx context.Context, embedding []float32, filter VectorFilter, limit int) ([]VectorMatch, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var matches []VectorMatch
+	for _, chunks := range s.chunks {
+		for _, chunk := range chunks {
+			knowledge := filter.Knowledge && chunk.Source == SourceKnowledge &&
+				(len(filter.Collections) == 0 || slices.Contains(filter.Collections, chunk.Collection))
+			profile := chunk.Source == SourceProfile && slices.Contains(filter.UserIDs, chunk.UserID)
+			if knowledge || profile {
+				matches = append(matches, VectorMatch{VectorChunk: chunk, Score: dot(embedding, chunk.Embedding)})
+			}
+		}
+	}
+	sort.Slice(matches, func(i, j int) bool { return matches[i].Score > matches[j].Score })
+	if len(matches) > limit {
+		matches = matches[:limit]
+	}
+	return matches, nil
+}
+
+func newTestVectorRetriever(t *testing.T) (*VectorRetriever, *memoryVectorStore) {
+	t.Helper()
+	t.Setenv("CONFIG_FILE", "")
+	t.Setenv("RAG_CHUNK_SIZE", "200")
+	t.Setenv("RAG_CHUNK_OVERLAP", "0")
+	cfg, err := config.Load()
+	if err != nil {
+		t.Fatalf("config.Load: %v", err)
+	}
+	store := newMemoryVectorStore()
+	return NewVectorRetriever(config.NewStore(cfg), store, NewFakeEmbedder(256)), store
+}
+
+func TestVectorRetrieverIndex(t *testing.T) {
+	r, store := newTestVectorRetriever(t)
+	ctx := context.Background()
+
+	// Three paragraphs, no two of which fit in one chunk together
+	paragraphs := []string{
+		strings.Repeat("Krishna teaches Arjuna about duty. ", 4),
+		strings.Repeat("The soul is eternal and never dies. ", 4),
+		strings.Repeat("Devotion is the highest path. ", 4),
+	}
+	doc := VectorDocument{Key: "knowledge:1", Source: SourceKnowledge, Title: "Gita", Collection: "gita",
+		Text: strings.Join(paragraphs, "\n\n")}
+	n, err := r.Index(ctx, doc)
+	if err != nil {
+		t.Fatalf("Index: %v", err)
+	}
+	if n != 3 || len(store.chunks[doc.Key]) != 3 {
+		t.Fatalf("indexed %d chunks, stored %d", n, len(store.chunks[doc.Key]))
+	}
+	for i, chunk := range store.chunks[doc.Key] {
+		if chunk.Index != i || chunk.Collection != "gita" || chunk.Title != "Gita" || len(chunk.Embedding) != 256 {
+			t.Errorf("chunk %d = %+v", i, chunk)
+		}
+	}
+
+	// Indexing again replaces the chunks
+	doc.Text = "A shorter text."
+	if n, _ := r.Index(ctx, doc); n != 1 || len(store.chunks[doc.Key]) != 1 {
+		t.Errorf("re-index left %d chunks", len(store.chunks[doc.Key]))
+	}
+
+	if _, err := r.Index(ctx, VectorDocument{Key: "knowledge:2", Text: " "}); err == nil {
+		t.Error("a document without text must not be indexed")
+	}
+
+	if err := r.Remove(ctx, doc.Key); err != nil || len(store.chunks) != 0 {
+		t.Errorf("Remove left %d documents, err %v", len(store.chunks), err)
+	}
+}
+
+func TestVectorRetrieverRetrieve(t *testing.T) {
+	r, _ := newTestVectorRetriever(t)
+	ctx := context.Background()
+	docs := []VectorDocument{
+		{Key: "knowledge:1", Source: SourceKnowledge, Title: "Gita", Collection: "gita", Text: "The soul is eternal and never dies."},
+		{Key: "knowledge:2", Source: SourceKnowledge, Title: "Cooking", Collection: "kitchen", Text: "Rice is cooked with ghee and cumin."},
+		{Key: "profile:7", Source: SourceProfile, Title: "Profile: Arjuna", UserID: 7, Text: "Arjuna likes kirtan and the soul teachings."},
+		{Key: "profile:8", Source: SourceProfile, Title: "Profile: Bhima", UserID: 8, Text: "Bhima likes the soul teachings too."},
+	}
+	for _, doc := range docs {
+		if _, err := r.Index(ctx, doc); err != nil {
+			t.Fatalf("Index %s: %v", doc.Key, err)
+		}
+	}
+
+	titles := func(query RetrievalQuery) []string {
+		t.Helper()
+		passages, err := r.Retrieve(ctx, query)
+		if err != nil {
+			t.Fatalf("Retrieve: %v", err)
+		}
+		var titles []string
+		for _, p := range passages {
+			titles = append(titles, p.Title)
+		}
+		return titles
+	}
+
+	if got := titles(RetrievalQuery{Text: "is the soul eternal", Knowledge: true, Limit: 1}); !slices.Equal(got, []string{"Gita"}) {
+		t.Errorf("best knowledge match = %v", got)
+	}
+	if got := titles(RetrievalQuery{Text: "soul", Knowledge: true, Collections: []string{"kitchen"}, Limit: 5}); !slices.Equal(got, []string{"Cooking"}) {
+		t.Errorf("collection filter = %v", got)
+	}
+	got := titles(RetrievalQuery{Text: "soul teachings", UserIDs: []uint{7}, Limit: 5})
+	if !slices.Equal(got, []string{"Profile: Arjuna"}) {
+		t.Errorf("profile filter = %v, want only the allowed profile", got)
+	}
+	if got := titles(RetrievalQuery{Text: "soul"}); len(got) != 0 {
+		t.Errorf("a query allowing nothing returned %v", got)
+	}
+}
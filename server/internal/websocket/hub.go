@@ -1,28 +1,74 @@
 package websocket
 
 import (
+	"encoding/json"
 	"rag-agent-server/internal/models"
 	"sync"
 )
 
+// RoomEventType is the "type" of every RoomEvent payload. Chat messages go
+// over the same socket, so clients check it before reading a payload as a
+// message.
+const RoomEventType = "room_event"
+
+// RoomEvent notifies clients about room lifecycle changes (archive, delete, leave)
+type RoomEvent struct {
+	Event  string      `json:"event"`
+	RoomID uint        `json:"roomId"`
+	UserID uint        `json:"userId,omitempty"`
+	Data   interface{} `json:"data,omitempty"`
+}
+
+// MarshalJSON adds "type": "room_event" to the payload
+func (e RoomEvent) MarshalJSON() ([]byte, error) {
+	type event RoomEvent
+	return json.Marshal(struct {
+		Type string `json:"type"`
+		event
+	}{RoomEventType, event(e)})
+}
+
+// AiStreamDelta is the Data of ai_stream_* events: a room AI reply being
+// generated. Clients append Delta to the stream with the same StreamID until
+// ai_stream_end delivers the persisted message.
+type AiStreamDelta struct {
+	StreamID string      `json:"streamId"`
+	Delta    string      `json:"delta,omitempty"`
+	Message  interface{} `json:"message,omitempty"`
+	Error    string      `json:"error,omitempty"`
+}
+
+type directMessage struct {
+	userIDs []uint
+	payload interface{}
+}
+
 type Hub struct {
 	// Registered clients by UserID
 	clients map[uint]*Client
 	// Inbound messages from the handlers
 	broadcast chan models.Message
+	// Payloads addressed to specific users
+	direct chan directMessage
 	// Register requests from the clients
 	Register chan *Client
 	// Unregister requests from clients
 	Unregister chan *Client
 	mu         sync.RWMutex
+	// roomMembers lists who room messages and events are delivered to
+	roomMembers func(roomID uint) []uint
 }
 
-func NewHub() *Hub {
+// NewHub creates a hub that delivers room traffic to the users roomMembers
+// returns for the room
+func NewHub(roomMembers func(roomID uint) []uint) *Hub {
 	return &Hub{
-		broadcast:  make(chan models.Message),
-		Register:   make(chan *Client),
-		Unregister: make(chan *Client),
-		clients:    make(map[uint]*Client),
+		roomMembers: roomMembers,
+		broadcast:   make(chan models.Message),
+		direct:      make(chan directMessage),
+		Register:    make(chan *Client),
+		Unregister:  make(chan *Client),
+		clients:     make(map[uint]*Client),
 	}
 }
 
@@ -43,22 +89,8 @@ func (h *Hub) Run() {
 		case message := <-h.broadcast:
 			h.mu.RLock()
 			for userID, client := range h.clients {
-				// Send if:
-				// 1. RecipientID matches
-				// 2. RoomID matches (broadcast to all, frontend filters)
-				// 3. Sender is the one who sent (sync across devices)
-
-				shouldSend := false
-				if message.RecipientID != 0 {
-					if userID == message.RecipientID || userID == message.SenderID {
-						shouldSend = true
-					}
-				} else if message.RoomID != 0 {
-					// Room broadcast
-					shouldSend = true
-				}
-
-				if shouldSend {
+				// Direct messages go to the recipient and back to the sender
+				if userID == message.RecipientID || userID == message.SenderID {
 					select {
 					case client.Send <- message:
 					default:
@@ -67,10 +99,40 @@ func (h *Hub) Run() {
 				}
 			}
 			h.mu.RUnlock()
+		case dm := <-h.direct:
+			h.mu.RLock()
+			for _, userID := range dm.userIDs {
+				if client, ok := h.clients[userID]; ok {
+					select {
+					case client.Send <- dm.payload:
+					default:
+					}
+				}
+			}
+			h.mu.RUnlock()
 		}
 	}
 }
 
+// Broadcast delivers a message: room messages to the room's members, direct
+// messages to the recipient and the sender
 func (h *Hub) Broadcast(msg models.Message) {
+	if msg.RecipientID == 0 && msg.RoomID != 0 {
+		h.SendToRoom(msg.RoomID, msg)
+		return
+	}
 	h.broadcast <- msg
 }
+
+// SendToUsers delivers an arbitrary JSON payload to the given users only
+func (h *Hub) SendToUsers(userIDs []uint, payload interface{}) {
+	if len(userIDs) == 0 {
+		return
+	}
+	h.direct <- directMessage{userIDs: userIDs, payload: payload}
+}
+
+// SendToRoom delivers a JSON payload to the members of a room
+func (h *Hub) SendToRoom(roomID uint, payload interface{}) {
+	h.SendToUsers(h.roomMembers(roomID), payload)
+}